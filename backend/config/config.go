@@ -30,6 +30,18 @@ type AppConfig struct {
 	StageStatusQueryTimeout int
 	NumWorkers              int
 	Port                    string
+	// MisfirePolicy is one of run_immediately | skip | grace
+	MisfirePolicy string
+	// MisfireGracePeriod is in minutes, used by the grace misfire policy
+	MisfireGracePeriod int
+	// ShutdownTimeout is in seconds, the time the active runs are given to save their state on shutdown
+	ShutdownTimeout int
+	// Timezone is the IANA name of the timezone the stage conditions are evaluated in, e.g. Europe/Moscow
+	Timezone string
+	// MaxParallelFlowRuns limits the sub-stages of the parallel stages executed at once across all the running sendposts, 0 means no limit
+	MaxParallelFlowRuns int
+	// Environment is the name of the deployment, e.g. prod, available to the parameters as {{ env }}
+	Environment string
 }
 
 type CORSConfig struct {
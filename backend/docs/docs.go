@@ -103,7 +103,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Creates a new sendpost with the specified parameters",
+                "description": "Creates a new sendpost with the specified parameters.\n` + "`" + `max_duration` + "`" + ` in seconds limits the whole run of the sendpost, the run exceeding it fails with the ` + "`" + `TIMED_OUT` + "`" + ` reason. 0 means no limit",
                 "consumes": [
                     "application/json"
                 ],
@@ -193,7 +193,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Copies a sendpost by its ID",
+                "description": "Copies a sendpost by its ID.\nThe ` + "`" + `max_duration` + "`" + ` of the original sendpost is kept if it isn't provided",
                 "tags": [
                     "Sendpost"
                 ],
@@ -276,103 +276,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/sendposts/{sendpost_id}/parameters": {
-            "post": {
-                "description": "Add or update sendpost parameters by its ID",
-                "tags": [
-                    "Sendpost"
-                ],
-                "summary": "Add or update sendpost parameters",
-                "operationId": "AddUpdateSendpostParameters",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "Sendpost ID",
-                        "name": "sendpost_id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "Sendpost parameters",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/requests.Parameters"
-                        }
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "Successfully added or updated",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    "400": {
-                        "description": "Invalid ID",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal server error",
-                        "schema": {
-                            "type": "string"
-                        }
-                    }
-                }
-            }
-        },
-        "/sendposts/{sendpost_id}/parameters/{key}": {
-            "delete": {
-                "description": "Delete sendpost parameter by its ID and key",
-                "tags": [
-                    "Sendpost"
-                ],
-                "summary": "Delete sendpost parameter",
-                "operationId": "DeleteSendpostParameter",
-                "parameters": [
-                    {
-                        "type": "integer",
-                        "description": "Sendpost ID",
-                        "name": "sendpost_id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "type": "string",
-                        "description": "Parameter key",
-                        "name": "key",
-                        "in": "path",
-                        "required": true
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "Successfully deleted",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    "400": {
-                        "description": "Invalid ID or key",
-                        "schema": {
-                            "type": "string"
-                        }
-                    },
-                    "500": {
-                        "description": "Internal server error",
-                        "schema": {
-                            "type": "string"
-                        }
-                    }
-                }
-            }
-        },
-        "/sendposts/{sendpost_id}/run": {
+        "/sendposts/{sendpost_id}/cancel": {
             "post": {
-                "description": "Start the sendpost",
+                "description": "Cancel the active run of the sendpost.\nThe flow runs in flight are set to CANCELLING in Prefect, the sendpost and its running stages are marked CANCELLED.",
                 "consumes": [
                     "application/json"
                 ],
@@ -382,7 +288,7 @@ const docTemplate = `{
                 "tags": [
                     "Sendpost Runner"
                 ],
-                "summary": "Start the sendpost",
+                "summary": "Cancel the sendpost run",
                 "parameters": [
                     {
                         "type": "integer",
@@ -405,6 +311,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "409": {
+                        "description": "Sendpost isn't running",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -414,9 +326,9 @@ const docTemplate = `{
                 }
             }
         },
-        "/sendposts/{sendpost_id}/run/ws": {
+        "/sendposts/{sendpost_id}/graph": {
             "get": {
-                "description": "Establishes a WebSocket connection to receive status updates on sendpost execution.",
+                "description": "Get the top level stages of a sendpost in the order of execution with the dependencies between them.\nA stage is run when all the stages it ` + "`" + `depends_on` + "`" + ` have completed, the independent stages are run concurrently.\nEvery edge means the stage ` + "`" + `to` + "`" + ` depends on the stage ` + "`" + `from` + "`" + `. The on-failure stages aren't included.",
                 "consumes": [
                     "application/json"
                 ],
@@ -424,9 +336,10 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Notifications"
+                    "Stage"
                 ],
-                "summary": "Connect to WebSocket notifications for sendpost execution",
+                "summary": "Get the stage graph of a sendpost",
+                "operationId": "GetSendpostGraph",
                 "parameters": [
                     {
                         "type": "integer",
@@ -437,36 +350,30 @@ const docTemplate = `{
                     }
                 ],
                 "responses": {
-                    "101": {
-                        "description": "Switching Protocols",
+                    "200": {
+                        "description": "Successfully retrieved graph",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/responses.StageGraph"
                         }
                     },
                     "400": {
-                        "description": "Invalid ID",
+                        "description": "Invalid ID format",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "type": "string"
                         }
                     },
                     "500": {
-                        "description": "Internal Server Error",
+                        "description": "Internal server error",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "type": "string"
                         }
                     }
                 }
             }
         },
-        "/sendposts/{sendpost_id}/stages": {
+        "/sendposts/{sendpost_id}/on-failure-stages": {
             "get": {
-                "description": "Get all stages of a sendpost by its ID.",
+                "description": "Get the on-failure chain of a sendpost in the order of execution.",
                 "consumes": [
                     "application/json"
                 ],
@@ -476,8 +383,8 @@ const docTemplate = `{
                 "tags": [
                     "Stage"
                 ],
-                "summary": "Get stages of a sendpost",
-                "operationId": "GetSendpostStages",
+                "summary": "Get on-failure stages of a sendpost",
+                "operationId": "GetOnFailureStages",
                 "parameters": [
                     {
                         "type": "integer",
@@ -512,7 +419,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Adds a new stage to the specified sendpost.\nIf ` + "`" + `previous_stage_id` + "`" + ` is provided adds stage after.\nIf field ` + "`" + `next_stage_id` + "`" + ` in the previous_stage is not null changes ` + "`" + `next_stage_id` + "`" + ` in previous_stage on the new provided stage id.\nAt the same time writes the new provided stage ` + "`" + `next_stage_id` + "`" + ` with previous_stage ` + "`" + `next_stage_id` + "`" + ` a.k.a this method allows insert stage between two stages.\nField ` + "`" + `type` + "`" + ` could be ` + "`" + `PARALLEL|SEQUENTIAL|OBSERVER` + "`" + `.",
+                "description": "Adds a new stage to the on-failure chain of the specified sendpost.\nThe chain is executed after a stage of the run failed or timed out, before the following ` + "`" + `always_run` + "`" + ` stages of the run.\nThe run stays ` + "`" + `FAILED` + "`" + `. The cancelled run doesn't execute the chain, the cancellation of the run stops the chain as well.\nIf ` + "`" + `previous_stage_id` + "`" + ` of the on-failure chain is provided adds stage after, otherwise as the first one.\nThe stages declaring ` + "`" + `failed_stage_id` + "`" + ` and ` + "`" + `failed_stage_error` + "`" + ` parameters receive the ID and the error of the failed stage.\nThe on-failure stages are managed by the stage endpoints the same way as the other stages.",
                 "consumes": [
                     "application/json"
                 ],
@@ -522,8 +429,8 @@ const docTemplate = `{
                 "tags": [
                     "Stage"
                 ],
-                "summary": "Add a stage to a sendpost",
-                "operationId": "AddStageToSendpost",
+                "summary": "Add an on-failure stage to a sendpost",
+                "operationId": "AddOnFailureStage",
                 "parameters": [
                     {
                         "type": "integer",
@@ -555,6 +462,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "422": {
+                        "description": "Parameters don't match the deployment schema",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ValidationErrors"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -564,20 +477,14 @@ const docTemplate = `{
                 }
             }
         },
-        "/sendposts/{sendpost_id}/stages/{stage_id}": {
-            "get": {
-                "description": "Get detailed information about a stage by its ID.",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
+        "/sendposts/{sendpost_id}/parameters": {
+            "post": {
+                "description": "Add or update sendpost parameters by its ID\nThe parameters are validated against the OpenAPI schemas of the parameters of the deployments of the stages\ndeclaring them, the mismatches are returned per field with 422 and no parameter is updated then.",
                 "tags": [
-                    "Stage"
+                    "Sendpost"
                 ],
-                "summary": "Get stage detailed info",
-                "operationId": "GetStageDetailedInfo",
+                "summary": "Add or update sendpost parameters",
+                "operationId": "AddUpdateSendpostParameters",
                 "parameters": [
                     {
                         "type": "integer",
@@ -587,26 +494,34 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "Stage ID",
-                        "name": "stage_id",
-                        "in": "path",
-                        "required": true
+                        "description": "Sendpost parameters",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.Parameters"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successfully retrieved stage",
+                        "description": "Successfully added or updated",
                         "schema": {
-                            "$ref": "#/definitions/responses.StageDetailed"
+                            "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Invalid ID format",
+                        "description": "Invalid ID",
                         "schema": {
                             "type": "string"
                         }
                     },
+                    "422": {
+                        "description": "Parameters don't match the deployment schema",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ValidationErrors"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -614,20 +529,16 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "put": {
-                "description": "Update parameters of a stage by its ID.",
-                "consumes": [
-                    "application/json"
-                ],
-                "produces": [
-                    "application/json"
-                ],
+            }
+        },
+        "/sendposts/{sendpost_id}/parameters/{key}": {
+            "delete": {
+                "description": "Delete sendpost parameter by its ID and key",
                 "tags": [
-                    "Stage"
+                    "Sendpost"
                 ],
-                "summary": "Update stage parameters",
-                "operationId": "UpdateStageParameters",
+                "summary": "Delete sendpost parameter",
+                "operationId": "DeleteSendpostParameter",
                 "parameters": [
                     {
                         "type": "integer",
@@ -637,31 +548,22 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "Stage ID",
-                        "name": "stage_id",
+                        "type": "string",
+                        "description": "Parameter key",
+                        "name": "key",
                         "in": "path",
                         "required": true
-                    },
-                    {
-                        "description": "Parameters",
-                        "name": "parameters",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/requests.Parameters"
-                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successfully updated parameters",
+                        "description": "Successfully deleted",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Invalid ID format",
+                        "description": "Invalid ID or key",
                         "schema": {
                             "type": "string"
                         }
@@ -673,9 +575,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "delete": {
-                "description": "Deletes a stage by its ID. If the stage is linked to other stages, they will be updated accordingly.",
+            }
+        },
+        "/sendposts/{sendpost_id}/render-parameters": {
+            "post": {
+                "description": "Resolves the parameters of the stages without running anything and returns the values every stage would be executed with,\nincluding the sub-stages of the parallel stages and the on-failure stages, and the layer every value was taken from.\nThe layers in the order of increasing priority: DEPLOYMENT (the defaults of the deployment), STAGE, PARENT (the parallel stage),\nGLOBAL (the global parameters of the sendpost), RUN (the overrides of the run). The parameters are declared by the deployment\nand the stage, the upper layers only override their values.\nThe expressions are in double braces, e.g. ` + "`" + `run.started_at | date \"2006-01-02\"` + "`" + ` or ` + "`" + `today | add_days -1` + "`" + `, with the variables\n` + "`" + `run.id` + "`" + `, ` + "`" + `run.started_at` + "`" + `, ` + "`" + `sendpost.id` + "`" + `, ` + "`" + `sendpost.name` + "`" + `, ` + "`" + `env` + "`" + `, ` + "`" + `today` + "`" + `, ` + "`" + `now` + "`" + ` (in the configured timezone), ` + "`" + `stages.\u003cstage_id\u003e.result.\u003ckey\u003e` + "`" + `\nand the filters ` + "`" + `date` + "`" + `, ` + "`" + `add_days` + "`" + `, ` + "`" + `tz` + "`" + `.\nWith ` + "`" + `run_id` + "`" + ` the parameters are rendered for the run, otherwise for the run which would be started now:\n` + "`" + `run.id` + "`" + ` is 0 and the outputs of the stages aren't available. The error of resolving is returned per stage.",
                 "consumes": [
                     "application/json"
                 ],
@@ -683,10 +587,10 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Stage"
+                    "Sendpost Runner"
                 ],
-                "summary": "Delete a stage",
-                "operationId": "DeleteStage",
+                "summary": "Render the parameters of the sendpost",
+                "operationId": "RenderSendpostParameters",
                 "parameters": [
                     {
                         "type": "integer",
@@ -696,22 +600,29 @@ const docTemplate = `{
                         "required": true
                     },
                     {
-                        "type": "integer",
-                        "description": "Stage ID",
-                        "name": "stage_id",
-                        "in": "path",
-                        "required": true
+                        "description": "Run to render the parameters for",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/requests.RenderParameters"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successfully deleted",
+                        "description": "OK",
                         "schema": {
-                            "type": "string"
+                            "$ref": "#/definitions/responses.RenderedParameters"
                         }
                     },
                     "400": {
-                        "description": "Invalid ID format",
+                        "description": "Invalid ID or request body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Sendpost or run not found",
                         "schema": {
                             "type": "string"
                         }
@@ -723,9 +634,11 @@ const docTemplate = `{
                         }
                     }
                 }
-            },
-            "patch": {
-                "description": "Block or unblock a stage by its ID.",
+            }
+        },
+        "/sendposts/{sendpost_id}/run": {
+            "post": {
+                "description": "Start the sendpost.\n` + "`" + `from=failed` + "`" + ` resumes the last failed or cancelled run: the stages and sub-stages completed there are not executed again.\n` + "`" + `from_stage` + "`" + ` starts the run from the given top level stage, the previous stages completed in the last run are reused, the others are skipped.\nOnly one run of the sendpost may be active at a time. If the sendpost is running, 409 is returned,\nor with ` + "`" + `queue=true` + "`" + ` the run is queued and starts when the active run is finished.\nThe run doesn't depend on the request: on shutdown it's interrupted and keeps its state, the flow runs aren't cancelled.\nThe optional body overrides the global parameters (` + "`" + `parameters` + "`" + `) and the parameters of the stages by the stage ID\n(` + "`" + `stage_parameters` + "`" + `) only within the run, they are recorded in the run history. The overridden parameters must be declared\nby the deployment or the stage, or by the sendpost for the global ones, and match the OpenAPI schema of the parameters of the deployment,\notherwise the mismatches are returned per field with 422.\nThe resumed run without the body keeps the overrides of the run it continues.",
                 "consumes": [
                     "application/json"
                 ],
@@ -733,10 +646,9 @@ const docTemplate = `{
                     "application/json"
                 ],
                 "tags": [
-                    "Stage"
+                    "Sendpost Runner"
                 ],
-                "summary": "Block/Unblock a stage",
-                "operationId": "BlockUnblockStage",
+                "summary": "Start the sendpost",
                 "parameters": [
                     {
                         "type": "integer",
@@ -745,23 +657,1061 @@ const docTemplate = `{
                         "in": "path",
                         "required": true
                     },
+                    {
+                        "enum": [
+                            "failed"
+                        ],
+                        "type": "string",
+                        "description": "Resume mode",
+                        "name": "from",
+                        "in": "query"
+                    },
                     {
                         "type": "integer",
-                        "description": "Stage ID",
-                        "name": "stage_id",
-                        "in": "path",
-                        "required": true
-                    }
-                ],
-                "responses": {
-                    "200": {
-                        "description": "Successfully blocked/unblocked",
+                        "description": "Stage ID to start from, can't be used with from",
+                        "name": "from_stage",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Queue the run if the sendpost is running",
+                        "name": "queue",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Parameter overrides of the run",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/requests.RunSendpost"
+                        }
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted or Queued",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID, query or request body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "The sendpost is already running or the last run hasn't failed",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Parameter overrides don't match the stages",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ValidationErrors"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "The server is shutting down",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/run/ws": {
+            "get": {
+                "description": "Establishes a WebSocket connection to receive status updates on sendpost execution.\nThe messages are the states, e.g. ` + "`" + `UPDATED` + "`" + ` or ` + "`" + `COMPLETED` + "`" + `. While a ` + "`" + `WAIT` + "`" + ` stage is waiting the countdown is sent every minute\nas the JSON object ` + "`" + `{\"type\":\"countdown\",\"stage_id\":1,\"wake_at\":\"2006-01-02T15:04:05Z\",\"remaining_seconds\":60}` + "`" + `.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Notifications"
+                ],
+                "summary": "Connect to WebSocket notifications for sendpost execution",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "101": {
+                        "description": "Switching Protocols",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/runs": {
+            "get": {
+                "description": "Get the history of the sendpost runs from the latest to the oldest.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sendpost Run"
+                ],
+                "summary": "Get sendpost runs",
+                "operationId": "GetSendpostRuns",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved runs",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/responses.SendpostRun"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/runs/{run_id}": {
+            "get": {
+                "description": "Get the sendpost run with the state, parameters, flow run ID and error of every executed stage.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sendpost Run"
+                ],
+                "summary": "Get sendpost run",
+                "operationId": "GetSendpostRun",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Run ID",
+                        "name": "run_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved run",
+                        "schema": {
+                            "$ref": "#/definitions/responses.SendpostRunDetailed"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Run not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/runs/{run_id}/approve": {
+            "post": {
+                "description": "Approves the ` + "`" + `APPROVAL` + "`" + ` stage the run is paused on, the run continues with the next stages.\n` + "`" + `stage_id` + "`" + ` is required only if several stages of the run are awaiting approval.\nThe stage couldn't be approved after its ` + "`" + `approval_timeout` + "`" + ` expired.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sendpost Run"
+                ],
+                "summary": "Approve the stage of a sendpost run",
+                "operationId": "ApproveSendpostRun",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Run ID",
+                        "name": "run_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Comment of the decision",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/requests.Approval"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stage approved",
+                        "schema": {
+                            "$ref": "#/definitions/responses.StageRun"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Run not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "No stage of the run is awaiting approval",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/runs/{run_id}/reject": {
+            "post": {
+                "description": "Rejects the ` + "`" + `APPROVAL` + "`" + ` stage the run is paused on, the stage fails with the ` + "`" + `REJECTED` + "`" + ` reason\nand the comment as the error, the on-failure stages are executed.\n` + "`" + `stage_id` + "`" + ` is required only if several stages of the run are awaiting approval.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sendpost Run"
+                ],
+                "summary": "Reject the stage of a sendpost run",
+                "operationId": "RejectSendpostRun",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Run ID",
+                        "name": "run_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Comment of the decision",
+                        "name": "request",
+                        "in": "body",
+                        "schema": {
+                            "$ref": "#/definitions/requests.Approval"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Stage rejected",
+                        "schema": {
+                            "$ref": "#/definitions/responses.StageRun"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Run not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "No stage of the run is awaiting approval",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/schedules": {
+            "get": {
+                "description": "Get all schedules of the sendpost.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Schedule"
+                ],
+                "summary": "Get sendpost schedules",
+                "operationId": "GetSchedules",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved schedules",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/responses.Schedule"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Creates a schedule which runs the sendpost automatically.\nEither ` + "`" + `planned_at` + "`" + ` (single run) or ` + "`" + `cron_expression` + "`" + ` (recurring runs) must be provided.\n` + "`" + `cron_expression` + "`" + ` has 5 fields ` + "`" + `minute hour day-of-month month day-of-week` + "`" + ` or one of ` + "`" + `@hourly|@daily|@weekly|@monthly|@yearly` + "`" + `.\n` + "`" + `timezone` + "`" + ` is an IANA timezone the cron expression is evaluated in, ` + "`" + `UTC` + "`" + ` by default.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Schedule"
+                ],
+                "summary": "Create a sendpost schedule",
+                "operationId": "CreateSchedule",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Schedule",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.Schedule"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Successfully created",
+                        "schema": {
+                            "$ref": "#/definitions/responses.Schedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/schedules/{schedule_id}": {
+            "get": {
+                "description": "Get the schedule of the sendpost by its ID.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Schedule"
+                ],
+                "summary": "Get sendpost schedule",
+                "operationId": "GetSchedule",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Schedule ID",
+                        "name": "schedule_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved schedule",
+                        "schema": {
+                            "$ref": "#/definitions/responses.Schedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Schedule not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Replaces the definition of the schedule. The pending run is rescheduled.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Schedule"
+                ],
+                "summary": "Update sendpost schedule",
+                "operationId": "UpdateSchedule",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Schedule ID",
+                        "name": "schedule_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Schedule",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.Schedule"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully updated",
+                        "schema": {
+                            "$ref": "#/definitions/responses.Schedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid request body",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes the schedule, the pending run is cancelled.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Schedule"
+                ],
+                "summary": "Delete sendpost schedule",
+                "operationId": "DeleteSchedule",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Schedule ID",
+                        "name": "schedule_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully deleted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/stages": {
+            "get": {
+                "description": "Get all stages of a sendpost by its ID.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stage"
+                ],
+                "summary": "Get stages of a sendpost",
+                "operationId": "GetSendpostStages",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved stages",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/responses.Stage"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Adds a new stage to the stage graph of the specified sendpost.\nIf ` + "`" + `previous_stage_id` + "`" + ` is provided the stage depends on it and the stages which depended on the previous stage depend on the new one a.k.a this method allows insert stage between two stages.\nOtherwise the stages which don't depend on other stages depend on the new one, i.e. it becomes the first stage.\nIf ` + "`" + `depends_on` + "`" + ` is provided instead, the stage depends on the given stages only and the other stages aren't changed.\nField ` + "`" + `type` + "`" + ` could be ` + "`" + `PARALLEL|SEQUENTIAL|OBSERVER|MAP|SUBSENDPOST|APPROVAL|WAIT` + "`" + `.\nThe failed flow run is created again up to ` + "`" + `max_retries` + "`" + ` times if it finished in one of ` + "`" + `retry_on` + "`" + ` states (` + "`" + `FAILED` + "`" + `, ` + "`" + `CRASHED` + "`" + ` by default).\n` + "`" + `retry_delay` + "`" + ` in seconds is doubled after every attempt up to an hour, ` + "`" + `max_retries` + "`" + ` is at most 10.\n` + "`" + `timeout` + "`" + ` in seconds limits the execution of the stage including the retries, 0 means no limit.\nThe stage exceeding it is failed with the ` + "`" + `TIMED_OUT` + "`" + ` reason and its flow run is cancelled.\nThe stage with a ` + "`" + `condition` + "`" + ` is run only if the condition is true, otherwise it is recorded as ` + "`" + `SKIPPED` + "`" + `.\nThe condition is an [expr](https://expr-lang.org) expression which may use ` + "`" + `params.\u003cname\u003e` + "`" + ` (sendpost global parameters),\n` + "`" + `stages[\"\u003cid\u003e\"].state` + "`" + `, ` + "`" + `weekday` + "`" + ` in the configured timezone and ` + "`" + `previous.state` + "`" + ` (the state of the stage it depends on,\nfor several stages ` + "`" + `COMPLETED` + "`" + ` if all of them completed, otherwise ` + "`" + `SKIPPED` + "`" + `),\ne.g. ` + "`" + `previous.state == \"COMPLETED\" \u0026\u0026 weekday in [\"Saturday\", \"Sunday\"]` + "`" + `.\nThe ` + "`" + `always_run` + "`" + ` stage is executed even if another stage of the run failed before it was started.\n` + "`" + `max_concurrency` + "`" + ` of the parallel stage limits the number of its sub-stages executed at once, 0 means no limit. The queued sub-stages are ` + "`" + `PENDING` + "`" + `.\n` + "`" + `failure_policy` + "`" + ` of the parallel stage is ` + "`" + `fail_fast` + "`" + ` (default, the other sub-stages are cancelled as soon as the stage couldn't succeed) or ` + "`" + `wait_all` + "`" + ` (all the sub-stages are waited for).\nThe parallel stage succeeds if at least ` + "`" + `min_success` + "`" + ` sub-stages completed or, if it is 0, not more than ` + "`" + `allowed_failures` + "`" + ` sub-stages failed.\nThe ` + "`" + `MAP` + "`" + ` stage runs its deployment once per element of the list parameter ` + "`" + `map_over` + "`" + ` (the stage parameter or, if the stage doesn't have it, the global one),\nthe element is passed as the ` + "`" + `map_key` + "`" + ` parameter. The flow runs are limited and failed the same way as the sub-stages of the parallel stage.\nThe ` + "`" + `SUBSENDPOST` + "`" + ` stage doesn't need ` + "`" + `deployment_id` + "`" + `, it runs the sendpost ` + "`" + `subsendpost_id` + "`" + ` as a nested run and succeeds if the nested run completed.\nThe stage parameters override the global parameters of the nested sendpost. The sendpost couldn't run itself even through other sendposts.\nThe ` + "`" + `APPROVAL` + "`" + ` stage doesn't need ` + "`" + `deployment_id` + "`" + `, it pauses the run (` + "`" + `PAUSED` + "`" + `) until the stage is approved or rejected via the run endpoints.\nThe approval expires after ` + "`" + `approval_timeout` + "`" + ` seconds, 0 means it doesn't expire. The rejected and expired stages fail.\nThe ` + "`" + `WAIT` + "`" + ` stage doesn't need ` + "`" + `deployment_id` + "`" + `, it waits for ` + "`" + `wait_duration` + "`" + ` seconds or until the nearest ` + "`" + `wait_until` + "`" + ` time (` + "`" + `HH:MM` + "`" + `) in ` + "`" + `wait_timezone` + "`" + ` (UTC by default).\nThe stage parameters are validated against the OpenAPI schema of the parameters of the deployment (types, required parameters, enums),\nthe values with the expressions aren't checked. The mismatches are returned per field with 422.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stage"
+                ],
+                "summary": "Add a stage to a sendpost",
+                "operationId": "AddStageToSendpost",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Stage creation data",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.Stage"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Successfully added stage",
+                        "schema": {
+                            "$ref": "#/definitions/responses.Stage"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Parameters don't match the deployment schema",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ValidationErrors"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/stages/{stage_id}": {
+            "get": {
+                "description": "Get detailed information about a stage by its ID.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stage"
+                ],
+                "summary": "Get stage detailed info",
+                "operationId": "GetStageDetailedInfo",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Stage ID",
+                        "name": "stage_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved stage",
+                        "schema": {
+                            "$ref": "#/definitions/responses.StageDetailed"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "put": {
+                "description": "Update parameters of a stage by its ID.\nThe parameters are validated against the OpenAPI schema of the parameters of the deployment, the mismatches are returned per field with 422.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stage"
+                ],
+                "summary": "Update stage parameters",
+                "operationId": "UpdateStageParameters",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Stage ID",
+                        "name": "stage_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Parameters",
+                        "name": "parameters",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.Parameters"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully updated parameters",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "Parameters don't match the deployment schema",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ValidationErrors"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Deletes a stage by its ID. If the stage is linked to other stages, they will be updated accordingly.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stage"
+                ],
+                "summary": "Delete a stage",
+                "operationId": "DeleteStage",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Stage ID",
+                        "name": "stage_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully deleted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Block or unblock a stage by its ID.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stage"
+                ],
+                "summary": "Block/Unblock a stage",
+                "operationId": "BlockUnblockStage",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Stage ID",
+                        "name": "stage_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully blocked/unblocked",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID format",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/stages/{stage_id}/dependencies": {
+            "post": {
+                "description": "Makes the stage depend on another top level stage of the same sendpost: the stage is run only after it has completed.\nReturns 400 if the dependency would form a cycle.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stage"
+                ],
+                "summary": "Add a stage dependency",
+                "operationId": "AddStageDependency",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Stage ID",
+                        "name": "stage_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Dependency",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/requests.StageDependency"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Successfully added dependency",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid dependency",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/stages/{stage_id}/dependencies/{depends_on_stage_id}": {
+            "delete": {
+                "description": "Removes the dependency of the stage on another stage.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Stage"
+                ],
+                "summary": "Delete a stage dependency",
+                "operationId": "DeleteStageDependency",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Stage ID",
+                        "name": "stage_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the stage it depends on",
+                        "name": "depends_on_stage_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully deleted dependency",
                         "schema": {
                             "type": "string"
                         }
                     },
                     "400": {
-                        "description": "Invalid ID format",
+                        "description": "Invalid dependency",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
                         "schema": {
                             "type": "string"
                         }
@@ -824,7 +1774,7 @@ const docTemplate = `{
                 }
             },
             "post": {
-                "description": "Adds a sub-stage to an existing parent stage.\nThe sub-stage will be linked to the parent and can have deployment parameters.\nCould only add sub-stage to PARALLEL stage type.",
+                "description": "Adds a sub-stage to an existing parent stage.\nThe sub-stage will be linked to the parent and can have deployment parameters.\nCould only add sub-stage to PARALLEL stage type.\nThe retry policy (` + "`" + `max_retries` + "`" + `, ` + "`" + `retry_delay` + "`" + `, ` + "`" + `retry_on` + "`" + `) is applied to the sub-stage the same way as to the stage.\nThe ` + "`" + `timeout` + "`" + ` of the sub-stage doesn't stop the other sub-stages.\nThe sub-stage may be a parallel stage with its own ` + "`" + `max_concurrency` + "`" + `.\nThe sub-stage couldn't have a ` + "`" + `condition` + "`" + `, couldn't be ` + "`" + `always_run` + "`" + ` and couldn't be a MAP, SUBSENDPOST, APPROVAL or WAIT stage.",
                 "consumes": [
                     "application/json"
                 ],
@@ -874,6 +1824,60 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "422": {
+                        "description": "Parameters don't match the deployment schema",
+                        "schema": {
+                            "$ref": "#/definitions/responses.ValidationErrors"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal server error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sendposts/{sendpost_id}/validate": {
+            "post": {
+                "description": "Check the parameters every stage of the sendpost would be executed with before running it, including the sub-stages\nof the parallel stages and the on-failure stages. The parameters are resolved by the layers as for the run started now\nand validated against the OpenAPI schema of the parameters of the deployment: the types, the required parameters and the enums.\nThe values with the expressions aren't checked, see render-parameters. The fields of the errors are ` + "`" + `stages.\u003cstage_id\u003e.\u003cparameter\u003e` + "`" + `.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "Sendpost Runner"
+                ],
+                "summary": "Validate the sendpost",
+                "operationId": "ValidateSendpost",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sendpost ID",
+                        "name": "sendpost_id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/responses.SendpostValidation"
+                        }
+                    },
+                    "400": {
+                        "description": "Invalid ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Sendpost not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal server error",
                         "schema": {
@@ -882,24 +1886,347 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "requests.Parameters": {
+        }
+    },
+    "definitions": {
+        "requests.Approval": {
+            "type": "object",
+            "properties": {
+                "comment": {
+                    "type": "string"
+                },
+                "stage_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "requests.Parameters": {
+            "type": "object",
+            "required": [
+                "parameters"
+            ],
+            "properties": {
+                "parameters": {
+                    "$ref": "#/definitions/value.JSONB"
+                }
+            }
+        },
+        "requests.RenderParameters": {
+            "type": "object",
+            "properties": {
+                "run_id": {
+                    "description": "RunID is the run the parameters are rendered for, the run which would be started now if nil",
+                    "type": "integer"
+                }
+            }
+        },
+        "requests.RunSendpost": {
+            "type": "object",
+            "properties": {
+                "parameters": {
+                    "description": "Parameters override the global parameters of the sendpost within the run",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/value.JSONB"
+                        }
+                    ]
+                },
+                "stage_parameters": {
+                    "description": "StageParameters override the parameters of the stages within the run by the stage ID",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/value.JSONB"
+                    }
+                }
+            }
+        },
+        "requests.Schedule": {
+            "type": "object",
+            "properties": {
+                "cron_expression": {
+                    "type": "string"
+                },
+                "planned_at": {
+                    "type": "string"
+                },
+                "timezone": {
+                    "type": "string"
+                }
+            }
+        },
+        "requests.Senpost": {
+            "type": "object",
+            "required": [
+                "sendpost_name"
+            ],
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "global_parameters": {
+                    "$ref": "#/definitions/value.JSONB"
+                },
+                "max_duration": {
+                    "type": "integer"
+                },
+                "sendpost_name": {
+                    "type": "string"
+                }
+            }
+        },
+        "requests.Stage": {
+            "type": "object",
+            "required": [
+                "type"
+            ],
+            "properties": {
+                "allowed_failures": {
+                    "type": "integer"
+                },
+                "always_run": {
+                    "type": "boolean"
+                },
+                "approval_timeout": {
+                    "type": "integer"
+                },
+                "condition": {
+                    "type": "string"
+                },
+                "depends_on": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "deployment_id": {
+                    "type": "string"
+                },
+                "failure_policy": {
+                    "$ref": "#/definitions/value.FailurePolicy"
+                },
+                "map_key": {
+                    "type": "string"
+                },
+                "map_over": {
+                    "type": "string"
+                },
+                "max_concurrency": {
+                    "type": "integer"
+                },
+                "max_retries": {
+                    "type": "integer"
+                },
+                "min_success": {
+                    "type": "integer"
+                },
+                "previous_stage_id": {
+                    "type": "integer"
+                },
+                "retry_delay": {
+                    "type": "integer"
+                },
+                "retry_on": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/value.StateType"
+                    }
+                },
+                "stage_parameters": {
+                    "$ref": "#/definitions/value.JSONB"
+                },
+                "subsendpost_id": {
+                    "type": "integer"
+                },
+                "timeout": {
+                    "type": "integer"
+                },
+                "type": {
+                    "$ref": "#/definitions/value.StageType"
+                },
+                "wait_duration": {
+                    "type": "integer"
+                },
+                "wait_timezone": {
+                    "type": "string"
+                },
+                "wait_until": {
+                    "type": "string"
+                }
+            }
+        },
+        "requests.StageDependency": {
+            "type": "object",
+            "required": [
+                "depends_on_stage_id"
+            ],
+            "properties": {
+                "depends_on_stage_id": {
+                    "type": "integer"
+                }
+            }
+        },
+        "responses.FieldError": {
+            "type": "object",
+            "required": [
+                "field",
+                "message"
+            ],
+            "properties": {
+                "field": {
+                    "description": "Field is the path to the parameter, e.g. stage_parameters.limit or stages.12.segment",
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                }
+            }
+        },
+        "responses.GraphEdge": {
+            "type": "object",
+            "required": [
+                "from",
+                "to"
+            ],
+            "properties": {
+                "from": {
+                    "type": "integer"
+                },
+                "to": {
+                    "type": "integer"
+                }
+            }
+        },
+        "responses.GraphStage": {
+            "type": "object",
+            "required": [
+                "always_run",
+                "depends_on",
+                "id",
+                "is_blocked",
+                "state",
+                "type"
+            ],
+            "properties": {
+                "always_run": {
+                    "type": "boolean"
+                },
+                "depends_on": {
+                    "type": "array",
+                    "items": {
+                        "type": "integer"
+                    }
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "is_blocked": {
+                    "type": "boolean"
+                },
+                "state": {
+                    "$ref": "#/definitions/value.StateType"
+                },
+                "type": {
+                    "$ref": "#/definitions/value.StageType"
+                }
+            }
+        },
+        "responses.RenderedParameters": {
+            "type": "object",
+            "required": [
+                "stages"
+            ],
+            "properties": {
+                "error": {
+                    "description": "Error of rendering the global parameters, they are returned as is then",
+                    "type": "string"
+                },
+                "global_parameters": {
+                    "$ref": "#/definitions/value.JSONB"
+                },
+                "stages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/responses.RenderedStageParameters"
+                    }
+                }
+            }
+        },
+        "responses.RenderedStageParameters": {
             "type": "object",
             "required": [
-                "parameters"
+                "stage_id",
+                "type"
             ],
             "properties": {
+                "deployment_id": {
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Error of resolving the parameters of the stage, the stage parameters are returned then",
+                    "type": "string"
+                },
                 "parameters": {
                     "$ref": "#/definitions/value.JSONB"
+                },
+                "parent_stage_id": {
+                    "type": "integer"
+                },
+                "sources": {
+                    "description": "Sources are the layers the values were taken from by the parameter names:\nDEPLOYMENT \u003c STAGE \u003c PARENT \u003c GLOBAL \u003c RUN",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/value.ParameterSource"
+                    }
+                },
+                "stage_id": {
+                    "type": "integer"
+                },
+                "type": {
+                    "$ref": "#/definitions/value.StageType"
                 }
             }
         },
-        "requests.Senpost": {
+        "responses.Schedule": {
             "type": "object",
             "required": [
-                "sendpost_name"
+                "id",
+                "planned_at",
+                "sendpost_id",
+                "timezone"
+            ],
+            "properties": {
+                "completed_at": {
+                    "type": "string"
+                },
+                "cron_expression": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "planned_at": {
+                    "type": "string"
+                },
+                "sendpost_id": {
+                    "type": "integer"
+                },
+                "skipped_at": {
+                    "type": "string"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "timezone": {
+                    "type": "string"
+                }
+            }
+        },
+        "responses.Sendpost": {
+            "type": "object",
+            "required": [
+                "id",
+                "name",
+                "state"
             ],
             "properties": {
                 "description": {
@@ -908,54 +2235,129 @@ const docTemplate = `{
                 "global_parameters": {
                     "$ref": "#/definitions/value.JSONB"
                 },
-                "sendpost_name": {
+                "id": {
+                    "type": "integer"
+                },
+                "max_duration": {
+                    "type": "integer"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "state": {
                     "type": "string"
                 }
             }
         },
-        "requests.Stage": {
+        "responses.SendpostRun": {
             "type": "object",
             "required": [
-                "deployment_id",
-                "type"
+                "id",
+                "sendpost_id",
+                "started_at",
+                "state"
             ],
             "properties": {
-                "deployment_id": {
+                "completed_at": {
                     "type": "string"
                 },
-                "previous_stage_id": {
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "parameters": {
+                    "$ref": "#/definitions/value.JSONB"
+                },
+                "parent_run_id": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "$ref": "#/definitions/value.FailureReason"
+                },
+                "resumed_from_run_id": {
+                    "type": "integer"
+                },
+                "sendpost_id": {
                     "type": "integer"
                 },
                 "stage_parameters": {
                     "$ref": "#/definitions/value.JSONB"
                 },
-                "type": {
-                    "$ref": "#/definitions/value.StageType"
+                "started_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "$ref": "#/definitions/value.StateType"
                 }
             }
         },
-        "responses.Sendpost": {
+        "responses.SendpostRunDetailed": {
             "type": "object",
             "required": [
                 "id",
-                "name",
+                "sendpost_id",
+                "stage_runs",
+                "started_at",
                 "state"
             ],
             "properties": {
-                "description": {
+                "completed_at": {
                     "type": "string"
                 },
-                "global_parameters": {
-                    "$ref": "#/definitions/value.JSONB"
+                "error": {
+                    "type": "string"
                 },
                 "id": {
                     "type": "integer"
                 },
-                "name": {
+                "parameters": {
+                    "$ref": "#/definitions/value.JSONB"
+                },
+                "parent_run_id": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "$ref": "#/definitions/value.FailureReason"
+                },
+                "resumed_from_run_id": {
+                    "type": "integer"
+                },
+                "sendpost_id": {
+                    "type": "integer"
+                },
+                "stage_parameters": {
+                    "$ref": "#/definitions/value.JSONB"
+                },
+                "stage_runs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/responses.StageRun"
+                    }
+                },
+                "started_at": {
                     "type": "string"
                 },
                 "state": {
-                    "type": "string"
+                    "$ref": "#/definitions/value.StateType"
+                }
+            }
+        },
+        "responses.SendpostValidation": {
+            "type": "object",
+            "required": [
+                "errors"
+            ],
+            "properties": {
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/responses.FieldError"
+                    }
+                },
+                "valid": {
+                    "type": "boolean"
                 }
             }
         },
@@ -991,41 +2393,286 @@ const docTemplate = `{
                 "type"
             ],
             "properties": {
+                "allowed_failures": {
+                    "type": "integer"
+                },
+                "always_run": {
+                    "type": "boolean"
+                },
+                "approval_timeout": {
+                    "type": "integer"
+                },
+                "condition": {
+                    "type": "string"
+                },
                 "deployment_id": {
                     "type": "string"
                 },
+                "failure_policy": {
+                    "$ref": "#/definitions/value.FailurePolicy"
+                },
                 "id": {
                     "type": "integer"
                 },
+                "map_key": {
+                    "type": "string"
+                },
+                "map_over": {
+                    "type": "string"
+                },
+                "max_concurrency": {
+                    "type": "integer"
+                },
+                "max_retries": {
+                    "type": "integer"
+                },
+                "min_success": {
+                    "type": "integer"
+                },
                 "parent_stage_id": {
                     "type": "integer"
                 },
+                "retry_delay": {
+                    "type": "integer"
+                },
+                "retry_on": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/value.StateType"
+                    }
+                },
                 "stage_parameters": {
                     "$ref": "#/definitions/value.JSONB"
                 },
                 "state": {
                     "$ref": "#/definitions/value.StateType"
                 },
+                "subsendpost_id": {
+                    "type": "integer"
+                },
+                "timeout": {
+                    "type": "integer"
+                },
+                "type": {
+                    "$ref": "#/definitions/value.StageType"
+                },
+                "wait_duration": {
+                    "type": "integer"
+                },
+                "wait_timezone": {
+                    "type": "string"
+                },
+                "wait_until": {
+                    "type": "string"
+                }
+            }
+        },
+        "responses.StageGraph": {
+            "type": "object",
+            "required": [
+                "edges",
+                "stages"
+            ],
+            "properties": {
+                "edges": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/responses.GraphEdge"
+                    }
+                },
+                "stages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/responses.GraphStage"
+                    }
+                }
+            }
+        },
+        "responses.StageRun": {
+            "type": "object",
+            "required": [
+                "attempt",
+                "id",
+                "stage_id",
+                "started_at",
+                "state",
+                "type"
+            ],
+            "properties": {
+                "attempt": {
+                    "type": "integer"
+                },
+                "completed_at": {
+                    "type": "string"
+                },
+                "decided_at": {
+                    "type": "string"
+                },
+                "decision": {
+                    "description": "Decision made on the approval stage with the comment and the time the approval expires at",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/value.ApprovalDecision"
+                        }
+                    ]
+                },
+                "decision_comment": {
+                    "type": "string"
+                },
+                "deployment_id": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "flow_run_id": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "parameters": {
+                    "$ref": "#/definitions/value.JSONB"
+                },
+                "parent_stage_id": {
+                    "type": "integer"
+                },
+                "reason": {
+                    "$ref": "#/definitions/value.FailureReason"
+                },
+                "result": {
+                    "description": "Result is the output of the completed flow run, referenced by the parameters of the next stages as stages.\u003cstage_id\u003e.result.\u003ckey\u003e",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/value.JSONB"
+                        }
+                    ]
+                },
+                "reused": {
+                    "type": "boolean"
+                },
+                "stage_id": {
+                    "type": "integer"
+                },
+                "started_at": {
+                    "type": "string"
+                },
+                "state": {
+                    "$ref": "#/definitions/value.StateType"
+                },
+                "subsendpost_run_id": {
+                    "description": "SubsendpostRunID is the run of the sendpost started by the subsendpost stage",
+                    "type": "integer"
+                },
                 "type": {
                     "$ref": "#/definitions/value.StageType"
+                },
+                "wake_at": {
+                    "description": "WakeAt is the time the wait stage finishes waiting",
+                    "type": "string"
+                }
+            }
+        },
+        "responses.ValidationErrors": {
+            "type": "object",
+            "required": [
+                "error",
+                "errors"
+            ],
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "errors": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/responses.FieldError"
+                    }
                 }
             }
         },
+        "value.ApprovalDecision": {
+            "type": "string",
+            "enum": [
+                "APPROVED",
+                "REJECTED"
+            ],
+            "x-enum-varnames": [
+                "Approved",
+                "Rejected"
+            ]
+        },
+        "value.FailurePolicy": {
+            "type": "string",
+            "enum": [
+                "fail_fast",
+                "wait_all"
+            ],
+            "x-enum-varnames": [
+                "FailFast",
+                "WaitAll"
+            ]
+        },
+        "value.FailureReason": {
+            "type": "string",
+            "enum": [
+                "TIMED_OUT",
+                "INTERRUPTED",
+                "LOCK_LOST",
+                "REJECTED",
+                "EXPIRED"
+            ],
+            "x-enum-varnames": [
+                "ReasonTimedOut",
+                "ReasonInterrupted",
+                "ReasonLockLost",
+                "ReasonRejected",
+                "ReasonExpired"
+            ]
+        },
         "value.JSONB": {
             "type": "object",
             "additionalProperties": true
         },
+        "value.ParameterSource": {
+            "type": "string",
+            "enum": [
+                "DEPLOYMENT",
+                "STAGE",
+                "PARENT",
+                "GLOBAL",
+                "RUN"
+            ],
+            "x-enum-varnames": [
+                "SourceDeployment",
+                "SourceStage",
+                "SourceParent",
+                "SourceGlobal",
+                "SourceRun"
+            ]
+        },
         "value.StageType": {
             "type": "string",
             "enum": [
                 "PARALLEL",
                 "SEQUENTIAL",
-                "OBSERVER"
+                "OBSERVER",
+                "MAP",
+                "SUBSENDPOST",
+                "APPROVAL",
+                "WAIT"
             ],
             "x-enum-varnames": [
                 "ParallelStage",
                 "SequentialStage",
-                "ObserverStage"
+                "ObserverStage",
+                "MapStage",
+                "SubsendpostStage",
+                "ApprovalStage",
+                "WaitStage"
             ]
         },
         "value.StateType": {
@@ -1041,7 +2688,9 @@ const docTemplate = `{
                 "PAUSED",
                 "CANCELLING",
                 "NEVERRUNNING",
-                "UPDATED"
+                "UPDATED",
+                "SKIPPED",
+                "TIMED_OUT"
             ],
             "x-enum-varnames": [
                 "Scheduled",
@@ -1054,7 +2703,9 @@ const docTemplate = `{
                 "Paused",
                 "Cancelling",
                 "NeverRunning",
-                "Updated"
+                "Updated",
+                "Skipped",
+                "TimedOut"
             ]
         }
     }
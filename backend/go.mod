@@ -3,6 +3,7 @@ module crm-uplift-ii24-backend
 go 1.23.6
 
 require (
+	github.com/expr-lang/expr v1.17.5
 	github.com/gin-contrib/cors v1.7.5
 	github.com/gin-gonic/gin v1.10.0
 	github.com/gorilla/websocket v1.5.3
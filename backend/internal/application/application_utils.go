@@ -4,6 +4,10 @@ import (
 	"crm-uplift-ii24-backend/internal/application/requests"
 	"crm-uplift-ii24-backend/internal/application/responses"
 	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/services"
+	"crm-uplift-ii24-backend/pkg/schema"
+	"errors"
 )
 
 func mapSendpost(sendpost *entity.Sendpost) *responses.Sendpost {
@@ -13,6 +17,7 @@ func mapSendpost(sendpost *entity.Sendpost) *responses.Sendpost {
 		Description:      sendpost.Description,
 		State:            string(sendpost.State),
 		GlobalParameters: sendpost.GlobalParameters,
+		MaxDuration:      sendpost.MaxDuration,
 	}
 }
 
@@ -25,6 +30,10 @@ func mapSendposts(sendposts []*entity.Sendpost) responses.Sendposts {
 }
 
 func mapStageDetailed(stage *entity.Stage) *responses.StageDetailed {
+	var retryOn []value.StateType
+	if stage.RetryOn != nil {
+		retryOn = *stage.RetryOn
+	}
 	return &responses.StageDetailed{
 		ID:              stage.ID,
 		State:           stage.State,
@@ -32,6 +41,23 @@ func mapStageDetailed(stage *entity.Stage) *responses.StageDetailed {
 		ParentStageID:   stage.ParentStageID,
 		DeploymentID:    stage.DeploymnentID,
 		StageParameters: stage.StageParameters,
+		MaxRetries:      stage.MaxRetries,
+		RetryDelay:      stage.RetryDelay,
+		RetryOn:         retryOn,
+		Timeout:         stage.Timeout,
+		Condition:       stage.Condition,
+		AlwaysRun:       stage.AlwaysRun,
+		MaxConcurrency:  stage.MaxConcurrency,
+		FailurePolicy:   stage.FailurePolicy,
+		MinSuccess:      stage.MinSuccess,
+		AllowedFailures: stage.AllowedFailures,
+		MapOver:         stage.MapOver,
+		MapKey:          stage.MapKey,
+		SubsendpostID:   stage.SubsendpostID,
+		ApprovalTimeout: stage.ApprovalTimeout,
+		WaitDuration:    stage.WaitDuration,
+		WaitUntil:       stage.WaitUntil,
+		WaitTimezone:    stage.WaitTimezone,
 	}
 }
 
@@ -52,11 +78,207 @@ func mapStages(stages []*entity.Stage) responses.SendpostStages {
 	return result
 }
 
-func unmarshalStage(sendpostID uint, stageRequest *requests.Stage) *entity.Stage {
-	return &entity.Stage{
+func mapStageGraph(graph *entity.StageGraph, stages []*entity.Stage) *responses.StageGraph {
+	result := &responses.StageGraph{Stages: []*responses.GraphStage{}, Edges: []*responses.GraphEdge{}}
+	for _, stage := range stages {
+		dependsOn := graph.DependsOn(stage.ID)
+		if dependsOn == nil {
+			dependsOn = []uint{}
+		}
+		result.Stages = append(result.Stages, &responses.GraphStage{
+			ID:        stage.ID,
+			Type:      stage.Type,
+			State:     stage.State,
+			IsBlocked: stage.IsBlocked,
+			AlwaysRun: stage.AlwaysRun,
+			DependsOn: dependsOn,
+		})
+		for _, id := range dependsOn {
+			result.Edges = append(result.Edges, &responses.GraphEdge{From: id, To: stage.ID})
+		}
+	}
+	return result
+}
+
+func unmarshalStage(sendpostID uint, stageRequest *requests.Stage) (*entity.Stage, error) {
+	stage := &entity.Stage{
 		SendpostID:      sendpostID,
 		Type:            stageRequest.StageType,
 		DeploymnentID:   stageRequest.DeploymentID,
 		StageParameters: stageRequest.StageParameters,
+		AlwaysRun:       stageRequest.AlwaysRun,
+	}
+	if err := stage.SetRetryPolicy(stageRequest.MaxRetries, stageRequest.RetryDelay, stageRequest.RetryOn); err != nil {
+		return nil, err
+	}
+	if err := stage.SetTimeout(stageRequest.Timeout); err != nil {
+		return nil, err
+	}
+	if err := stage.SetCondition(stageRequest.Condition); err != nil {
+		return nil, err
+	}
+	if err := stage.SetMaxConcurrency(stageRequest.MaxConcurrency); err != nil {
+		return nil, err
+	}
+	if err := stage.SetFailurePolicy(stageRequest.FailurePolicy, stageRequest.MinSuccess, stageRequest.AllowedFailures); err != nil {
+		return nil, err
+	}
+	if err := stage.SetMap(stageRequest.MapOver, stageRequest.MapKey); err != nil {
+		return nil, err
+	}
+	if err := stage.SetSubsendpost(stageRequest.SubsendpostID); err != nil {
+		return nil, err
+	}
+	if err := stage.SetApprovalTimeout(stageRequest.ApprovalTimeout); err != nil {
+		return nil, err
+	}
+	if err := stage.SetWait(stageRequest.WaitDuration, stageRequest.WaitUntil, stageRequest.WaitTimezone); err != nil {
+		return nil, err
+	}
+	if stage.NeedsDeployment() && stage.DeploymnentID == "" {
+		return nil, entity.ErrDeploymentRequired
+	}
+	return stage, nil
+}
+
+func mapSendpostRun(run *entity.SendpostRun) *responses.SendpostRun {
+	return &responses.SendpostRun{
+		ID:               run.ID,
+		SendpostID:       run.SendpostID,
+		State:            run.State,
+		StartedAt:        run.StartedAt,
+		CompletedAt:      run.CompletedAt,
+		Error:            run.Error,
+		Reason:           run.Reason,
+		ResumedFromRunID: run.ResumedFromRunID,
+		ParentRunID:      run.ParentRunID,
+		Parameters:       run.Parameters,
+		StageParameters:  run.StageParameters,
+	}
+}
+
+func mapSendpostRuns(runs []*entity.SendpostRun) responses.SendpostRuns {
+	var result []*responses.SendpostRun
+	for _, run := range runs {
+		result = append(result, mapSendpostRun(run))
+	}
+	return result
+}
+
+func mapStageRun(stageRun *entity.StageRun) *responses.StageRun {
+	return &responses.StageRun{
+		ID:               stageRun.ID,
+		StageID:          stageRun.StageID,
+		ParentStageID:    stageRun.ParentStageID,
+		Type:             stageRun.Type,
+		State:            stageRun.State,
+		DeploymentID:     stageRun.DeploymentID,
+		FlowRunID:        stageRun.FlowRunID,
+		Parameters:       stageRun.Parameters,
+		StartedAt:        stageRun.StartedAt,
+		CompletedAt:      stageRun.CompletedAt,
+		Error:            stageRun.Error,
+		Reused:           stageRun.Reused,
+		Attempt:          stageRun.Attempt,
+		Reason:           stageRun.Reason,
+		SubsendpostRunID: stageRun.SubsendpostRunID,
+		Decision:         stageRun.Decision,
+		DecisionComment:  stageRun.DecisionComment,
+		DecidedAt:        stageRun.DecidedAt,
+		ExpiresAt:        stageRun.ExpiresAt,
+		WakeAt:           stageRun.WakeAt,
+		Result:           stageRun.Result,
+	}
+}
+
+func mapSendpostRunDetailed(run *entity.SendpostRun) *responses.SendpostRunDetailed {
+	stageRuns := make([]*responses.StageRun, 0, len(run.StageRuns))
+	for _, stageRun := range run.StageRuns {
+		stageRuns = append(stageRuns, mapStageRun(stageRun))
+	}
+	return &responses.SendpostRunDetailed{
+		ID:               run.ID,
+		SendpostID:       run.SendpostID,
+		State:            run.State,
+		StartedAt:        run.StartedAt,
+		CompletedAt:      run.CompletedAt,
+		Error:            run.Error,
+		Reason:           run.Reason,
+		ResumedFromRunID: run.ResumedFromRunID,
+		ParentRunID:      run.ParentRunID,
+		Parameters:       run.Parameters,
+		StageParameters:  run.StageParameters,
+		StageRuns:        stageRuns,
+	}
+}
+
+func mapSchedule(schedule *entity.SendpostSchedule) *responses.Schedule {
+	return &responses.Schedule{
+		ID:             schedule.ID,
+		SendpostID:     schedule.SendpostID,
+		CronExpression: schedule.CronExpression,
+		Timezone:       schedule.Timezone,
+		PlannedAt:      schedule.PlannedAt,
+		StartedAt:      schedule.StartedAt,
+		CompletedAt:    schedule.CompletedAt,
+		SkippedAt:      schedule.SkippedAt,
+	}
+}
+
+func mapSchedules(schedules []*entity.SendpostSchedule) responses.Schedules {
+	var result []*responses.Schedule
+	for _, schedule := range schedules {
+		result = append(result, mapSchedule(schedule))
+	}
+	return result
+}
+
+func mapParametersPreview(preview *services.ParametersPreview) *responses.RenderedParameters {
+	result := &responses.RenderedParameters{
+		GlobalParameters: preview.GlobalParameters,
+		Error:            errorString(preview.GlobalErr),
+		Stages:           make([]*responses.RenderedStageParameters, 0, len(preview.Stages)),
+	}
+	for _, stage := range preview.Stages {
+		result.Stages = append(result.Stages, &responses.RenderedStageParameters{
+			StageID:       stage.Stage.ID,
+			ParentStageID: stage.Stage.ParentStageID,
+			Type:          stage.Stage.Type,
+			DeploymentID:  stage.Stage.DeploymnentID,
+			Parameters:    stage.Parameters,
+			Sources:       stage.Sources,
+			Error:         errorString(stage.Err),
+		})
 	}
+	return result
+}
+
+func errorString(err error) *string {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	return &msg
+}
+
+func mapFieldErrors(errs schema.Errors) []*responses.FieldError {
+	result := make([]*responses.FieldError, 0, len(errs))
+	for _, fieldErr := range errs {
+		result = append(result, &responses.FieldError{Field: fieldErr.Field, Message: fieldErr.Message})
+	}
+	return result
+}
+
+// validationErrors returns the field errors of the parameters not matching the schema,
+// nil if err isn't the error of the validation.
+func validationErrors(err error) *responses.ValidationErrors {
+	var errs schema.Errors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+	return &responses.ValidationErrors{Error: err.Error(), Errors: mapFieldErrors(errs)}
+}
+
+func mapSendpostValidation(errs schema.Errors) *responses.SendpostValidation {
+	return &responses.SendpostValidation{Valid: len(errs) == 0, Errors: mapFieldErrors(errs)}
 }
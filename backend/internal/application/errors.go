@@ -4,4 +4,5 @@ const (
 	InvalidIDErr          string = "Invalid ID"
 	InvalidRequestBodyErr string = "Invalid request body"
 	InvalidKeyErr         string = "Invalid key"
+	InvalidQueryErr       string = "Invalid query parameters"
 )
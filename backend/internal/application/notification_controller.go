@@ -35,6 +35,8 @@ func NewNotificationController(allowedOrigins []string, notificationService *ser
 
 //	@Summary		Connect to WebSocket notifications for sendpost execution
 //	@Description	Establishes a WebSocket connection to receive status updates on sendpost execution.
+//	@Description	The messages are the states, e.g. `UPDATED` or `COMPLETED`. While a `WAIT` stage is waiting the countdown is sent every minute
+//	@Description	as the JSON object `{"type":"countdown","stage_id":1,"wake_at":"2006-01-02T15:04:05Z","remaining_seconds":60}`.
 //	@Tags			Notifications
 //	@Accept			json
 //	@Produce		json
@@ -0,0 +1,6 @@
+package requests
+
+type Approval struct {
+	Comment string `json:"comment"`
+	StageID *uint  `json:"stage_id"`
+}
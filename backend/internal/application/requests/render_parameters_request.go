@@ -0,0 +1,6 @@
+package requests
+
+type RenderParameters struct {
+	// RunID is the run the parameters are rendered for, the run which would be started now if nil
+	RunID *uint `json:"run_id"`
+}
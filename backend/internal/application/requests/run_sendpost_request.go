@@ -0,0 +1,10 @@
+package requests
+
+import "crm-uplift-ii24-backend/internal/domain/value"
+
+type RunSendpost struct {
+	// Parameters override the global parameters of the sendpost within the run
+	Parameters *value.JSONB `json:"parameters"`
+	// StageParameters override the parameters of the stages within the run by the stage ID
+	StageParameters map[uint]value.JSONB `json:"stage_parameters"`
+}
@@ -0,0 +1,9 @@
+package requests
+
+import "time"
+
+type Schedule struct {
+	PlannedAt      *time.Time `json:"planned_at"`
+	CronExpression *string    `json:"cron_expression"`
+	Timezone       string     `json:"timezone"`
+}
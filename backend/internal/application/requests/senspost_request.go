@@ -6,4 +6,5 @@ type Senpost struct {
 	SendpostName     string       `binding:"required" json:"sendpost_name"`
 	Description      *string      `json:"description"`
 	GlobalParameters *value.JSONB `json:"global_parameters"`
+	MaxDuration      *int         `json:"max_duration"`
 }
@@ -5,8 +5,30 @@ import (
 )
 
 type Stage struct {
-	StageType       value.StageType `json:"type" binding:"required"`
-	DeploymentID    string          `json:"deployment_id" binding:"required"`
-	StageParameters *value.JSONB    `json:"stage_parameters"`
-	PreviousStageID *uint           `json:"previous_stage_id"`
+	StageType       value.StageType     `json:"type" binding:"required"`
+	DeploymentID    string              `json:"deployment_id"`
+	StageParameters *value.JSONB        `json:"stage_parameters"`
+	PreviousStageID *uint               `json:"previous_stage_id"`
+	MaxRetries      int                 `json:"max_retries"`
+	RetryDelay      int                 `json:"retry_delay"`
+	RetryOn         []value.StateType   `json:"retry_on"`
+	Timeout         int                 `json:"timeout"`
+	Condition       string              `json:"condition"`
+	AlwaysRun       bool                `json:"always_run"`
+	DependsOn       []uint              `json:"depends_on"`
+	MaxConcurrency  int                 `json:"max_concurrency"`
+	FailurePolicy   value.FailurePolicy `json:"failure_policy"`
+	MinSuccess      int                 `json:"min_success"`
+	AllowedFailures int                 `json:"allowed_failures"`
+	MapOver         string              `json:"map_over"`
+	MapKey          string              `json:"map_key"`
+	SubsendpostID   *uint               `json:"subsendpost_id"`
+	ApprovalTimeout int                 `json:"approval_timeout"`
+	WaitDuration    int                 `json:"wait_duration"`
+	WaitUntil       string              `json:"wait_until"`
+	WaitTimezone    string              `json:"wait_timezone"`
+}
+
+type StageDependency struct {
+	DependsOnStageID uint `json:"depends_on_stage_id" binding:"required"`
 }
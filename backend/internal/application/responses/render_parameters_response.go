@@ -0,0 +1,23 @@
+package responses
+
+import "crm-uplift-ii24-backend/internal/domain/value"
+
+type RenderedParameters struct {
+	GlobalParameters *value.JSONB `json:"global_parameters"`
+	// Error of rendering the global parameters, they are returned as is then
+	Error  *string                    `json:"error"`
+	Stages []*RenderedStageParameters `json:"stages" validate:"required"`
+}
+
+type RenderedStageParameters struct {
+	StageID       uint            `json:"stage_id" validate:"required"`
+	ParentStageID *uint           `json:"parent_stage_id"`
+	Type          value.StageType `json:"type" validate:"required"`
+	DeploymentID  string          `json:"deployment_id"`
+	Parameters    *value.JSONB    `json:"parameters"`
+	// Sources are the layers the values were taken from by the parameter names:
+	// DEPLOYMENT < STAGE < PARENT < GLOBAL < RUN
+	Sources map[string]value.ParameterSource `json:"sources"`
+	// Error of resolving the parameters of the stage, the stage parameters are returned then
+	Error *string `json:"error"`
+}
@@ -0,0 +1,16 @@
+package responses
+
+import "time"
+
+type Schedules []*Schedule
+
+type Schedule struct {
+	ID             uint       `json:"id" validate:"required"`
+	SendpostID     uint       `json:"sendpost_id" validate:"required"`
+	CronExpression *string    `json:"cron_expression"`
+	Timezone       string     `json:"timezone" validate:"required"`
+	PlannedAt      time.Time  `json:"planned_at" validate:"required"`
+	StartedAt      *time.Time `json:"started_at"`
+	CompletedAt    *time.Time `json:"completed_at"`
+	SkippedAt      *time.Time `json:"skipped_at"`
+}
@@ -10,4 +10,5 @@ type Sendpost struct {
 	Description      *string      `json:"description"`
 	State            string       `json:"state" validate:"required"`
 	GlobalParameters *value.JSONB `json:"global_parameters"`
+	MaxDuration      int          `json:"max_duration"`
 }
@@ -0,0 +1,65 @@
+package responses
+
+import (
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"time"
+)
+
+type SendpostRuns []*SendpostRun
+
+type SendpostRun struct {
+	ID               uint                 `json:"id" validate:"required"`
+	SendpostID       uint                 `json:"sendpost_id" validate:"required"`
+	State            value.StateType      `json:"state" validate:"required"`
+	StartedAt        time.Time            `json:"started_at" validate:"required"`
+	CompletedAt      *time.Time           `json:"completed_at"`
+	Error            *string              `json:"error"`
+	Reason           *value.FailureReason `json:"reason"`
+	ResumedFromRunID *uint                `json:"resumed_from_run_id"`
+	ParentRunID      *uint                `json:"parent_run_id"`
+	Parameters       *value.JSONB         `json:"parameters"`
+	StageParameters  *value.JSONB         `json:"stage_parameters"`
+}
+
+type SendpostRunDetailed struct {
+	ID               uint                 `json:"id" validate:"required"`
+	SendpostID       uint                 `json:"sendpost_id" validate:"required"`
+	State            value.StateType      `json:"state" validate:"required"`
+	StartedAt        time.Time            `json:"started_at" validate:"required"`
+	CompletedAt      *time.Time           `json:"completed_at"`
+	Error            *string              `json:"error"`
+	Reason           *value.FailureReason `json:"reason"`
+	ResumedFromRunID *uint                `json:"resumed_from_run_id"`
+	ParentRunID      *uint                `json:"parent_run_id"`
+	Parameters       *value.JSONB         `json:"parameters"`
+	StageParameters  *value.JSONB         `json:"stage_parameters"`
+	StageRuns        []*StageRun          `json:"stage_runs" validate:"required"`
+}
+
+type StageRun struct {
+	ID            uint                 `json:"id" validate:"required"`
+	StageID       uint                 `json:"stage_id" validate:"required"`
+	ParentStageID *uint                `json:"parent_stage_id"`
+	Type          value.StageType      `json:"type" validate:"required"`
+	State         value.StateType      `json:"state" validate:"required"`
+	DeploymentID  string               `json:"deployment_id"`
+	FlowRunID     *string              `json:"flow_run_id"`
+	Parameters    *value.JSONB         `json:"parameters"`
+	StartedAt     time.Time            `json:"started_at" validate:"required"`
+	CompletedAt   *time.Time           `json:"completed_at"`
+	Error         *string              `json:"error"`
+	Reused        bool                 `json:"reused"`
+	Attempt       int                  `json:"attempt" validate:"required"`
+	Reason        *value.FailureReason `json:"reason"`
+	// SubsendpostRunID is the run of the sendpost started by the subsendpost stage
+	SubsendpostRunID *uint `json:"subsendpost_run_id"`
+	// Decision made on the approval stage with the comment and the time the approval expires at
+	Decision        *value.ApprovalDecision `json:"decision"`
+	DecisionComment *string                 `json:"decision_comment"`
+	DecidedAt       *time.Time              `json:"decided_at"`
+	ExpiresAt       *time.Time              `json:"expires_at"`
+	// WakeAt is the time the wait stage finishes waiting
+	WakeAt *time.Time `json:"wake_at"`
+	// Result is the output of the completed flow run, referenced by the parameters of the next stages as stages.<stage_id>.result.<key>
+	Result *value.JSONB `json:"result"`
+}
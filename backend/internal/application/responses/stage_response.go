@@ -5,12 +5,29 @@ import (
 )
 
 type StageDetailed struct {
-	ID              uint            `json:"id" validate:"required"`
-	Type            value.StageType `json:"type" validate:"required"`
-	State           value.StateType `json:"state" validate:"required"`
-	ParentStageID   *uint           `json:"parent_stage_id"`
-	DeploymentID    string          `json:"deployment_id" validate:"required"`
-	StageParameters *value.JSONB    `json:"stage_parameters"`
+	ID              uint                `json:"id" validate:"required"`
+	Type            value.StageType     `json:"type" validate:"required"`
+	State           value.StateType     `json:"state" validate:"required"`
+	ParentStageID   *uint               `json:"parent_stage_id"`
+	DeploymentID    string              `json:"deployment_id" validate:"required"`
+	StageParameters *value.JSONB        `json:"stage_parameters"`
+	MaxRetries      int                 `json:"max_retries"`
+	RetryDelay      int                 `json:"retry_delay"`
+	RetryOn         []value.StateType   `json:"retry_on"`
+	Timeout         int                 `json:"timeout"`
+	Condition       *string             `json:"condition"`
+	AlwaysRun       bool                `json:"always_run"`
+	MaxConcurrency  int                 `json:"max_concurrency"`
+	FailurePolicy   value.FailurePolicy `json:"failure_policy"`
+	MinSuccess      int                 `json:"min_success"`
+	AllowedFailures int                 `json:"allowed_failures"`
+	MapOver         string              `json:"map_over"`
+	MapKey          string              `json:"map_key"`
+	SubsendpostID   *uint               `json:"subsendpost_id"`
+	ApprovalTimeout int                 `json:"approval_timeout"`
+	WaitDuration    int                 `json:"wait_duration"`
+	WaitUntil       string              `json:"wait_until"`
+	WaitTimezone    string              `json:"wait_timezone"`
 }
 
 type SendpostStages []*Stage
@@ -21,3 +38,23 @@ type Stage struct {
 	State     value.StateType `json:"state" validate:"required"`
 	IsBlocked bool            `json:"is_blocked" validate:"required"`
 }
+
+type StageGraph struct {
+	Stages []*GraphStage `json:"stages" validate:"required"`
+	Edges  []*GraphEdge  `json:"edges" validate:"required"`
+}
+
+type GraphStage struct {
+	ID        uint            `json:"id" validate:"required"`
+	Type      value.StageType `json:"type" validate:"required"`
+	State     value.StateType `json:"state" validate:"required"`
+	IsBlocked bool            `json:"is_blocked" validate:"required"`
+	AlwaysRun bool            `json:"always_run" validate:"required"`
+	DependsOn []uint          `json:"depends_on" validate:"required"`
+}
+
+// GraphEdge means the stage To depends on the stage From
+type GraphEdge struct {
+	From uint `json:"from" validate:"required"`
+	To   uint `json:"to" validate:"required"`
+}
@@ -0,0 +1,18 @@
+package responses
+
+// ValidationErrors are the parameters not matching the schema of the parameters of the deployment
+type ValidationErrors struct {
+	Error  string        `json:"error" validate:"required"`
+	Errors []*FieldError `json:"errors" validate:"required"`
+}
+
+type FieldError struct {
+	// Field is the path to the parameter, e.g. stage_parameters.limit or stages.12.segment
+	Field   string `json:"field" validate:"required"`
+	Message string `json:"message" validate:"required"`
+}
+
+type SendpostValidation struct {
+	Valid  bool          `json:"valid"`
+	Errors []*FieldError `json:"errors" validate:"required"`
+}
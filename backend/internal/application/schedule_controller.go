@@ -0,0 +1,234 @@
+package application
+
+import (
+	"crm-uplift-ii24-backend/internal/application/requests"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/services"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	ErrorCreateSchedule string = "[Schedule controller] Error CreateSchedule"
+	ErrorGetSchedules   string = "[Schedule controller] Error GetSchedules"
+	ErrorGetSchedule    string = "[Schedule controller] Error GetSchedule"
+	ErrorUpdateSchedule string = "[Schedule controller] Error UpdateSchedule"
+	ErrorDeleteSchedule string = "[Schedule controller] Error DeleteSchedule"
+)
+
+type ScheduleController struct {
+	scheduleService  *services.ScheduleService
+	schedulerService *services.SendpostSchedulerService
+}
+
+func NewScheduleController(scheduleService *services.ScheduleService, schedulerService *services.SendpostSchedulerService) *ScheduleController {
+	return &ScheduleController{scheduleService: scheduleService, schedulerService: schedulerService}
+}
+
+//	@Summary		Create a sendpost schedule
+//	@Description	Creates a schedule which runs the sendpost automatically.
+//	@Description	Either `planned_at` (single run) or `cron_expression` (recurring runs) must be provided.
+//	@Description	`cron_expression` has 5 fields `minute hour day-of-month month day-of-week` or one of `@hourly|@daily|@weekly|@monthly|@yearly`.
+//	@Description	`timezone` is an IANA timezone the cron expression is evaluated in, `UTC` by default.
+//	@ID				CreateSchedule
+//	@Tags			Schedule
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int					true	"Sendpost ID"
+//	@Param			request		body		requests.Schedule	true	"Schedule"
+//	@Success		201			{object}	responses.Schedule	"Successfully created"
+//	@Failure		400			{string}	string				"Invalid request body"
+//	@Failure		500			{string}	string				"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/schedules [post]
+func (sc *ScheduleController) CreateSchedule(ctx *gin.Context) {
+	logging.Info("[Schedule controller] CreateSchedule request")
+
+	idStr := ctx.Param("sendpost_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logging.Warn(ErrorCreateSchedule, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	var request requests.Schedule
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		logging.Warn(ErrorCreateSchedule, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidRequestBodyErr)
+		return
+	}
+
+	logging.Debug("[Schedule controller] CreateSchedule", zap.Int("sendpost_id", id), zap.Any("request", request))
+
+	schedule, err := sc.schedulerService.CreateSchedule(ctx, uint(id), request.PlannedAt, request.CronExpression, request.Timezone)
+	if err != nil {
+		logging.Warn(ErrorCreateSchedule, zap.Error(err))
+		if errors.Is(err, entity.ErrInvalidSchedule) {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	ctx.JSON(http.StatusCreated, mapSchedule(schedule))
+}
+
+//	@Summary		Get sendpost schedules
+//	@Description	Get all schedules of the sendpost.
+//	@ID				GetSchedules
+//	@Tags			Schedule
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int					true	"Sendpost ID"
+//	@Success		200			{object}	responses.Schedules	"Successfully retrieved schedules"
+//	@Failure		400			{string}	string				"Invalid ID format"
+//	@Failure		500			{string}	string				"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/schedules [get]
+func (sc *ScheduleController) GetSchedules(ctx *gin.Context) {
+	logging.Info("[Schedule controller] GetSchedules request")
+
+	idStr := ctx.Param("sendpost_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logging.Warn(ErrorGetSchedules, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	logging.Debug("[Schedule controller] GetSchedules", zap.Int("sendpost_id", id))
+
+	schedules, err := sc.scheduleService.GetSchedules(ctx, uint(id))
+	if err != nil {
+		logging.Warn(ErrorGetSchedules, zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	ctx.JSON(http.StatusOK, mapSchedules(schedules))
+}
+
+//	@Summary		Get sendpost schedule
+//	@Description	Get the schedule of the sendpost by its ID.
+//	@ID				GetSchedule
+//	@Tags			Schedule
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int					true	"Sendpost ID"
+//	@Param			schedule_id	path		int					true	"Schedule ID"
+//	@Success		200			{object}	responses.Schedule	"Successfully retrieved schedule"
+//	@Failure		400			{string}	string				"Invalid ID format"
+//	@Failure		404			{string}	string				"Schedule not found"
+//	@Router			/sendposts/{sendpost_id}/schedules/{schedule_id} [get]
+func (sc *ScheduleController) GetSchedule(ctx *gin.Context) {
+	logging.Info("[Schedule controller] GetSchedule request")
+
+	sendpostID, scheduleID, err := parseScheduleIDs(ctx)
+	if err != nil {
+		logging.Warn(ErrorGetSchedule, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	logging.Debug("[Schedule controller] GetSchedule", zap.Uint("sendpost_id", sendpostID), zap.Uint("schedule_id", scheduleID))
+
+	schedule, err := sc.scheduleService.GetSchedule(ctx, sendpostID, scheduleID)
+	if err != nil {
+		logging.Warn(ErrorGetSchedule, zap.Error(err))
+		ctx.JSON(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	ctx.JSON(http.StatusOK, mapSchedule(schedule))
+}
+
+//	@Summary		Update sendpost schedule
+//	@Description	Replaces the definition of the schedule. The pending run is rescheduled.
+//	@ID				UpdateSchedule
+//	@Tags			Schedule
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int					true	"Sendpost ID"
+//	@Param			schedule_id	path		int					true	"Schedule ID"
+//	@Param			request		body		requests.Schedule	true	"Schedule"
+//	@Success		200			{object}	responses.Schedule	"Successfully updated"
+//	@Failure		400			{string}	string				"Invalid request body"
+//	@Failure		500			{string}	string				"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/schedules/{schedule_id} [put]
+func (sc *ScheduleController) UpdateSchedule(ctx *gin.Context) {
+	logging.Info("[Schedule controller] UpdateSchedule request")
+
+	sendpostID, scheduleID, err := parseScheduleIDs(ctx)
+	if err != nil {
+		logging.Warn(ErrorUpdateSchedule, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	var request requests.Schedule
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		logging.Warn(ErrorUpdateSchedule, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidRequestBodyErr)
+		return
+	}
+
+	logging.Debug("[Schedule controller] UpdateSchedule", zap.Uint("schedule_id", scheduleID), zap.Any("request", request))
+
+	schedule, err := sc.schedulerService.ChangeSchedule(ctx, sendpostID, scheduleID, request.PlannedAt, request.CronExpression, request.Timezone)
+	if err != nil {
+		logging.Warn(ErrorUpdateSchedule, zap.Error(err))
+		if errors.Is(err, entity.ErrInvalidSchedule) {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	ctx.JSON(http.StatusOK, mapSchedule(schedule))
+}
+
+//	@Summary		Delete sendpost schedule
+//	@Description	Deletes the schedule, the pending run is cancelled.
+//	@ID				DeleteSchedule
+//	@Tags			Schedule
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int		true	"Sendpost ID"
+//	@Param			schedule_id	path		int		true	"Schedule ID"
+//	@Success		200			{string}	string	"Successfully deleted"
+//	@Failure		400			{string}	string	"Invalid ID format"
+//	@Failure		500			{string}	string	"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/schedules/{schedule_id} [delete]
+func (sc *ScheduleController) DeleteSchedule(ctx *gin.Context) {
+	logging.Info("[Schedule controller] DeleteSchedule request")
+
+	sendpostID, scheduleID, err := parseScheduleIDs(ctx)
+	if err != nil {
+		logging.Warn(ErrorDeleteSchedule, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	logging.Debug("[Schedule controller] DeleteSchedule", zap.Uint("schedule_id", scheduleID))
+
+	if err := sc.schedulerService.DeleteSchedule(ctx, sendpostID, scheduleID); err != nil {
+		logging.Warn(ErrorDeleteSchedule, zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	ctx.JSON(http.StatusOK, "Succesfully deleted")
+}
+
+func parseScheduleIDs(ctx *gin.Context) (sendpostID uint, scheduleID uint, err error) {
+	sendpostIdInt, err := strconv.Atoi(ctx.Param("sendpost_id"))
+	if err != nil {
+		return 0, 0, err
+	}
+	scheduleIdInt, err := strconv.Atoi(ctx.Param("schedule_id"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint(sendpostIdInt), uint(scheduleIdInt), nil
+}
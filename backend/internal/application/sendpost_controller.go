@@ -2,8 +2,10 @@ package application
 
 import (
 	"crm-uplift-ii24-backend/internal/application/requests"
+	"crm-uplift-ii24-backend/internal/domain/entity"
 	"crm-uplift-ii24-backend/internal/services"
 	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -26,7 +28,8 @@ func NewSendpostController(sendpostService *services.SendpostService) *SendpostC
 }
 
 // @Summary		Create a sendpost
-// @Description	Creates a new sendpost with the specified parameters
+// @Description	Creates a new sendpost with the specified parameters.
+// @Description	`max_duration` in seconds limits the whole run of the sendpost, the run exceeding it fails with the `TIMED_OUT` reason. 0 means no limit
 //
 // @ID				CreateSendpost
 //
@@ -50,8 +53,13 @@ func (s *SendpostController) CreateSendpost(ctx *gin.Context) {
 
 	logging.Debug("[Sendpost controller] CreateSendpost", zap.Any("request", request))
 
-	sendpost, err := s.sendpostService.CreateSendpost(ctx, request.SendpostName, request.Description, request.GlobalParameters)
+	sendpost, err := s.sendpostService.CreateSendpost(ctx, request.SendpostName, request.Description, request.GlobalParameters, request.MaxDuration)
 	if err != nil {
+		logging.Warn("[Sendpost controller] Error CreateSendpost", zap.Error(err))
+		if errors.Is(err, entity.ErrInvalidMaxDuration) {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
@@ -147,7 +155,8 @@ func (s *SendpostController) DeleteSendpost(ctx *gin.Context) {
 }
 
 // @Summary		Copy a sendpost
-// @Description	Copies a sendpost by its ID
+// @Description	Copies a sendpost by its ID.
+// @Description	The `max_duration` of the original sendpost is kept if it isn't provided
 //
 // @ID				CopySendpost
 //
@@ -178,9 +187,13 @@ func (s *SendpostController) CopySendpost(ctx *gin.Context) {
 		return
 	}
 
-	sendpost, err := s.sendpostService.CopySendpost(ctx, uint(id), request.SendpostName, request.Description, request.GlobalParameters)
+	sendpost, err := s.sendpostService.CopySendpost(ctx, uint(id), request.SendpostName, request.Description, request.GlobalParameters, request.MaxDuration)
 	if err != nil {
 		logging.Warn(ErrorCopySendpost, zap.Error(err))
+		if errors.Is(err, entity.ErrInvalidMaxDuration) {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
@@ -189,15 +202,18 @@ func (s *SendpostController) CopySendpost(ctx *gin.Context) {
 
 // @Summary		Add or update sendpost parameters
 // @Description	Add or update sendpost parameters by its ID
+// @Description	The parameters are validated against the OpenAPI schemas of the parameters of the deployments of the stages
+// @Description	declaring them, the mismatches are returned per field with 422 and no parameter is updated then.
 //
 // @ID				AddUpdateSendpostParameters
 //
 // @Tags			Sendpost
-// @Param			sendpost_id	path		int					true	"Sendpost ID"
-// @Param			request		body		requests.Parameters	true	"Sendpost parameters"
-// @Success		200			{string}	string				"Successfully added or updated"
-// @Failure		400			{string}	string				"Invalid ID"
-// @Failure		500			{string}	string				"Internal server error"
+// @Param			sendpost_id	path		int							true	"Sendpost ID"
+// @Param			request		body		requests.Parameters			true	"Sendpost parameters"
+// @Success		200			{string}	string						"Successfully added or updated"
+// @Failure		400			{string}	string						"Invalid ID"
+// @Failure		422			{object}	responses.ValidationErrors	"Parameters don't match the deployment schema"
+// @Failure		500			{string}	string						"Internal server error"
 // @Router			/sendposts/{sendpost_id}/parameters [post]
 func (s *SendpostController) AddUpdateSendpostParameters(ctx *gin.Context) {
 	logging.Info("[Sendpost controller] AddUpdateSendpostParameters request")
@@ -217,6 +233,15 @@ func (s *SendpostController) AddUpdateSendpostParameters(ctx *gin.Context) {
 		return
 	}
 	logging.Debug("[Sendpost controller] AddUpdateSendpostParameters", zap.Any("sendpost_id", id), zap.Any("parameters", request.Parameters))
+	if err := s.sendpostService.ValidateSendpostParameters(ctx, uint(id), request.Parameters); err != nil {
+		logging.Warn(ErrorAddUpdateSendpostParameters, zap.Error(err))
+		if validationErr := validationErrors(err); validationErr != nil {
+			ctx.JSON(http.StatusUnprocessableEntity, validationErr)
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
 	for k, v := range request.Parameters {
 		if err := s.sendpostService.AddUpdateSendpostParameter(ctx, uint(id), k, v); err != nil {
 			logging.Warn(ErrorAddUpdateSendpostParameters, zap.Error(err))
@@ -0,0 +1,194 @@
+package application
+
+import (
+	"crm-uplift-ii24-backend/internal/application/requests"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/services"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	ErrorGetSendpostRuns string = "[SendpostRunController] Error GetSendpostRuns"
+	ErrorGetSendpostRun  string = "[SendpostRunController] Error GetSendpostRun"
+	ErrorApprove         string = "[SendpostRunController] Error Approve"
+	ErrorReject          string = "[SendpostRunController] Error Reject"
+)
+
+type SendpostRunController struct {
+	runHistoryService *services.RunHistoryService
+	approvalService   *services.ApprovalService
+}
+
+func NewSendpostRunController(runHistoryService *services.RunHistoryService, approvalService *services.ApprovalService) *SendpostRunController {
+	return &SendpostRunController{runHistoryService: runHistoryService, approvalService: approvalService}
+}
+
+//	@Summary		Get sendpost runs
+//	@Description	Get the history of the sendpost runs from the latest to the oldest.
+//	@ID				GetSendpostRuns
+//	@Tags			Sendpost Run
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int						true	"Sendpost ID"
+//	@Success		200			{object}	responses.SendpostRuns	"Successfully retrieved runs"
+//	@Failure		400			{string}	string					"Invalid ID format"
+//	@Failure		500			{string}	string					"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/runs [get]
+func (c *SendpostRunController) GetSendpostRuns(ctx *gin.Context) {
+	logging.Info("[SendpostRunController] GetSendpostRuns request")
+
+	idStr := ctx.Param("sendpost_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logging.Warn(ErrorGetSendpostRuns, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	logging.Debug("[SendpostRunController] GetSendpostRuns", zap.Int("sendpost_id", id))
+
+	runs, err := c.runHistoryService.GetSendpostRuns(ctx, uint(id))
+	if err != nil {
+		logging.Warn(ErrorGetSendpostRuns, zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	ctx.JSON(http.StatusOK, mapSendpostRuns(runs))
+}
+
+//	@Summary		Get sendpost run
+//	@Description	Get the sendpost run with the state, parameters, flow run ID and error of every executed stage.
+//	@ID				GetSendpostRun
+//	@Tags			Sendpost Run
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int								true	"Sendpost ID"
+//	@Param			run_id		path		int								true	"Run ID"
+//	@Success		200			{object}	responses.SendpostRunDetailed	"Successfully retrieved run"
+//	@Failure		400			{string}	string							"Invalid ID format"
+//	@Failure		404			{string}	string							"Run not found"
+//	@Router			/sendposts/{sendpost_id}/runs/{run_id} [get]
+func (c *SendpostRunController) GetSendpostRun(ctx *gin.Context) {
+	logging.Info("[SendpostRunController] GetSendpostRun request")
+
+	sendpostIdStr := ctx.Param("sendpost_id")
+	sendpostId, err := strconv.Atoi(sendpostIdStr)
+	if err != nil {
+		logging.Warn(ErrorGetSendpostRun, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	runIdStr := ctx.Param("run_id")
+	runId, err := strconv.Atoi(runIdStr)
+	if err != nil {
+		logging.Warn(ErrorGetSendpostRun, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	logging.Debug("[SendpostRunController] GetSendpostRun", zap.Int("sendpost_id", sendpostId), zap.Int("run_id", runId))
+
+	run, err := c.runHistoryService.GetSendpostRun(ctx, uint(sendpostId), uint(runId))
+	if err != nil {
+		logging.Warn(ErrorGetSendpostRun, zap.Error(err))
+		ctx.JSON(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+	ctx.JSON(http.StatusOK, mapSendpostRunDetailed(run))
+}
+
+//	@Summary		Approve the stage of a sendpost run
+//	@Description	Approves the `APPROVAL` stage the run is paused on, the run continues with the next stages.
+//	@Description	`stage_id` is required only if several stages of the run are awaiting approval.
+//	@Description	The stage couldn't be approved after its `approval_timeout` expired.
+//	@ID				ApproveSendpostRun
+//	@Tags			Sendpost Run
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int					true	"Sendpost ID"
+//	@Param			run_id		path		int					true	"Run ID"
+//	@Param			request		body		requests.Approval	false	"Comment of the decision"
+//	@Success		200			{object}	responses.StageRun	"Stage approved"
+//	@Failure		400			{string}	string				"Invalid ID format"
+//	@Failure		404			{string}	string				"Run not found"
+//	@Failure		409			{string}	string				"No stage of the run is awaiting approval"
+//	@Failure		500			{string}	string				"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/runs/{run_id}/approve [post]
+func (c *SendpostRunController) Approve(ctx *gin.Context) {
+	logging.Info("[SendpostRunController] Approve request")
+	c.decide(ctx, value.Approved, ErrorApprove)
+}
+
+//	@Summary		Reject the stage of a sendpost run
+//	@Description	Rejects the `APPROVAL` stage the run is paused on, the stage fails with the `REJECTED` reason
+//	@Description	and the comment as the error, the on-failure stages are executed.
+//	@Description	`stage_id` is required only if several stages of the run are awaiting approval.
+//	@ID				RejectSendpostRun
+//	@Tags			Sendpost Run
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int					true	"Sendpost ID"
+//	@Param			run_id		path		int					true	"Run ID"
+//	@Param			request		body		requests.Approval	false	"Comment of the decision"
+//	@Success		200			{object}	responses.StageRun	"Stage rejected"
+//	@Failure		400			{string}	string				"Invalid ID format"
+//	@Failure		404			{string}	string				"Run not found"
+//	@Failure		409			{string}	string				"No stage of the run is awaiting approval"
+//	@Failure		500			{string}	string				"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/runs/{run_id}/reject [post]
+func (c *SendpostRunController) Reject(ctx *gin.Context) {
+	logging.Info("[SendpostRunController] Reject request")
+	c.decide(ctx, value.Rejected, ErrorReject)
+}
+
+// decide records the decision on the stage of the run awaiting approval.
+func (c *SendpostRunController) decide(ctx *gin.Context, decision value.ApprovalDecision, errorPrefix string) {
+	sendpostId, err := strconv.Atoi(ctx.Param("sendpost_id"))
+	if err != nil {
+		logging.Warn(errorPrefix, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+	runId, err := strconv.Atoi(ctx.Param("run_id"))
+	if err != nil {
+		logging.Warn(errorPrefix, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	// Комментарий необязателен, запрос может быть без тела
+	var request requests.Approval
+	if err := ctx.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		logging.Warn(errorPrefix, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidRequestBodyErr)
+		return
+	}
+
+	logging.Debug("[SendpostRunController] decide", zap.Int("sendpost_id", sendpostId), zap.Int("run_id", runId), zap.String("decision", string(decision)), zap.Any("request", request))
+
+	stageRun, err := c.approvalService.Decide(ctx, uint(sendpostId), uint(runId), request.StageID, decision, request.Comment)
+	if err != nil {
+		logging.Warn(errorPrefix, zap.Error(err))
+		switch {
+		case errors.Is(err, services.ErrRunNotFound):
+			ctx.JSON(http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		case errors.Is(err, entity.ErrApprovalNotPending):
+			ctx.JSON(http.StatusConflict, err.Error())
+		case errors.Is(err, services.ErrApprovalStageRequired):
+			ctx.JSON(http.StatusBadRequest, err.Error())
+		default:
+			ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		return
+	}
+	ctx.JSON(http.StatusOK, mapStageRun(stageRun))
+}
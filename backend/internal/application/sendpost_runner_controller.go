@@ -1,8 +1,11 @@
 package application
 
 import (
+	"crm-uplift-ii24-backend/internal/application/requests"
 	"crm-uplift-ii24-backend/internal/services"
 	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -11,7 +14,10 @@ import (
 )
 
 const (
-	ErrorRunningSendpost = "[Sendpost Runner Controller] Error running sendpost"
+	ErrorRunningSendpost    = "[Sendpost Runner Controller] Error running sendpost"
+	ErrorCancellingSendpost = "[Sendpost Runner Controller] Error cancelling sendpost"
+	ErrorRenderParameters   = "[Sendpost Runner Controller] Error rendering parameters"
+	ErrorValidateSendpost   = "[Sendpost Runner Controller] Error validating sendpost"
 )
 
 type SendpostRunnerController struct {
@@ -23,14 +29,31 @@ func NewSendpostRunnerController(sendpostRunnerService *services.SendpostRunnerS
 }
 
 //	@Summary		Start the sendpost
-//	@Description	Start the sendpost
+//	@Description	Start the sendpost.
+//	@Description	`from=failed` resumes the last failed or cancelled run: the stages and sub-stages completed there are not executed again.
+//	@Description	`from_stage` starts the run from the given top level stage, the previous stages completed in the last run are reused, the others are skipped.
+//	@Description	Only one run of the sendpost may be active at a time. If the sendpost is running, 409 is returned,
+//	@Description	or with `queue=true` the run is queued and starts when the active run is finished.
+//	@Description	The run doesn't depend on the request: on shutdown it's interrupted and keeps its state, the flow runs aren't cancelled.
+//	@Description	The optional body overrides the global parameters (`parameters`) and the parameters of the stages by the stage ID
+//	@Description	(`stage_parameters`) only within the run, they are recorded in the run history. The overridden parameters must be declared
+//	@Description	by the deployment or the stage, or by the sendpost for the global ones, and match the OpenAPI schema of the parameters of the deployment,
+//	@Description	otherwise the mismatches are returned per field with 422.
+//	@Description	The resumed run without the body keeps the overrides of the run it continues.
 //	@Tags			Sendpost Runner
 //	@Accept			json
 //	@Produce		json
-//	@Param			sendpost_id	path		int		true	"Sendpost ID"
-//	@Success		202			{object}	string	"Accepted"
-//	@Failure		400			{object}	string	"Invalid ID"
+//	@Param			sendpost_id	path		int						true	"Sendpost ID"
+//	@Param			from		query		string					false	"Resume mode"	Enums(failed)
+//	@Param			from_stage	query		int						false	"Stage ID to start from, can't be used with from"
+//	@Param			queue		query		bool					false	"Queue the run if the sendpost is running"
+//	@Param			request		body		requests.RunSendpost	false	"Parameter overrides of the run"
+//	@Success		202			{object}	string					"Accepted or Queued"
+//	@Failure		400			{object}	string					"Invalid ID, query or request body"
+//	@Failure		422			{object}	responses.ValidationErrors	"Parameter overrides don't match the stages"
+//	@Failure		409			{object}	string	"The sendpost is already running or the last run hasn't failed"
 //	@Failure		500			{object}	string	"Internal server error"
+//	@Failure		503			{object}	string	"The server is shutting down"
 //	@Router			/sendposts/{sendpost_id}/run [post]
 func (c *SendpostRunnerController) Start(ctx *gin.Context) {
 	logging.Info("[Sendpost Runner Controller] Start request")
@@ -43,7 +66,202 @@ func (c *SendpostRunnerController) Start(ctx *gin.Context) {
 		return
 	}
 
-	c.sendpostRunnerService.Start(ctx, uint(id))
+	var opts services.RunOptions
+	switch from := ctx.Query("from"); from {
+	case "":
+	case "failed":
+		opts.FromFailed = true
+	default:
+		logging.Warn(ErrorRunningSendpost, zap.String("from", from))
+		ctx.JSON(http.StatusBadRequest, InvalidQueryErr)
+		return
+	}
+	if fromStage := ctx.Query("from_stage"); fromStage != "" {
+		if opts.FromFailed {
+			logging.Warn(ErrorRunningSendpost, zap.String("from_stage", fromStage))
+			ctx.JSON(http.StatusBadRequest, InvalidQueryErr)
+			return
+		}
+		stageID, err := strconv.Atoi(fromStage)
+		if err != nil {
+			logging.Warn(ErrorRunningSendpost, zap.Error(err))
+			ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+			return
+		}
+		stageIDUint := uint(stageID)
+		opts.FromStageID = &stageIDUint
+	}
+	if queue := ctx.Query("queue"); queue != "" {
+		opts.QueueIfRunning, err = strconv.ParseBool(queue)
+		if err != nil {
+			logging.Warn(ErrorRunningSendpost, zap.Error(err))
+			ctx.JSON(http.StatusBadRequest, InvalidQueryErr)
+			return
+		}
+	}
+
+	// Переопределения необязательны, запрос может быть без тела
+	var request requests.RunSendpost
+	if err := ctx.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		logging.Warn(ErrorRunningSendpost, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidRequestBodyErr)
+		return
+	}
+	opts.Parameters = request.Parameters
+	opts.StageParameters = request.StageParameters
+
+	queued, err := c.sendpostRunnerService.Start(ctx, uint(id), opts)
+	if err != nil {
+		logging.Warn(ErrorRunningSendpost, zap.Error(err))
+		switch {
+		case errors.Is(err, services.ErrInvalidOverrides):
+			ctx.JSON(http.StatusUnprocessableEntity, validationErrors(err))
+		case errors.Is(err, services.ErrSendpostAlreadyRunning),
+			errors.Is(err, services.ErrRunAlreadyQueued),
+			errors.Is(err, services.ErrNothingToResume):
+			ctx.JSON(http.StatusConflict, err.Error())
+		case errors.Is(err, services.ErrInvalidFromStage):
+			ctx.JSON(http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrServerShuttingDown):
+			ctx.JSON(http.StatusServiceUnavailable, err.Error())
+		default:
+			ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		return
+	}
+	if queued {
+		ctx.JSON(http.StatusAccepted, "Queued")
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, "Accepted")
+}
+
+//	@Summary		Cancel the sendpost run
+//	@Description	Cancel the active run of the sendpost.
+//	@Description	The flow runs in flight are set to CANCELLING in Prefect, the sendpost and its running stages are marked CANCELLED.
+//	@Tags			Sendpost Runner
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int		true	"Sendpost ID"
+//	@Success		202			{object}	string	"Accepted"
+//	@Failure		400			{object}	string	"Invalid ID"
+//	@Failure		409			{object}	string	"Sendpost isn't running"
+//	@Failure		500			{object}	string	"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/cancel [post]
+func (c *SendpostRunnerController) Cancel(ctx *gin.Context) {
+	logging.Info("[Sendpost Runner Controller] Cancel request")
+
+	idStr := ctx.Param("sendpost_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logging.Warn(ErrorCancellingSendpost, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	if err := c.sendpostRunnerService.Cancel(ctx, uint(id)); err != nil {
+		logging.Warn(ErrorCancellingSendpost, zap.Error(err))
+		if errors.Is(err, services.ErrSendpostNotRunning) {
+			ctx.JSON(http.StatusConflict, err.Error())
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
 
 	ctx.JSON(http.StatusAccepted, "Accepted")
 }
+
+//	@Summary		Render the parameters of the sendpost
+//	@Description	Resolves the parameters of the stages without running anything and returns the values every stage would be executed with,
+//	@Description	including the sub-stages of the parallel stages and the on-failure stages, and the layer every value was taken from.
+//	@Description	The layers in the order of increasing priority: DEPLOYMENT (the defaults of the deployment), STAGE, PARENT (the parallel stage),
+//	@Description	GLOBAL (the global parameters of the sendpost), RUN (the overrides of the run). The parameters are declared by the deployment
+//	@Description	and the stage, the upper layers only override their values.
+//	@Description	The expressions are in double braces, e.g. `run.started_at | date "2006-01-02"` or `today | add_days -1`, with the variables
+//	@Description	`run.id`, `run.started_at`, `sendpost.id`, `sendpost.name`, `env`, `today`, `now` (in the configured timezone), `stages.<stage_id>.result.<key>`
+//	@Description	and the filters `date`, `add_days`, `tz`.
+//	@Description	With `run_id` the parameters are rendered for the run, otherwise for the run which would be started now:
+//	@Description	`run.id` is 0 and the outputs of the stages aren't available. The error of resolving is returned per stage.
+//	@ID				RenderSendpostParameters
+//	@Tags			Sendpost Runner
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int							true	"Sendpost ID"
+//	@Param			request		body		requests.RenderParameters	false	"Run to render the parameters for"
+//	@Success		200			{object}	responses.RenderedParameters
+//	@Failure		400			{object}	string	"Invalid ID or request body"
+//	@Failure		404			{object}	string	"Sendpost or run not found"
+//	@Failure		500			{object}	string	"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/render-parameters [post]
+func (c *SendpostRunnerController) RenderParameters(ctx *gin.Context) {
+	logging.Info("[Sendpost Runner Controller] RenderParameters request")
+
+	id, err := strconv.Atoi(ctx.Param("sendpost_id"))
+	if err != nil {
+		logging.Warn(ErrorRenderParameters, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	// Запуск необязателен, запрос может быть без тела
+	var request requests.RenderParameters
+	if err := ctx.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		logging.Warn(ErrorRenderParameters, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidRequestBodyErr)
+		return
+	}
+
+	preview, err := c.sendpostRunnerService.PreviewParameters(ctx, uint(id), request.RunID)
+	if err != nil {
+		logging.Warn(ErrorRenderParameters, zap.Error(err))
+		switch {
+		case errors.Is(err, services.ErrSendpostNotFound), errors.Is(err, services.ErrRunNotFound):
+			ctx.JSON(http.StatusNotFound, err.Error())
+		default:
+			ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		}
+		return
+	}
+
+	ctx.JSON(http.StatusOK, mapParametersPreview(preview))
+}
+
+//	@Summary		Validate the sendpost
+//	@Description	Check the parameters every stage of the sendpost would be executed with before running it, including the sub-stages
+//	@Description	of the parallel stages and the on-failure stages. The parameters are resolved by the layers as for the run started now
+//	@Description	and validated against the OpenAPI schema of the parameters of the deployment: the types, the required parameters and the enums.
+//	@Description	The values with the expressions aren't checked, see render-parameters. The fields of the errors are `stages.<stage_id>.<parameter>`.
+//	@ID				ValidateSendpost
+//	@Tags			Sendpost Runner
+//	@Produce		json
+//	@Param			sendpost_id	path		int	true	"Sendpost ID"
+//	@Success		200			{object}	responses.SendpostValidation
+//	@Failure		400			{object}	string	"Invalid ID"
+//	@Failure		404			{object}	string	"Sendpost not found"
+//	@Failure		500			{object}	string	"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/validate [post]
+func (c *SendpostRunnerController) Validate(ctx *gin.Context) {
+	logging.Info("[Sendpost Runner Controller] Validate request")
+
+	id, err := strconv.Atoi(ctx.Param("sendpost_id"))
+	if err != nil {
+		logging.Warn(ErrorValidateSendpost, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	errs, err := c.sendpostRunnerService.Validate(ctx, uint(id))
+	if err != nil {
+		logging.Warn(ErrorValidateSendpost, zap.Error(err))
+		if errors.Is(err, services.ErrSendpostNotFound) {
+			ctx.JSON(http.StatusNotFound, err.Error())
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, mapSendpostValidation(errs))
+}
@@ -5,6 +5,7 @@ import (
 	"crm-uplift-ii24-backend/internal/domain/entity"
 	"crm-uplift-ii24-backend/internal/services"
 	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -18,6 +19,11 @@ const (
 	ErrorDeleteStage          string = "[Stage controller] Error DeleteStage"
 	ErrorGetStageDetailedInfo string = "[Stage controller] Error GetStageDetailedInfo"
 	ErrorGetSendpostStages    string = "[Stage controller] Error GetSendpostStages"
+	ErrorAddOnFailureStage    string = "[Stage controller] Error AddOnFailureStage"
+	ErrorGetOnFailureStages   string = "[Stage controller] Error GetOnFailureStages"
+	ErrorGetSendpostGraph     string = "[Stage controller] Error GetSendpostGraph"
+	ErrorAddStageDependency   string = "[Stage controller] Error AddStageDependency"
+	ErrorDeleteDependency     string = "[Stage controller] Error DeleteStageDependency"
 	ErrorBlockUnblock         string = "[Stage controller] Error BlockUnblock"
 	ErrorGetSubStages         string = "[Stage controller] Error GetSubStages"
 	ErrorGetStageParameters   string = "[Stage controller] Error GetStageParameters"
@@ -34,20 +40,43 @@ func NewStageController(stageService *services.StageService, executor entity.Sta
 }
 
 //	@Summary		Add a stage to a sendpost
-//	@Description	Adds a new stage to the specified sendpost.
-//	@Description	If `previous_stage_id` is provided adds stage after.
-//	@Description	If field `next_stage_id` in the previous_stage is not null changes `next_stage_id` in previous_stage on the new provided stage id.
-//	@Description	At the same time writes the new provided stage `next_stage_id` with previous_stage `next_stage_id` a.k.a this method allows insert stage between two stages.
-//	@Description	Field `type` could be `PARALLEL|SEQUENTIAL|OBSERVER`.
+//	@Description	Adds a new stage to the stage graph of the specified sendpost.
+//	@Description	If `previous_stage_id` is provided the stage depends on it and the stages which depended on the previous stage depend on the new one a.k.a this method allows insert stage between two stages.
+//	@Description	Otherwise the stages which don't depend on other stages depend on the new one, i.e. it becomes the first stage.
+//	@Description	If `depends_on` is provided instead, the stage depends on the given stages only and the other stages aren't changed.
+//	@Description	Field `type` could be `PARALLEL|SEQUENTIAL|OBSERVER|MAP|SUBSENDPOST|APPROVAL|WAIT`.
+//	@Description	The failed flow run is created again up to `max_retries` times if it finished in one of `retry_on` states (`FAILED`, `CRASHED` by default).
+//	@Description	`retry_delay` in seconds is doubled after every attempt up to an hour, `max_retries` is at most 10.
+//	@Description	`timeout` in seconds limits the execution of the stage including the retries, 0 means no limit.
+//	@Description	The stage exceeding it is failed with the `TIMED_OUT` reason and its flow run is cancelled.
+//	@Description	The stage with a `condition` is run only if the condition is true, otherwise it is recorded as `SKIPPED`.
+//	@Description	The condition is an [expr](https://expr-lang.org) expression which may use `params.<name>` (sendpost global parameters),
+//	@Description	`stages["<id>"].state`, `weekday` in the configured timezone and `previous.state` (the state of the stage it depends on,
+//	@Description	for several stages `COMPLETED` if all of them completed, otherwise `SKIPPED`),
+//	@Description	e.g. `previous.state == "COMPLETED" && weekday in ["Saturday", "Sunday"]`.
+//	@Description	The `always_run` stage is executed even if another stage of the run failed before it was started.
+//	@Description	`max_concurrency` of the parallel stage limits the number of its sub-stages executed at once, 0 means no limit. The queued sub-stages are `PENDING`.
+//	@Description	`failure_policy` of the parallel stage is `fail_fast` (default, the other sub-stages are cancelled as soon as the stage couldn't succeed) or `wait_all` (all the sub-stages are waited for).
+//	@Description	The parallel stage succeeds if at least `min_success` sub-stages completed or, if it is 0, not more than `allowed_failures` sub-stages failed.
+//	@Description	The `MAP` stage runs its deployment once per element of the list parameter `map_over` (the stage parameter or, if the stage doesn't have it, the global one),
+//	@Description	the element is passed as the `map_key` parameter. The flow runs are limited and failed the same way as the sub-stages of the parallel stage.
+//	@Description	The `SUBSENDPOST` stage doesn't need `deployment_id`, it runs the sendpost `subsendpost_id` as a nested run and succeeds if the nested run completed.
+//	@Description	The stage parameters override the global parameters of the nested sendpost. The sendpost couldn't run itself even through other sendposts.
+//	@Description	The `APPROVAL` stage doesn't need `deployment_id`, it pauses the run (`PAUSED`) until the stage is approved or rejected via the run endpoints.
+//	@Description	The approval expires after `approval_timeout` seconds, 0 means it doesn't expire. The rejected and expired stages fail.
+//	@Description	The `WAIT` stage doesn't need `deployment_id`, it waits for `wait_duration` seconds or until the nearest `wait_until` time (`HH:MM`) in `wait_timezone` (UTC by default).
+//	@Description	The stage parameters are validated against the OpenAPI schema of the parameters of the deployment (types, required parameters, enums),
+//	@Description	the values with the expressions aren't checked. The mismatches are returned per field with 422.
 //	@ID				AddStageToSendpost
 //	@Tags			Stage
 //	@Param			sendpost_id	path	int	true	"Sendpost ID"
 //	@Accept			json
 //	@Produce		json
 //	@Param			request	body		requests.Stage	true	"Stage creation data"
-//	@Success		201		{object}	responses.Stage	"Successfully added stage"
-//	@Failure		400		{string}	string			InvalidRequestBodyErr
-//	@Failure		500		{string}	string			"Internal server error"
+//	@Success		201		{object}	responses.Stage				"Successfully added stage"
+//	@Failure		400		{string}	string						InvalidRequestBodyErr
+//	@Failure		422		{object}	responses.ValidationErrors	"Parameters don't match the deployment schema"
+//	@Failure		500		{string}	string						"Internal server error"
 //	@Router			/sendposts/{sendpost_id}/stages [post]
 func (sc *StageController) AddStageToSendpost(ctx *gin.Context) {
 	logging.Info("[Stage controller] AddStageToSendpost request")
@@ -69,10 +98,33 @@ func (sc *StageController) AddStageToSendpost(ctx *gin.Context) {
 
 	logging.Debug("[Stage Controller] AddStageToSendpost", zap.Int("sendpost_id", id), zap.Any("request", request))
 
-	stage := unmarshalStage(uint(id), &request)
+	stage, err := unmarshalStage(uint(id), &request)
+	if err != nil {
+		logging.Warn(ErrorAddStageToSendpost, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
 
-	if err := sc.stageService.AddStage(ctx, stage, request.PreviousStageID); err != nil {
+	if len(request.DependsOn) > 0 {
+		if request.PreviousStageID != nil {
+			logging.Warn(ErrorAddStageToSendpost, zap.String("error", "previous_stage_id and depends_on are both set"))
+			ctx.JSON(http.StatusBadRequest, "previous_stage_id and depends_on couldn't be both set")
+			return
+		}
+		err = sc.stageService.AddStageWithDependencies(ctx, stage, request.DependsOn)
+	} else {
+		err = sc.stageService.AddStage(ctx, stage, request.PreviousStageID)
+	}
+	if err != nil {
 		logging.Warn(ErrorAddStageToSendpost, zap.Error(err))
+		if validationErr := validationErrors(err); validationErr != nil {
+			ctx.JSON(http.StatusUnprocessableEntity, validationErr)
+			return
+		}
+		if errors.Is(err, entity.ErrInvalidDependency) || errors.Is(err, entity.ErrInvalidSubsendpost) || errors.Is(err, entity.ErrSubsendpostCycle) {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
@@ -118,6 +170,10 @@ func (sc *StageController) GetSubStages(ctx *gin.Context) {
 //	@Description	Adds a sub-stage to an existing parent stage.
 //	@Description	The sub-stage will be linked to the parent and can have deployment parameters.
 //	@Description	Could only add sub-stage to PARALLEL stage type.
+//	@Description	The retry policy (`max_retries`, `retry_delay`, `retry_on`) is applied to the sub-stage the same way as to the stage.
+//	@Description	The `timeout` of the sub-stage doesn't stop the other sub-stages.
+//	@Description	The sub-stage may be a parallel stage with its own `max_concurrency`.
+//	@Description	The sub-stage couldn't have a `condition`, couldn't be `always_run` and couldn't be a MAP, SUBSENDPOST, APPROVAL or WAIT stage.
 //
 //	@ID				AddSubStage
 //
@@ -128,9 +184,10 @@ func (sc *StageController) GetSubStages(ctx *gin.Context) {
 //	@Accept			json
 //	@Produce		json
 //	@Param			request	body		requests.Stage	true	"Sub-stage creation data"
-//	@Success		201		{object}	responses.Stage	"Successfully added sub-stage"
-//	@Failure		400		{string}	string			InvalidRequestBodyErr
-//	@Failure		500		{string}	string			"Internal server error"
+//	@Success		201		{object}	responses.Stage				"Successfully added sub-stage"
+//	@Failure		400		{string}	string						InvalidRequestBodyErr
+//	@Failure		422		{object}	responses.ValidationErrors	"Parameters don't match the deployment schema"
+//	@Failure		500		{string}	string						"Internal server error"
 //	@Router			/sendposts/{sendpost_id}/stages/{stage_id}/sub-stages [post]
 func (sc *StageController) AddSubStage(ctx *gin.Context) {
 	logging.Info("[Stage controller] AddSubStage request")
@@ -160,9 +217,24 @@ func (sc *StageController) AddSubStage(ctx *gin.Context) {
 
 	logging.Debug("[Stage controller] AddSubStage", zap.Int("stage_id", stageId), zap.Any("request", request))
 
-	stage := unmarshalStage(uint(sendpostId), request)
+	stage, err := unmarshalStage(uint(sendpostId), request)
+	if err != nil {
+		logging.Warn(ErrorAddSubStage, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
 	if err := sc.stageService.AddSubStage(ctx, uint(stageId), stage); err != nil {
 		logging.Warn(ErrorAddSubStage, zap.Error(err))
+		if validationErr := validationErrors(err); validationErr != nil {
+			ctx.JSON(http.StatusUnprocessableEntity, validationErr)
+			return
+		}
+		if errors.Is(err, entity.ErrInvalidSubStage) || errors.Is(err, entity.ErrInvalidCondition) ||
+			errors.Is(err, entity.ErrInvalidMap) || errors.Is(err, entity.ErrInvalidSubsendpost) ||
+			errors.Is(err, entity.ErrInvalidApproval) || errors.Is(err, entity.ErrInvalidWait) {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
@@ -269,6 +341,233 @@ func (sc *StageController) GetSendpostStages(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, mapStages(stages))
 }
 
+//	@Summary		Add an on-failure stage to a sendpost
+//	@Description	Adds a new stage to the on-failure chain of the specified sendpost.
+//	@Description	The chain is executed after a stage of the run failed or timed out, before the following `always_run` stages of the run.
+//	@Description	The run stays `FAILED`. The cancelled run doesn't execute the chain, the cancellation of the run stops the chain as well.
+//	@Description	If `previous_stage_id` of the on-failure chain is provided adds stage after, otherwise as the first one.
+//	@Description	The stages declaring `failed_stage_id` and `failed_stage_error` parameters receive the ID and the error of the failed stage.
+//	@Description	The on-failure stages are managed by the stage endpoints the same way as the other stages.
+//	@ID				AddOnFailureStage
+//	@Tags			Stage
+//	@Param			sendpost_id	path	int	true	"Sendpost ID"
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		requests.Stage	true	"Stage creation data"
+//	@Success		201		{object}	responses.Stage				"Successfully added stage"
+//	@Failure		400		{string}	string						InvalidRequestBodyErr
+//	@Failure		422		{object}	responses.ValidationErrors	"Parameters don't match the deployment schema"
+//	@Failure		500		{string}	string						"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/on-failure-stages [post]
+func (sc *StageController) AddOnFailureStage(ctx *gin.Context) {
+	logging.Info("[Stage controller] AddOnFailureStage request")
+
+	idStr := ctx.Param("sendpost_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logging.Warn(ErrorAddOnFailureStage, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidRequestBodyErr)
+		return
+	}
+
+	var request requests.Stage
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		logging.Warn(ErrorAddOnFailureStage, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidRequestBodyErr)
+		return
+	}
+
+	logging.Debug("[Stage Controller] AddOnFailureStage", zap.Int("sendpost_id", id), zap.Any("request", request))
+
+	stage, err := unmarshalStage(uint(id), &request)
+	if err != nil {
+		logging.Warn(ErrorAddOnFailureStage, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := sc.stageService.AddOnFailureStage(ctx, stage, request.PreviousStageID); err != nil {
+		logging.Warn(ErrorAddOnFailureStage, zap.Error(err))
+		if validationErr := validationErrors(err); validationErr != nil {
+			ctx.JSON(http.StatusUnprocessableEntity, validationErr)
+			return
+		}
+		if errors.Is(err, entity.ErrInvalidSubsendpost) || errors.Is(err, entity.ErrSubsendpostCycle) {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	ctx.JSON(http.StatusCreated, mapStage(stage))
+}
+
+//	@Summary		Get on-failure stages of a sendpost
+//	@Description	Get the on-failure chain of a sendpost in the order of execution.
+//	@ID				GetOnFailureStages
+//	@Tags			Stage
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int							true	"Sendpost ID"
+//	@Success		200			{object}	responses.SendpostStages	"Successfully retrieved stages"
+//	@Failure		400			{string}	string						"Invalid ID format"
+//	@Failure		500			{string}	string						"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/on-failure-stages [get]
+func (sc *StageController) GetOnFailureStages(ctx *gin.Context) {
+	logging.Info("[Stage controller] GetOnFailureStages request")
+
+	idStr := ctx.Param("sendpost_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logging.Warn(ErrorGetOnFailureStages, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	stages, err := sc.stageService.GetOnFailureStages(ctx, uint(id))
+	if err != nil {
+		logging.Warn(ErrorGetOnFailureStages, zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	ctx.JSON(http.StatusOK, mapStages(stages))
+}
+
+//	@Summary		Get the stage graph of a sendpost
+//	@Description	Get the top level stages of a sendpost in the order of execution with the dependencies between them.
+//	@Description	A stage is run when all the stages it `depends_on` have completed, the independent stages are run concurrently.
+//	@Description	Every edge means the stage `to` depends on the stage `from`. The on-failure stages aren't included.
+//	@ID				GetSendpostGraph
+//	@Tags			Stage
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int						true	"Sendpost ID"
+//	@Success		200			{object}	responses.StageGraph	"Successfully retrieved graph"
+//	@Failure		400			{string}	string					"Invalid ID format"
+//	@Failure		500			{string}	string					"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/graph [get]
+func (sc *StageController) GetSendpostGraph(ctx *gin.Context) {
+	logging.Info("[Stage controller] GetSendpostGraph request")
+
+	idStr := ctx.Param("sendpost_id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		logging.Warn(ErrorGetSendpostGraph, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	graph, err := sc.stageService.GetSendpostGraph(ctx, uint(id))
+	if err != nil {
+		logging.Warn(ErrorGetSendpostGraph, zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	stages, err := graph.TopologicalOrder()
+	if err != nil {
+		logging.Warn(ErrorGetSendpostGraph, zap.Error(err))
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	ctx.JSON(http.StatusOK, mapStageGraph(graph, stages))
+}
+
+//	@Summary		Add a stage dependency
+//	@Description	Makes the stage depend on another top level stage of the same sendpost: the stage is run only after it has completed.
+//	@Description	Returns 400 if the dependency would form a cycle.
+//	@ID				AddStageDependency
+//	@Tags			Stage
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id	path		int							true	"Sendpost ID"
+//	@Param			stage_id	path		int							true	"Stage ID"
+//	@Param			request		body		requests.StageDependency	true	"Dependency"
+//	@Success		201			{string}	string						"Successfully added dependency"
+//	@Failure		400			{string}	string						"Invalid dependency"
+//	@Failure		500			{string}	string						"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/stages/{stage_id}/dependencies [post]
+func (sc *StageController) AddStageDependency(ctx *gin.Context) {
+	logging.Info("[Stage controller] AddStageDependency request")
+
+	sendpostID, err := strconv.Atoi(ctx.Param("sendpost_id"))
+	if err != nil {
+		logging.Warn(ErrorAddStageDependency, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+	stageID, err := strconv.Atoi(ctx.Param("stage_id"))
+	if err != nil {
+		logging.Warn(ErrorAddStageDependency, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	var request requests.StageDependency
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		logging.Warn(ErrorAddStageDependency, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidRequestBodyErr)
+		return
+	}
+
+	if err := sc.stageService.AddDependency(ctx, uint(sendpostID), uint(stageID), request.DependsOnStageID); err != nil {
+		logging.Warn(ErrorAddStageDependency, zap.Error(err))
+		if errors.Is(err, entity.ErrInvalidDependency) || errors.Is(err, entity.ErrDependencyCycle) {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	ctx.JSON(http.StatusCreated, "Successfully added dependency")
+}
+
+//	@Summary		Delete a stage dependency
+//	@Description	Removes the dependency of the stage on another stage.
+//	@ID				DeleteStageDependency
+//	@Tags			Stage
+//	@Accept			json
+//	@Produce		json
+//	@Param			sendpost_id			path		int		true	"Sendpost ID"
+//	@Param			stage_id			path		int		true	"Stage ID"
+//	@Param			depends_on_stage_id	path		int		true	"ID of the stage it depends on"
+//	@Success		200					{string}	string	"Successfully deleted dependency"
+//	@Failure		400					{string}	string	"Invalid dependency"
+//	@Failure		500					{string}	string	"Internal server error"
+//	@Router			/sendposts/{sendpost_id}/stages/{stage_id}/dependencies/{depends_on_stage_id} [delete]
+func (sc *StageController) DeleteStageDependency(ctx *gin.Context) {
+	logging.Info("[Stage controller] DeleteStageDependency request")
+
+	sendpostID, err := strconv.Atoi(ctx.Param("sendpost_id"))
+	if err != nil {
+		logging.Warn(ErrorDeleteDependency, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+	stageID, err := strconv.Atoi(ctx.Param("stage_id"))
+	if err != nil {
+		logging.Warn(ErrorDeleteDependency, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+	dependsOnStageID, err := strconv.Atoi(ctx.Param("depends_on_stage_id"))
+	if err != nil {
+		logging.Warn(ErrorDeleteDependency, zap.Error(err))
+		ctx.JSON(http.StatusBadRequest, InvalidIDErr)
+		return
+	}
+
+	if err := sc.stageService.RemoveDependency(ctx, uint(sendpostID), uint(stageID), uint(dependsOnStageID)); err != nil {
+		logging.Warn(ErrorDeleteDependency, zap.Error(err))
+		if errors.Is(err, entity.ErrInvalidDependency) {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	ctx.JSON(http.StatusOK, "Successfully deleted dependency")
+}
+
 //	@Summary		Block/Unblock a stage
 //	@Description	Block or unblock a stage by its ID.
 //	@ID				BlockUnblockStage
@@ -328,6 +627,7 @@ func (sc *StageController) GetStageParameters(ctx *gin.Context) {
 
 //	@Summary		Update stage parameters
 //	@Description	Update parameters of a stage by its ID.
+//	@Description	The parameters are validated against the OpenAPI schema of the parameters of the deployment, the mismatches are returned per field with 422.
 //	@ID				UpdateStageParameters
 //	@Tags			Stage
 //	@Accept			json
@@ -335,9 +635,10 @@ func (sc *StageController) GetStageParameters(ctx *gin.Context) {
 //	@Param			sendpost_id	path		int					true	"Sendpost ID"
 //	@Param			stage_id	path		int					true	"Stage ID"
 //	@Param			parameters	body		requests.Parameters	true	"Parameters"
-//	@Success		200			{string}	string				"Successfully updated parameters"
-//	@Failure		400			{string}	string				"Invalid ID format"
-//	@Failure		500			{string}	string				"Internal server error"
+//	@Success		200			{string}	string						"Successfully updated parameters"
+//	@Failure		400			{string}	string						"Invalid ID format"
+//	@Failure		422			{object}	responses.ValidationErrors	"Parameters don't match the deployment schema"
+//	@Failure		500			{string}	string						"Internal server error"
 //	@Router			/sendposts/{sendpost_id}/stages/{stage_id} [put]
 func (sc *StageController) UpdateParameters(ctx *gin.Context) {
 	logging.Info("[Stage controller] UpdateParameters request")
@@ -359,6 +660,10 @@ func (sc *StageController) UpdateParameters(ctx *gin.Context) {
 
 	if err := sc.stageService.UpdateParameters(ctx, uint(id), request.Parameters); err != nil {
 		logging.Warn(ErrorUpdateParameters, zap.Error(err))
+		if validationErr := validationErrors(err); validationErr != nil {
+			ctx.JSON(http.StatusUnprocessableEntity, validationErr)
+			return
+		}
 		ctx.JSON(http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
 		return
 	}
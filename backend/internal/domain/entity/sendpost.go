@@ -3,22 +3,30 @@ package entity
 import (
 	"crm-uplift-ii24-backend/internal/domain/value"
 	"errors"
+	"fmt"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+var ErrInvalidMaxDuration = errors.New("invalid max duration")
+
 type Sendpost struct {
 	gorm.Model
 	SendpostName string `gorm:"not null"`
 
 	Description *string
 
-	FirstStageID *uint
-	FirstStage   *Stage `gorm:"foreignkey:FirstStageID;references:ID;constraint:OnDelete:SET NULL;"`
+	// OnFailureStageID is the first stage of the chain executed after a stage of the run failed
+	OnFailureStageID *uint
+	OnFailureStage   *Stage `gorm:"foreignkey:OnFailureStageID;references:ID;constraint:OnDelete:SET NULL;"`
 
 	State value.StateType `gorm:"size:20;default:NEVERRUNNING;not null"`
 
 	GlobalParameters *value.JSONB `gorm:"type:jsonb"`
+
+	// MaxDuration in seconds limits the whole run of the sendpost, 0 means no limit
+	MaxDuration int `gorm:"default:0;not null"`
 }
 
 func (s *Sendpost) Update(sendpostName string, description *string, parameters *value.JSONB) error {
@@ -38,10 +46,30 @@ func (s *Sendpost) Update(sendpostName string, description *string, parameters *
 	return nil
 }
 
+// IsRunning reports whether the sendpost has an active run, the paused run is active too.
+func (s *Sendpost) IsRunning() bool {
+	return s.State == value.Running || s.State == value.Paused
+}
+
 func (s *Sendpost) Copy(NewName string, NewDescription *string) *Sendpost {
 	return &Sendpost{
 		SendpostName:     NewName,
 		Description:      NewDescription,
 		GlobalParameters: s.GlobalParameters,
+		MaxDuration:      s.MaxDuration,
+	}
+}
+
+// SetMaxDuration validates and sets the max duration of the run in seconds.
+func (s *Sendpost) SetMaxDuration(maxDuration int) error {
+	if maxDuration < 0 {
+		return fmt.Errorf("%w: max_duration mustn't be negative", ErrInvalidMaxDuration)
 	}
+	s.MaxDuration = maxDuration
+	return nil
+}
+
+// GetMaxDuration returns the max duration of the run, 0 if the run isn't limited.
+func (s *Sendpost) GetMaxDuration() time.Duration {
+	return time.Duration(s.MaxDuration) * time.Second
 }
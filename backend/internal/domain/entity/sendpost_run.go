@@ -0,0 +1,258 @@
+package entity
+
+import (
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SendpostRun is a single execution of a sendpost.
+// Unlike Sendpost.State it is never overwritten by the next run,
+// so it keeps the history of every attempt.
+type SendpostRun struct {
+	gorm.Model
+	SendpostID uint      `gorm:"not null;index"`
+	Sendpost   *Sendpost `gorm:"foreignKey:SendpostID;references:ID;constraint:OnDelete:CASCADE;"`
+
+	State value.StateType `gorm:"size:20;default:PENDING;not null"`
+
+	StartedAt   time.Time
+	CompletedAt *time.Time
+
+	Error *string
+	// Reason explains the failure when the state doesn't, e.g. the timeout
+	Reason *value.FailureReason `gorm:"size:20"`
+
+	// ResumedFromRunID is the run this run continues, nil if the run started from the first stage
+	ResumedFromRunID *uint
+
+	// ParentRunID is the run of the sendpost whose subsendpost stage started this run
+	ParentRunID *uint `gorm:"index"`
+	// Parameters override the global parameters of the sendpost within the run
+	Parameters *value.JSONB `gorm:"type:jsonb"`
+	// StageParameters override the parameters of the stages within the run by the stage ID
+	StageParameters *value.JSONB `gorm:"type:jsonb"`
+
+	StageRuns []*StageRun `gorm:"foreignKey:SendpostRunID;constraint:OnDelete:CASCADE;"`
+
+	// completedStageRuns are the stage runs of the resumed run by stage ID,
+	// the stages completed there aren't executed again
+	completedStageRuns map[uint]*StageRun
+
+	// injected are the values set by the backend within the run, e.g. the failed stage
+	// for the failure handling stages, they aren't saved
+	injected value.JSONB
+}
+
+func NewSendpostRun(sendpostID uint) *SendpostRun {
+	return &SendpostRun{
+		SendpostID: sendpostID,
+		State:      value.Running,
+		StartedAt:  time.Now(),
+	}
+}
+
+// Nest makes the run started by the subsendpost stage of the parent run.
+// The parameters override the global parameters of the sendpost within the run.
+func (r *SendpostRun) Nest(parentRunID *uint, parameters *value.JSONB) {
+	r.ParentRunID = parentRunID
+	r.Parameters = parameters
+}
+
+// GlobalParameters returns the global parameters of the sendpost with the overrides of the run applied.
+// The global parameters themselves aren't changed.
+func (r *SendpostRun) GlobalParameters(global *value.JSONB) *value.JSONB {
+	if r.Parameters == nil || len(*r.Parameters) == 0 {
+		return global
+	}
+	params := make(value.JSONB)
+	if global != nil {
+		for k, v := range *global {
+			params[k] = v
+		}
+	}
+	for k, v := range *r.Parameters {
+		params[k] = v
+	}
+	return &params
+}
+
+// Inject sets the values of the parameters for the stages executed further within the run.
+// The values override the parameters the stages declare and aren't saved.
+func (r *SendpostRun) Inject(params map[string]any) {
+	if r.injected == nil {
+		r.injected = make(value.JSONB)
+	}
+	for k, v := range params {
+		r.injected[k] = v
+	}
+}
+
+// OverrideStages sets the values overriding the parameters of the given stages within the run.
+func (r *SendpostRun) OverrideStages(stageParameters map[uint]value.JSONB) {
+	if len(stageParameters) == 0 {
+		return
+	}
+	params := make(value.JSONB, len(stageParameters))
+	for stageID, stageParams := range stageParameters {
+		// Значения хранятся так же, как читаются из базы
+		params[strconv.FormatUint(uint64(stageID), 10)] = map[string]interface{}(stageParams)
+	}
+	r.StageParameters = &params
+}
+
+// Overrides returns the values overriding the parameters of the stage within the run:
+// the parameters of the run, the parameters of the run for the stage and the injected values.
+func (r *SendpostRun) Overrides(stageID uint) *value.JSONB {
+	var stageParams map[string]interface{}
+	if r.StageParameters != nil {
+		stageParams, _ = (*r.StageParameters)[strconv.FormatUint(uint64(stageID), 10)].(map[string]interface{})
+	}
+	if len(stageParams) == 0 && len(r.injected) == 0 {
+		return r.Parameters
+	}
+	params := make(value.JSONB)
+	if r.Parameters != nil {
+		for k, v := range *r.Parameters {
+			params[k] = v
+		}
+	}
+	for k, v := range stageParams {
+		params[k] = v
+	}
+	for k, v := range r.injected {
+		params[k] = v
+	}
+	return &params
+}
+
+// Pause marks the run waiting for the approval of its stage.
+func (r *SendpostRun) Pause() {
+	r.State = value.Paused
+}
+
+// Resume marks the paused run as running again.
+func (r *SendpostRun) Resume() {
+	r.State = value.Running
+}
+
+// Complete sets the final state of the run.
+// The error is saved if the run is finished with it.
+func (r *SendpostRun) Complete(state value.StateType, err error) {
+	now := time.Now()
+	r.State = state
+	r.CompletedAt = &now
+	if err != nil {
+		msg := err.Error()
+		r.Error = &msg
+	}
+}
+
+// Fail marks the run as failed for the reason the state doesn't tell,
+// e.g. the run exceeded the max duration or was interrupted.
+func (r *SendpostRun) Fail(reason value.FailureReason, err error) {
+	r.Complete(value.Failed, err)
+	r.Reason = &reason
+}
+
+// IsResumable reports whether the run may be continued from the point it stopped.
+func (r *SendpostRun) IsResumable() bool {
+	return r.State == value.Failed || r.State == value.Cancelled
+}
+
+// ResumeFrom makes the run a continuation of the previous run.
+// The stages completed in the previous run won't be executed again.
+func (r *SendpostRun) ResumeFrom(previous *SendpostRun) {
+	r.ResumedFromRunID = &previous.ID
+	// Продолжение без своих переопределений выполняется с переопределениями предыдущего запуска
+	if r.Parameters == nil && r.StageParameters == nil {
+		r.Parameters = previous.Parameters
+		r.StageParameters = previous.StageParameters
+	}
+	r.completedStageRuns = make(map[uint]*StageRun)
+	for _, stageRun := range previous.StageRuns {
+		if stageRun.State != value.Completed {
+			continue
+		}
+		if existing, ok := r.completedStageRuns[stageRun.StageID]; !ok || existing.ID < stageRun.ID {
+			r.completedStageRuns[stageRun.StageID] = stageRun
+		}
+	}
+}
+
+// Recover makes the run interrupted by the restart continue from the point it stopped.
+// The stages the run completed itself won't be executed again.
+func (r *SendpostRun) Recover() {
+	r.completedStageRuns = make(map[uint]*StageRun)
+	for _, stageRun := range r.latestStageRuns() {
+		if stageRun.State == value.Completed {
+			r.completedStageRuns[stageRun.StageID] = stageRun
+		}
+	}
+}
+
+// InFlightStageRuns returns the latest records of the stages which
+// hadn't finished when the run was interrupted.
+func (r *SendpostRun) InFlightStageRuns() []*StageRun {
+	var inFlight []*StageRun
+	for _, stageRun := range r.latestStageRuns() {
+		if !stageRun.State.IsFinal() {
+			inFlight = append(inFlight, stageRun)
+		}
+	}
+	return inFlight
+}
+
+// AwaitingApprovalStageRuns returns the latest records of the approval stages
+// the decision could be made on at the given time.
+func (r *SendpostRun) AwaitingApprovalStageRuns(now time.Time) []*StageRun {
+	var awaiting []*StageRun
+	for _, stageRun := range r.latestStageRuns() {
+		if stageRun.IsAwaitingApproval(now) {
+			awaiting = append(awaiting, stageRun)
+		}
+	}
+	return awaiting
+}
+
+// latestStageRuns returns the latest record of every stage, e.g. the last retry attempt.
+func (r *SendpostRun) latestStageRuns() []*StageRun {
+	latest := make(map[uint]*StageRun)
+	var order []uint
+	for _, stageRun := range r.StageRuns {
+		existing, ok := latest[stageRun.StageID]
+		if !ok {
+			order = append(order, stageRun.StageID)
+		}
+		if !ok || existing.ID < stageRun.ID {
+			latest[stageRun.StageID] = stageRun
+		}
+	}
+	stageRuns := make([]*StageRun, 0, len(order))
+	for _, stageID := range order {
+		stageRuns = append(stageRuns, latest[stageID])
+	}
+	return stageRuns
+}
+
+// CompletedStageRun returns the stage run completed in the resumed run,
+// nil if the stage should be executed.
+func (r *SendpostRun) CompletedStageRun(stageID uint) *StageRun {
+	return r.completedStageRuns[stageID]
+}
+
+// StopResumingStages makes the given stages be executed
+// regardless of their results in the resumed run.
+func (r *SendpostRun) StopResumingStages(stageIDs map[uint]bool) {
+	for stageID := range stageIDs {
+		delete(r.completedStageRuns, stageID)
+	}
+}
+
+// StopResuming makes all the following stages be executed
+// regardless of their results in the resumed run.
+func (r *SendpostRun) StopResuming() {
+	r.completedStageRuns = nil
+}
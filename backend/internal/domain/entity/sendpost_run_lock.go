@@ -0,0 +1,14 @@
+package entity
+
+import "time"
+
+// SendpostRunLock is a lease which allows only one run of the sendpost at a time
+// across all the backend replicas. The lease is renewed while the run is active
+// and may be taken over by another owner once it's expired.
+type SendpostRunLock struct {
+	SendpostID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Owner      string `gorm:"size:255;not null"`
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSendpostRunOverrides(t *testing.T) {
+	run := NewSendpostRun(1)
+	run.Nest(nil, &value.JSONB{"date": "2024-01-01", "segment": "vip"})
+	run.OverrideStages(map[uint]value.JSONB{2: {"segment": "new"}})
+
+	assert.Equal(t, value.JSONB{"date": "2024-01-01", "segment": "vip"}, *run.Overrides(1))
+	assert.Equal(t, value.JSONB{"date": "2024-01-01", "segment": "new"}, *run.Overrides(2))
+
+	run.Inject(map[string]any{"segment": "failed"})
+	assert.Equal(t, value.JSONB{"date": "2024-01-01", "segment": "failed"}, *run.Overrides(2))
+
+	// продолжение без своих переопределений берёт их из предыдущего запуска
+	resumed := NewSendpostRun(1)
+	resumed.ResumeFrom(run)
+	assert.Equal(t, value.JSONB{"date": "2024-01-01", "segment": "new"}, *resumed.Overrides(2))
+}
@@ -1,18 +1,107 @@
 package entity
 
 import (
+	"crm-uplift-ii24-backend/pkg/cron"
+	"errors"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+const DefaultScheduleTimezone = "UTC"
+
+var ErrInvalidSchedule = errors.New("invalid schedule")
+
 type SendpostSchedule struct {
 	gorm.Model
 
 	SendpostID uint      `gorm:"not_null;index"`
 	Sendpost   *Sendpost `gorm:"foreignKey:SendpostID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;references:ID"`
 
+	// CronExpression makes the schedule recurring,
+	// PlannedAt is recalculated from it after every activation
+	CronExpression *string `gorm:"size:255"`
+	Timezone       string  `gorm:"size:64;default:UTC;not null"`
+
 	PlannedAt   time.Time
 	StartedAt   *time.Time
 	CompletedAt *time.Time
+	// SkippedAt is set when the schedule misfired and wasn't run
+	SkippedAt *time.Time
+}
+
+// IsRecurring reports whether the schedule is defined by a cron expression.
+func (s *SendpostSchedule) IsRecurring() bool {
+	return s.CronExpression != nil && *s.CronExpression != ""
+}
+
+// Location returns the timezone the cron expression is evaluated in.
+func (s *SendpostSchedule) Location() (*time.Location, error) {
+	if s.Timezone == "" {
+		s.Timezone = DefaultScheduleTimezone
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid timezone %q: %s", ErrInvalidSchedule, s.Timezone, err)
+	}
+	return loc, nil
+}
+
+// Update validates and sets the schedule definition.
+// Either plannedAt or cronExpression must be provided. For the recurring
+// schedule PlannedAt is set to the next activation time after now.
+func (s *SendpostSchedule) Update(plannedAt *time.Time, cronExpression *string, timezone string) error {
+	if plannedAt == nil && (cronExpression == nil || *cronExpression == "") {
+		return fmt.Errorf("%w: either planned_at or cron_expression must be provided", ErrInvalidSchedule)
+	}
+	s.CronExpression = cronExpression
+	s.Timezone = timezone
+	if _, err := s.Location(); err != nil {
+		return err
+	}
+	s.StartedAt = nil
+	s.CompletedAt = nil
+	s.SkippedAt = nil
+
+	if s.IsRecurring() {
+		return s.ScheduleNext(time.Now())
+	}
+	s.PlannedAt = *plannedAt
+	return nil
+}
+
+// ScheduleNext sets PlannedAt of the recurring schedule to the first activation
+// time after the given time and resets the start and completion times.
+func (s *SendpostSchedule) ScheduleNext(after time.Time) error {
+	if !s.IsRecurring() {
+		return fmt.Errorf("%w: schedule is not recurring", ErrInvalidSchedule)
+	}
+	schedule, err := cron.Parse(*s.CronExpression)
+	if err != nil {
+		return fmt.Errorf("%w: invalid cron expression: %s", ErrInvalidSchedule, err)
+	}
+	loc, err := s.Location()
+	if err != nil {
+		return err
+	}
+	next := schedule.Next(after.In(loc))
+	if next.IsZero() {
+		return fmt.Errorf("%w: cron expression %q never matches", ErrInvalidSchedule, *s.CronExpression)
+	}
+	s.PlannedAt = next
+	s.StartedAt = nil
+	s.CompletedAt = nil
+	s.SkippedAt = nil
+	return nil
+}
+
+// IsMisfired reports whether the planned time of the not yet started schedule has passed.
+func (s *SendpostSchedule) IsMisfired(now time.Time) bool {
+	return s.StartedAt == nil && s.PlannedAt.Before(now)
+}
+
+// Skip marks the schedule as skipped.
+func (s *SendpostSchedule) Skip(now time.Time) {
+	s.SkippedAt = &now
 }
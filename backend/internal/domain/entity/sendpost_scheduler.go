@@ -4,6 +4,6 @@ import "context"
 
 type SendpostScheduler interface {
 	AddSchedule(ctx context.Context, schedule SendpostSchedule)
-	RemoveSchedule(sendpostID uint)
+	RemoveSchedule(scheduleID uint)
 	GetQueue() <-chan SendpostSchedule
 }
@@ -2,11 +2,51 @@ package entity
 
 import (
 	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/condition"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidRetryPolicy = errors.New("invalid retry policy")
+	ErrInvalidTimeout     = errors.New("invalid timeout")
+	ErrInvalidCondition   = errors.New("invalid condition")
+	ErrInvalidConcurrency = errors.New("invalid max concurrency")
+	ErrInvalidPolicy      = errors.New("invalid failure policy")
+	ErrInvalidMap         = errors.New("invalid map stage")
+	ErrInvalidSubsendpost = errors.New("invalid subsendpost stage")
+	ErrSubsendpostCycle   = errors.New("subsendpost stages form a cycle")
+	ErrDeploymentRequired = errors.New("deployment_id is required")
+	ErrInvalidApproval    = errors.New("invalid approval stage")
+	ErrInvalidWait        = errors.New("invalid wait stage")
+	ErrInvalidSubStage    = errors.New("invalid sub-stage")
+)
+
+// conditionEnv is the sample of the values the stage condition may refer to
+var conditionEnv = map[string]any{
+	"params":   map[string]any{},
+	"stages":   map[string]any{},
+	"previous": map[string]any{},
+	"weekday":  "",
+}
+
+// waitUntilLayout is the format of the wall-clock time the wait stage waits until
+const waitUntilLayout = "15:04"
+
+// DefaultRetryOn are the flow run states the stage is retried on if retry_on isn't set
+var DefaultRetryOn = value.StateTypes{value.Failed, value.Crashed}
+
+const (
+	// MaxRetriesLimit is the upper limit of max_retries of the stage
+	MaxRetriesLimit = 10
+	// MaxRetryDelay caps the delay between the attempts doubled after every attempt
+	MaxRetryDelay = time.Hour
+)
+
 type Stage struct {
 	gorm.Model
 	SendpostID uint      `gorm:"not_null;index"`
@@ -26,16 +66,140 @@ type Stage struct {
 	SubStages     []*Stage `gorm:"foreignKey:ParentStageID;constraint:OnDelete:CASCADE;"`
 
 	IsBlocked bool `gorm:"default:false"`
+
+	// Retry policy: the failed flow run is created again up to MaxRetries times.
+	// RetryDelay in seconds is doubled after every attempt
+	MaxRetries int               `gorm:"default:0;not null"`
+	RetryDelay int               `gorm:"default:0;not null"`
+	RetryOn    *value.StateTypes `gorm:"type:jsonb"`
+
+	// Timeout in seconds limits the execution of the stage including the retries, 0 means no limit
+	Timeout int `gorm:"default:0;not null"`
+
+	// Condition is evaluated before the stage is run, the stage is skipped if it is false
+	Condition *string `gorm:"type:text"`
+
+	// AlwaysRun stage is executed even if a preceding stage of the run failed
+	AlwaysRun bool `gorm:"default:false;not null"`
+
+	// MaxConcurrency limits the number of the sub-stages of the parallel stage executed at once, 0 means no limit
+	MaxConcurrency int `gorm:"default:0;not null"`
+
+	// FailurePolicy of the parallel stage: the sub-stages are cancelled on the failure or waited for.
+	// The parallel stage succeeds if at least MinSuccess sub-stages completed or, if MinSuccess is 0,
+	// not more than AllowedFailures sub-stages failed
+	FailurePolicy   value.FailurePolicy `gorm:"size:20;default:fail_fast;not null"`
+	MinSuccess      int                 `gorm:"default:0;not null"`
+	AllowedFailures int                 `gorm:"default:0;not null"`
+
+	// MapOver is the name of the list parameter of the map stage, the stage parameter is taken before the global one.
+	// Every element of the list is passed to its own flow run as the MapKey parameter
+	MapOver string `gorm:"size:255"`
+	MapKey  string `gorm:"size:255"`
+
+	// SubsendpostID is the sendpost run by the subsendpost stage,
+	// the stage parameters override the global parameters of the sendpost within the run
+	SubsendpostID *uint `gorm:"index"`
+
+	// ApprovalTimeout in seconds is the time the approval stage waits for the decision,
+	// the approval expires after it. 0 means the stage waits until the run is cancelled
+	ApprovalTimeout int `gorm:"default:0;not null"`
+
+	// The wait stage waits for WaitDuration seconds or until the WaitUntil wall-clock time (HH:MM) in WaitTimezone
+	WaitDuration int    `gorm:"default:0;not null"`
+	WaitUntil    string `gorm:"size:5"`
+	WaitTimezone string `gorm:"size:64"`
+
+	// runParameters are the stage parameters with the expressions rendered for the current run, they aren't saved
+	runParameters *value.JSONB
 }
 
 func (s *Stage) IsParallel() bool {
 	return s.Type == value.ParallelStage
 }
 
+func (s *Stage) IsMap() bool {
+	return s.Type == value.MapStage
+}
+
+func (s *Stage) IsSubsendpost() bool {
+	return s.Type == value.SubsendpostStage
+}
+
+func (s *Stage) IsApproval() bool {
+	return s.Type == value.ApprovalStage
+}
+
+func (s *Stage) IsWait() bool {
+	return s.Type == value.WaitStage
+}
+
+// HasSubStages reports whether the stage is executed by its sub-stages.
+// The sub-stages of the map stage are created for the elements of the list when the stage is run.
+func (s *Stage) HasSubStages() bool {
+	return s.IsParallel() || s.IsMap()
+}
+
 func (s *Stage) UpdateState(state value.StateType) {
 	s.State = state
 }
 
+// SetRunParameters sets the parameters the stage is executed with in the current run.
+func (s *Stage) SetRunParameters(params *value.JSONB) {
+	s.runParameters = params
+}
+
+// RunParameters returns the parameters the stage is executed with in the current run,
+// the stage parameters if they haven't been rendered.
+func (s *Stage) RunParameters() *value.JSONB {
+	if s.runParameters != nil {
+		return s.runParameters
+	}
+	return s.StageParameters
+}
+
+// ResolvedParameters are the parameters the stage is executed with within the run
+// and the layer every value was taken from.
+type ResolvedParameters struct {
+	Parameters *value.JSONB
+	Sources    map[string]value.ParameterSource
+}
+
+// ResolveParameters layers the parameters of the stage in the order of increasing priority:
+// the defaults of the deployment, the stage parameters, the parameters of the parallel parent
+// or of the map parent within the run, the global parameters of the sendpost and the overrides of the run. The parameters are declared
+// by the deployment and the stage, the upper layers only override their values.
+// The stage parameters aren't changed, any layer may be nil.
+func (s *Stage) ResolveParameters(defaults, parent, global, overrides *value.JSONB) *ResolvedParameters {
+	if defaults == nil && s.StageParameters == nil {
+		return &ResolvedParameters{Sources: map[string]value.ParameterSource{}}
+	}
+	params := make(value.JSONB)
+	sources := make(map[string]value.ParameterSource)
+	for _, layer := range []struct {
+		source value.ParameterSource
+		params *value.JSONB
+	}{
+		{value.SourceDeployment, defaults},
+		{value.SourceStage, s.StageParameters},
+		{value.SourceParent, parent},
+		{value.SourceGlobal, global},
+		{value.SourceRun, overrides},
+	} {
+		if layer.params == nil {
+			continue
+		}
+		declares := layer.source == value.SourceDeployment || layer.source == value.SourceStage
+		for k, v := range *layer.params {
+			if _, ok := params[k]; ok || declares {
+				params[k] = v
+				sources[k] = layer.source
+			}
+		}
+	}
+	return &ResolvedParameters{Parameters: &params, Sources: sources}
+}
+
 func (s *Stage) UpdateNextStageID(nextStageID *uint) error {
 	if s.ParentStageID != nil {
 		return errors.New("parent stage id and next stage id couldn't both be fullfield")
@@ -51,5 +215,369 @@ func (s *Stage) Copy(newSendpostId uint) *Stage {
 		DeploymnentID:   s.DeploymnentID,
 		StageParameters: s.StageParameters,
 		IsBlocked:       s.IsBlocked,
+		MaxRetries:      s.MaxRetries,
+		RetryDelay:      s.RetryDelay,
+		RetryOn:         s.RetryOn,
+		Timeout:         s.Timeout,
+		Condition:       s.Condition,
+		AlwaysRun:       s.AlwaysRun,
+		MaxConcurrency:  s.MaxConcurrency,
+		FailurePolicy:   s.FailurePolicy,
+		MinSuccess:      s.MinSuccess,
+		AllowedFailures: s.AllowedFailures,
+		MapOver:         s.MapOver,
+		MapKey:          s.MapKey,
+		SubsendpostID:   s.SubsendpostID,
+		ApprovalTimeout: s.ApprovalTimeout,
+		WaitDuration:    s.WaitDuration,
+		WaitUntil:       s.WaitUntil,
+		WaitTimezone:    s.WaitTimezone,
+	}
+}
+
+// SetCondition validates and sets the condition of the stage.
+// An empty condition removes it.
+func (s *Stage) SetCondition(expr string) error {
+	if strings.TrimSpace(expr) == "" {
+		s.Condition = nil
+		return nil
+	}
+	if _, err := condition.Parse(expr, conditionEnv); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidCondition, err)
+	}
+	s.Condition = &expr
+	return nil
+}
+
+// ParseCondition compiles the condition of the stage. The condition may refer to
+// params, stages, previous and weekday, see SendpostRunnerService.evalCondition.
+func (s *Stage) ParseCondition() (*condition.Expression, error) {
+	return condition.Parse(*s.Condition, conditionEnv)
+}
+
+// ValidateSubStage checks the stage may be a sub-stage of the parallel stage: the condition and always_run
+// are taken into account only for the top level stages, and the map, subsendpost, approval
+// and wait stages aren't supported by the parallel stage runner.
+func (s *Stage) ValidateSubStage() error {
+	switch {
+	case s.HasCondition():
+		return fmt.Errorf("%w: sub-stages of parallel stages couldn't have a condition", ErrInvalidCondition)
+	case s.IsMap():
+		return fmt.Errorf("%w: sub-stages of parallel stages couldn't be map stages", ErrInvalidMap)
+	case s.IsSubsendpost():
+		return fmt.Errorf("%w: sub-stages of parallel stages couldn't be subsendpost stages", ErrInvalidSubsendpost)
+	case s.IsApproval():
+		return fmt.Errorf("%w: sub-stages of parallel stages couldn't be approval stages", ErrInvalidApproval)
+	case s.IsWait():
+		return fmt.Errorf("%w: sub-stages of parallel stages couldn't be wait stages", ErrInvalidWait)
+	case s.AlwaysRun:
+		return fmt.Errorf("%w: sub-stages of parallel stages couldn't be always run", ErrInvalidSubStage)
+	}
+	return nil
+}
+
+// HasCondition reports whether the stage is run only if its condition is true.
+func (s *Stage) HasCondition() bool {
+	return s.Condition != nil && *s.Condition != ""
+}
+
+// SetTimeout validates and sets the timeout of the stage in seconds.
+func (s *Stage) SetTimeout(timeout int) error {
+	if timeout < 0 {
+		return fmt.Errorf("%w: timeout mustn't be negative", ErrInvalidTimeout)
+	}
+	s.Timeout = timeout
+	return nil
+}
+
+// SetMaxConcurrency validates and sets the max number of the sub-stages executed at once.
+// Only the parallel stage may be limited.
+func (s *Stage) SetMaxConcurrency(maxConcurrency int) error {
+	if maxConcurrency < 0 {
+		return fmt.Errorf("%w: max_concurrency mustn't be negative", ErrInvalidConcurrency)
+	}
+	if maxConcurrency > 0 && !s.HasSubStages() {
+		return fmt.Errorf("%w: only parallel and map stages could be limited", ErrInvalidConcurrency)
+	}
+	s.MaxConcurrency = maxConcurrency
+	return nil
+}
+
+// SetFailurePolicy validates and sets the failure policy of the parallel stage.
+// An empty policy means fail_fast. min_success and allowed_failures couldn't be both set.
+func (s *Stage) SetFailurePolicy(policy value.FailurePolicy, minSuccess int, allowedFailures int) error {
+	if policy == "" {
+		policy = value.FailFast
+	}
+	if !policy.IsValid() {
+		return fmt.Errorf("%w: unknown policy %s", ErrInvalidPolicy, policy)
+	}
+	if minSuccess < 0 || allowedFailures < 0 {
+		return fmt.Errorf("%w: min_success and allowed_failures mustn't be negative", ErrInvalidPolicy)
+	}
+	if minSuccess > 0 && allowedFailures > 0 {
+		return fmt.Errorf("%w: min_success and allowed_failures couldn't be both set", ErrInvalidPolicy)
+	}
+	if !s.HasSubStages() && (policy != value.FailFast || minSuccess > 0 || allowedFailures > 0) {
+		return fmt.Errorf("%w: only parallel and map stages have the failure policy", ErrInvalidPolicy)
+	}
+	s.FailurePolicy = policy
+	s.MinSuccess = minSuccess
+	s.AllowedFailures = allowedFailures
+	return nil
+}
+
+// SetMap validates and sets the list parameter of the map stage and the parameter its elements are passed as.
+// Only the map stage has them and they are required for it.
+func (s *Stage) SetMap(mapOver string, mapKey string) error {
+	if !s.IsMap() {
+		if mapOver != "" || mapKey != "" {
+			return fmt.Errorf("%w: only map stages have map_over and map_key", ErrInvalidMap)
+		}
+		return nil
+	}
+	if mapOver == "" || mapKey == "" {
+		return fmt.Errorf("%w: map_over and map_key are required", ErrInvalidMap)
+	}
+	s.MapOver = mapOver
+	s.MapKey = mapKey
+	return nil
+}
+
+// SetSubsendpost validates and sets the sendpost run by the subsendpost stage.
+// Only the subsendpost stage has it and it is required for it.
+// The cycles of the subsendpost stages are checked when the stage is added to the sendpost.
+func (s *Stage) SetSubsendpost(sendpostID *uint) error {
+	if !s.IsSubsendpost() {
+		if sendpostID != nil {
+			return fmt.Errorf("%w: only subsendpost stages have subsendpost_id", ErrInvalidSubsendpost)
+		}
+		return nil
+	}
+	if sendpostID == nil {
+		return fmt.Errorf("%w: subsendpost_id is required", ErrInvalidSubsendpost)
+	}
+	if *sendpostID == s.SendpostID {
+		return fmt.Errorf("%w: sendpost couldn't run itself", ErrSubsendpostCycle)
+	}
+	s.SubsendpostID = sendpostID
+	return nil
+}
+
+// SetApprovalTimeout validates and sets the time in seconds the approval stage waits for the decision.
+// Only the approval stage has it.
+func (s *Stage) SetApprovalTimeout(timeout int) error {
+	if timeout < 0 {
+		return fmt.Errorf("%w: approval_timeout mustn't be negative", ErrInvalidApproval)
+	}
+	if timeout > 0 && !s.IsApproval() {
+		return fmt.Errorf("%w: only approval stages have approval_timeout", ErrInvalidApproval)
+	}
+	s.ApprovalTimeout = timeout
+	return nil
+}
+
+// GetApprovalTimeout returns the time the approval stage waits for the decision, 0 if it doesn't expire.
+func (s *Stage) GetApprovalTimeout() time.Duration {
+	return time.Duration(s.ApprovalTimeout) * time.Second
+}
+
+// SetWait validates and sets the time the wait stage waits for: either the duration in seconds
+// or the wall-clock time HH:MM in the timezone (UTC by default). Only the wait stage has them.
+func (s *Stage) SetWait(duration int, until string, timezone string) error {
+	if !s.IsWait() {
+		if duration != 0 || until != "" || timezone != "" {
+			return fmt.Errorf("%w: only wait stages have wait_duration, wait_until and wait_timezone", ErrInvalidWait)
+		}
+		return nil
+	}
+	if duration < 0 {
+		return fmt.Errorf("%w: wait_duration mustn't be negative", ErrInvalidWait)
+	}
+	if (duration > 0) == (until != "") {
+		return fmt.Errorf("%w: either wait_duration or wait_until must be provided", ErrInvalidWait)
+	}
+	if until == "" && timezone != "" {
+		return fmt.Errorf("%w: wait_timezone is used only with wait_until", ErrInvalidWait)
+	}
+	if until != "" {
+		if _, err := time.Parse(waitUntilLayout, until); err != nil {
+			return fmt.Errorf("%w: wait_until must be HH:MM: %s", ErrInvalidWait, err)
+		}
+		if timezone == "" {
+			timezone = DefaultScheduleTimezone
+		}
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return fmt.Errorf("%w: invalid timezone %q: %s", ErrInvalidWait, timezone, err)
+		}
+	}
+	s.WaitDuration = duration
+	s.WaitUntil = until
+	s.WaitTimezone = timezone
+	return nil
+}
+
+// WakeAt returns the time the wait stage started at the given time finishes waiting.
+// The wall-clock target is the nearest HH:MM in the timezone after the start.
+func (s *Stage) WakeAt(start time.Time) (time.Time, error) {
+	if s.WaitUntil == "" {
+		return start.Add(time.Duration(s.WaitDuration) * time.Second), nil
+	}
+	until, err := time.Parse(waitUntilLayout, s.WaitUntil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: wait_until must be HH:MM: %s", ErrInvalidWait, err)
+	}
+	loc, err := time.LoadLocation(s.WaitTimezone)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: invalid timezone %q: %s", ErrInvalidWait, s.WaitTimezone, err)
+	}
+	local := start.In(loc)
+	wakeAt := time.Date(local.Year(), local.Month(), local.Day(), until.Hour(), until.Minute(), 0, 0, loc)
+	if !wakeAt.After(local) {
+		wakeAt = time.Date(local.Year(), local.Month(), local.Day()+1, until.Hour(), until.Minute(), 0, 0, loc)
+	}
+	return wakeAt, nil
+}
+
+// NeedsDeployment reports whether the stage is executed by the deployment of the executor.
+func (s *Stage) NeedsDeployment() bool {
+	return !s.IsSubsendpost() && !s.IsApproval() && !s.IsWait()
+}
+
+// MapItems returns the list the map stage is expanded over. The list is taken
+// from the stage parameters or, if the stage doesn't have it, from the global parameters.
+func (s *Stage) MapItems(globalParameters *value.JSONB) ([]any, error) {
+	var list any
+	var ok bool
+	if params := s.RunParameters(); params != nil {
+		list, ok = (*params)[s.MapOver]
+	}
+	if !ok && globalParameters != nil {
+		list, ok = (*globalParameters)[s.MapOver]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: parameter %s not found", ErrInvalidMap, s.MapOver)
+	}
+	items, ok := list.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: parameter %s is not a list", ErrInvalidMap, s.MapOver)
+	}
+	return items, nil
+}
+
+// MapItem returns the element of the list the sub-stage of the map stage is created for.
+func (s *Stage) MapItem(mapKey string) (any, bool) {
+	if s.StageParameters == nil {
+		return nil, false
+	}
+	item, ok := (*s.StageParameters)[mapKey]
+	return item, ok
+}
+
+// NewMapSubStage creates the sub-stage of the map stage for the element of the list.
+// The sub-stage executes the deployment of the map stage with its stored parameters
+// and the element as the MapKey parameter, the retry policy is taken from the map stage.
+func (s *Stage) NewMapSubStage(item any) *Stage {
+	subStage := &Stage{
+		SendpostID:    s.SendpostID,
+		ParentStageID: &s.ID,
+		Type:          value.SequentialStage,
+	}
+	s.UpdateMapSubStage(subStage, item)
+	return subStage
+}
+
+// UpdateMapSubStage updates the deployment, the parameters and the retry policy
+// of the sub-stage of the map stage after the map stage was changed.
+func (s *Stage) UpdateMapSubStage(subStage *Stage, item any) {
+	params := make(value.JSONB)
+	if s.StageParameters != nil {
+		for k, v := range *s.StageParameters {
+			params[k] = v
+		}
+	}
+	delete(params, s.MapOver)
+	params[s.MapKey] = item
+	subStage.DeploymnentID = s.DeploymnentID
+	subStage.StageParameters = &params
+	subStage.MaxRetries = s.MaxRetries
+	subStage.RetryDelay = s.RetryDelay
+	subStage.RetryOn = s.RetryOn
+}
+
+// SubStagesSucceeded reports whether the parallel stage succeeded with the given outcomes of its sub-stages.
+func (s *Stage) SubStagesSucceeded(succeeded int, failed int) bool {
+	if s.MinSuccess > 0 {
+		return succeeded >= s.MinSuccess
+	}
+	return failed <= s.AllowedFailures
+}
+
+// SubStagesMaySucceed reports whether the parallel stage could still succeed
+// when the pending sub-stages haven't finished yet.
+func (s *Stage) SubStagesMaySucceed(succeeded int, failed int, pending int) bool {
+	if s.MinSuccess > 0 {
+		return succeeded+pending >= s.MinSuccess
+	}
+	return failed <= s.AllowedFailures
+}
+
+// GetTimeout returns the timeout of the stage, 0 if the stage isn't limited.
+func (s *Stage) GetTimeout() time.Duration {
+	return time.Duration(s.Timeout) * time.Second
+}
+
+// SetRetryPolicy validates and sets the retry policy of the stage.
+// Only the unsuccessful flow run states may be retried on.
+func (s *Stage) SetRetryPolicy(maxRetries int, retryDelay int, retryOn value.StateTypes) error {
+	if maxRetries < 0 || retryDelay < 0 {
+		return fmt.Errorf("%w: max_retries and retry_delay mustn't be negative", ErrInvalidRetryPolicy)
+	}
+	if maxRetries > MaxRetriesLimit {
+		return fmt.Errorf("%w: max_retries mustn't exceed %d", ErrInvalidRetryPolicy, MaxRetriesLimit)
+	}
+	if time.Duration(retryDelay) > MaxRetryDelay/time.Second {
+		return fmt.Errorf("%w: retry_delay mustn't exceed %d seconds", ErrInvalidRetryPolicy, int(MaxRetryDelay/time.Second))
+	}
+	for _, state := range retryOn {
+		if !state.IsFailure() {
+			return fmt.Errorf("%w: stage couldn't be retried on %s state", ErrInvalidRetryPolicy, state)
+		}
+	}
+	s.MaxRetries = maxRetries
+	s.RetryDelay = retryDelay
+	s.RetryOn = nil
+	if len(retryOn) > 0 {
+		s.RetryOn = &retryOn
+	}
+	return nil
+}
+
+// ShouldRetry reports whether the flow run finished in the state
+// should be created again after the given attempt.
+func (s *Stage) ShouldRetry(state value.StateType, attempt int) bool {
+	if attempt > s.MaxRetries {
+		return false
+	}
+	retryOn := DefaultRetryOn
+	if s.RetryOn != nil && len(*s.RetryOn) > 0 {
+		retryOn = *s.RetryOn
+	}
+	return retryOn.Contains(state)
+}
+
+// RetryDelayAfter returns the delay before the next attempt after the given one,
+// the delay is doubled after every attempt up to MaxRetryDelay.
+func (s *Stage) RetryDelayAfter(attempt int) time.Duration {
+	delay := time.Duration(s.RetryDelay) * time.Second
+	if delay > MaxRetryDelay {
+		return MaxRetryDelay
+	}
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= MaxRetryDelay {
+			return MaxRetryDelay
+		}
 	}
+	return delay
 }
@@ -6,8 +6,8 @@ import (
 )
 
 type StageRunner interface {
-	Start(ctx context.Context, stage *Stage) error
-	CheckState(ctx context.Context, stage *Stage) error
+	Start(ctx context.Context, run *SendpostRun, stage *Stage) error
+	CheckState(ctx context.Context, run *SendpostRun, stage *Stage) error
 }
 
 type StageRunnerFactory interface {
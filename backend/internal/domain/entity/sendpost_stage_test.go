@@ -0,0 +1,165 @@
+package entity
+
+import (
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestStageShouldRetry(t *testing.T) {
+	stage := &Stage{}
+	require.NoError(t, stage.SetRetryPolicy(2, 0, nil))
+	assert.True(t, stage.ShouldRetry(value.Failed, 1))
+	assert.True(t, stage.ShouldRetry(value.Crashed, 2))
+	// попытки сверх max_retries не выполняются
+	assert.False(t, stage.ShouldRetry(value.Failed, 3))
+	// отменённый flow run по умолчанию не повторяется
+	assert.False(t, stage.ShouldRetry(value.Cancelled, 1))
+
+	require.NoError(t, stage.SetRetryPolicy(2, 0, value.StateTypes{value.Crashed}))
+	assert.True(t, stage.ShouldRetry(value.Crashed, 1))
+	assert.False(t, stage.ShouldRetry(value.Failed, 1))
+
+	assert.ErrorIs(t, stage.SetRetryPolicy(1, 0, value.StateTypes{value.Completed}), ErrInvalidRetryPolicy)
+}
+
+func TestStageRetryDelayAfter(t *testing.T) {
+	stage := &Stage{}
+	require.NoError(t, stage.SetRetryPolicy(3, 60, nil))
+	assert.Equal(t, time.Minute, stage.RetryDelayAfter(1))
+	assert.Equal(t, 4*time.Minute, stage.RetryDelayAfter(3))
+	// задержка не переполняется и не превышает MaxRetryDelay
+	assert.Equal(t, MaxRetryDelay, stage.RetryDelayAfter(100))
+
+	assert.ErrorIs(t, stage.SetRetryPolicy(MaxRetriesLimit+1, 60, nil), ErrInvalidRetryPolicy)
+	assert.ErrorIs(t, stage.SetRetryPolicy(1, int(MaxRetryDelay/time.Second)+1, nil), ErrInvalidRetryPolicy)
+}
+
+func TestStageSetCondition(t *testing.T) {
+	stage := &Stage{}
+	require.NoError(t, stage.SetCondition(`previous.state == "COMPLETED" && weekday in ["Saturday", "Sunday"]`))
+	assert.True(t, stage.HasCondition())
+
+	// Неизвестные имена и ошибки типов отклоняются при сохранении условия
+	for _, condition := range []string{"weekday ==", "segment == 'vip'", "weekday > 1", "weekday"} {
+		assert.ErrorIs(t, stage.SetCondition(condition), ErrInvalidCondition, condition)
+	}
+
+	require.NoError(t, stage.SetCondition("  "))
+	assert.False(t, stage.HasCondition())
+}
+
+func TestStageValidateSubStage(t *testing.T) {
+	assert.NoError(t, (&Stage{Type: value.SequentialStage}).ValidateSubStage())
+	assert.NoError(t, (&Stage{Type: value.ParallelStage}).ValidateSubStage())
+	assert.ErrorIs(t, (&Stage{Type: value.MapStage}).ValidateSubStage(), ErrInvalidMap)
+	assert.ErrorIs(t, (&Stage{Type: value.SubsendpostStage}).ValidateSubStage(), ErrInvalidSubsendpost)
+	assert.ErrorIs(t, (&Stage{Type: value.ApprovalStage}).ValidateSubStage(), ErrInvalidApproval)
+	assert.ErrorIs(t, (&Stage{Type: value.WaitStage}).ValidateSubStage(), ErrInvalidWait)
+	assert.ErrorIs(t, (&Stage{Type: value.SequentialStage, AlwaysRun: true}).ValidateSubStage(), ErrInvalidSubStage)
+
+	stage := &Stage{Type: value.SequentialStage}
+	require.NoError(t, stage.SetCondition(`weekday == "Monday"`))
+	assert.ErrorIs(t, stage.ValidateSubStage(), ErrInvalidCondition)
+}
+
+func TestStageSubStagesSucceeded(t *testing.T) {
+	stage := &Stage{AllowedFailures: 1}
+	assert.True(t, stage.SubStagesSucceeded(1, 1))
+	assert.False(t, stage.SubStagesSucceeded(3, 2))
+	assert.False(t, stage.SubStagesMaySucceed(0, 2, 3))
+
+	// min_success важнее allowed_failures
+	stage = &Stage{MinSuccess: 2, AllowedFailures: 5}
+	assert.False(t, stage.SubStagesSucceeded(1, 0))
+	assert.True(t, stage.SubStagesSucceeded(2, 3))
+	assert.True(t, stage.SubStagesMaySucceed(1, 3, 1))
+	assert.False(t, stage.SubStagesMaySucceed(0, 3, 1))
+}
+
+func TestStageMapItems(t *testing.T) {
+	stage := &Stage{Model: gorm.Model{ID: 7}, Type: value.MapStage, DeploymnentID: "deployment"}
+	require.NoError(t, stage.SetMap("regions", "region"))
+
+	global := value.JSONB{"regions": []any{"msk", "spb"}}
+	items, err := stage.MapItems(&global)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"msk", "spb"}, items)
+
+	// параметр этапа важнее глобального
+	stage.StageParameters = &value.JSONB{"regions": []any{"nsk"}, "date": "2024-01-01"}
+	items, err = stage.MapItems(&global)
+	require.NoError(t, err)
+	assert.Equal(t, []any{"nsk"}, items)
+
+	subStage := stage.NewMapSubStage("nsk")
+	assert.Equal(t, uint(7), *subStage.ParentStageID)
+	assert.Equal(t, "deployment", subStage.DeploymnentID)
+	assert.Equal(t, value.JSONB{"region": "nsk", "date": "2024-01-01"}, *subStage.StageParameters)
+
+	// параметры запуска не сохраняются в подэтапе
+	stage.SetRunParameters(&value.JSONB{"regions": []any{"nsk"}, "date": "2024-02-01"})
+	stage.UpdateMapSubStage(subStage, "nsk")
+	assert.Equal(t, value.JSONB{"region": "nsk", "date": "2024-01-01"}, *subStage.StageParameters)
+	stage.SetRunParameters(nil)
+
+	stage.StageParameters = &value.JSONB{"regions": "nsk"}
+	_, err = stage.MapItems(nil)
+	assert.ErrorIs(t, err, ErrInvalidMap)
+}
+
+func TestStageSetSubsendpost(t *testing.T) {
+	subsendpostID := uint(2)
+	stage := &Stage{SendpostID: 1, Type: value.SubsendpostStage}
+	require.NoError(t, stage.SetSubsendpost(&subsendpostID))
+	assert.Equal(t, subsendpostID, *stage.SubsendpostID)
+	assert.False(t, stage.NeedsDeployment())
+
+	// sendpost не может запускать сам себя
+	sendpostID := uint(1)
+	assert.ErrorIs(t, stage.SetSubsendpost(&sendpostID), ErrSubsendpostCycle)
+	assert.ErrorIs(t, stage.SetSubsendpost(nil), ErrInvalidSubsendpost)
+	assert.ErrorIs(t, (&Stage{Type: value.SequentialStage}).SetSubsendpost(&subsendpostID), ErrInvalidSubsendpost)
+}
+
+func TestStageWakeAt(t *testing.T) {
+	stage := &Stage{Type: value.WaitStage}
+	require.NoError(t, stage.SetWait(0, "09:00", "Europe/Moscow"))
+	assert.ErrorIs(t, stage.SetWait(60, "09:00", ""), ErrInvalidWait)
+	assert.ErrorIs(t, stage.SetWait(0, "9 am", ""), ErrInvalidWait)
+
+	loc, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+	wakeAt, err := stage.WakeAt(time.Date(2024, 5, 1, 8, 30, 0, 0, loc))
+	require.NoError(t, err)
+	assert.True(t, wakeAt.Equal(time.Date(2024, 5, 1, 9, 0, 0, 0, loc)))
+	wakeAt, err = stage.WakeAt(time.Date(2024, 5, 1, 9, 0, 0, 0, loc))
+	require.NoError(t, err)
+	assert.True(t, wakeAt.Equal(time.Date(2024, 5, 2, 9, 0, 0, 0, loc)))
+}
+
+func TestStageResolveParameters(t *testing.T) {
+	stage := &Stage{StageParameters: &value.JSONB{"date": "2024-01-01", "segment": "vip", "limit": 10}}
+	defaults := value.JSONB{"limit": 100, "dry_run": false}
+	parent := value.JSONB{"segment": "new", "region": "msk"}
+	global := value.JSONB{"date": "2024-02-01", "unrelated": true}
+	overrides := value.JSONB{"date": "2024-03-01", "dry_run": true}
+
+	resolved := stage.ResolveParameters(&defaults, &parent, &global, &overrides)
+	assert.Equal(t, value.JSONB{"date": "2024-03-01", "segment": "new", "limit": 10, "dry_run": true}, *resolved.Parameters)
+	assert.Equal(t, map[string]value.ParameterSource{
+		"date":    value.SourceRun,
+		"segment": value.SourceParent,
+		"limit":   value.SourceStage,
+		"dry_run": value.SourceRun,
+	}, resolved.Sources)
+	// параметры этапа не меняются
+	assert.Equal(t, value.JSONB{"date": "2024-01-01", "segment": "vip", "limit": 10}, *stage.StageParameters)
+
+	resolved = (&Stage{}).ResolveParameters(nil, nil, &global, nil)
+	assert.Nil(t, resolved.Parameters)
+}
@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// StageDependency means the stage is started only after the stage it depends on has completed.
+// The top level stages of the sendpost with their dependencies form the StageGraph.
+type StageDependency struct {
+	ID               uint   `gorm:"primarykey"`
+	StageID          uint   `gorm:"not null;uniqueIndex:idx_stage_dependency"`
+	Stage            *Stage `gorm:"foreignKey:StageID;constraint:OnDelete:CASCADE;"`
+	DependsOnStageID uint   `gorm:"not null;uniqueIndex:idx_stage_dependency;index"`
+	DependsOnStage   *Stage `gorm:"foreignKey:DependsOnStageID;constraint:OnDelete:CASCADE;"`
+	CreatedAt        time.Time
+}
+
+func NewStageDependency(stageID uint, dependsOnStageID uint) *StageDependency {
+	return &StageDependency{StageID: stageID, DependsOnStageID: dependsOnStageID}
+}
@@ -0,0 +1,157 @@
+package entity
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var (
+	ErrDependencyCycle   = errors.New("stage dependencies form a cycle")
+	ErrInvalidDependency = errors.New("invalid stage dependency")
+)
+
+// StageGraph is the directed acyclic graph of the top level stages of the sendpost.
+// A stage is run when all the stages it depends on have completed,
+// the independent stages are run concurrently.
+type StageGraph struct {
+	stages     map[uint]*Stage
+	dependsOn  map[uint][]uint
+	dependents map[uint][]uint
+}
+
+// NewStageGraph builds the graph of the stages. The dependencies
+// on the stages which aren't in the graph are ignored.
+func NewStageGraph(stages []*Stage, dependencies []*StageDependency) *StageGraph {
+	g := &StageGraph{
+		stages:     make(map[uint]*Stage, len(stages)),
+		dependsOn:  make(map[uint][]uint),
+		dependents: make(map[uint][]uint),
+	}
+	for _, stage := range stages {
+		g.stages[stage.ID] = stage
+	}
+	for _, dependency := range dependencies {
+		if g.stages[dependency.StageID] == nil || g.stages[dependency.DependsOnStageID] == nil {
+			continue
+		}
+		g.link(dependency.StageID, dependency.DependsOnStageID)
+	}
+	return g
+}
+
+func (g *StageGraph) link(stageID uint, dependsOnStageID uint) {
+	g.dependsOn[stageID] = append(g.dependsOn[stageID], dependsOnStageID)
+	g.dependents[dependsOnStageID] = append(g.dependents[dependsOnStageID], stageID)
+}
+
+// Len returns the number of the stages in the graph.
+func (g *StageGraph) Len() int {
+	return len(g.stages)
+}
+
+// Stage returns the stage of the graph by its ID, nil if the graph doesn't contain it.
+func (g *StageGraph) Stage(stageID uint) *Stage {
+	return g.stages[stageID]
+}
+
+// DependsOn returns the IDs of the stages the stage depends on.
+func (g *StageGraph) DependsOn(stageID uint) []uint {
+	return sortedIDs(g.dependsOn[stageID])
+}
+
+// Dependents returns the IDs of the stages which depend on the stage.
+func (g *StageGraph) Dependents(stageID uint) []uint {
+	return sortedIDs(g.dependents[stageID])
+}
+
+// Roots returns the stages which don't depend on other stages ordered by ID.
+func (g *StageGraph) Roots() []*Stage {
+	var roots []*Stage
+	for _, id := range g.ids() {
+		if len(g.dependsOn[id]) == 0 {
+			roots = append(roots, g.stages[id])
+		}
+	}
+	return roots
+}
+
+// Descendants returns the IDs of the stages which depend on the stage directly or transitively.
+func (g *StageGraph) Descendants(stageID uint) map[uint]bool {
+	descendants := make(map[uint]bool)
+	queue := []uint{stageID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, dependent := range g.dependents[id] {
+			if !descendants[dependent] {
+				descendants[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+	return descendants
+}
+
+// TopologicalOrder returns the stages ordered so that every stage follows the stages it depends on.
+// The independent stages are ordered by ID. Returns ErrDependencyCycle if the graph has a cycle.
+func (g *StageGraph) TopologicalOrder() ([]*Stage, error) {
+	remaining := make(map[uint]int, len(g.stages))
+	for id := range g.stages {
+		remaining[id] = len(g.dependsOn[id])
+	}
+	var ready []uint
+	for _, stage := range g.Roots() {
+		ready = append(ready, stage.ID)
+	}
+	order := make([]*Stage, 0, len(g.stages))
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return ready[i] < ready[j] })
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, g.stages[id])
+		for _, dependent := range g.dependents[id] {
+			remaining[dependent]--
+			if remaining[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(order) != len(g.stages) {
+		return nil, ErrDependencyCycle
+	}
+	return order, nil
+}
+
+// AddDependency makes the stage depend on the other stage of the graph.
+// Returns ErrInvalidDependency if any of the stages isn't in the graph
+// or the dependency exists, ErrDependencyCycle if the dependency would form a cycle.
+func (g *StageGraph) AddDependency(stageID uint, dependsOnStageID uint) error {
+	if g.stages[stageID] == nil || g.stages[dependsOnStageID] == nil {
+		return fmt.Errorf("%w: stages %d and %d aren't top level stages of the same sendpost", ErrInvalidDependency, stageID, dependsOnStageID)
+	}
+	for _, id := range g.dependsOn[stageID] {
+		if id == dependsOnStageID {
+			return fmt.Errorf("%w: stage %d already depends on stage %d", ErrInvalidDependency, stageID, dependsOnStageID)
+		}
+	}
+	if stageID == dependsOnStageID || g.Descendants(stageID)[dependsOnStageID] {
+		return fmt.Errorf("%w: stage %d depends on stage %d", ErrDependencyCycle, dependsOnStageID, stageID)
+	}
+	g.link(stageID, dependsOnStageID)
+	return nil
+}
+
+func (g *StageGraph) ids() []uint {
+	ids := make([]uint, 0, len(g.stages))
+	for id := range g.stages {
+		ids = append(ids, id)
+	}
+	return sortedIDs(ids)
+}
+
+func sortedIDs(ids []uint) []uint {
+	sorted := append([]uint(nil), ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
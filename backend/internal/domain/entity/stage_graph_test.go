@@ -0,0 +1,49 @@
+package entity
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// newTestGraph builds A(1) → (B(2), C(3)) → D(4), C(3) → E(5)
+func newTestGraph() *StageGraph {
+	var stages []*Stage
+	for id := uint(1); id <= 5; id++ {
+		stages = append(stages, &Stage{Model: gorm.Model{ID: id}})
+	}
+	return NewStageGraph(stages, []*StageDependency{
+		NewStageDependency(2, 1),
+		NewStageDependency(3, 1),
+		NewStageDependency(4, 2),
+		NewStageDependency(4, 3),
+		NewStageDependency(5, 3),
+	})
+}
+
+func TestStageGraphTopologicalOrder(t *testing.T) {
+	order, err := newTestGraph().TopologicalOrder()
+	require.NoError(t, err)
+
+	var ids []uint
+	for _, stage := range order {
+		ids = append(ids, stage.ID)
+	}
+	assert.Equal(t, []uint{1, 2, 3, 4, 5}, ids)
+}
+
+func TestStageGraphAddDependency(t *testing.T) {
+	g := newTestGraph()
+
+	assert.ErrorIs(t, g.AddDependency(1, 4), ErrDependencyCycle)
+	assert.ErrorIs(t, g.AddDependency(3, 3), ErrDependencyCycle)
+	assert.ErrorIs(t, g.AddDependency(4, 2), ErrInvalidDependency)
+	assert.ErrorIs(t, g.AddDependency(6, 1), ErrInvalidDependency)
+
+	require.NoError(t, g.AddDependency(5, 2))
+	assert.Equal(t, []uint{2, 3}, g.DependsOn(5))
+	assert.Equal(t, map[uint]bool{2: true, 3: true, 4: true, 5: true}, g.Descendants(1))
+	assert.Equal(t, []uint{4, 5}, g.Dependents(2))
+}
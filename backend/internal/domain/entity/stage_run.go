@@ -0,0 +1,189 @@
+package entity
+
+import (
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrApprovalNotPending means the stage run isn't waiting for the approval anymore or has never been
+var ErrApprovalNotPending = errors.New("stage isn't awaiting approval")
+
+// StageRun is a single execution of a stage within a sendpost run.
+// It keeps the parameters which were sent to the executor and the flow run ID.
+type StageRun struct {
+	gorm.Model
+	SendpostRunID uint `gorm:"not null;index"`
+	StageID       uint `gorm:"not null;index"`
+	ParentStageID *uint
+
+	State value.StateType `gorm:"size:20;default:PENDING;not null"`
+	Type  value.StageType `gorm:"size:20;not null"`
+
+	DeploymentID string       `gorm:"size:255"`
+	FlowRunID    *string      `gorm:"size:255"`
+	Parameters   *value.JSONB `gorm:"type:jsonb"`
+
+	StartedAt   time.Time
+	CompletedAt *time.Time
+
+	Error *string
+	// Reason explains the failure when the state doesn't, e.g. the timeout
+	Reason *value.FailureReason `gorm:"size:20"`
+
+	// Reused is true if the stage wasn't executed, its result was taken from the resumed run
+	Reused bool `gorm:"default:false;not null"`
+
+	// Attempt is the number of the flow run creation, starting from 1
+	Attempt int `gorm:"default:1;not null"`
+
+	// SubsendpostRunID is the run of the sendpost started by the subsendpost stage
+	SubsendpostRunID *uint
+
+	// Decision made on the approval stage with the comment, nil while the stage is awaiting it.
+	// ExpiresAt is the time the approval expires at, nil if it doesn't expire
+	Decision        *value.ApprovalDecision `gorm:"size:20"`
+	DecisionComment *string                 `gorm:"type:text"`
+	DecidedAt       *time.Time
+	ExpiresAt       *time.Time
+
+	// WakeAt is the time the wait stage finishes waiting, kept to continue waiting after the restart
+	WakeAt *time.Time
+
+	// Result is the output of the completed flow run, referenced by the parameters of the next stages
+	Result *value.JSONB `gorm:"type:jsonb"`
+}
+
+func NewStageRun(sendpostRunID uint, stage *Stage) *StageRun {
+	var parameters *value.JSONB
+	if runParameters := stage.RunParameters(); runParameters != nil {
+		params := make(value.JSONB, len(*runParameters))
+		for k, v := range *runParameters {
+			params[k] = v
+		}
+		parameters = &params
+	}
+	return &StageRun{
+		SendpostRunID: sendpostRunID,
+		StageID:       stage.ID,
+		ParentStageID: stage.ParentStageID,
+		State:         value.Pending,
+		Type:          stage.Type,
+		DeploymentID:  stage.DeploymnentID,
+		Parameters:    parameters,
+		StartedAt:     time.Now(),
+		Attempt:       1,
+	}
+}
+
+// IsQueued reports whether the stage is waiting to be started, i.e. its flow run hasn't been created yet.
+func (r *StageRun) IsQueued() bool {
+	return r.State == value.Pending && r.FlowRunID == nil
+}
+
+// Start marks the start of the queued stage run with the current stage parameters.
+func (r *StageRun) Start(stage *Stage) {
+	r.Parameters = NewStageRun(r.SendpostRunID, stage).Parameters
+	r.StartedAt = time.Now()
+}
+
+// AwaitApproval pauses the approval stage run until the decision is made.
+// The approval expires after the timeout unless it is 0.
+func (r *StageRun) AwaitApproval(timeout time.Duration) {
+	r.State = value.Paused
+	if timeout > 0 {
+		expiresAt := time.Now().Add(timeout)
+		r.ExpiresAt = &expiresAt
+	}
+}
+
+// IsPaused reports whether the stage run is waiting for the approval, the decision may already be made.
+func (r *StageRun) IsPaused() bool {
+	return r.State == value.Paused
+}
+
+// IsAwaitingApproval reports whether the decision could be made on the stage run at the given time.
+func (r *StageRun) IsAwaitingApproval(now time.Time) bool {
+	return r.IsPaused() && r.Decision == nil && !r.IsExpired(now)
+}
+
+// IsExpired reports whether the approval of the stage run expired by the given time.
+func (r *StageRun) IsExpired(now time.Time) bool {
+	return r.ExpiresAt != nil && !now.Before(*r.ExpiresAt)
+}
+
+// Decide records the decision made on the approval stage run with the comment.
+// Returns ErrApprovalNotPending if the stage run isn't awaiting the approval.
+func (r *StageRun) Decide(decision value.ApprovalDecision, comment string) error {
+	now := time.Now()
+	if !r.IsAwaitingApproval(now) {
+		return fmt.Errorf("%w: stage run %d is %s", ErrApprovalNotPending, r.ID, r.State)
+	}
+	r.Decision = &decision
+	r.DecidedAt = &now
+	if comment != "" {
+		r.DecisionComment = &comment
+	}
+	return nil
+}
+
+// NextAttempt creates the record of the next attempt to execute the stage.
+func (r *StageRun) NextAttempt(stage *Stage) *StageRun {
+	next := NewStageRun(r.SendpostRunID, stage)
+	next.Attempt = r.Attempt + 1
+	return next
+}
+
+// UpdateState sets the state of the stage run.
+// Terminal states also set the completion time and the error if any.
+func (r *StageRun) UpdateState(state value.StateType, err error) {
+	r.State = state
+	if state.IsFinal() {
+		now := time.Now()
+		r.CompletedAt = &now
+	}
+	if err != nil {
+		msg := err.Error()
+		r.Error = &msg
+	}
+}
+
+// SetResult records the output of the completed flow run.
+func (r *StageRun) SetResult(result map[string]interface{}) {
+	output := value.JSONB(result)
+	r.Result = &output
+}
+
+// Fail marks the stage run as failed for the reason the state doesn't tell, e.g. the timeout.
+func (r *StageRun) Fail(reason value.FailureReason, err error) {
+	r.UpdateState(value.Failed, err)
+	r.Reason = &reason
+}
+
+// Reuse copies the completed stage run into the run resuming it.
+func (r *StageRun) Reuse(sendpostRunID uint) *StageRun {
+	return &StageRun{
+		SendpostRunID:    sendpostRunID,
+		StageID:          r.StageID,
+		ParentStageID:    r.ParentStageID,
+		State:            r.State,
+		Type:             r.Type,
+		DeploymentID:     r.DeploymentID,
+		FlowRunID:        r.FlowRunID,
+		Parameters:       r.Parameters,
+		StartedAt:        r.StartedAt,
+		CompletedAt:      r.CompletedAt,
+		Reused:           true,
+		Attempt:          r.Attempt,
+		SubsendpostRunID: r.SubsendpostRunID,
+		Decision:         r.Decision,
+		DecisionComment:  r.DecisionComment,
+		DecidedAt:        r.DecidedAt,
+		ExpiresAt:        r.ExpiresAt,
+		WakeAt:           r.WakeAt,
+		Result:           r.Result,
+	}
+}
@@ -0,0 +1,25 @@
+package entity
+
+import (
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageRunDecide(t *testing.T) {
+	stageRun := NewStageRun(1, &Stage{Type: value.ApprovalStage})
+	assert.ErrorIs(t, stageRun.Decide(value.Approved, ""), ErrApprovalNotPending)
+
+	stageRun.AwaitApproval(time.Hour)
+	require.True(t, stageRun.IsAwaitingApproval(time.Now()))
+	assert.False(t, stageRun.IsAwaitingApproval(time.Now().Add(2*time.Hour)))
+
+	require.NoError(t, stageRun.Decide(value.Rejected, "wrong segment"))
+	assert.Equal(t, value.Rejected, *stageRun.Decision)
+	assert.Equal(t, "wrong segment", *stageRun.DecisionComment)
+	assert.True(t, stageRun.IsPaused())
+	assert.ErrorIs(t, stageRun.Decide(value.Approved, ""), ErrApprovalNotPending)
+}
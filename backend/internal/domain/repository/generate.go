@@ -2,3 +2,4 @@ package repository
 
 //go:generate mockery --name=SendpostRepository --output=../../mocks --outpkg=mocks
 //go:generate mockery --name=StageRepository --output=../../mocks --outpkg=mocks
+//go:generate mockery --name=StageDependencyRepository --output=../../mocks --outpkg=mocks
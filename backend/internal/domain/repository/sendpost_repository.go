@@ -11,7 +11,7 @@ type SendpostRepository interface {
 	DeleteSendpost(ctx context.Context, sendpostID uint) error
 	GetSendpostByID(ctx context.Context, sendpostID uint) (*entity.Sendpost, error)
 	GetSendposts(ctx context.Context) ([]*entity.Sendpost, error)
-	GetFirstStage(ctx context.Context, sendpostID uint) (*entity.Stage, error)
+	GetOnFailureStage(ctx context.Context, sendpostID uint) (*entity.Stage, error)
 	GetSendpostParameters(ctx context.Context, sendpostID uint) (*value.JSONB, error)
 	UpdateSendpostParameters(ctx context.Context, sendpostID uint, parameters *map[string]interface{}) error
 }
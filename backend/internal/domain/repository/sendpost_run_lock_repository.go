@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+	"time"
+)
+
+type SendpostRunLockRepository interface {
+	AcquireLock(ctx context.Context, sendpostID uint, owner string, expiresAt time.Time) (bool, error)
+	RenewLock(ctx context.Context, sendpostID uint, owner string, expiresAt time.Time) (bool, error)
+	ReleaseLock(ctx context.Context, sendpostID uint, owner string) error
+}
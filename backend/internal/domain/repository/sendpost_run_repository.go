@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+)
+
+type SendpostRunRepository interface {
+	SaveSendpostRun(ctx context.Context, run *entity.SendpostRun) error
+	GetSendpostRunByID(ctx context.Context, runID uint) (*entity.SendpostRun, error)
+	GetSendpostRuns(ctx context.Context, sendpostID uint) ([]*entity.SendpostRun, error)
+	GetLastSendpostRun(ctx context.Context, sendpostID uint) (*entity.SendpostRun, error)
+}
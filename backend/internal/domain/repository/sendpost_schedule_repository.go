@@ -3,11 +3,14 @@ package repository
 import (
 	"context"
 	"crm-uplift-ii24-backend/internal/domain/entity"
+	"time"
 )
 
 type SendpostScheduleRepository interface {
 	SaveSchedule(ctx context.Context, schedule *entity.SendpostSchedule) error
 	DeleteSchedule(ctx context.Context, scheduleID uint) error
 	GetScheduleByID(ctx context.Context, scheduleID uint) (*entity.SendpostSchedule, error)
-	GetScheduleBySendpostID(ctx context.Context, sendpostID uint) (*entity.SendpostSchedule, error)
+	GetSchedulesBySendpostID(ctx context.Context, sendpostID uint) ([]*entity.SendpostSchedule, error)
+	GetPendingSchedules(ctx context.Context) ([]*entity.SendpostSchedule, error)
+	ClaimSchedule(ctx context.Context, scheduleID uint, plannedAt time.Time, startedAt time.Time) (bool, error)
 }
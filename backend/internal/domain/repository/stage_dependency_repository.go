@@ -0,0 +1,13 @@
+package repository
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+)
+
+type StageDependencyRepository interface {
+	SaveDependency(ctx context.Context, dependency *entity.StageDependency) error
+	DeleteDependency(ctx context.Context, stageID uint, dependsOnStageID uint) error
+	DeleteStageDependencies(ctx context.Context, stageID uint) error
+	GetSendpostDependencies(ctx context.Context, sendpostID uint) ([]*entity.StageDependency, error)
+}
@@ -0,0 +1,12 @@
+package repository
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+)
+
+type StageRunRepository interface {
+	SaveStageRun(ctx context.Context, stageRun *entity.StageRun) error
+	GetStageRun(ctx context.Context, sendpostRunID uint, stageID uint) (*entity.StageRun, error)
+	GetStageRuns(ctx context.Context, sendpostRunID uint) ([]*entity.StageRun, error)
+}
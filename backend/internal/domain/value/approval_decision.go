@@ -0,0 +1,9 @@
+package value
+
+// ApprovalDecision is the decision made on the approval stage
+type ApprovalDecision string
+
+const (
+	Approved ApprovalDecision = "APPROVED"
+	Rejected ApprovalDecision = "REJECTED"
+)
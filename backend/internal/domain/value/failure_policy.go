@@ -0,0 +1,19 @@
+package value
+
+// FailurePolicy defines how the parallel stage reacts to the failure of its sub-stage.
+type FailurePolicy string
+
+const (
+	// FailFast cancels the other sub-stages as soon as the parallel stage couldn't succeed anymore.
+	FailFast FailurePolicy = "fail_fast"
+	// WaitAll waits for all the sub-stages to finish before the parallel stage is failed.
+	WaitAll FailurePolicy = "wait_all"
+)
+
+func (p FailurePolicy) IsValid() bool {
+	switch p {
+	case FailFast, WaitAll:
+		return true
+	}
+	return false
+}
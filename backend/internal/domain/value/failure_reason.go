@@ -0,0 +1,18 @@
+package value
+
+// FailureReason explains why the run or the stage finished unsuccessfully
+// when the state alone doesn't tell it.
+type FailureReason string
+
+const (
+	// ReasonTimedOut means the execution exceeded its timeout and was stopped.
+	ReasonTimedOut FailureReason = "TIMED_OUT"
+	// ReasonInterrupted means the backend stopped during the run and the run couldn't be recovered.
+	ReasonInterrupted FailureReason = "INTERRUPTED"
+	// ReasonLockLost means the run lost its lock and was stopped, the sendpost may be run by another replica.
+	ReasonLockLost FailureReason = "LOCK_LOST"
+	// ReasonRejected means the approval stage was rejected.
+	ReasonRejected FailureReason = "REJECTED"
+	// ReasonExpired means the approval stage hadn't been approved or rejected before its approval timeout.
+	ReasonExpired FailureReason = "EXPIRED"
+)
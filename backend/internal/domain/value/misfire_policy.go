@@ -0,0 +1,22 @@
+package value
+
+// MisfirePolicy defines what happens to the schedule whose planned time
+// passed while the service was down.
+type MisfirePolicy string
+
+const (
+	// MisfireRunImmediately runs the missed schedule right after the start.
+	MisfireRunImmediately MisfirePolicy = "run_immediately"
+	// MisfireSkip skips the missed schedule.
+	MisfireSkip MisfirePolicy = "skip"
+	// MisfireGrace runs the missed schedule if it's late not more than the grace period, skips otherwise.
+	MisfireGrace MisfirePolicy = "grace"
+)
+
+func (p MisfirePolicy) IsValid() bool {
+	switch p {
+	case MisfireRunImmediately, MisfireSkip, MisfireGrace:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package value
+
+// ParameterSource is the layer the effective value of the stage parameter was taken from.
+// The layers are listed in the order of increasing priority.
+type ParameterSource string
+
+const (
+	// SourceDeployment is the default value of the parameter of the deployment.
+	SourceDeployment ParameterSource = "DEPLOYMENT"
+	// SourceStage is the value set in the stage.
+	SourceStage ParameterSource = "STAGE"
+	// SourceParent is the value set in the parallel stage or, within the run, in the map stage the stage is a sub-stage of.
+	SourceParent ParameterSource = "PARENT"
+	// SourceGlobal is the global parameter of the sendpost.
+	SourceGlobal ParameterSource = "GLOBAL"
+	// SourceRun is the override of the run.
+	SourceRun ParameterSource = "RUN"
+)
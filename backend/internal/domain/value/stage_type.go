@@ -6,4 +6,12 @@ const (
 	ParallelStage   StageType = "PARALLEL"
 	SequentialStage StageType = "SEQUENTIAL"
 	ObserverStage   StageType = "OBSERVER"
+	// MapStage runs its deployment once per element of a list parameter
+	MapStage StageType = "MAP"
+	// SubsendpostStage runs another sendpost and waits for its run to finish
+	SubsendpostStage StageType = "SUBSENDPOST"
+	// ApprovalStage pauses the run until the stage is approved or rejected
+	ApprovalStage StageType = "APPROVAL"
+	// WaitStage waits for the duration or until the wall-clock time without running a flow
+	WaitStage StageType = "WAIT"
 )
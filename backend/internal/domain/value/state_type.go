@@ -20,11 +20,33 @@ const (
 	Cancelling   StateType = "CANCELLING"
 	NeverRunning StateType = "NEVERRUNNING"
 	Updated      StateType = "UPDATED"
+	Skipped      StateType = "SKIPPED"
+	TimedOut     StateType = "TIMED_OUT"
 )
 
 func (st StateType) IsValid() bool {
 	switch st {
-	case Scheduled, Pending, Running, Completed, Failed, Cancelled, Crashed, Paused, Cancelling, Updated, NeverRunning:
+	case Scheduled, Pending, Running, Completed, Failed, Cancelled, Crashed, Paused, Cancelling, Updated, NeverRunning, Skipped, TimedOut:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsFinal reports whether the state is terminal and won't change anymore.
+func (st StateType) IsFinal() bool {
+	switch st {
+	case Completed, Failed, Cancelled, Crashed, Skipped:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsFailure reports whether the flow run finished unsuccessfully.
+func (st StateType) IsFailure() bool {
+	switch st {
+	case Failed, Crashed, Cancelled, Cancelling:
 		return true
 	default:
 		return false
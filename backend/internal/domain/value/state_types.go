@@ -0,0 +1,46 @@
+package value
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// StateTypes - список состояний, хранится в JSONB
+type StateTypes []StateType
+
+// Contains reports whether the list contains the state.
+func (sts StateTypes) Contains(state StateType) bool {
+	for _, st := range sts {
+		if st == state {
+			return true
+		}
+	}
+	return false
+}
+
+// Value преобразует StateTypes в []byte для хранения в базе
+func (sts StateTypes) Value() (driver.Value, error) {
+	if sts == nil {
+		return nil, nil
+	}
+	return json.Marshal(sts)
+}
+
+// Scan преобразует []byte в StateTypes при чтении из базы
+func (sts *StateTypes) Scan(value interface{}) error {
+	if value == nil {
+		*sts = nil
+		return nil
+	}
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("неверный тип для StateTypes: %T", value)
+	}
+	var data []StateType
+	if err := json.Unmarshal(bytes, &data); err != nil {
+		return err
+	}
+	*sts = data
+	return nil
+}
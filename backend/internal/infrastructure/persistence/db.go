@@ -44,23 +44,90 @@ func AutoMigrate(db *gorm.DB) error {
 		&entity.Sendpost{},
 		&entity.Stage{},
 		&entity.SendpostSchedule{},
+		&entity.SendpostRun{},
+		&entity.StageRun{},
+		&entity.SendpostRunLock{},
+		&entity.StageDependency{},
 	); err != nil {
 		return err
 	}
 
-	if err := db.Migrator().CreateConstraint(&entity.Sendpost{}, "FirstStage"); err != nil {
+	if err := createConstraint(db, &entity.Sendpost{}, "OnFailureStage"); err != nil {
 		return err
 	}
-	if err := db.Migrator().CreateConstraint(&entity.Stage{}, "Sendpost"); err != nil {
+	if err := createConstraint(db, &entity.Stage{}, "Sendpost"); err != nil {
 		return err
 	}
-	if err := db.Migrator().CreateConstraint(&entity.Stage{}, "NextStage"); err != nil {
+	if err := createConstraint(db, &entity.Stage{}, "NextStage"); err != nil {
 		return err
 	}
-	if err := db.Migrator().CreateConstraint(&entity.Stage{}, "SubStages"); err != nil {
+	if err := createConstraint(db, &entity.Stage{}, "SubStages"); err != nil {
+		return err
+	}
+	if err := createConstraint(db, &entity.SendpostRun{}, "Sendpost"); err != nil {
+		return err
+	}
+	if err := createConstraint(db, &entity.SendpostRun{}, "StageRuns"); err != nil {
+		return err
+	}
+	if err := createConstraint(db, &entity.StageDependency{}, "Stage"); err != nil {
+		return err
+	}
+	if err := createConstraint(db, &entity.StageDependency{}, "DependsOnStage"); err != nil {
+		return err
+	}
+	if err := migrateStageChains(db); err != nil {
 		return err
 	}
 
 	logging.Logger.Info("Database migration completed successfully")
 	return nil
 }
+
+// onFailureChain selects the IDs of the stages of the on-failure chains, they stay linked by NextStageID
+const onFailureChain = `WITH RECURSIVE on_failure AS (
+	SELECT on_failure_stage_id AS id FROM sendposts WHERE on_failure_stage_id IS NOT NULL
+	UNION
+	SELECT stages.next_stage_id FROM stages JOIN on_failure ON stages.id = on_failure.id
+	WHERE stages.next_stage_id IS NOT NULL
+) `
+
+// migrateStageChains converts the NextStageID chains of the top level stages into the stage dependencies:
+// every stage of the chain depends on the previous one. The migration is run only once,
+// it drops the first stage column of the sendposts which isn't used by the stage graph.
+func migrateStageChains(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&entity.Sendpost{}, "first_stage_id") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(onFailureChain + `
+			INSERT INTO stage_dependencies (stage_id, depends_on_stage_id, created_at)
+			SELECT next_stage_id, id, NOW() FROM stages
+			WHERE next_stage_id IS NOT NULL AND parent_stage_id IS NULL AND deleted_at IS NULL
+				AND next_stage_id IN (SELECT id FROM stages WHERE deleted_at IS NULL)
+				AND id NOT IN (SELECT id FROM on_failure)
+			ON CONFLICT DO NOTHING`).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(onFailureChain + `
+			UPDATE stages SET next_stage_id = NULL
+			WHERE next_stage_id IS NOT NULL AND parent_stage_id IS NULL
+				AND id NOT IN (SELECT id FROM on_failure)`).Error; err != nil {
+			return err
+		}
+		if err := tx.Migrator().DropColumn(&entity.Sendpost{}, "first_stage_id"); err != nil {
+			return err
+		}
+		logging.Logger.Info("Stage chains migrated to stage dependencies")
+		return nil
+	})
+}
+
+// createConstraint creates the constraint only if it doesn't exist yet,
+// so the migration could be run on every start.
+func createConstraint(db *gorm.DB, model interface{}, name string) error {
+	if db.Migrator().HasConstraint(model, name) {
+		return nil
+	}
+	return db.Migrator().CreateConstraint(model, name)
+}
@@ -39,7 +39,7 @@ func (sr *gormSendpostRepository) DeleteSendpost(ctx context.Context, sendpostID
 }
 
 // GetSendpostByID retrieves a Sendpost entity by its ID from the database.
-// It uses the provided context for database operations and preloads the "FirstStage" relation.
+// It uses the provided context for database operations.
 // Returns the Sendpost entity if found, or an error if not found or if a database error occurs.
 func (sr *gormSendpostRepository) GetSendpostByID(ctx context.Context, sendpostID uint) (*entity.Sendpost, error) {
 	var sendpost *entity.Sendpost
@@ -70,19 +70,18 @@ func (sr *gormSendpostRepository) GetSendposts(ctx context.Context) ([]*entity.S
 	return sendposts, nil
 }
 
-// GetFirstStage retrieves the first stage associated with a given sendpost ID.
-// It uses the provided context for database operations and returns the first stage
-// entity or an error if the operation fails.
-func (sr *gormSendpostRepository) GetFirstStage(ctx context.Context, sendpostID uint) (*entity.Stage, error) {
+// GetOnFailureStage retrieves the first stage of the on-failure chain of the sendpost.
+// It returns nil if the sendpost has no on-failure stages.
+func (sr *gormSendpostRepository) GetOnFailureStage(ctx context.Context, sendpostID uint) (*entity.Stage, error) {
 	var sendpost entity.Sendpost
 	if err := sr.db.WithContext(ctx).
-		Preload("FirstStage").
+		Preload("OnFailureStage").
 		Where("id = ?", sendpostID).
 		First(&sendpost).Error; err != nil {
 		return nil, err
 	}
-	logging.Debug("[Senpost repo] GetFirstStage", zap.Any("first_stage", sendpost.FirstStage))
-	return sendpost.FirstStage, nil
+	logging.Debug("[Senpost repo] GetOnFailureStage", zap.Any("on_failure_stage", sendpost.OnFailureStage))
+	return sendpost.OnFailureStage, nil
 }
 
 // GetSendpostParameters retrieves the global parameters of a Sendpost entity
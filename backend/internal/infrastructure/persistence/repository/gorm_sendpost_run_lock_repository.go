@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/repository"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormSendpostRunLockRepository struct {
+	db *gorm.DB
+}
+
+// NewGormSendpostRunLockRepository creates a new instance of gormSendpostRunLockRepository
+// using the provided gorm.DB connection. It returns an implementation of
+// the SendpostRunLockRepository interface.
+func NewGormSendpostRunLockRepository(db *gorm.DB) repository.SendpostRunLockRepository {
+	return &gormSendpostRunLockRepository{db: db}
+}
+
+// AcquireLock takes the lease of the sendpost for the owner until expiresAt.
+// The lease is taken only if it doesn't exist or has expired, the check and the update
+// are done in a single upsert statement, so only one of the competing owners succeeds.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values, cancellation, and deadlines.
+//	sendpostID - The unique identifier of the sendpost to be locked.
+//	owner - The unique identifier of the lock owner.
+//	expiresAt - The time the lease expires if it isn't renewed.
+//
+// Returns:
+//
+//	bool - true if the lease has been taken.
+//	error - An error if a database error occurs.
+func (r *gormSendpostRunLockRepository) AcquireLock(ctx context.Context, sendpostID uint, owner string, expiresAt time.Time) (bool, error) {
+	lock := entity.SendpostRunLock{
+		SendpostID: sendpostID,
+		Owner:      owner,
+		ExpiresAt:  expiresAt,
+	}
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "sendpost_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"owner", "expires_at", "updated_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Lt{Column: clause.Column{Table: "sendpost_run_locks", Name: "expires_at"}, Value: time.Now()},
+			}},
+		}).
+		Create(&lock)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RenewLock prolongs the lease of the owner until expiresAt.
+// Returns false if the lease doesn't belong to the owner anymore.
+func (r *gormSendpostRunLockRepository) RenewLock(ctx context.Context, sendpostID uint, owner string, expiresAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&entity.SendpostRunLock{}).
+		Where("sendpost_id = ? AND owner = ?", sendpostID, owner).
+		Update("expires_at", expiresAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseLock removes the lease of the owner. The lease taken over by another owner is kept.
+func (r *gormSendpostRunLockRepository) ReleaseLock(ctx context.Context, sendpostID uint, owner string) error {
+	return r.db.WithContext(ctx).
+		Where("sendpost_id = ? AND owner = ?", sendpostID, owner).
+		Delete(&entity.SendpostRunLock{}).Error
+}
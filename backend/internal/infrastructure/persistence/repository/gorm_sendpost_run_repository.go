@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/repository"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type gormSendpostRunRepository struct {
+	db *gorm.DB
+}
+
+// NewGormSendpostRunRepository creates a new instance of gormSendpostRunRepository
+// using the provided gorm.DB connection. It returns an implementation of
+// the SendpostRunRepository interface.
+func NewGormSendpostRunRepository(db *gorm.DB) repository.SendpostRunRepository {
+	return &gormSendpostRunRepository{db: db}
+}
+
+// SaveSendpostRun persists a SendpostRun entity to the database using the provided context.
+// Associated stage runs are not saved, they are persisted by StageRunRepository.
+func (r *gormSendpostRunRepository) SaveSendpostRun(ctx context.Context, run *entity.SendpostRun) error {
+	logging.Debug("[SendpostRun repo] SaveSendpostRun", zap.Any("run", run))
+	return r.db.WithContext(ctx).Omit(clause.Associations).Save(run).Error
+}
+
+// GetSendpostRunByID retrieves a SendpostRun entity by its ID from the database
+// and preloads its stage runs ordered by the start time.
+// Returns an error if the run is not found or if a database error occurs.
+func (r *gormSendpostRunRepository) GetSendpostRunByID(ctx context.Context, runID uint) (*entity.SendpostRun, error) {
+	var run *entity.SendpostRun
+
+	if err := r.db.WithContext(ctx).
+		Preload("StageRuns", func(db *gorm.DB) *gorm.DB {
+			return db.Order("started_at asc, id asc")
+		}).
+		First(&run, runID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("sendpost run not found")
+		}
+		return nil, err
+	}
+	logging.Debug("[SendpostRun repo] GetSendpostRunByID", zap.Any("run", run))
+	return run, nil
+}
+
+// GetSendpostRuns retrieves all runs of the sendpost ordered from the latest to the oldest.
+// Stage runs are not preloaded.
+func (r *gormSendpostRunRepository) GetSendpostRuns(ctx context.Context, sendpostID uint) ([]*entity.SendpostRun, error) {
+	var runs []*entity.SendpostRun
+
+	if err := r.db.WithContext(ctx).
+		Where("sendpost_id = ?", sendpostID).
+		Order("started_at desc, id desc").
+		Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	logging.Debug("[SendpostRun repo] GetSendpostRuns", zap.Any("runs", runs))
+	return runs, nil
+}
+
+// GetLastSendpostRun retrieves the latest run of the sendpost with its stage runs.
+// Returns nil if the sendpost has never been run.
+func (r *gormSendpostRunRepository) GetLastSendpostRun(ctx context.Context, sendpostID uint) (*entity.SendpostRun, error) {
+	var runs []*entity.SendpostRun
+
+	if err := r.db.WithContext(ctx).
+		Preload("StageRuns", func(db *gorm.DB) *gorm.DB {
+			return db.Order("started_at asc, id asc")
+		}).
+		Where("sendpost_id = ?", sendpostID).
+		Order("started_at desc, id desc").
+		Limit(1).
+		Find(&runs).Error; err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, nil
+	}
+	logging.Debug("[SendpostRun repo] GetLastSendpostRun", zap.Any("run", runs[0]))
+	return runs[0], nil
+}
@@ -5,6 +5,7 @@ import (
 	"crm-uplift-ii24-backend/internal/domain/entity"
 	"crm-uplift-ii24-backend/internal/domain/repository"
 	"errors"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -55,30 +56,66 @@ func (r *gormSendpostScheduleRepository) GetScheduleByID(ctx context.Context, sc
 	return &sendpost, nil
 }
 
-// GetScheduleBySendpostID retrieves a SendpostSchedule entity from the database
-// using the provided sendpostID. It returns the SendpostSchedule if found,
-// or an error if the schedule is not found or if any other database error occurs.
+// GetSchedulesBySendpostID retrieves all SendpostSchedule entities of the sendpost
+// ordered by the planned time.
 //
 // Parameters:
 //
 //	ctx - The context for managing request-scoped values, cancellation, and deadlines.
-//	sendpostID - The unique identifier for the SendpostSchedule to be retrieved.
+//	sendpostID - The unique identifier of the sendpost.
 //
 // Returns:
 //
-//	*entity.SendpostSchedule - The retrieved SendpostSchedule entity.
-//	error - An error if the schedule is not found or if a database error occurs.
-func (r *gormSendpostScheduleRepository) GetScheduleBySendpostID(ctx context.Context, sendpostID uint) (*entity.SendpostSchedule, error) {
-	var sendpost entity.SendpostSchedule
+//	[]*entity.SendpostSchedule - The schedules of the sendpost.
+//	error - An error if a database error occurs.
+func (r *gormSendpostScheduleRepository) GetSchedulesBySendpostID(ctx context.Context, sendpostID uint) ([]*entity.SendpostSchedule, error) {
+	var schedules []*entity.SendpostSchedule
 
 	if err := r.db.WithContext(ctx).
 		Where("sendpost_id = ?", sendpostID).
-		First(&sendpost).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return nil, errors.New("schedule not found")
-		} else {
-			return nil, err
-		}
+		Order("planned_at asc").
+		Find(&schedules).Error; err != nil {
+		return nil, err
 	}
-	return &sendpost, nil
+	return schedules, nil
+}
+
+// GetPendingSchedules retrieves the schedules which haven't been started or skipped yet
+// and the recurring schedules ordered by the planned time.
+// The recurring schedule may be left started if the service stopped during its run.
+func (r *gormSendpostScheduleRepository) GetPendingSchedules(ctx context.Context) ([]*entity.SendpostSchedule, error) {
+	var schedules []*entity.SendpostSchedule
+
+	if err := r.db.WithContext(ctx).
+		Where("(started_at IS NULL AND skipped_at IS NULL) OR (cron_expression IS NOT NULL AND cron_expression <> '')").
+		Order("planned_at asc").
+		Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	return schedules, nil
+}
+
+// ClaimSchedule atomically marks the schedule planned at plannedAt as started, so only one replica
+// runs it. The schedule which was changed, started or skipped meanwhile isn't claimed.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values, cancellation, and deadlines.
+//	scheduleID - The unique identifier of the schedule.
+//	plannedAt - The planned time the schedule fired at.
+//	startedAt - The time the run is started at.
+//
+// Returns:
+//
+//	bool - Whether the schedule was claimed.
+//	error - An error if a database error occurs.
+func (r *gormSendpostScheduleRepository) ClaimSchedule(ctx context.Context, scheduleID uint, plannedAt time.Time, startedAt time.Time) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&entity.SendpostSchedule{}).
+		Where("id = ? AND planned_at = ? AND started_at IS NULL AND skipped_at IS NULL", scheduleID, plannedAt).
+		Update("started_at", startedAt)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
 }
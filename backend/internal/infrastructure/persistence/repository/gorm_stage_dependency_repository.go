@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/repository"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type gormStageDependencyRepository struct {
+	db *gorm.DB
+}
+
+// NewGormStageDependencyRepository creates a new instance of gormStageDependencyRepository
+// using the provided gorm.DB connection. It returns an implementation of the
+// repository.StageDependencyRepository interface.
+func NewGormStageDependencyRepository(db *gorm.DB) repository.StageDependencyRepository {
+	return &gormStageDependencyRepository{db: db}
+}
+
+// SaveDependency saves the dependency of the stage on the other stage.
+func (r *gormStageDependencyRepository) SaveDependency(ctx context.Context, dependency *entity.StageDependency) error {
+	logging.Debug("[StageDependency repo] SaveDependency", zap.Any("dependency", dependency))
+	return r.db.WithContext(ctx).Save(dependency).Error
+}
+
+// DeleteDependency removes the dependency of the stage on the other stage.
+func (r *gormStageDependencyRepository) DeleteDependency(ctx context.Context, stageID uint, dependsOnStageID uint) error {
+	logging.Debug("[StageDependency repo] DeleteDependency", zap.Uint("stage_id", stageID), zap.Uint("depends_on_stage_id", dependsOnStageID))
+	return r.db.WithContext(ctx).
+		Where("stage_id = ? AND depends_on_stage_id = ?", stageID, dependsOnStageID).
+		Delete(&entity.StageDependency{}).Error
+}
+
+// DeleteStageDependencies removes the dependencies of the stage and on the stage.
+func (r *gormStageDependencyRepository) DeleteStageDependencies(ctx context.Context, stageID uint) error {
+	logging.Debug("[StageDependency repo] DeleteStageDependencies", zap.Uint("stage_id", stageID))
+	return r.db.WithContext(ctx).
+		Where("stage_id = ? OR depends_on_stage_id = ?", stageID, stageID).
+		Delete(&entity.StageDependency{}).Error
+}
+
+// GetSendpostDependencies retrieves the dependencies between the stages of the sendpost.
+func (r *gormStageDependencyRepository) GetSendpostDependencies(ctx context.Context, sendpostID uint) ([]*entity.StageDependency, error) {
+	var dependencies []*entity.StageDependency
+
+	if err := r.db.WithContext(ctx).
+		Joins("JOIN stages ON stages.id = stage_dependencies.stage_id AND stages.deleted_at IS NULL").
+		Where("stages.sendpost_id = ?", sendpostID).
+		Order("stage_dependencies.id asc").
+		Find(&dependencies).Error; err != nil {
+		return nil, err
+	}
+	logging.Debug("[StageDependency repo] GetSendpostDependencies", zap.Any("dependencies", dependencies))
+	return dependencies, nil
+}
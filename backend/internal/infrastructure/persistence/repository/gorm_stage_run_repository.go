@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/repository"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type gormStageRunRepository struct {
+	db *gorm.DB
+}
+
+// NewGormStageRunRepository creates a new instance of gormStageRunRepository
+// using the provided gorm.DB connection. It returns an implementation of
+// the StageRunRepository interface.
+func NewGormStageRunRepository(db *gorm.DB) repository.StageRunRepository {
+	return &gormStageRunRepository{db: db}
+}
+
+// SaveStageRun persists a StageRun entity to the database using the provided context.
+// It returns an error if the operation fails.
+func (r *gormStageRunRepository) SaveStageRun(ctx context.Context, stageRun *entity.StageRun) error {
+	logging.Debug("[StageRun repo] SaveStageRun", zap.Any("stage_run", stageRun))
+	return r.db.WithContext(ctx).Save(stageRun).Error
+}
+
+// GetStageRun retrieves the latest run of the stage within the given sendpost run.
+// Returns nil without an error if the stage hasn't been run yet.
+func (r *gormStageRunRepository) GetStageRun(ctx context.Context, sendpostRunID uint, stageID uint) (*entity.StageRun, error) {
+	var stageRun *entity.StageRun
+
+	if err := r.db.WithContext(ctx).
+		Where("sendpost_run_id = ? AND stage_id = ?", sendpostRunID, stageID).
+		Order("id desc").
+		First(&stageRun).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	logging.Debug("[StageRun repo] GetStageRun", zap.Any("stage_run", stageRun))
+	return stageRun, nil
+}
+
+// GetStageRuns retrieves all stage runs of the sendpost run ordered by the start time.
+func (r *gormStageRunRepository) GetStageRuns(ctx context.Context, sendpostRunID uint) ([]*entity.StageRun, error) {
+	var stageRuns []*entity.StageRun
+
+	if err := r.db.WithContext(ctx).
+		Where("sendpost_run_id = ?", sendpostRunID).
+		Order("started_at asc, id asc").
+		Find(&stageRuns).Error; err != nil {
+		return nil, err
+	}
+	logging.Debug("[StageRun repo] GetStageRuns", zap.Any("stage_runs", stageRuns))
+	return stageRuns, nil
+}
@@ -9,44 +9,67 @@ import (
 
 type sendpostScheduler struct {
 	queue           chan entity.SendpostSchedule
-	activeSchedules map[uint]context.CancelFunc
+	activeSchedules map[uint]*activeSchedule
 	mu              sync.Mutex
 }
 
+type activeSchedule struct {
+	cancel context.CancelFunc
+}
+
 func NewSendpostScheduler() entity.SendpostScheduler {
 	return &sendpostScheduler{
 		queue:           make(chan entity.SendpostSchedule, 100),
-		activeSchedules: make(map[uint]context.CancelFunc),
+		activeSchedules: make(map[uint]*activeSchedule),
 	}
 }
 
+// AddSchedule waits until the schedule's PlannedAt and puts it to the queue.
+// If the schedule with the same ID is already waiting it is replaced.
+// The schedule is dropped if ctx is done before it has been queued.
 func (q *sendpostScheduler) AddSchedule(ctx context.Context, schedule entity.SendpostSchedule) {
+	scheduleCtx, cancel := context.WithCancel(ctx)
+	active := &activeSchedule{cancel: cancel}
+
 	q.mu.Lock()
-	if cancel, exists := q.activeSchedules[schedule.SendpostID]; exists {
-		cancel() // Отмена старой задачи, если расписание обновилось
+	if old, exists := q.activeSchedules[schedule.ID]; exists {
+		old.cancel() // Отмена старой задачи, если расписание обновилось
 	}
-	_, cancel := context.WithCancel(ctx)
-	q.activeSchedules[schedule.SendpostID] = cancel
+	q.activeSchedules[schedule.ID] = active
 	q.mu.Unlock()
-	delay := time.Until(schedule.PlannedAt)
-	if delay > 0 {
-		go func() {
-			time.Sleep(delay)
-			q.mu.Lock()
-			delete(q.activeSchedules, schedule.SendpostID)
+
+	go func() {
+		defer cancel()
+
+		timer := time.NewTimer(time.Until(schedule.PlannedAt))
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-scheduleCtx.Done():
+			return
+		}
+
+		q.mu.Lock()
+		if q.activeSchedules[schedule.ID] != active {
 			q.mu.Unlock()
-			q.queue <- schedule
-		}()
-	} else {
-		q.queue <- schedule
-	}
+			return
+		}
+		delete(q.activeSchedules, schedule.ID)
+		q.mu.Unlock()
+
+		select {
+		case q.queue <- schedule:
+		case <-ctx.Done():
+		}
+	}()
 }
 
-func (q *sendpostScheduler) RemoveSchedule(sendpostID uint) {
+func (q *sendpostScheduler) RemoveSchedule(scheduleID uint) {
 	q.mu.Lock()
-	if cancel, exists := q.activeSchedules[sendpostID]; exists {
-		cancel()
-		delete(q.activeSchedules, sendpostID)
+	if active, exists := q.activeSchedules[scheduleID]; exists {
+		active.cancel()
+		delete(q.activeSchedules, scheduleID)
 	}
 	q.mu.Unlock()
 }
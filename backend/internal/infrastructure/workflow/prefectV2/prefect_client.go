@@ -8,6 +8,7 @@ import (
 	requests "crm-uplift-ii24-backend/internal/infrastructure/workflow/prefectV2/requests"
 	responses "crm-uplift-ii24-backend/internal/infrastructure/workflow/prefectV2/responses"
 	"crm-uplift-ii24-backend/pkg/logging"
+	"crm-uplift-ii24-backend/pkg/schema"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -150,6 +151,66 @@ func (pc *PrefectClientV2) Status(ctx context.Context, flowRunID string) (stateT
 	return &response.StateType, nil
 }
 
+// Cancel asks the Prefect API to cancel the flow run by setting it to the CANCELLING state.
+// Prefect cancels the infrastructure of the flow run and then moves it to CANCELLED.
+// Returns an error if the request fails or the state transition isn't accepted.
+//
+// Parameters:
+//
+//	ctx - The context for the HTTP request, allowing for cancellation and timeouts.
+//	flowRunID - The unique identifier of the flow run to be cancelled.
+//
+// Returns:
+//
+//	An error if the request fails or Prefect rejected the cancellation, otherwise nil.
+func (pc *PrefectClientV2) Cancel(ctx context.Context, flowRunID string) error {
+	url := fmt.Sprintf("%s/flow_runs/%s/set_state", pc.prefectApiUrl, flowRunID)
+
+	reqBody := requests.SetStateRequest{
+		State: requests.State{
+			Type:    value.Cancelling,
+			Name:    "Cancelling",
+			Message: "Cancelled by OBSERVER",
+		},
+	}
+
+	logging.Debug("[PrefectClientV2] Cancel", zap.String("flow_run_id", flowRunID), zap.Any("request", reqBody))
+
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("accept", applicationJSON)
+	req.Header.Set("Content-Type", applicationJSON)
+
+	resp, err := pc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to cancel flow run: %s", resp.Status)
+	}
+
+	var response responses.SetStateResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return err
+	}
+
+	logging.Debug("[PrefectClientV2] Cancel", zap.Any("response", response))
+
+	if response.Status != responses.SetStateAccepted {
+		return fmt.Errorf("flow run cancellation %s: %s", response.Status, response.Details.Reason)
+	}
+	return nil
+}
+
 // CheckFlowRunCompletionByDeploymentID checks if a flow run has completed for a given deployment ID
 // within a specified time interval. It sends a POST request to the Prefect API to retrieve flow run
 // history and checks the response for completed states. Returns an error if the flow run hasn't
@@ -269,3 +330,120 @@ func (pc *PrefectClientV2) GetDeploymentParameters(ctx context.Context, deployme
 
 	return response.Parameters, nil
 }
+
+// GetDeploymentSchema retrieves the OpenAPI schema of the parameters of the deployment
+// (parameter_openapi_schema) the parameters of the flow run are validated against.
+//
+// Parameters:
+//
+//	ctx - The context for the HTTP request, allowing for cancellation and timeouts.
+//	deploymentID - The unique identifier of the deployment whose schema is to be fetched.
+//
+// Returns:
+//
+//	The schema of the parameters, nil if the deployment doesn't have it.
+//	An error if the request fails or if the response cannot be decoded.
+func (pc *PrefectClientV2) GetDeploymentSchema(ctx context.Context, deploymentID string) (*schema.Schema, error) {
+	url := fmt.Sprintf("%s/deployments/%s", pc.prefectApiUrl, deploymentID)
+
+	var response responses.ParametersResponse
+	if err := pc.do(ctx, "GET", url, nil, &response); err != nil {
+		return nil, fmt.Errorf("failed to read deployment parameter schema: %w", err)
+	}
+	return response.ParameterOpenAPISchema, nil
+}
+
+// Result retrieves the output of the completed flow run from the Prefect API.
+// The output consists of the literal result of the flow run state and the keyed
+// artifacts created by the flow run, the artifact data is put by the artifact key.
+// The result persisted in the result storage is a reference and isn't read.
+//
+// Parameters:
+//
+//	ctx - The context for the HTTP request, allowing for cancellation and timeouts.
+//	flowRunID - The unique identifier of the completed flow run.
+//
+// Returns:
+//
+//	A map containing the output of the flow run, empty if the flow run has no output.
+//	An error if the requests fail or if the responses cannot be decoded.
+func (pc *PrefectClientV2) Result(ctx context.Context, flowRunID string) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+
+	var flowRun responses.FlowRunResultResponse
+	if err := pc.do(ctx, "GET", fmt.Sprintf("%s/flow_runs/%s", pc.prefectApiUrl, flowRunID), nil, &flowRun); err != nil {
+		return nil, fmt.Errorf("failed to read flow run result: %w", err)
+	}
+	if flowRun.State != nil && len(flowRun.State.Data) > 0 {
+		var literal responses.ResultLiteral
+		if err := json.Unmarshal(flowRun.State.Data, &literal); err == nil && literal.Type == responses.ResultTypeLiteral {
+			if values, ok := literal.Value.(map[string]interface{}); ok {
+				for k, v := range values {
+					result[k] = v
+				}
+			} else if literal.Value != nil {
+				result["value"] = literal.Value
+			}
+		}
+	}
+
+	reqBody := requests.ArtifactFilterRequest{
+		Artifacts: requests.ArtifactFilter{
+			FlowRunID: requests.FlowRunIDFilter{Any: []string{flowRunID}},
+		},
+	}
+	var artifacts []responses.ArtifactResponse
+	if err := pc.do(ctx, "POST", fmt.Sprintf("%s/artifacts/filter", pc.prefectApiUrl), reqBody, &artifacts); err != nil {
+		return nil, fmt.Errorf("failed to read flow run artifacts: %w", err)
+	}
+	for _, artifact := range artifacts {
+		if artifact.Key == nil || *artifact.Key == "" {
+			continue
+		}
+		data := artifact.Data
+		// Артефакты с JSON в виде строки разбираются, остальные сохраняются как есть
+		if s, ok := data.(string); ok {
+			var parsed interface{}
+			if err := json.Unmarshal([]byte(s), &parsed); err == nil {
+				data = parsed
+			}
+		}
+		result[*artifact.Key] = data
+	}
+
+	logging.Debug("[PrefectClientV2] Result", zap.String("flow_run_id", flowRunID), zap.Any("result", result))
+
+	return result, nil
+}
+
+// do sends the request with the JSON body, if any, and decodes the JSON response into out.
+func (pc *PrefectClientV2) do(ctx context.Context, method string, url string, reqBody interface{}, out interface{}) error {
+	body := bytes.NewBuffer(nil)
+	if reqBody != nil {
+		b, err := json.Marshal(reqBody)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("accept", applicationJSON)
+	if reqBody != nil {
+		req.Header.Set("Content-Type", applicationJSON)
+	}
+
+	resp, err := pc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,13 @@
+package prefectV2
+
+type ArtifactFilterRequest struct {
+	Artifacts ArtifactFilter `json:"artifacts"`
+}
+
+type ArtifactFilter struct {
+	FlowRunID FlowRunIDFilter `json:"flow_run_id"`
+}
+
+type FlowRunIDFilter struct {
+	Any []string `json:"any_"`
+}
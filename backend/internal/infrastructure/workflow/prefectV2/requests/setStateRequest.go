@@ -0,0 +1,14 @@
+package prefectV2
+
+import "crm-uplift-ii24-backend/internal/domain/value"
+
+type SetStateRequest struct {
+	State State `json:"state"`
+	Force bool  `json:"force"`
+}
+
+type State struct {
+	Type    value.StateType `json:"type"`
+	Name    string          `json:"name,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
@@ -1,5 +1,8 @@
 package prefectV2
 
+import "crm-uplift-ii24-backend/pkg/schema"
+
 type ParametersResponse struct {
-	Parameters map[string]interface{} `json:"parameters"`
+	Parameters             map[string]interface{} `json:"parameters"`
+	ParameterOpenAPISchema *schema.Schema         `json:"parameter_openapi_schema"`
 }
@@ -0,0 +1,29 @@
+package prefectV2
+
+import "encoding/json"
+
+// FlowRunResultResponse is the flow run with the data of its final state.
+type FlowRunResultResponse struct {
+	FlowID string        `json:"id"`
+	State  *FlowRunState `json:"state"`
+}
+
+type FlowRunState struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// ResultLiteral is the result of the flow run persisted in the state itself.
+// The results persisted in the storage are references and aren't read.
+type ResultLiteral struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+const ResultTypeLiteral = "literal"
+
+type ArtifactResponse struct {
+	Key  *string     `json:"key"`
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
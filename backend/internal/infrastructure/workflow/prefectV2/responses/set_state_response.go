@@ -0,0 +1,12 @@
+package prefectV2
+
+const SetStateAccepted string = "ACCEPT"
+
+type SetStateResponse struct {
+	Status  string         `json:"status"`
+	Details SetStateDetail `json:"details"`
+}
+
+type SetStateDetail struct {
+	Reason string `json:"reason"`
+}
@@ -34,12 +34,12 @@ func (_m *SendpostRepository) DeleteSendpost(ctx context.Context, sendpostID uin
 	return r0
 }
 
-// GetFirstStage provides a mock function with given fields: ctx, sendpostID
-func (_m *SendpostRepository) GetFirstStage(ctx context.Context, sendpostID uint) (*entity.Stage, error) {
+// GetOnFailureStage provides a mock function with given fields: ctx, sendpostID
+func (_m *SendpostRepository) GetOnFailureStage(ctx context.Context, sendpostID uint) (*entity.Stage, error) {
 	ret := _m.Called(ctx, sendpostID)
 
 	if len(ret) == 0 {
-		panic("no return value specified for GetFirstStage")
+		panic("no return value specified for GetOnFailureStage")
 	}
 
 	var r0 *entity.Stage
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ErrorAwaitApproval    string = "[ApprovalService] error AwaitApproval"
+	ErrorDecide           string = "[ApprovalService] error Decide"
+	StageAwaitingApproval string = "[ApprovalService] Stage awaiting approval"
+	StageApproved         string = "[ApprovalService] Stage approved"
+	StageRejected         string = "[ApprovalService] Stage rejected"
+	StageApprovalExpired  string = "[ApprovalService] Stage approval expired"
+)
+
+// approvalPollInterval is how often the waiting stage checks the decision made on another replica
+const approvalPollInterval = 10 * time.Second
+
+var (
+	// ErrApprovalStageRequired means several stages of the run are awaiting approval and the stage isn't specified
+	ErrApprovalStageRequired = errors.New("several stages are awaiting approval, stage_id is required")
+	// ErrRunNotFound means the run doesn't exist or doesn't belong to the sendpost
+	ErrRunNotFound = errors.New("sendpost run not found")
+)
+
+// ApprovalService pauses the run on the approval stage until the stage is approved or rejected.
+// The decision is saved in the stage run, so it may be made on any replica
+// and the stage awaiting approval survives the restart of the backend.
+type ApprovalService struct {
+	sendpostService     *SendpostService
+	stageService        *StageService
+	stageRunnerService  *StageRunnerService
+	runHistoryService   *RunHistoryService
+	notificationService *SenpostRunNotificationService
+
+	// decisions wake up the stages waiting on this replica by the stage run ID
+	decisions map[uint]chan struct{}
+	mu        sync.Mutex
+}
+
+func NewApprovalService(sendpostService *SendpostService, stageService *StageService, stageRunnerService *StageRunnerService, runHistoryService *RunHistoryService, notificationService *SenpostRunNotificationService) *ApprovalService {
+	return &ApprovalService{
+		sendpostService:     sendpostService,
+		stageService:        stageService,
+		stageRunnerService:  stageRunnerService,
+		runHistoryService:   runHistoryService,
+		notificationService: notificationService,
+		decisions:           make(map[uint]chan struct{}),
+	}
+}
+
+// AwaitApproval records the start of the approval stage and pauses the stage, the run and the sendpost.
+// The stage which was awaiting approval before the restart keeps its record and its expiry time.
+//
+// Parameters:
+//
+//	ctx - The context of the run.
+//	run - The sendpost run the stage is executed within.
+//	stage - The approval stage.
+//
+// Returns:
+//
+//	error - An error if the stage couldn't be paused.
+func (s *ApprovalService) AwaitApproval(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	stageRun, err := s.runHistoryService.GetStageRun(ctx, run, stage)
+	if err != nil {
+		return logging.WrapError(ErrorAwaitApproval, err)
+	}
+	if stageRun == nil || !stageRun.IsPaused() {
+		stageRun, err = s.runHistoryService.StartStageRun(ctx, run, stage)
+		if err != nil {
+			return s.stageRunnerService.HandleFailedStage(ctx, run, stage, logging.WrapError(ErrorAwaitApproval, err))
+		}
+		stageRun.AwaitApproval(stage.GetApprovalTimeout())
+		if err := s.runHistoryService.SaveStageRun(ctx, stageRun); err != nil {
+			return s.stageRunnerService.HandleFailedStage(ctx, run, stage, logging.WrapError(ErrorAwaitApproval, err))
+		}
+	}
+	logging.Info(StageAwaitingApproval, zap.Uint("stage_id", stage.ID), zap.Uint("stage_run_id", stageRun.ID), zap.Timep("expires_at", stageRun.ExpiresAt))
+
+	if err := s.stageService.UpdateStageState(ctx, stage, value.Paused); err != nil {
+		return err
+	}
+	if err := s.runHistoryService.PauseRun(ctx, run); err != nil {
+		logging.Warn(ErrorAwaitApproval, zap.Uint("run_id", run.ID), zap.Error(err))
+	}
+	if err := s.sendpostService.UpdateSendpostState(ctx, run.SendpostID, value.Paused); err != nil {
+		return err
+	}
+	if err := s.notificationService.NotifyRunSendpost(run.SendpostID, value.Paused); err != nil {
+		logging.Warn(ErrorNotifyRunSendpost)
+	}
+	return nil
+}
+
+// WaitForDecision blocks until the approval stage is approved, rejected or its approval expires.
+// The approved stage is completed, the rejected and the expired ones are failed with
+// the REJECTED and EXPIRED reasons. The run and the sendpost are resumed when
+// no other stage of the run is awaiting approval.
+// If ctx is done, the stage is cancelled with HandleCancelledStage.
+func (s *ApprovalService) WaitForDecision(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	stageRun, err := s.runHistoryService.GetStageRun(ctx, run, stage)
+	if err != nil || stageRun == nil {
+		return s.stageRunnerService.HandleFailedStage(ctx, run, stage, fmt.Errorf("%s: stage run not found: %v", ErrorAwaitApproval, err))
+	}
+	decided := s.subscribe(stageRun.ID)
+	defer s.unsubscribe(stageRun.ID)
+
+	var expired <-chan time.Time
+	if stageRun.ExpiresAt != nil {
+		timer := time.NewTimer(time.Until(*stageRun.ExpiresAt))
+		defer timer.Stop()
+		expired = timer.C
+	}
+	ticker := time.NewTicker(approvalPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return s.stageRunnerService.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
+		case <-decided:
+		case <-ticker.C:
+		case <-expired:
+		}
+
+		stageRun, err = s.runHistoryService.GetStageRun(ctx, run, stage)
+		if err != nil {
+			logging.Warn(ErrorAwaitApproval, zap.Uint("stage_id", stage.ID), zap.Error(err))
+			continue
+		}
+		if stageRun.Decision != nil {
+			return s.applyDecision(ctx, run, stage, stageRun)
+		}
+		if stageRun.IsExpired(time.Now()) {
+			logging.Warn(StageApprovalExpired, zap.Uint("stage_id", stage.ID))
+			s.resume(ctx, run, stage)
+			return s.stageRunnerService.HandleFailedStageWithReason(ctx, run, stage, value.ReasonExpired,
+				fmt.Errorf("approval expired at %s", stageRun.ExpiresAt.Format(time.RFC3339)))
+		}
+	}
+}
+
+// applyDecision completes the approved stage or fails the rejected one and resumes the run.
+func (s *ApprovalService) applyDecision(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, stageRun *entity.StageRun) error {
+	s.resume(ctx, run, stage)
+	if *stageRun.Decision == value.Approved {
+		logging.Info(StageApproved, zap.Uint("stage_id", stage.ID))
+		return s.stageRunnerService.UpdateState(ctx, run, stage, value.Completed)
+	}
+	logging.Warn(StageRejected, zap.Uint("stage_id", stage.ID))
+	err := errors.New("approval rejected")
+	if stageRun.DecisionComment != nil {
+		err = fmt.Errorf("%w: %s", err, *stageRun.DecisionComment)
+	}
+	return s.stageRunnerService.HandleFailedStageWithReason(ctx, run, stage, value.ReasonRejected, err)
+}
+
+// resume marks the run and the sendpost as running again unless
+// another stage of the run is still awaiting approval.
+func (s *ApprovalService) resume(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) {
+	stageRuns, err := s.runHistoryService.GetStageRuns(ctx, run)
+	if err != nil {
+		logging.Warn(ErrorAwaitApproval, zap.Uint("run_id", run.ID), zap.Error(err))
+		return
+	}
+	for _, stageRun := range stageRuns {
+		if stageRun.StageID != stage.ID && stageRun.IsPaused() {
+			return
+		}
+	}
+	if err := s.runHistoryService.ResumeRun(ctx, run); err != nil {
+		logging.Warn(ErrorAwaitApproval, zap.Uint("run_id", run.ID), zap.Error(err))
+	}
+	if err := s.sendpostService.UpdateSendpostState(ctx, run.SendpostID, value.Running); err != nil {
+		logging.Warn(ErrorAwaitApproval, zap.Uint("sendpost_id", run.SendpostID), zap.Error(err))
+	}
+	if err := s.notificationService.NotifyRunSendpost(run.SendpostID, value.Running); err != nil {
+		logging.Warn(ErrorNotifyRunSendpost)
+	}
+}
+
+// Decide records the decision on the stage of the run awaiting approval with the comment.
+// The waiting stage is resumed on this replica at once, on another replica within approvalPollInterval.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//	sendpostID - The sendpost the run belongs to.
+//	runID - The paused run.
+//	stageID - The approval stage, may be nil if only one stage of the run is awaiting approval.
+//	decision - Approved or Rejected.
+//	comment - The comment of the decision, may be empty.
+//
+// Returns:
+//
+//	*entity.StageRun - The stage run the decision was made on.
+//	error - ErrRunNotFound, entity.ErrApprovalNotPending, ErrApprovalStageRequired or a repository error.
+func (s *ApprovalService) Decide(ctx context.Context, sendpostID uint, runID uint, stageID *uint, decision value.ApprovalDecision, comment string) (*entity.StageRun, error) {
+	run, err := s.runHistoryService.GetSendpostRun(ctx, sendpostID, runID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRunNotFound, err)
+	}
+
+	var awaiting []*entity.StageRun
+	for _, stageRun := range run.AwaitingApprovalStageRuns(time.Now()) {
+		if stageID == nil || stageRun.StageID == *stageID {
+			awaiting = append(awaiting, stageRun)
+		}
+	}
+	if len(awaiting) == 0 {
+		return nil, fmt.Errorf("%w: no stage of run %d is awaiting approval", entity.ErrApprovalNotPending, runID)
+	}
+	if len(awaiting) > 1 {
+		return nil, ErrApprovalStageRequired
+	}
+
+	stageRun := awaiting[0]
+	if err := stageRun.Decide(decision, comment); err != nil {
+		return nil, err
+	}
+	if err := s.runHistoryService.SaveStageRun(ctx, stageRun); err != nil {
+		return nil, logging.WrapError(ErrorDecide, err)
+	}
+	logging.Info("[ApprovalService] Decision made", zap.Uint("run_id", runID), zap.Uint("stage_id", stageRun.StageID), zap.String("decision", string(decision)))
+	s.wake(stageRun.ID)
+	return stageRun, nil
+}
+
+func (s *ApprovalService) subscribe(stageRunID uint) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ch := make(chan struct{}, 1)
+	s.decisions[stageRunID] = ch
+	return ch
+}
+
+func (s *ApprovalService) unsubscribe(stageRunID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.decisions, stageRunID)
+}
+
+// wake resumes the stage waiting on this replica, the stages on the other replicas poll the decision.
+func (s *ApprovalService) wake(stageRunID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ch, ok := s.decisions[stageRunID]; ok {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
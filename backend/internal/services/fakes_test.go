@@ -0,0 +1,523 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/schema"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"time"
+)
+
+// fakeStageRunRepository keeps the stage runs in memory, they are stored
+// and returned as copies the way the database does.
+type fakeStageRunRepository struct {
+	mu        sync.Mutex
+	stageRuns []*entity.StageRun
+	nextID    uint
+}
+
+func (r *fakeStageRunRepository) SaveStageRun(ctx context.Context, stageRun *entity.StageRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stageRun.ID == 0 {
+		r.nextID++
+		stageRun.ID = r.nextID
+		stageRun.CreatedAt = time.Now()
+	}
+	saved := *stageRun
+	for i, existing := range r.stageRuns {
+		if existing.ID == saved.ID {
+			r.stageRuns[i] = &saved
+			return nil
+		}
+	}
+	r.stageRuns = append(r.stageRuns, &saved)
+	return nil
+}
+
+func (r *fakeStageRunRepository) GetStageRun(ctx context.Context, sendpostRunID uint, stageID uint) (*entity.StageRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest *entity.StageRun
+	for _, stageRun := range r.stageRuns {
+		if stageRun.SendpostRunID == sendpostRunID && stageRun.StageID == stageID && (latest == nil || stageRun.ID > latest.ID) {
+			latest = stageRun
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	found := *latest
+	return &found, nil
+}
+
+func (r *fakeStageRunRepository) GetStageRuns(ctx context.Context, sendpostRunID uint) ([]*entity.StageRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stageRuns []*entity.StageRun
+	for _, stageRun := range r.stageRuns {
+		if stageRun.SendpostRunID == sendpostRunID {
+			found := *stageRun
+			stageRuns = append(stageRuns, &found)
+		}
+	}
+	sort.Slice(stageRuns, func(i, j int) bool { return stageRuns[i].ID < stageRuns[j].ID })
+	return stageRuns, nil
+}
+
+// states returns the state of the latest record of every stage within the run.
+func (r *fakeStageRunRepository) states(sendpostRunID uint) map[uint]value.StateType {
+	stageRuns, _ := r.GetStageRuns(context.Background(), sendpostRunID)
+	states := make(map[uint]value.StateType)
+	for _, stageRun := range stageRuns {
+		states[stageRun.StageID] = stageRun.State
+	}
+	return states
+}
+
+// fakeSendpostRunRepository keeps the runs in memory, they are returned
+// with their stage runs like the repository preloads them.
+type fakeSendpostRunRepository struct {
+	stageRuns *fakeStageRunRepository
+
+	mu     sync.Mutex
+	runs   []*entity.SendpostRun
+	nextID uint
+}
+
+func (r *fakeSendpostRunRepository) SaveSendpostRun(ctx context.Context, run *entity.SendpostRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if run.ID == 0 {
+		r.nextID++
+		run.ID = r.nextID
+		run.CreatedAt = time.Now()
+	}
+	saved := *run
+	saved.StageRuns = nil
+	for i, existing := range r.runs {
+		if existing.ID == saved.ID {
+			r.runs[i] = &saved
+			return nil
+		}
+	}
+	r.runs = append(r.runs, &saved)
+	return nil
+}
+
+func (r *fakeSendpostRunRepository) GetSendpostRunByID(ctx context.Context, runID uint) (*entity.SendpostRun, error) {
+	r.mu.Lock()
+	var found *entity.SendpostRun
+	for _, run := range r.runs {
+		if run.ID == runID {
+			found = run
+		}
+	}
+	r.mu.Unlock()
+	if found == nil {
+		return nil, errors.New("sendpost run not found")
+	}
+	return r.withStageRuns(ctx, found)
+}
+
+func (r *fakeSendpostRunRepository) GetSendpostRuns(ctx context.Context, sendpostID uint) ([]*entity.SendpostRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var runs []*entity.SendpostRun
+	for i := len(r.runs) - 1; i >= 0; i-- {
+		if r.runs[i].SendpostID == sendpostID {
+			found := *r.runs[i]
+			runs = append(runs, &found)
+		}
+	}
+	return runs, nil
+}
+
+func (r *fakeSendpostRunRepository) GetLastSendpostRun(ctx context.Context, sendpostID uint) (*entity.SendpostRun, error) {
+	r.mu.Lock()
+	var last *entity.SendpostRun
+	for _, run := range r.runs {
+		if run.SendpostID == sendpostID {
+			last = run
+		}
+	}
+	r.mu.Unlock()
+	if last == nil {
+		return nil, nil
+	}
+	return r.withStageRuns(ctx, last)
+}
+
+func (r *fakeSendpostRunRepository) withStageRuns(ctx context.Context, run *entity.SendpostRun) (*entity.SendpostRun, error) {
+	found := *run
+	stageRuns, err := r.stageRuns.GetStageRuns(ctx, run.ID)
+	if err != nil {
+		return nil, err
+	}
+	found.StageRuns = stageRuns
+	return &found, nil
+}
+
+// newFakeRunHistory creates the run history service over the in-memory repositories.
+func newFakeRunHistory() (*RunHistoryService, *fakeSendpostRunRepository, *fakeStageRunRepository) {
+	stageRuns := &fakeStageRunRepository{}
+	runs := &fakeSendpostRunRepository{stageRuns: stageRuns}
+	return NewRunHistoryService(runs, stageRuns), runs, stageRuns
+}
+
+// newTestStageRunnerService returns the stage runner service resolving the parameters of the stages
+// by layers with the template service rendering them, the defaults of the deployments are taken from the executor.
+func newTestStageRunnerService(executor entity.StageExecutor, sendpostService *SendpostService, stageService *StageService, history *RunHistoryService) (*StageRunnerService, *TemplateService) {
+	templateService := NewTemplateService(sendpostService, history, "test", time.UTC)
+	parameterService := NewParameterService(executor, sendpostService, stageService, templateService, NewSchemaService(executor))
+	return NewStageRunnerService(executor, stageService, history, parameterService, 1), templateService
+}
+
+// fakeSendpostScheduleRepository keeps the schedules in memory, they are stored
+// and returned as copies the way the database does.
+type fakeSendpostScheduleRepository struct {
+	mu        sync.Mutex
+	schedules map[uint]*entity.SendpostSchedule
+	nextID    uint
+}
+
+func newFakeSendpostScheduleRepository() *fakeSendpostScheduleRepository {
+	return &fakeSendpostScheduleRepository{schedules: make(map[uint]*entity.SendpostSchedule)}
+}
+
+func (r *fakeSendpostScheduleRepository) SaveSchedule(ctx context.Context, schedule *entity.SendpostSchedule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if schedule.ID == 0 {
+		r.nextID++
+		schedule.ID = r.nextID
+	}
+	saved := *schedule
+	r.schedules[saved.ID] = &saved
+	return nil
+}
+
+func (r *fakeSendpostScheduleRepository) DeleteSchedule(ctx context.Context, scheduleID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.schedules, scheduleID)
+	return nil
+}
+
+func (r *fakeSendpostScheduleRepository) GetScheduleByID(ctx context.Context, scheduleID uint) (*entity.SendpostSchedule, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	schedule, ok := r.schedules[scheduleID]
+	if !ok {
+		return nil, errors.New("schedule not found")
+	}
+	found := *schedule
+	return &found, nil
+}
+
+func (r *fakeSendpostScheduleRepository) GetSchedulesBySendpostID(ctx context.Context, sendpostID uint) ([]*entity.SendpostSchedule, error) {
+	return r.find(func(schedule *entity.SendpostSchedule) bool {
+		return schedule.SendpostID == sendpostID
+	}), nil
+}
+
+func (r *fakeSendpostScheduleRepository) GetPendingSchedules(ctx context.Context) ([]*entity.SendpostSchedule, error) {
+	return r.find(func(schedule *entity.SendpostSchedule) bool {
+		return (schedule.StartedAt == nil && schedule.SkippedAt == nil) || schedule.IsRecurring()
+	}), nil
+}
+
+func (r *fakeSendpostScheduleRepository) ClaimSchedule(ctx context.Context, scheduleID uint, plannedAt time.Time, startedAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	schedule, ok := r.schedules[scheduleID]
+	if !ok || !schedule.PlannedAt.Equal(plannedAt) || schedule.StartedAt != nil || schedule.SkippedAt != nil {
+		return false, nil
+	}
+	schedule.StartedAt = &startedAt
+	return true, nil
+}
+
+// find returns the copies of the schedules matching the filter ordered by the planned time.
+func (r *fakeSendpostScheduleRepository) find(filter func(schedule *entity.SendpostSchedule) bool) []*entity.SendpostSchedule {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var schedules []*entity.SendpostSchedule
+	for _, schedule := range r.schedules {
+		if filter(schedule) {
+			found := *schedule
+			schedules = append(schedules, &found)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].PlannedAt.Before(schedules[j].PlannedAt) })
+	return schedules
+}
+
+// fakeSendpostScheduler records the schedules put to it.
+// The schedules are fired only when the test sends them to queue.
+type fakeSendpostScheduler struct {
+	queue chan entity.SendpostSchedule
+
+	mu        sync.Mutex
+	scheduled []entity.SendpostSchedule
+}
+
+func newFakeSendpostScheduler() *fakeSendpostScheduler {
+	return &fakeSendpostScheduler{queue: make(chan entity.SendpostSchedule)}
+}
+
+func (s *fakeSendpostScheduler) AddSchedule(ctx context.Context, schedule entity.SendpostSchedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scheduled = append(s.scheduled, schedule)
+}
+
+func (s *fakeSendpostScheduler) RemoveSchedule(scheduleID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var kept []entity.SendpostSchedule
+	for _, schedule := range s.scheduled {
+		if schedule.ID != scheduleID {
+			kept = append(kept, schedule)
+		}
+	}
+	s.scheduled = kept
+}
+
+func (s *fakeSendpostScheduler) GetQueue() <-chan entity.SendpostSchedule {
+	return s.queue
+}
+
+// added returns the schedules put to the scheduler.
+func (s *fakeSendpostScheduler) added() []entity.SendpostSchedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]entity.SendpostSchedule(nil), s.scheduled...)
+}
+
+// fakeStageExecutor creates the flow runs in memory, they are reported running
+// until they are cancelled. The default parameters and the parameter schemas of the deployments
+// are taken from defaults and schemas.
+type fakeStageExecutor struct {
+	defaults map[string]map[string]interface{}
+	schemas  map[string]*schema.Schema
+
+	mu        sync.Mutex
+	flowRuns  map[string]string
+	states    map[string]value.StateType
+	cancelled []string
+}
+
+func newFakeStageExecutor() *fakeStageExecutor {
+	return &fakeStageExecutor{
+		flowRuns: make(map[string]string),
+		states:   make(map[string]value.StateType),
+	}
+}
+
+func (e *fakeStageExecutor) Run(ctx context.Context, deploymentID string, parameters *map[string]interface{}) (*string, *value.StateType, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	flowRunID := fmt.Sprintf("%s-%d", deploymentID, len(e.flowRuns)+1)
+	e.flowRuns[flowRunID] = deploymentID
+	e.states[flowRunID] = value.Running
+	state := value.Running
+	return &flowRunID, &state, nil
+}
+
+func (e *fakeStageExecutor) Status(ctx context.Context, flowRunID string) (*value.StateType, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	state, ok := e.states[flowRunID]
+	if !ok {
+		return nil, fmt.Errorf("flow run %s not found", flowRunID)
+	}
+	return &state, nil
+}
+
+func (e *fakeStageExecutor) Cancel(ctx context.Context, flowRunID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cancelled = append(e.cancelled, flowRunID)
+	e.states[flowRunID] = value.Cancelled
+	return nil
+}
+
+func (e *fakeStageExecutor) CheckFlowRunCompletionByDeploymentID(ctx context.Context, hisoryStart time.Time, historyEnd time.Time, deploymentID string) error {
+	return nil
+}
+
+func (e *fakeStageExecutor) GetDeploymentParameters(ctx context.Context, deploymentID string) (map[string]interface{}, error) {
+	return e.defaults[deploymentID], nil
+}
+
+func (e *fakeStageExecutor) Result(ctx context.Context, flowRunID string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (e *fakeStageExecutor) GetDeploymentSchema(ctx context.Context, deploymentID string) (*schema.Schema, error) {
+	return e.schemas[deploymentID], nil
+}
+
+// setState changes the state the executor reports for the flow run.
+func (e *fakeStageExecutor) setState(flowRunID string, state value.StateType) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.states[flowRunID] = state
+}
+
+// forget makes the executor report the flow run as not found.
+func (e *fakeStageExecutor) forget(flowRunID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.states, flowRunID)
+}
+
+// flowRunCount returns the number of the flow runs created by the executor.
+func (e *fakeStageExecutor) flowRunCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.flowRuns)
+}
+
+// cancelledFlowRuns returns the flow runs cancelled via the executor.
+func (e *fakeStageExecutor) cancelledFlowRuns() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.cancelled...)
+}
+
+// fakeSendpostRunLockRepository keeps the leases in memory.
+// failRenewals makes the renewals fail, expire lets the lease of the run expire.
+type fakeSendpostRunLockRepository struct {
+	mu       sync.Mutex
+	locks    map[uint]fakeRunLock
+	renewErr error
+}
+
+type fakeRunLock struct {
+	owner     string
+	expiresAt time.Time
+}
+
+func newFakeSendpostRunLockRepository() *fakeSendpostRunLockRepository {
+	return &fakeSendpostRunLockRepository{locks: make(map[uint]fakeRunLock)}
+}
+
+func (r *fakeSendpostRunLockRepository) AcquireLock(ctx context.Context, sendpostID uint, owner string, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lock, ok := r.locks[sendpostID]; ok && lock.expiresAt.After(time.Now()) {
+		return false, nil
+	}
+	r.locks[sendpostID] = fakeRunLock{owner: owner, expiresAt: expiresAt}
+	return true, nil
+}
+
+func (r *fakeSendpostRunLockRepository) RenewLock(ctx context.Context, sendpostID uint, owner string, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.renewErr != nil {
+		return false, r.renewErr
+	}
+	if lock, ok := r.locks[sendpostID]; !ok || lock.owner != owner {
+		return false, nil
+	}
+	r.locks[sendpostID] = fakeRunLock{owner: owner, expiresAt: expiresAt}
+	return true, nil
+}
+
+func (r *fakeSendpostRunLockRepository) ReleaseLock(ctx context.Context, sendpostID uint, owner string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lock, ok := r.locks[sendpostID]; ok && lock.owner == owner {
+		delete(r.locks, sendpostID)
+	}
+	return nil
+}
+
+// failRenewals makes the renewals of the leases fail with err.
+func (r *fakeSendpostRunLockRepository) failRenewals(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.renewErr = err
+}
+
+// expire makes the lease of the sendpost expired, as if its owner stopped renewing it.
+func (r *fakeSendpostRunLockRepository) expire(sendpostID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if lock, ok := r.locks[sendpostID]; ok {
+		lock.expiresAt = time.Now().Add(-time.Second)
+		r.locks[sendpostID] = lock
+	}
+}
+
+// owner returns the owner of the lease of the sendpost, empty if it isn't locked.
+func (r *fakeSendpostRunLockRepository) owner(sendpostID uint) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.locks[sendpostID].owner
+}
+
+// newTestRunLockService creates the run lock service renewing the leases every few milliseconds.
+func newTestRunLockService(repo *fakeSendpostRunLockRepository) *RunLockService {
+	locks := NewRunLockService(repo)
+	locks.renewInterval = 10 * time.Millisecond
+	return locks
+}
+
+// fakeStageRunner starts the flow runs of the stages and completes them at once.
+// The stages listed in fail are failed with the given error, the stages listed in block
+// run until the context is done. The started stages and their parameters are recorded.
+type fakeStageRunner struct {
+	service    *StageRunnerService
+	fail       map[uint]error
+	block      map[uint]bool
+	mu         sync.Mutex
+	started    []uint
+	parameters map[uint]value.JSONB
+}
+
+func (r *fakeStageRunner) Start(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	r.mu.Lock()
+	r.started = append(r.started, stage.ID)
+	if params := stage.RunParameters(); params != nil {
+		if r.parameters == nil {
+			r.parameters = make(map[uint]value.JSONB)
+		}
+		r.parameters[stage.ID] = maps.Clone(*params)
+	}
+	r.mu.Unlock()
+	return r.service.Start(ctx, run, stage)
+}
+
+func (r *fakeStageRunner) CheckState(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	if err, ok := r.fail[stage.ID]; ok {
+		return r.service.HandleFailedStage(ctx, run, stage, err)
+	}
+	if r.block[stage.ID] {
+		<-ctx.Done()
+		return r.service.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
+	}
+	return r.service.UpdateState(ctx, run, stage, value.Completed)
+}
+
+// startedStages returns the IDs of the started stages in the order of their start.
+func (r *fakeStageRunner) startedStages() []uint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]uint(nil), r.started...)
+}
+
+// startParameters returns the parameters the stage was started with.
+func (r *fakeStageRunner) startParameters(stageID uint) value.JSONB {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.parameters[stageID]
+}
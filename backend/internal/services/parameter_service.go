@@ -0,0 +1,273 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"crm-uplift-ii24-backend/pkg/schema"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	ErrorResolveParameters string = "[ParameterService] error resolving stage parameters"
+	ErrorRenderParameters  string = "[ParameterService] error rendering stage parameters"
+	ErrorValidateOverrides string = "[ParameterService] error validating parameter overrides"
+)
+
+// ErrInvalidOverrides means the overrides of the run don't match the parameters the stages declare,
+// the error wraps schema.Errors with the mismatch of every field
+var ErrInvalidOverrides = errors.New("invalid parameter overrides")
+
+// ParameterService resolves the parameters the stages are executed with within the run.
+// The stored parameters of the stages and of the sendpost aren't changed by the run.
+type ParameterService struct {
+	executor        entity.StageExecutor
+	sendpostService *SendpostService
+	stageService    *StageService
+	templateService *TemplateService
+	schemaService   *SchemaService
+}
+
+func NewParameterService(executor entity.StageExecutor, sendpostService *SendpostService, stageService *StageService, templateService *TemplateService, schemaService *SchemaService) *ParameterService {
+	return &ParameterService{
+		executor:        executor,
+		sendpostService: sendpostService,
+		stageService:    stageService,
+		templateService: templateService,
+		schemaService:   schemaService,
+	}
+}
+
+// Resolve layers the parameters of the stage within the run, see entity.Stage.ResolveParameters:
+// the defaults of the deployment < the stage < the parallel parent or the map parent within the run
+// < the global parameters of the sendpost < the overrides of the run. The expressions within the values are rendered
+// with the variables of the run.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//	run - The sendpost run the stage is executed within.
+//	stage - The stage whose parameters are resolved.
+//
+// Returns:
+//
+//	*entity.ResolvedParameters - The parameters of the stage and the layer of every value.
+//	error - An error if a layer couldn't be retrieved or an expression couldn't be rendered.
+func (s *ParameterService) Resolve(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) (*entity.ResolvedParameters, error) {
+	resolved, err := s.layer(ctx, run, stage)
+	if err != nil {
+		return nil, logging.WrapError(ErrorResolveParameters, err)
+	}
+	if resolved.Parameters, err = s.templateService.Render(ctx, run, resolved.Parameters); err != nil {
+		return nil, fmt.Errorf("%s: %w", ErrorRenderParameters, err)
+	}
+	return resolved, nil
+}
+
+// Validate checks the parameters of the stage resolved within the run against the schema
+// of its deployment. The values with the expressions aren't rendered and aren't checked.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//	run - The sendpost run the stage would be executed within.
+//	stage - The stage whose parameters are validated.
+//
+// Returns:
+//
+//	schema.Errors - The mismatches of the parameters with the schema.
+//	error - An error if a layer or the schema couldn't be retrieved.
+func (s *ParameterService) Validate(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) (schema.Errors, error) {
+	resolved, err := s.layer(ctx, run, stage)
+	if err != nil {
+		return nil, logging.WrapError(ErrorResolveParameters, err)
+	}
+	return s.schemaService.StageErrors(ctx, stage, resolved.Parameters)
+}
+
+// layer layers the parameters of the stage within the run without rendering the expressions.
+func (s *ParameterService) layer(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) (*entity.ResolvedParameters, error) {
+	defaults, err := s.deploymentDefaults(ctx, stage)
+	if err != nil {
+		return nil, err
+	}
+
+	var parent *value.JSONB
+	var mapStage *entity.Stage
+	if stage.ParentStageID != nil {
+		parentStage, err := s.stageService.GetStage(ctx, *stage.ParentStageID)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case parentStage.IsParallel():
+			parent = parentStage.StageParameters
+		case parentStage.IsMap():
+			// Подэтап map этапа получает его параметры в рамках запуска, кроме списка и элемента
+			if parent, err = s.mapParameters(ctx, run, parentStage); err != nil {
+				return nil, err
+			}
+			mapStage = parentStage
+		}
+	}
+
+	global, err := s.sendpostService.GetSendpostParameters(ctx, run.SendpostID)
+	if err != nil {
+		return nil, err
+	}
+	resolved := stage.ResolveParameters(defaults, parent, global, run.Overrides(stage.ID))
+	if mapStage != nil {
+		// Элемент списка не переопределяется глобальными параметрами и параметрами запуска
+		if item, ok := stage.MapItem(mapStage.MapKey); ok && resolved.Parameters != nil {
+			(*resolved.Parameters)[mapStage.MapKey] = item
+			resolved.Sources[mapStage.MapKey] = value.SourceStage
+		}
+	}
+	return resolved, nil
+}
+
+// mapParameters returns the parameters of the map stage within the run its sub-stages are layered with,
+// without the list the stage is expanded over and the element passed to the sub-stage.
+func (s *ParameterService) mapParameters(ctx context.Context, run *entity.SendpostRun, mapStage *entity.Stage) (*value.JSONB, error) {
+	resolved, err := s.layer(ctx, run, mapStage)
+	if err != nil || resolved.Parameters == nil {
+		return nil, err
+	}
+	params := make(value.JSONB, len(*resolved.Parameters))
+	for k, v := range *resolved.Parameters {
+		params[k] = v
+	}
+	delete(params, mapStage.MapOver)
+	delete(params, mapStage.MapKey)
+	return &params, nil
+}
+
+// ValidateOverrides checks the overrides of the run against the parameters of the stages: every overridden
+// parameter must be declared by the deployment or the stage, or for the global overrides by the sendpost,
+// and the value must match the schema of the parameters of the deployment of every stage it's passed to.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//	sendpostID - The sendpost the run is started for.
+//	stages - The stages of the sendpost the overrides may apply to.
+//	global - The overrides of the global parameters, may be nil.
+//	stageParameters - The overrides of the parameters of the stages by the stage ID, may be nil.
+//
+// Returns:
+//
+//	error - ErrInvalidOverrides with the mismatch of every field or an error if the parameters couldn't be retrieved.
+func (s *ParameterService) ValidateOverrides(ctx context.Context, sendpostID uint, stages []*entity.Stage, global *value.JSONB, stageParameters map[uint]value.JSONB) error {
+	sendpostParams, err := s.sendpostService.GetSendpostParameters(ctx, sendpostID)
+	if err != nil {
+		return logging.WrapError(ErrorValidateOverrides, err)
+	}
+	declared := make(map[uint]*value.JSONB, len(stages))
+	for _, stage := range stages {
+		defaults, err := s.deploymentDefaults(ctx, stage)
+		if err != nil {
+			return logging.WrapError(ErrorValidateOverrides, err)
+		}
+		declared[stage.ID] = stage.ResolveParameters(defaults, nil, nil, nil).Parameters
+	}
+
+	var errs schema.Errors
+	if global != nil {
+		for _, key := range sortedKeys(*global) {
+			field := "parameters." + key
+			ok := declares(sendpostParams, key)
+			for _, stage := range stages {
+				if !declares(declared[stage.ID], key) {
+					continue
+				}
+				ok = true
+				fieldErrs, err := s.schemaService.ValueErrors(ctx, stage, key, (*global)[key])
+				if err != nil {
+					return logging.WrapError(ErrorValidateOverrides, err)
+				}
+				errs = append(errs, forStage(fieldErrs.Prefix("parameters"), stage.ID)...)
+			}
+			if !ok {
+				errs = append(errs, schema.FieldError{Field: field, Message: "isn't declared by the sendpost or its stages"})
+			}
+		}
+	}
+	for _, stageID := range sortedStageIDs(stageParameters) {
+		prefix := fmt.Sprintf("stage_parameters.%d", stageID)
+		params, ok := declared[stageID]
+		if !ok {
+			errs = append(errs, schema.FieldError{Field: prefix, Message: "isn't a stage of the sendpost"})
+			continue
+		}
+		stage := stageByID(stages, stageID)
+		overrides := stageParameters[stageID]
+		for _, key := range sortedKeys(overrides) {
+			if !declares(params, key) {
+				errs = append(errs, schema.FieldError{Field: prefix + "." + key, Message: "isn't declared by the stage"})
+				continue
+			}
+			fieldErrs, err := s.schemaService.ValueErrors(ctx, stage, key, overrides[key])
+			if err != nil {
+				return logging.WrapError(ErrorValidateOverrides, err)
+			}
+			errs = append(errs, fieldErrs.Prefix(prefix)...)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidOverrides, errs)
+	}
+	return nil
+}
+
+// deploymentDefaults returns the default parameters of the deployment of the stage,
+// nil if the stage isn't executed by a deployment.
+func (s *ParameterService) deploymentDefaults(ctx context.Context, stage *entity.Stage) (*value.JSONB, error) {
+	if !stage.NeedsDeployment() || stage.DeploymnentID == "" {
+		return nil, nil
+	}
+	params, err := s.executor.GetDeploymentParameters(ctx, stage.DeploymnentID)
+	if err != nil {
+		return nil, err
+	}
+	defaults := value.JSONB(params)
+	return &defaults, nil
+}
+
+// declares reports whether the parameter is declared by the stage or the sendpost.
+func declares(declared *value.JSONB, key string) bool {
+	if declared == nil {
+		return false
+	}
+	_, ok := (*declared)[key]
+	return ok
+}
+
+func stageByID(stages []*entity.Stage, stageID uint) *entity.Stage {
+	for _, stage := range stages {
+		if stage.ID == stageID {
+			return stage
+		}
+	}
+	return nil
+}
+
+func sortedKeys(params value.JSONB) []string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedStageIDs(stageParameters map[uint]value.JSONB) []uint {
+	ids := make([]uint, 0, len(stageParameters))
+	for id := range stageParameters {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
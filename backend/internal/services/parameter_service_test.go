@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/mocks"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"crm-uplift-ii24-backend/pkg/schema"
+
+	"go.uber.org/zap"
+)
+
+func TestResolveMapSubStageParameters(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	ctx := context.Background()
+	mapStage := &entity.Stage{
+		Model:           gorm.Model{ID: 5},
+		SendpostID:      1,
+		Type:            value.MapStage,
+		DeploymnentID:   "load",
+		MapOver:         "regions",
+		MapKey:          "region",
+		StageParameters: &value.JSONB{"regions": []any{"nsk", "msk"}, "region": "", "date": "2024-01-01", "table": "tmp_{{ run.id }}"},
+	}
+	subStage := mapStage.NewMapSubStage("nsk")
+	subStage.ID = 6
+
+	sendpostRepo := new(mocks.SendpostRepository)
+	sendpostRepo.On("GetSendpostParameters", mock.Anything, uint(1)).Return(&value.JSONB{"date": "2024-01-15"}, nil)
+	sendpostRepo.On("GetSendpostByID", mock.Anything, uint(1)).Return(&entity.Sendpost{Model: gorm.Model{ID: 1}}, nil)
+	stageRepo := new(mocks.StageRepository)
+	stageRepo.On("GetStageByID", mock.Anything, uint(5)).Return(mapStage, nil)
+	stageService := NewStageService(stageRepo, sendpostRepo, new(mocks.StageDependencyRepository), NewSchemaService(nil))
+	history, _, _ := newFakeRunHistory()
+	stageRunnerService, _ := newTestStageRunnerService(newFakeStageExecutor(), NewSendpostService(sendpostRepo, stageService), stageService, history)
+
+	// Параметры запуска переопределяют значения map этапа, но не элемент списка
+	run, err := history.CreateRun(ctx, 1, nil, nil, &value.JSONB{"date": "2024-02-01", "region": "spb"}, nil)
+	require.NoError(t, err)
+	resolved, err := stageRunnerService.ResolveParameters(ctx, run, subStage)
+	require.NoError(t, err)
+
+	assert.Equal(t, value.JSONB{"region": "nsk", "date": "2024-02-01", "table": "tmp_1"}, *resolved.Parameters)
+	assert.Equal(t, value.SourceStage, resolved.Sources["region"])
+	assert.Equal(t, value.SourceRun, resolved.Sources["date"])
+	// Сохранённые параметры подэтапа не меняются
+	assert.Equal(t, value.JSONB{"region": "nsk", "date": "2024-01-01", "table": "tmp_{{ run.id }}"}, *subStage.StageParameters)
+}
+
+func TestValidateOverrides(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	ctx := context.Background()
+	sendpostRepo := new(mocks.SendpostRepository)
+	sendpostRepo.On("GetSendpostParameters", mock.Anything, uint(1)).Return(&value.JSONB{"segment": "vip"}, nil)
+	executor := newFakeStageExecutor()
+	executor.defaults = map[string]map[string]interface{}{"load": {"limit": float64(100)}}
+	executor.schemas = map[string]*schema.Schema{"load": {Type: "object", Properties: map[string]*schema.Schema{"limit": {Type: "integer"}}}}
+	stageService := NewStageService(new(mocks.StageRepository), sendpostRepo, new(mocks.StageDependencyRepository), NewSchemaService(nil))
+	sendpostService := NewSendpostService(sendpostRepo, stageService)
+	history, _, _ := newFakeRunHistory()
+	parameterService := NewParameterService(executor, sendpostService, stageService, NewTemplateService(sendpostService, history, "test", time.UTC), NewSchemaService(executor))
+	stages := []*entity.Stage{
+		{Model: gorm.Model{ID: 1}, SendpostID: 1, DeploymnentID: "load", StageParameters: &value.JSONB{"date": "2024-01-01"}},
+		{Model: gorm.Model{ID: 2}, SendpostID: 1, DeploymnentID: "report", StageParameters: &value.JSONB{"format": "csv"}},
+	}
+
+	// Параметры, объявленные sendpost, деплойментом или этапом
+	require.NoError(t, parameterService.ValidateOverrides(ctx, 1, stages,
+		&value.JSONB{"segment": "all", "limit": float64(10)},
+		map[uint]value.JSONB{1: {"date": "2024-02-01"}, 2: {"format": "xlsx"}}))
+
+	err := parameterService.ValidateOverrides(ctx, 1, stages,
+		&value.JSONB{"unknown": 1, "limit": "10"},
+		map[uint]value.JSONB{2: {"date": "2024-02-01"}, 3: {"format": "xlsx"}})
+	require.ErrorIs(t, err, ErrInvalidOverrides)
+	var errs schema.Errors
+	require.ErrorAs(t, err, &errs)
+	fields := make([]string, 0, len(errs))
+	for _, fieldErr := range errs {
+		fields = append(fields, fieldErr.Field)
+	}
+	assert.Equal(t, []string{"parameters.limit", "parameters.unknown", "stage_parameters.2.date", "stage_parameters.3"}, fields)
+}
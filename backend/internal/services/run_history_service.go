@@ -0,0 +1,294 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/repository"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"fmt"
+	"strconv"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ErrorCreateRun           string = "[RunHistoryService] error CreateRun"
+	ErrorCompleteRun         string = "[RunHistoryService] error CompleteRun"
+	ErrorFailRun             string = "[RunHistoryService] error FailRun"
+	ErrorGetSendpostRun      string = "[RunHistoryService] error GetSendpostRun"
+	ErrorGetSendpostRuns     string = "[RunHistoryService] error GetSendpostRuns"
+	ErrorGetLastSendpostRun  string = "[RunHistoryService] error GetLastSendpostRun"
+	ErrorReuseStageRun       string = "[RunHistoryService] error ReuseStageRun"
+	ErrorStartStageRun       string = "[RunHistoryService] error StartStageRun"
+	ErrorUpdateStageRunState string = "[RunHistoryService] error UpdateStageRunState"
+	ErrorFailStageRun        string = "[RunHistoryService] error FailStageRun"
+	ErrorGetStageRuns        string = "[RunHistoryService] error GetStageRuns"
+	ErrorLinkSubsendpostRun  string = "[RunHistoryService] error LinkSubsendpostRun"
+	ErrorPauseRun            string = "[RunHistoryService] error PauseRun"
+	ErrorResumeRun           string = "[RunHistoryService] error ResumeRun"
+)
+
+// RunHistoryService keeps the history of sendpost runs and of the stages executed within them.
+type RunHistoryService struct {
+	runRepo      repository.SendpostRunRepository
+	stageRunRepo repository.StageRunRepository
+}
+
+func NewRunHistoryService(runRepo repository.SendpostRunRepository, stageRunRepo repository.StageRunRepository) *RunHistoryService {
+	return &RunHistoryService{runRepo: runRepo, stageRunRepo: stageRunRepo}
+}
+
+// CreateRun creates a new running SendpostRun for the sendpost and persists it.
+// If the previous run is given, the new run resumes it.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values, cancellation, and deadlines.
+//	sendpostID - The unique identifier of the sendpost being run.
+//	previous - The run to be resumed, nil if the run starts from the first stage.
+//	parentRunID - The run whose subsendpost stage started the run, nil if the run isn't nested.
+//	parameters - The overrides of the global parameters of the sendpost within the run, may be nil.
+//	stageParameters - The overrides of the parameters of the stages within the run by the stage ID, may be nil.
+//
+// Returns:
+//
+//	*entity.SendpostRun - The created run.
+//	error - An error if the run could not be saved.
+func (s *RunHistoryService) CreateRun(ctx context.Context, sendpostID uint, previous *entity.SendpostRun, parentRunID *uint, parameters *value.JSONB, stageParameters map[uint]value.JSONB) (*entity.SendpostRun, error) {
+	run := entity.NewSendpostRun(sendpostID)
+	run.Nest(parentRunID, parameters)
+	run.OverrideStages(stageParameters)
+	if previous != nil {
+		run.ResumeFrom(previous)
+	}
+	if err := s.runRepo.SaveSendpostRun(ctx, run); err != nil {
+		return nil, logging.WrapError(ErrorCreateRun, err)
+	}
+	logging.Debug("[RunHistoryService] CreateRun", zap.Uint("sendpost_id", sendpostID), zap.Uint("run_id", run.ID))
+	return run, nil
+}
+
+// CompleteRun sets the final state of the run and saves it.
+// The error is recorded in the run if it isn't nil.
+func (s *RunHistoryService) CompleteRun(ctx context.Context, run *entity.SendpostRun, state value.StateType, runErr error) error {
+	run.Complete(state, runErr)
+	if err := s.runRepo.SaveSendpostRun(ctx, run); err != nil {
+		return logging.WrapError(ErrorCompleteRun, err)
+	}
+	return nil
+}
+
+// FailRun marks the run as failed with the reason and saves it.
+func (s *RunHistoryService) FailRun(ctx context.Context, run *entity.SendpostRun, reason value.FailureReason, runErr error) error {
+	run.Fail(reason, runErr)
+	if err := s.runRepo.SaveSendpostRun(ctx, run); err != nil {
+		return logging.WrapError(ErrorFailRun, err)
+	}
+	return nil
+}
+
+// PauseRun marks the run as paused while its stage is waiting for the approval and saves it.
+func (s *RunHistoryService) PauseRun(ctx context.Context, run *entity.SendpostRun) error {
+	run.Pause()
+	if err := s.runRepo.SaveSendpostRun(ctx, run); err != nil {
+		return logging.WrapError(ErrorPauseRun, err)
+	}
+	return nil
+}
+
+// ResumeRun marks the paused run as running and saves it.
+func (s *RunHistoryService) ResumeRun(ctx context.Context, run *entity.SendpostRun) error {
+	run.Resume()
+	if err := s.runRepo.SaveSendpostRun(ctx, run); err != nil {
+		return logging.WrapError(ErrorResumeRun, err)
+	}
+	return nil
+}
+
+// GetSendpostRuns retrieves all runs of the sendpost from the latest to the oldest.
+func (s *RunHistoryService) GetSendpostRuns(ctx context.Context, sendpostID uint) ([]*entity.SendpostRun, error) {
+	runs, err := s.runRepo.GetSendpostRuns(ctx, sendpostID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorGetSendpostRuns, err)
+	}
+	return runs, nil
+}
+
+// GetSendpostRun retrieves the run with its stage runs.
+// It returns an error if the run doesn't belong to the sendpost.
+func (s *RunHistoryService) GetSendpostRun(ctx context.Context, sendpostID uint, runID uint) (*entity.SendpostRun, error) {
+	run, err := s.runRepo.GetSendpostRunByID(ctx, runID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorGetSendpostRun, err)
+	}
+	if run.SendpostID != sendpostID {
+		return nil, fmt.Errorf("%s: run %d doesn't belong to sendpost %d", ErrorGetSendpostRun, runID, sendpostID)
+	}
+	return run, nil
+}
+
+// GetLastSendpostRun retrieves the latest run of the sendpost with its stage runs.
+// Returns nil if the sendpost has never been run.
+func (s *RunHistoryService) GetLastSendpostRun(ctx context.Context, sendpostID uint) (*entity.SendpostRun, error) {
+	run, err := s.runRepo.GetLastSendpostRun(ctx, sendpostID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorGetLastSendpostRun, err)
+	}
+	return run, nil
+}
+
+// ReuseStageRun records the stage completed in the resumed run as completed within the run.
+func (s *RunHistoryService) ReuseStageRun(ctx context.Context, run *entity.SendpostRun, completed *entity.StageRun) error {
+	if err := s.stageRunRepo.SaveStageRun(ctx, completed.Reuse(run.ID)); err != nil {
+		return logging.WrapError(ErrorReuseStageRun, err)
+	}
+	return nil
+}
+
+// StartStageRun records the start of the stage within the run.
+// The current stage parameters are saved as the parameters sent to the executor.
+// If the stage was queued within the run its record is started instead of creating a new one.
+func (s *RunHistoryService) StartStageRun(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) (*entity.StageRun, error) {
+	stageRun, err := s.GetStageRun(ctx, run, stage)
+	if err != nil {
+		return nil, logging.WrapError(ErrorStartStageRun, err)
+	}
+	if stageRun != nil && stageRun.IsQueued() {
+		stageRun.Start(stage)
+	} else {
+		stageRun = entity.NewStageRun(run.ID, stage)
+	}
+	if err := s.stageRunRepo.SaveStageRun(ctx, stageRun); err != nil {
+		return nil, logging.WrapError(ErrorStartStageRun, err)
+	}
+	return stageRun, nil
+}
+
+// QueueStageRun records the stage waiting to be started within the run as pending.
+// The stage already queued within the run isn't recorded again.
+func (s *RunHistoryService) QueueStageRun(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	stageRun, err := s.GetStageRun(ctx, run, stage)
+	if err != nil {
+		return logging.WrapError(ErrorStartStageRun, err)
+	}
+	if stageRun != nil && stageRun.IsQueued() {
+		return nil
+	}
+	if err := s.stageRunRepo.SaveStageRun(ctx, entity.NewStageRun(run.ID, stage)); err != nil {
+		return logging.WrapError(ErrorStartStageRun, err)
+	}
+	return nil
+}
+
+// StartStageRunAttempt records the start of the next attempt to execute the stage within the run.
+func (s *RunHistoryService) StartStageRunAttempt(ctx context.Context, previous *entity.StageRun, stage *entity.Stage) (*entity.StageRun, error) {
+	stageRun := previous.NextAttempt(stage)
+	if err := s.stageRunRepo.SaveStageRun(ctx, stageRun); err != nil {
+		return nil, logging.WrapError(ErrorStartStageRun, err)
+	}
+	return stageRun, nil
+}
+
+// GetStageRun retrieves the latest record of the stage within the run.
+// It returns nil if the stage hasn't been started in the run.
+func (s *RunHistoryService) GetStageRun(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) (*entity.StageRun, error) {
+	return s.stageRunRepo.GetStageRun(ctx, run.ID, stage.ID)
+}
+
+// GetStageRuns retrieves all records of the stages within the run ordered by the start time.
+func (s *RunHistoryService) GetStageRuns(ctx context.Context, run *entity.SendpostRun) ([]*entity.StageRun, error) {
+	stageRuns, err := s.stageRunRepo.GetStageRuns(ctx, run.ID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorGetStageRuns, err)
+	}
+	return stageRuns, nil
+}
+
+// LinkSubsendpostRun records the run of the sendpost started by the subsendpost stage within the run.
+func (s *RunHistoryService) LinkSubsendpostRun(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, nested *entity.SendpostRun) error {
+	stageRun, err := s.GetStageRun(ctx, run, stage)
+	if err != nil {
+		return logging.WrapError(ErrorLinkSubsendpostRun, err)
+	}
+	if stageRun == nil {
+		return fmt.Errorf("%s: stage %d hasn't been started", ErrorLinkSubsendpostRun, stage.ID)
+	}
+	stageRun.SubsendpostRunID = &nested.ID
+	if err := s.stageRunRepo.SaveStageRun(ctx, stageRun); err != nil {
+		return logging.WrapError(ErrorLinkSubsendpostRun, err)
+	}
+	return nil
+}
+
+// SaveStageRun persists the changes of the stage run.
+func (s *RunHistoryService) SaveStageRun(ctx context.Context, stageRun *entity.StageRun) error {
+	return s.stageRunRepo.SaveStageRun(ctx, stageRun)
+}
+
+// UpdateStageRunState updates the state of the stage record within the run.
+// If the stage hasn't been recorded yet the record is created.
+func (s *RunHistoryService) UpdateStageRunState(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, state value.StateType, stageErr error) error {
+	stageRun, err := s.GetStageRun(ctx, run, stage)
+	if err != nil {
+		return logging.WrapError(ErrorUpdateStageRunState, err)
+	}
+	if stageRun == nil {
+		stageRun = entity.NewStageRun(run.ID, stage)
+	}
+	stageRun.UpdateState(state, stageErr)
+	if err := s.stageRunRepo.SaveStageRun(ctx, stageRun); err != nil {
+		return logging.WrapError(ErrorUpdateStageRunState, err)
+	}
+	return nil
+}
+
+// FailStageRun marks the stage record within the run as failed with the reason.
+// If the stage hasn't been recorded yet the record is created.
+func (s *RunHistoryService) FailStageRun(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, reason value.FailureReason, stageErr error) error {
+	stageRun, err := s.GetStageRun(ctx, run, stage)
+	if err != nil {
+		return logging.WrapError(ErrorFailStageRun, err)
+	}
+	if stageRun == nil {
+		stageRun = entity.NewStageRun(run.ID, stage)
+	}
+	stageRun.Fail(reason, stageErr)
+	if err := s.stageRunRepo.SaveStageRun(ctx, stageRun); err != nil {
+		return logging.WrapError(ErrorFailStageRun, err)
+	}
+	return nil
+}
+
+// StageOutputs returns the states and the results of the stages executed within the run
+// by the stage IDs, the latest attempt of every stage is taken:
+//
+//	<id>.state - the state of the stage
+//	<id>.result - the output of the flow run of the stage, empty if it has none
+func (s *RunHistoryService) StageOutputs(ctx context.Context, run *entity.SendpostRun) (map[string]any, error) {
+	stageRuns, err := s.GetStageRuns(ctx, run)
+	if err != nil {
+		return nil, err
+	}
+	// Учитывается последняя попытка каждого этапа
+	latest := make(map[uint]*entity.StageRun)
+	for _, stageRun := range stageRuns {
+		if existing, ok := latest[stageRun.StageID]; !ok || existing.ID < stageRun.ID {
+			latest[stageRun.StageID] = stageRun
+		}
+	}
+	outputs := make(map[string]any, len(latest))
+	for stageID, stageRun := range latest {
+		result := make(map[string]any)
+		if stageRun.Result != nil {
+			for k, v := range *stageRun.Result {
+				result[k] = v
+			}
+		}
+		outputs[strconv.FormatUint(uint64(stageID), 10)] = map[string]any{
+			"state":  string(stageRun.State),
+			"result": result,
+		}
+	}
+	return outputs, nil
+}
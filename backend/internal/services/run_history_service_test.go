@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+func TestRunHistoryCompleteRun(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	ctx := context.Background()
+	history, _, _ := newFakeRunHistory()
+
+	run, err := history.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, value.Running, run.State)
+	assert.Nil(t, run.CompletedAt)
+
+	require.NoError(t, history.CompleteRun(ctx, run, value.Failed, errors.New("stage failed")))
+	saved, err := history.GetSendpostRun(ctx, 1, run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, value.Failed, saved.State)
+	assert.NotNil(t, saved.CompletedAt)
+	require.NotNil(t, saved.Error)
+	assert.Equal(t, "stage failed", *saved.Error)
+
+	// запуск другой рассылки не отдаётся
+	_, err = history.GetSendpostRun(ctx, 2, run.ID)
+	assert.Error(t, err)
+}
+
+func TestRunHistoryStageRuns(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	ctx := context.Background()
+	history, _, stageRuns := newFakeRunHistory()
+	run, err := history.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	params := value.JSONB{"segment": "vip"}
+	stage := &entity.Stage{Model: gorm.Model{ID: 1}, SendpostID: 1, DeploymnentID: "d1", StageParameters: &params}
+	stageRun, err := history.StartStageRun(ctx, run, stage)
+	require.NoError(t, err)
+	assert.Equal(t, value.Pending, stageRun.State)
+
+	// запись хранит параметры, с которыми этап был запущен
+	params["segment"] = "new"
+	require.NoError(t, history.UpdateStageRunState(ctx, run, stage, value.Failed, errors.New("flow run crashed")))
+	saved, err := history.GetStageRun(ctx, run, stage)
+	require.NoError(t, err)
+	assert.Equal(t, stageRun.ID, saved.ID)
+	assert.Equal(t, value.Failed, saved.State)
+	assert.NotNil(t, saved.CompletedAt)
+	assert.Equal(t, "vip", (*saved.Parameters)["segment"])
+	require.NotNil(t, saved.Error)
+	assert.Equal(t, "flow run crashed", *saved.Error)
+
+	// этап, не записанный в запуске, получает запись при изменении состояния
+	unrecorded := &entity.Stage{Model: gorm.Model{ID: 2}, SendpostID: 1}
+	require.NoError(t, history.UpdateStageRunState(ctx, run, unrecorded, value.Completed, nil))
+	assert.Equal(t, map[uint]value.StateType{1: value.Failed, 2: value.Completed}, stageRuns.states(run.ID))
+
+	saved, err = history.GetStageRun(ctx, run, &entity.Stage{Model: gorm.Model{ID: 3}})
+	require.NoError(t, err)
+	assert.Nil(t, saved)
+}
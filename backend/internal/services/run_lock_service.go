@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/repository"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// runLockTTL is the time the lease is kept if the owner stops renewing it
+	runLockTTL           = time.Minute
+	runLockRenewInterval = runLockTTL / 3
+	// runLockWaitInterval is the interval of the attempts to take the lease by the queued run
+	runLockWaitInterval = 5 * time.Second
+	// runLockMaxRenewErrors is the number of the failed renewals in a row after which the lease is considered lost,
+	// the lease expires before the next attempt
+	runLockMaxRenewErrors = 2
+
+	ErrorLockSendpost string = "[RunLockService] error locking sendpost"
+)
+
+var (
+	ErrSendpostAlreadyRunning = errors.New("sendpost is already running")
+	// ErrRunLockLost is the cause of the run cancellation when the lease of the run couldn't be renewed,
+	// so the sendpost may be run by another replica
+	ErrRunLockLost = errors.New("sendpost run lock lost")
+)
+
+// RunLockService guarantees that only one run of the sendpost is active at a time
+// across all the backend replicas. The lock is a lease row renewed while the run is active,
+// so the lock of the crashed replica expires by itself. The run whose lease is lost
+// is cancelled with ErrRunLockLost as the cause.
+type RunLockService struct {
+	repo          repository.SendpostRunLockRepository
+	instanceID    string
+	renewInterval time.Duration
+}
+
+func NewRunLockService(repo repository.SendpostRunLockRepository) *RunLockService {
+	instanceID, err := os.Hostname()
+	if err != nil {
+		instanceID = "observer"
+	}
+	return &RunLockService{repo: repo, instanceID: instanceID, renewInterval: runLockRenewInterval}
+}
+
+// TryLock takes the run lock of the sendpost.
+// The run must be performed within the returned context, it is cancelled with ErrRunLockLost
+// as the cause if the lease is lost while the run is active.
+// The returned func releases the lock and must be called when the run is finished.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values, cancellation, and deadlines.
+//	sendpostID - The unique identifier of the sendpost to be locked.
+//
+// Returns:
+//
+//	context.Context - The context of the run, derived from ctx.
+//	func() - The func releasing the lock.
+//	error - ErrSendpostAlreadyRunning if the lock is taken by another run,
+//	or an error if the lock couldn't be taken.
+func (s *RunLockService) TryLock(ctx context.Context, sendpostID uint) (context.Context, func(), error) {
+	owner := s.newOwner()
+	acquired, err := s.repo.AcquireLock(ctx, sendpostID, owner, time.Now().Add(runLockTTL))
+	if err != nil {
+		return nil, nil, logging.WrapError(ErrorLockSendpost, err)
+	}
+	if !acquired {
+		return nil, nil, ErrSendpostAlreadyRunning
+	}
+	logging.Debug("[RunLockService] Sendpost locked", zap.Uint("sendpost_id", sendpostID), zap.String("owner", owner))
+
+	lockCtx, lose := context.WithCancelCause(ctx)
+	// Аренда принадлежит запуску и не зависит от контекста, в котором была взята
+	renewCtx, stopRenew := context.WithCancel(context.Background())
+	go s.renew(renewCtx, sendpostID, owner, lose)
+
+	return lockCtx, func() {
+		stopRenew()
+		if err := s.repo.ReleaseLock(context.Background(), sendpostID, owner); err != nil {
+			logging.Warn("[RunLockService] error releasing sendpost lock", zap.Uint("sendpost_id", sendpostID), zap.Error(err))
+		}
+		lose(nil)
+		logging.Debug("[RunLockService] Sendpost unlocked", zap.Uint("sendpost_id", sendpostID), zap.String("owner", owner))
+	}, nil
+}
+
+// Lock waits until the run lock of the sendpost is released and takes it.
+// It returns the context error if ctx is done before the lock is taken.
+func (s *RunLockService) Lock(ctx context.Context, sendpostID uint) (context.Context, func(), error) {
+	ticker := time.NewTicker(runLockWaitInterval)
+	defer ticker.Stop()
+	for {
+		lockCtx, unlock, err := s.TryLock(ctx, sendpostID)
+		if !errors.Is(err, ErrSendpostAlreadyRunning) {
+			return lockCtx, unlock, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// renew prolongs the lease until ctx is done. If the lease was taken over or couldn't be renewed
+// runLockMaxRenewErrors times in a row, the run is cancelled via lose with ErrRunLockLost.
+func (s *RunLockService) renew(ctx context.Context, sendpostID uint, owner string, lose context.CancelCauseFunc) {
+	ticker := time.NewTicker(s.renewInterval)
+	defer ticker.Stop()
+	renewErrors := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			renewed, err := s.repo.RenewLock(ctx, sendpostID, owner, time.Now().Add(runLockTTL))
+			if err != nil {
+				renewErrors++
+				logging.Warn("[RunLockService] error renewing sendpost lock", zap.Uint("sendpost_id", sendpostID), zap.Int("attempt", renewErrors), zap.Error(err))
+				if renewErrors < runLockMaxRenewErrors {
+					continue
+				}
+				s.lost(ctx, sendpostID, owner, lose, fmt.Errorf("%w: %s", ErrRunLockLost, err))
+				return
+			}
+			if !renewed {
+				s.lost(ctx, sendpostID, owner, lose, fmt.Errorf("%w: lease taken over", ErrRunLockLost))
+				return
+			}
+			renewErrors = 0
+		}
+	}
+}
+
+// lost cancels the run whose lease is lost unless the run has already released it.
+func (s *RunLockService) lost(ctx context.Context, sendpostID uint, owner string, lose context.CancelCauseFunc, cause error) {
+	if ctx.Err() != nil {
+		return
+	}
+	logging.Error("[RunLockService] Sendpost lock lost", zap.Uint("sendpost_id", sendpostID), zap.String("owner", owner), zap.Error(cause))
+	lose(cause)
+}
+
+// newOwner returns the unique owner of the lock: the replica host name and a random suffix.
+func (s *RunLockService) newOwner() string {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Sprintf("%s/%d", s.instanceID, time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%s/%s", s.instanceID, hex.EncodeToString(suffix))
+}
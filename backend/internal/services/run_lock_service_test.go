@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+func TestRunLockConflict(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	locks := newTestRunLockService(newFakeSendpostRunLockRepository())
+
+	_, unlock, err := locks.TryLock(context.Background(), 1)
+	require.NoError(t, err)
+
+	_, _, err = locks.TryLock(context.Background(), 1)
+	assert.ErrorIs(t, err, ErrSendpostAlreadyRunning)
+
+	// запуск отклоняется с 409, пока блокировка занята
+	srs := &SendpostRunnerService{runLockService: locks}
+	queued, err := srs.Start(context.Background(), 1, RunOptions{})
+	assert.False(t, queued)
+	assert.ErrorIs(t, err, ErrSendpostAlreadyRunning)
+
+	unlock()
+	_, unlock, err = locks.TryLock(context.Background(), 1)
+	require.NoError(t, err)
+	unlock()
+}
+
+func TestRunLockExpiredLease(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	repo := newFakeSendpostRunLockRepository()
+	_, err := repo.AcquireLock(context.Background(), 1, "crashed/1", time.Now().Add(runLockTTL))
+	require.NoError(t, err)
+	locks := newTestRunLockService(repo)
+
+	_, _, err = locks.TryLock(context.Background(), 1)
+	require.ErrorIs(t, err, ErrSendpostAlreadyRunning)
+
+	// аренда упавшей реплики истекает сама
+	repo.expire(1)
+	_, unlock, err := locks.TryLock(context.Background(), 1)
+	require.NoError(t, err)
+	assert.NotEqual(t, "crashed/1", repo.owner(1))
+	unlock()
+}
+
+func TestRunLockLostCancelsRun(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	for name, loseLease := range map[string]func(t *testing.T, repo *fakeSendpostRunLockRepository){
+		"taken over": func(t *testing.T, repo *fakeSendpostRunLockRepository) {
+			repo.expire(1)
+			_, err := repo.AcquireLock(context.Background(), 1, "other/1", time.Now().Add(runLockTTL))
+			require.NoError(t, err)
+		},
+		"renew errors": func(t *testing.T, repo *fakeSendpostRunLockRepository) {
+			repo.failRenewals(errors.New("connection refused"))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			repo := newFakeSendpostRunLockRepository()
+			locks := newTestRunLockService(repo)
+
+			runCtx, unlock, err := locks.TryLock(context.Background(), 1)
+			require.NoError(t, err)
+			defer unlock()
+
+			loseLease(t, repo)
+			select {
+			case <-runCtx.Done():
+			case <-time.After(time.Second):
+				t.Fatal("run wasn't cancelled after the lock was lost")
+			}
+			assert.ErrorIs(t, context.Cause(runCtx), ErrRunLockLost)
+		})
+	}
+}
+
+func TestRunLockReleasedDoesntLoseLock(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	repo := newFakeSendpostRunLockRepository()
+	locks := newTestRunLockService(repo)
+
+	runCtx, unlock, err := locks.TryLock(context.Background(), 1)
+	require.NoError(t, err)
+
+	unlock()
+	repo.failRenewals(errors.New("connection refused"))
+	time.Sleep(5 * locks.renewInterval)
+	assert.ErrorIs(t, context.Cause(runCtx), context.Canceled)
+	assert.Empty(t, repo.owner(1))
+}
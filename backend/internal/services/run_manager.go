@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrServerShuttingDown = errors.New("server is shutting down")
+	// ErrServerShutdown is the cause of the run interruption on shutdown.
+	// The interrupted run keeps its state to be continued after the restart
+	ErrServerShutdown = errors.New("run interrupted by server shutdown")
+)
+
+// RunManager owns the lifetime of the sendpost runs. The runs are executed
+// within the server-lifetime context instead of the request which started them,
+// the active runs are registered to be cancelled and waited for on shutdown.
+type RunManager struct {
+	ctx      context.Context
+	stop     context.CancelCauseFunc
+	runs     map[uint]*activeRun
+	wg       sync.WaitGroup
+	stopping bool
+	mu       sync.Mutex
+}
+
+// activeRun is a handle of the running sendpost
+type activeRun struct {
+	cancel context.CancelCauseFunc
+}
+
+func NewRunManager(ctx context.Context) *RunManager {
+	ctx, stop := context.WithCancelCause(ctx)
+	return &RunManager{ctx: ctx, stop: stop, runs: make(map[uint]*activeRun)}
+}
+
+// Go runs fn in the background within the server-lifetime context.
+// Returns ErrServerShuttingDown if the manager is shutting down.
+func (m *RunManager) Go(fn func(ctx context.Context)) error {
+	if err := m.add(); err != nil {
+		return err
+	}
+	go func() {
+		defer m.wg.Done()
+		fn(m.ctx)
+	}()
+	return nil
+}
+
+// Register makes the run of the sendpost cancellable via Cancel and Shutdown.
+// The returned func must be called when the run is finished.
+// Returns ErrServerShuttingDown if the manager is shutting down.
+func (m *RunManager) Register(ctx context.Context, sendpostID uint) (context.Context, func(), error) {
+	if err := m.add(); err != nil {
+		return nil, nil, err
+	}
+	runCtx, cancel := context.WithCancelCause(ctx)
+	// Запуск, начатый не в контексте менеджера, тоже прерывается при остановке
+	stopOnShutdown := context.AfterFunc(m.ctx, func() {
+		cancel(context.Cause(m.ctx))
+	})
+	active := &activeRun{cancel: cancel}
+
+	m.mu.Lock()
+	m.runs[sendpostID] = active
+	m.mu.Unlock()
+
+	return runCtx, func() {
+		m.mu.Lock()
+		if m.runs[sendpostID] == active {
+			delete(m.runs, sendpostID)
+		}
+		m.mu.Unlock()
+		stopOnShutdown()
+		cancel(nil)
+		m.wg.Done()
+	}, nil
+}
+
+// Detach returns the context carrying the values of ctx which isn't cancelled with it,
+// but is still interrupted with ErrServerShutdown when the manager is shut down.
+// It lets the run finish its work after the run context timed out. Until the returned
+// func is called, Cancel of the sendpost cancels the detached context instead of the run.
+func (m *RunManager) Detach(ctx context.Context, sendpostID uint) (context.Context, context.CancelFunc) {
+	detached, cancel := context.WithCancelCause(context.WithoutCancel(ctx))
+	stopOnShutdown := context.AfterFunc(m.ctx, func() {
+		cancel(context.Cause(m.ctx))
+	})
+	active := &activeRun{cancel: cancel}
+
+	m.mu.Lock()
+	previous, registered := m.runs[sendpostID]
+	m.runs[sendpostID] = active
+	m.mu.Unlock()
+
+	return detached, func() {
+		m.mu.Lock()
+		if m.runs[sendpostID] == active {
+			if registered {
+				m.runs[sendpostID] = previous
+			} else {
+				delete(m.runs, sendpostID)
+			}
+		}
+		m.mu.Unlock()
+		stopOnShutdown()
+		cancel(nil)
+	}
+}
+
+// Cancel cancels the active run of the sendpost with the given cause.
+// Returns ErrSendpostNotRunning if the sendpost has no active run.
+func (m *RunManager) Cancel(sendpostID uint, cause error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	active, ok := m.runs[sendpostID]
+	if !ok {
+		return ErrSendpostNotRunning
+	}
+	active.cancel(cause)
+	return nil
+}
+
+// ActiveRuns returns the IDs of the sendposts being run.
+func (m *RunManager) ActiveRuns() []uint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ids := make([]uint, 0, len(m.runs))
+	for id := range m.runs {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Shutdown stops accepting new runs and interrupts the active ones with ErrServerShutdown.
+// The interrupted runs don't cancel their flow runs, they save their state and finish.
+// Shutdown waits for them until ctx is done and returns the ctx error if the deadline is exceeded.
+func (m *RunManager) Shutdown(ctx context.Context) error {
+	m.mu.Lock()
+	m.stopping = true
+	m.mu.Unlock()
+
+	logging.Info("[RunManager] Shutdown", zap.Uints("active_sendpost_ids", m.ActiveRuns()))
+	m.stop(ErrServerShutdown)
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		logging.Info("[RunManager] All runs stopped")
+		return nil
+	case <-ctx.Done():
+		logging.Error("[RunManager] Runs didn't stop before the shutdown deadline", zap.Uints("active_sendpost_ids", m.ActiveRuns()))
+		return ctx.Err()
+	}
+}
+
+// add counts the new background job unless the manager is shutting down.
+func (m *RunManager) add() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopping {
+		return ErrServerShuttingDown
+	}
+	m.wg.Add(1)
+	return nil
+}
@@ -0,0 +1,30 @@
+package runners
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/services"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// approvalStageRunner pauses the run until the approval stage is approved or rejected.
+// The stage isn't executed by the executor.
+type approvalStageRunner struct {
+	approvalService *services.ApprovalService
+}
+
+func newApprovalStageRunner(approvalService *services.ApprovalService) entity.StageRunner {
+	return &approvalStageRunner{approvalService: approvalService}
+}
+
+func (asr *approvalStageRunner) Start(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	logging.Debug("[Stage Runner Approval] Start", zap.Uint("stage_id", stage.ID))
+	return asr.approvalService.AwaitApproval(ctx, run, stage)
+}
+
+func (asr *approvalStageRunner) CheckState(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	logging.Debug("[Stage Runner Approval] CheckState", zap.Uint("stage_id", stage.ID))
+	return asr.approvalService.WaitForDecision(ctx, run, stage)
+}
@@ -0,0 +1,179 @@
+package runners
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/schema"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// fakeStageRunRepository keeps the stage runs in memory, they are stored
+// and returned as copies the way the database does.
+type fakeStageRunRepository struct {
+	mu        sync.Mutex
+	stageRuns []*entity.StageRun
+	nextID    uint
+}
+
+func (r *fakeStageRunRepository) SaveStageRun(ctx context.Context, stageRun *entity.StageRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if stageRun.ID == 0 {
+		r.nextID++
+		stageRun.ID = r.nextID
+	}
+	saved := *stageRun
+	for i, existing := range r.stageRuns {
+		if existing.ID == saved.ID {
+			r.stageRuns[i] = &saved
+			return nil
+		}
+	}
+	r.stageRuns = append(r.stageRuns, &saved)
+	return nil
+}
+
+func (r *fakeStageRunRepository) GetStageRun(ctx context.Context, sendpostRunID uint, stageID uint) (*entity.StageRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var latest *entity.StageRun
+	for _, stageRun := range r.stageRuns {
+		if stageRun.SendpostRunID == sendpostRunID && stageRun.StageID == stageID && (latest == nil || stageRun.ID > latest.ID) {
+			latest = stageRun
+		}
+	}
+	if latest == nil {
+		return nil, nil
+	}
+	found := *latest
+	return &found, nil
+}
+
+func (r *fakeStageRunRepository) GetStageRuns(ctx context.Context, sendpostRunID uint) ([]*entity.StageRun, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var stageRuns []*entity.StageRun
+	for _, stageRun := range r.stageRuns {
+		if stageRun.SendpostRunID == sendpostRunID {
+			found := *stageRun
+			stageRuns = append(stageRuns, &found)
+		}
+	}
+	return stageRuns, nil
+}
+
+// states returns the state of the latest record of every stage within the run.
+func (r *fakeStageRunRepository) states(sendpostRunID uint) map[uint]value.StateType {
+	stageRuns, _ := r.GetStageRuns(context.Background(), sendpostRunID)
+	states := make(map[uint]value.StateType)
+	for _, stageRun := range stageRuns {
+		states[stageRun.StageID] = stageRun.State
+	}
+	return states
+}
+
+// fakeSendpostRunRepository only assigns the IDs to the runs, the parallel stage runner
+// doesn't read them back.
+type fakeSendpostRunRepository struct {
+	mu     sync.Mutex
+	nextID uint
+}
+
+func (r *fakeSendpostRunRepository) SaveSendpostRun(ctx context.Context, run *entity.SendpostRun) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if run.ID == 0 {
+		r.nextID++
+		run.ID = r.nextID
+	}
+	return nil
+}
+
+func (r *fakeSendpostRunRepository) GetSendpostRunByID(ctx context.Context, runID uint) (*entity.SendpostRun, error) {
+	return nil, errors.New("sendpost run not found")
+}
+
+func (r *fakeSendpostRunRepository) GetSendpostRuns(ctx context.Context, sendpostID uint) ([]*entity.SendpostRun, error) {
+	return nil, nil
+}
+
+func (r *fakeSendpostRunRepository) GetLastSendpostRun(ctx context.Context, sendpostID uint) (*entity.SendpostRun, error) {
+	return nil, nil
+}
+
+// fakeStageExecutor creates the flow runs in memory, they are reported running
+// until they are cancelled. The flow runs of the deployments in runErrs aren't created,
+// beforeRun is called before every flow run is created.
+type fakeStageExecutor struct {
+	runErrs   map[string]error
+	beforeRun func(deploymentID string)
+
+	mu        sync.Mutex
+	flowRuns  []string
+	cancelled []string
+}
+
+func newFakeStageExecutor() *fakeStageExecutor {
+	return &fakeStageExecutor{runErrs: make(map[string]error)}
+}
+
+func (e *fakeStageExecutor) Run(ctx context.Context, deploymentID string, parameters *map[string]interface{}) (*string, *value.StateType, error) {
+	if e.beforeRun != nil {
+		e.beforeRun(deploymentID)
+	}
+	if err, ok := e.runErrs[deploymentID]; ok {
+		return nil, nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	flowRunID := fmt.Sprintf("%s-%d", deploymentID, len(e.flowRuns)+1)
+	e.flowRuns = append(e.flowRuns, flowRunID)
+	state := value.Running
+	return &flowRunID, &state, nil
+}
+
+func (e *fakeStageExecutor) Status(ctx context.Context, flowRunID string) (*value.StateType, error) {
+	state := value.Running
+	return &state, nil
+}
+
+func (e *fakeStageExecutor) Cancel(ctx context.Context, flowRunID string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.cancelled = append(e.cancelled, flowRunID)
+	return nil
+}
+
+func (e *fakeStageExecutor) CheckFlowRunCompletionByDeploymentID(ctx context.Context, hisoryStart time.Time, historyEnd time.Time, deploymentID string) error {
+	return nil
+}
+
+func (e *fakeStageExecutor) GetDeploymentParameters(ctx context.Context, deploymentID string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (e *fakeStageExecutor) Result(ctx context.Context, flowRunID string) (map[string]interface{}, error) {
+	return nil, nil
+}
+
+func (e *fakeStageExecutor) GetDeploymentSchema(ctx context.Context, deploymentID string) (*schema.Schema, error) {
+	return nil, nil
+}
+
+// createdFlowRuns returns the flow runs created by the executor.
+func (e *fakeStageExecutor) createdFlowRuns() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.flowRuns...)
+}
+
+// cancelledFlowRuns returns the flow runs cancelled via the executor.
+func (e *fakeStageExecutor) cancelledFlowRuns() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.cancelled...)
+}
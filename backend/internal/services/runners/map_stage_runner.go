@@ -0,0 +1,38 @@
+package runners
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/services"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// mapStageRunner runs the deployment of the map stage once per element of its list.
+// The sub-stages are created for the elements on start and executed the same way
+// as the sub-stages of the parallel stage, with its concurrency limits and failure policy.
+type mapStageRunner struct {
+	*parallelStageRunner
+}
+
+func newMapStageRunner(stageRunnerService *services.StageRunnerService, stageService *services.StageService, notificationService *services.SenpostRunNotificationService, flowRunLimit *services.Semaphore) entity.StageRunner {
+	return &mapStageRunner{
+		parallelStageRunner: &parallelStageRunner{stageRunnerService: stageRunnerService, stageService: stageService, notificationService: notificationService, flowRunLimit: flowRunLimit},
+	}
+}
+
+func (msr *mapStageRunner) Start(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	logging.Debug("[Stage Runner Map] Start", zap.Uint("stage_id", stage.ID))
+
+	if err := msr.stageRunnerService.StartWithoutExecutor(ctx, run, stage); err != nil {
+		return err
+	}
+
+	subStages, err := msr.stageService.ExpandMapStage(ctx, run, stage)
+	if err != nil {
+		return msr.stageRunnerService.HandleFailedStage(ctx, run, stage, err)
+	}
+	logging.Debug("[Stage Runner Map] Expanded", zap.Uint("stage_id", stage.ID), zap.Int("sub_stages", len(subStages)))
+	return msr.queueSubStages(ctx, run, stage, subStages)
+}
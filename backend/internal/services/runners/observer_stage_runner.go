@@ -3,7 +3,6 @@ package runners
 import (
 	"context"
 	"crm-uplift-ii24-backend/internal/domain/entity"
-	"crm-uplift-ii24-backend/internal/domain/value"
 	"crm-uplift-ii24-backend/internal/services"
 	"crm-uplift-ii24-backend/pkg/logging"
 	"time"
@@ -20,13 +19,13 @@ func newObserverStageRunner(stageRunnerService *services.StageRunnerService, sta
 	return &observerStageRunner{stageRunnerService: stageRunnerService, stageService: stageService}
 }
 
-func (ost *observerStageRunner) Start(ctx context.Context, stage *entity.Stage) error {
+func (ost *observerStageRunner) Start(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
 	logging.Debug("[Stage Runner Observer] Start", zap.Uint("stage_id", stage.ID))
 
-	return ost.stageService.UpdateStageState(ctx, stage, value.Running)
+	return ost.stageRunnerService.StartWithoutExecutor(ctx, run, stage)
 }
 
-func (ost *observerStageRunner) CheckState(ctx context.Context, stage *entity.Stage) error {
+func (ost *observerStageRunner) CheckState(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
 	logging.Debug("[Stage Runner Observer] CheckState", zap.Uint("stage_id", stage.ID))
 
 	now := time.Now()
@@ -34,6 +33,7 @@ func (ost *observerStageRunner) CheckState(ctx context.Context, stage *entity.St
 
 	return ost.stageRunnerService.CheckStageCompledSuccesfullyInPeriod(
 		ctx,
+		run,
 		stage,
 		time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()),
 		time.Now(),
@@ -6,24 +6,36 @@ import (
 	"crm-uplift-ii24-backend/internal/domain/value"
 	"crm-uplift-ii24-backend/internal/services"
 	"crm-uplift-ii24-backend/pkg/logging"
-	"sync"
+	"errors"
+	"fmt"
 
 	"go.uber.org/zap"
 )
 
+const SubStageFailuresTolerated string = "[Stage Runner Parallel] Sub-stage failures tolerated by the failure policy"
+
+// ErrSubStageFailed is the cause of the cancellation of the sub-stages when
+// the parallel stage with the fail_fast policy couldn't succeed anymore
+var ErrSubStageFailed = errors.New("sibling sub-stage failed")
+
 type parallelStageRunner struct {
-	stageRunnerService *services.StageRunnerService
-	stageService       *services.StageService
+	stageRunnerService  *services.StageRunnerService
+	stageService        *services.StageService
+	notificationService *services.SenpostRunNotificationService
+	// flowRunLimit is shared by all the parallel stages of the running sendposts
+	flowRunLimit *services.Semaphore
 }
 
-func newParallelStageRunner(stageRunnerService *services.StageRunnerService, stageService *services.StageService) entity.StageRunner {
-	return &parallelStageRunner{stageRunnerService: stageRunnerService, stageService: stageService}
+func newParallelStageRunner(stageRunnerService *services.StageRunnerService, stageService *services.StageService, notificationService *services.SenpostRunNotificationService, flowRunLimit *services.Semaphore) entity.StageRunner {
+	return &parallelStageRunner{stageRunnerService: stageRunnerService, stageService: stageService, notificationService: notificationService, flowRunLimit: flowRunLimit}
 }
 
-func (psr *parallelStageRunner) Start(ctx context.Context, stage *entity.Stage) error {
+// Start marks the parallel stage as running and queues its sub-stages.
+// The sub-stages are started in CheckState as soon as the concurrency limits allow.
+func (psr *parallelStageRunner) Start(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
 	logging.Debug("[Stage Runner Parallel] Start", zap.Uint("stage_id", stage.ID))
 
-	if err := psr.stageService.UpdateStageState(ctx, stage, value.Running); err != nil {
+	if err := psr.stageRunnerService.StartWithoutExecutor(ctx, run, stage); err != nil {
 		return err
 	}
 
@@ -31,43 +43,41 @@ func (psr *parallelStageRunner) Start(ctx context.Context, stage *entity.Stage)
 	if err != nil {
 		return err
 	}
+	return psr.queueSubStages(ctx, run, stage, subStages)
+}
 
-	var wg sync.WaitGroup
-	errorsChan := make(chan error, len(subStages))
-
+// queueSubStages records the sub-stages to be started in CheckState as pending.
+// The blocked sub-stages are skipped, the sub-stages completed in the resumed run are reused.
+func (psr *parallelStageRunner) queueSubStages(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, subStages []*entity.Stage) error {
 	for _, subStage := range subStages {
-		wg.Add(1)
-		go func(subStage *entity.Stage) {
-			defer wg.Done()
-			logging.Debug("[Stage Runner Parallel] Start", zap.Uint("sub_stage_id", subStage.ID))
-			var err error
-			if subStage.IsParallel() {
-				err = psr.Start(ctx, subStage)
-			} else {
-				err = psr.stageRunnerService.Start(ctx, subStage)
-			}
-
-			if err != nil {
-				errorsChan <- err
+		if subStage.IsBlocked {
+			if err := psr.stageRunnerService.Skip(ctx, run, subStage); err != nil {
+				return psr.handleSubStageErr(ctx, run, stage, err)
 			}
-		}(subStage)
-	}
-
-	go func() {
-		wg.Wait()
-		close(errorsChan)
-	}()
-
-	for err := range errorsChan {
+			continue
+		}
+		// При возобновлении запуска перезапускаются только незавершённые подэтапы
+		reused, err := psr.stageRunnerService.Reuse(ctx, run, subStage)
 		if err != nil {
-			return psr.stageRunnerService.HandleFailedStage(ctx, stage, err)
+			return psr.handleSubStageErr(ctx, run, stage, err)
+		}
+		if reused {
+			continue
+		}
+		if err := psr.stageRunnerService.Queue(ctx, run, subStage); err != nil {
+			return psr.handleSubStageErr(ctx, run, stage, err)
 		}
 	}
 
 	return nil
 }
 
-func (psr *parallelStageRunner) CheckState(ctx context.Context, stage *entity.Stage) error {
+// CheckState executes the queued sub-stages concurrently and waits for all of them,
+// so the outcome of every sub-stage is recorded. At most MaxConcurrency sub-stages of the stage
+// are executed at once, the flow runs of all the parallel stages are limited by the global limit as well.
+// With the fail_fast policy the other sub-stages are cancelled as soon as the stage couldn't succeed anymore.
+// The stage succeeds if the outcomes satisfy its min_success or allowed_failures threshold.
+func (psr *parallelStageRunner) CheckState(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
 	logging.Debug("[Stage Runner Parallel] CheckState", zap.Uint("stage_id", stage.ID))
 
 	subStages, err := psr.stageService.GetSubStages(ctx, stage.ID)
@@ -75,37 +85,115 @@ func (psr *parallelStageRunner) CheckState(ctx context.Context, stage *entity.St
 		return err
 	}
 
-	var wg sync.WaitGroup
-	errorsChan := make(chan error, len(subStages))
+	subCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	limit := services.NewSemaphore(stage.MaxConcurrency)
+	results := make(chan error, len(subStages))
+	succeeded, pending := 0, 0
 
 	for _, subStage := range subStages {
-		wg.Add(1)
+		if subStage.IsBlocked {
+			continue
+		}
+		if run.CompletedStageRun(subStage.ID) != nil {
+			succeeded++
+			continue
+		}
+		pending++
 		go func() {
-			defer wg.Done()
-			logging.Debug("[Stage Runner Parallel] CheckState", zap.Uint("sub_stage_id", subStage.ID))
-			var err error
-			if subStage.IsParallel() {
-				err = psr.CheckState(ctx, subStage)
-			} else {
-				err = psr.stageRunnerService.CheckState(ctx, subStage)
-			}
-
-			if err != nil {
-				errorsChan <- err
-			}
+			results <- psr.runSubStage(subCtx, run, subStage, limit)
 		}()
 	}
 
-	go func() {
-		wg.Wait()
-		close(errorsChan)
-	}()
+	var failures []error
+	cancelled := false
+	for ; pending > 0; pending-- {
+		err := <-results
+		if cancelled {
+			// Подэтапы, отменённые после падения соседнего, не учитываются
+			continue
+		}
+		if err == nil {
+			succeeded++
+			continue
+		}
+		failures = append(failures, err)
+		if stage.FailurePolicy != value.WaitAll && !stage.SubStagesMaySucceed(succeeded, len(failures), pending-1) {
+			logging.Warn(ErrSubStageFailed.Error(), zap.Uint("stage_id", stage.ID), zap.Error(err))
+			cancel(fmt.Errorf("%w: %s", ErrSubStageFailed, err))
+			cancelled = true
+		}
+	}
 
-	for err := range errorsChan {
-		if err != nil {
-			return psr.stageRunnerService.HandleFailedStage(ctx, stage, err)
+	if ctx.Err() != nil {
+		return psr.stageRunnerService.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
+	}
+	if !stage.SubStagesSucceeded(succeeded, len(failures)) {
+		err := fmt.Errorf("%d sub-stages failed, %d completed: %w", len(failures), succeeded, errors.Join(failures...))
+		return psr.stageRunnerService.HandleFailedStage(ctx, run, stage, err)
+	}
+	if len(failures) > 0 {
+		logging.Warn(SubStageFailuresTolerated, zap.Uint("stage_id", stage.ID), zap.Int("failed", len(failures)), zap.Int("completed", succeeded))
+	}
+
+	return psr.stageRunnerService.UpdateState(ctx, run, stage, value.Completed)
+}
+
+// runSubStage waits for a free slot and executes the sub-stage until it finishes.
+// The nested parallel stage takes a slot of the parent only, its flow runs take the global slots themselves.
+func (psr *parallelStageRunner) runSubStage(ctx context.Context, run *entity.SendpostRun, subStage *entity.Stage, limit *services.Semaphore) error {
+	if err := limit.Acquire(ctx); err != nil {
+		return psr.stageRunnerService.HandleCancelledStage(ctx, run, subStage, err)
+	}
+	defer limit.Release()
+	if !subStage.IsParallel() {
+		if err := psr.flowRunLimit.Acquire(ctx); err != nil {
+			return psr.stageRunnerService.HandleCancelledStage(ctx, run, subStage, err)
 		}
+		defer psr.flowRunLimit.Release()
 	}
 
-	return psr.stageService.UpdateStageState(ctx, stage, value.Completed)
+	logging.Debug("[Stage Runner Parallel] Start", zap.Uint("sub_stage_id", subStage.ID))
+	// Таймаут подэтапа отсчитывается с его запуска и не прерывает остальные подэтапы
+	subCtx, cancel := psr.stageRunnerService.WithTimeout(ctx, subStage)
+	defer cancel()
+
+	var err error
+	if subStage.IsParallel() {
+		err = psr.Start(subCtx, run, subStage)
+	} else {
+		if _, err := psr.stageRunnerService.ResolveParameters(subCtx, run, subStage); err != nil {
+			return psr.stageRunnerService.HandleFailedStage(subCtx, run, subStage, err)
+		}
+		err = psr.stageRunnerService.Start(subCtx, run, subStage)
+	}
+	if err != nil {
+		return err
+	}
+	psr.notify(subStage)
+
+	logging.Debug("[Stage Runner Parallel] CheckState", zap.Uint("sub_stage_id", subStage.ID))
+	if subStage.IsParallel() {
+		err = psr.CheckState(subCtx, run, subStage)
+	} else {
+		err = psr.stageRunnerService.CheckState(subCtx, run, subStage)
+	}
+	psr.notify(subStage)
+	return err
+}
+
+func (psr *parallelStageRunner) notify(subStage *entity.Stage) {
+	if err := psr.notificationService.NotifyRunSendpost(subStage.SendpostID, value.Updated); err != nil {
+		logging.Warn(services.ErrorNotifyRunSendpost)
+	}
+}
+
+// handleSubStageErr marks the parallel stage as cancelled if the run was cancelled
+// or the parallel stage timed out, as failed otherwise.
+func (psr *parallelStageRunner) handleSubStageErr(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, err error) error {
+	if ctx.Err() != nil {
+		return psr.stageRunnerService.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
+	}
+	return psr.stageRunnerService.HandleFailedStage(ctx, run, stage, err)
 }
@@ -0,0 +1,124 @@
+package runners
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/mocks"
+	"crm-uplift-ii24-backend/internal/services"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// testParallelStage is the parallel stage 10 with the sub-stages 11, 12 and 13.
+// The flow run of the sub-stage 11 couldn't be created, it fails only after
+// the flow runs of the other sub-stages are created.
+type testParallelStage struct {
+	runner    entity.StageRunner
+	executor  *fakeStageExecutor
+	stageRuns *fakeStageRunRepository
+	history   *services.RunHistoryService
+	parent    *entity.Stage
+}
+
+func newTestParallelStage(parent *entity.Stage) *testParallelStage {
+	logging.Logger = zap.NewNop()
+	parent.Model = gorm.Model{ID: 10}
+	parent.SendpostID = 1
+	parent.Type = value.ParallelStage
+	subStages := []*entity.Stage{
+		{Model: gorm.Model{ID: 11}, SendpostID: 1, ParentStageID: &parent.ID, DeploymnentID: "fail"},
+		{Model: gorm.Model{ID: 12}, SendpostID: 1, ParentStageID: &parent.ID, DeploymnentID: "slow"},
+		{Model: gorm.Model{ID: 13}, SendpostID: 1, ParentStageID: &parent.ID, DeploymnentID: "slow"},
+	}
+	stageRepo := new(mocks.StageRepository)
+	stageRepo.On("GetStageByID", mock.Anything, parent.ID).Return(parent, nil)
+	stageRepo.On("GetSubStages", mock.Anything, parent.ID).Return(subStages, nil)
+	stageRepo.On("SaveStage", mock.Anything, mock.Anything).Return(nil)
+
+	executor := newFakeStageExecutor()
+	executor.runErrs["fail"] = errors.New("deployment not found")
+	var started sync.WaitGroup
+	started.Add(2)
+	executor.beforeRun = func(deploymentID string) {
+		if deploymentID == "slow" {
+			started.Done()
+			return
+		}
+		started.Wait()
+	}
+
+	stageRuns := &fakeStageRunRepository{}
+	history := services.NewRunHistoryService(&fakeSendpostRunRepository{}, stageRuns)
+	sendpostRepo := new(mocks.SendpostRepository)
+	sendpostRepo.On("GetSendpostParameters", mock.Anything, uint(1)).Return(&value.JSONB{}, nil)
+	stageService := services.NewStageService(stageRepo, sendpostRepo, new(mocks.StageDependencyRepository), services.NewSchemaService(nil))
+	sendpostService := services.NewSendpostService(sendpostRepo, stageService)
+	templateService := services.NewTemplateService(sendpostService, history, "test", time.UTC)
+	parameterService := services.NewParameterService(executor, sendpostService, stageService, templateService, services.NewSchemaService(executor))
+	stageRunnerService := services.NewStageRunnerService(executor, stageService, history, parameterService, 1)
+	return &testParallelStage{
+		runner:    newParallelStageRunner(stageRunnerService, stageService, services.NewSenpostRunNotificationService(nil), services.NewSemaphore(0)),
+		executor:  executor,
+		stageRuns: stageRuns,
+		history:   history,
+		parent:    parent,
+	}
+}
+
+func TestParallelStageFailFastCancelsSiblings(t *testing.T) {
+	p := newTestParallelStage(&entity.Stage{FailurePolicy: value.FailFast})
+	ctx := context.Background()
+	run, err := p.history.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, p.runner.Start(ctx, run, p.parent))
+	assert.Error(t, p.runner.CheckState(ctx, run, p.parent))
+
+	// flow run соседних подэтапов отменяются, не дожидаясь их завершения
+	assert.Len(t, p.executor.createdFlowRuns(), 2)
+	assert.ElementsMatch(t, p.executor.createdFlowRuns(), p.executor.cancelledFlowRuns())
+	assert.Equal(t, map[uint]value.StateType{10: value.Failed, 11: value.Failed, 12: value.Cancelled, 13: value.Cancelled}, p.stageRuns.states(run.ID))
+}
+
+func TestParallelStageToleratedFailureDoesntCancelSiblings(t *testing.T) {
+	cases := map[string]*entity.Stage{
+		"wait_all":         {FailurePolicy: value.WaitAll},
+		"allowed_failures": {FailurePolicy: value.FailFast, AllowedFailures: 1},
+		"min_success":      {FailurePolicy: value.FailFast, MinSuccess: 2},
+	}
+	for name, parent := range cases {
+		t.Run(name, func(t *testing.T) {
+			p := newTestParallelStage(parent)
+			ctx, cancel := context.WithCancel(context.Background())
+			run, err := p.history.CreateRun(ctx, 1, nil, nil, nil, nil)
+			require.NoError(t, err)
+
+			require.NoError(t, p.runner.Start(ctx, run, p.parent))
+			done := make(chan error, 1)
+			go func() {
+				done <- p.runner.CheckState(ctx, run, p.parent)
+			}()
+
+			// Падение подэтапа не мешает этапу завершиться успешно, соседние подэтапы продолжают выполняться
+			require.Eventually(t, func() bool { return p.stageRuns.states(run.ID)[11] == value.Failed }, time.Second, time.Millisecond)
+			assert.Never(t, func() bool { return len(p.executor.cancelledFlowRuns()) > 0 }, 50*time.Millisecond, time.Millisecond)
+
+			cancel()
+			<-done
+			assert.Equal(t, value.Cancelled, p.stageRuns.states(run.ID)[10])
+			assert.Len(t, p.executor.cancelledFlowRuns(), 2)
+		})
+	}
+}
@@ -17,12 +17,12 @@ func newSequentialStageRunner(StageRunnerService *services.StageRunnerService) e
 	return &sequentialStageRunner{StageRunnerService: StageRunnerService}
 }
 
-func (ssr *sequentialStageRunner) Start(ctx context.Context, stage *entity.Stage) error {
+func (ssr *sequentialStageRunner) Start(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
 	logging.Debug("[Stage Runner Sequential] Start", zap.Uint("stage_id", stage.ID))
-	return ssr.StageRunnerService.Start(ctx, stage)
+	return ssr.StageRunnerService.Start(ctx, run, stage)
 }
 
-func (ssr *sequentialStageRunner) CheckState(ctx context.Context, stage *entity.Stage) error {
+func (ssr *sequentialStageRunner) CheckState(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
 	logging.Debug("[Stage Runner Sequential] CheckState", zap.Uint("stage_id", stage.ID))
-	return ssr.StageRunnerService.CheckState(ctx, stage)
+	return ssr.StageRunnerService.CheckState(ctx, run, stage)
 }
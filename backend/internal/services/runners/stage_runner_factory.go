@@ -7,20 +7,38 @@ import (
 )
 
 type stageRunnerFactory struct {
-	StageRunnerService *services.StageRunnerService
-	stageService       *services.StageService
+	StageRunnerService  *services.StageRunnerService
+	stageService        *services.StageService
+	notificationService *services.SenpostRunNotificationService
+	approvalService     *services.ApprovalService
+	flowRunLimit        *services.Semaphore
 }
 
-func NewStageRunnerFactory(StageRunnerService *services.StageRunnerService, stageService *services.StageService) entity.StageRunnerFactory {
-	return &stageRunnerFactory{StageRunnerService: StageRunnerService, stageService: stageService}
+// NewStageRunnerFactory creates the factory of the stage runners.
+// maxParallelFlowRuns limits the number of the sub-stages of all the parallel stages
+// executed at once across the running sendposts, 0 means no limit.
+func NewStageRunnerFactory(StageRunnerService *services.StageRunnerService, stageService *services.StageService, notificationService *services.SenpostRunNotificationService, approvalService *services.ApprovalService, maxParallelFlowRuns int) entity.StageRunnerFactory {
+	return &stageRunnerFactory{
+		StageRunnerService:  StageRunnerService,
+		stageService:        stageService,
+		notificationService: notificationService,
+		approvalService:     approvalService,
+		flowRunLimit:        services.NewSemaphore(maxParallelFlowRuns),
+	}
 }
 
 func (srf *stageRunnerFactory) CreateRunner(stageType value.StageType) entity.StageRunner {
 	switch stageType {
 	case value.ParallelStage:
-		return newParallelStageRunner(srf.StageRunnerService, srf.stageService)
+		return newParallelStageRunner(srf.StageRunnerService, srf.stageService, srf.notificationService, srf.flowRunLimit)
+	case value.MapStage:
+		return newMapStageRunner(srf.StageRunnerService, srf.stageService, srf.notificationService, srf.flowRunLimit)
 	case value.ObserverStage:
 		return newObserverStageRunner(srf.StageRunnerService, srf.stageService)
+	case value.ApprovalStage:
+		return newApprovalStageRunner(srf.approvalService)
+	case value.WaitStage:
+		return newWaitStageRunner(srf.StageRunnerService, srf.notificationService)
 	case value.SequentialStage:
 		return newSequentialStageRunner(srf.StageRunnerService)
 	default:
@@ -0,0 +1,68 @@
+package runners
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/services"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// waitCountdownInterval is how often the listeners are notified of the time left until the wait stage finishes
+const waitCountdownInterval = time.Minute
+
+// waitStageRunner waits for the duration or until the wall-clock time of the wait stage.
+// The stage isn't executed by the executor, the wake-up time is saved in the stage run
+// so the waiting continues after the restart.
+type waitStageRunner struct {
+	stageRunnerService  *services.StageRunnerService
+	notificationService *services.SenpostRunNotificationService
+	wakeAt              time.Time
+}
+
+func newWaitStageRunner(stageRunnerService *services.StageRunnerService, notificationService *services.SenpostRunNotificationService) entity.StageRunner {
+	return &waitStageRunner{stageRunnerService: stageRunnerService, notificationService: notificationService}
+}
+
+func (wsr *waitStageRunner) Start(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	logging.Debug("[Stage Runner Wait] Start", zap.Uint("stage_id", stage.ID))
+
+	wakeAt, err := wsr.stageRunnerService.StartWait(ctx, run, stage)
+	if err != nil {
+		return err
+	}
+	wsr.wakeAt = wakeAt
+	return nil
+}
+
+// CheckState waits until the wake-up time notifying the listeners of the time left.
+func (wsr *waitStageRunner) CheckState(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	logging.Debug("[Stage Runner Wait] CheckState", zap.Uint("stage_id", stage.ID), zap.Time("wake_at", wsr.wakeAt))
+
+	timer := time.NewTimer(time.Until(wsr.wakeAt))
+	defer timer.Stop()
+	ticker := time.NewTicker(waitCountdownInterval)
+	defer ticker.Stop()
+
+	wsr.notifyCountdown(stage)
+	for {
+		select {
+		case <-ctx.Done():
+			return wsr.stageRunnerService.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
+		case <-ticker.C:
+			wsr.notifyCountdown(stage)
+		case <-timer.C:
+			logging.Info(services.StageCompleted, zap.Uint("stage_id", stage.ID))
+			return wsr.stageRunnerService.UpdateState(ctx, run, stage, value.Completed)
+		}
+	}
+}
+
+func (wsr *waitStageRunner) notifyCountdown(stage *entity.Stage) {
+	if err := wsr.notificationService.NotifyCountdown(stage.SendpostID, stage.ID, wsr.wakeAt); err != nil {
+		logging.Warn(services.ErrorNotifyRunSendpost, zap.Error(err))
+	}
+}
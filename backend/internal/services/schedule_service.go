@@ -16,28 +16,35 @@ func NewScheduleService(repo repository.SendpostScheduleRepository) *ScheduleSer
 	return &ScheduleService{repo: repo}
 }
 
-// CreateSchedule creates a new sendpost schedule with the specified sendpost ID and planned time.
+// CreateSchedule creates a new sendpost schedule with the specified sendpost ID.
+// The schedule is either planned once at plannedAt or recurring by the cron expression
+// evaluated in the given timezone.
 // It saves the schedule using the repository and returns the created schedule or an error if saving fails.
 //
 // Parameters:
 //
 //	ctx - The context for managing request-scoped values, cancellation, and deadlines.
 //	sendopstID - The unique identifier for the sendpost.
-//	plannedAt - The time when the sendpost is planned to be sent.
+//	plannedAt - The time when the sendpost is planned to be sent, if the schedule isn't recurring.
+//	cronExpression - The cron expression of the recurring schedule.
+//	timezone - The IANA timezone the cron expression is evaluated in.
 //
 // Returns:
 //
 //	*entity.SendpostSchedule - The created sendpost schedule.
-//	error - An error if the schedule could not be saved.
+//	error - An error if the schedule is invalid or could not be saved.
 func (ss *ScheduleService) CreateSchedule(
 	ctx context.Context,
 	sendopstID uint,
-	plannedAt time.Time,
-
+	plannedAt *time.Time,
+	cronExpression *string,
+	timezone string,
 ) (*entity.SendpostSchedule, error) {
 	schedule := entity.SendpostSchedule{
 		SendpostID: sendopstID,
-		PlannedAt:  plannedAt,
+	}
+	if err := schedule.Update(plannedAt, cronExpression, timezone); err != nil {
+		return nil, fmt.Errorf("[ScheduleService] error create schedule: %w", err)
 	}
 	if err := ss.repo.SaveSchedule(ctx, &schedule); err != nil {
 		return nil, fmt.Errorf("[ScheduleService] error create schedule: %s", err)
@@ -45,6 +52,80 @@ func (ss *ScheduleService) CreateSchedule(
 	return &schedule, nil
 }
 
+// GetSchedule retrieves the schedule by its ID.
+// It returns an error if the schedule doesn't belong to the sendpost.
+func (ss *ScheduleService) GetSchedule(ctx context.Context, sendpostID uint, scheduleID uint) (*entity.SendpostSchedule, error) {
+	schedule, err := ss.repo.GetScheduleByID(ctx, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("[ScheduleService] error GetSchedule: %s", err)
+	}
+	if schedule.SendpostID != sendpostID {
+		return nil, fmt.Errorf("[ScheduleService] error GetSchedule: schedule %d doesn't belong to sendpost %d", scheduleID, sendpostID)
+	}
+	return schedule, nil
+}
+
+// GetSchedules retrieves all schedules of the sendpost.
+func (ss *ScheduleService) GetSchedules(ctx context.Context, sendpostID uint) ([]*entity.SendpostSchedule, error) {
+	schedules, err := ss.repo.GetSchedulesBySendpostID(ctx, sendpostID)
+	if err != nil {
+		return nil, fmt.Errorf("[ScheduleService] error GetSchedules: %s", err)
+	}
+	return schedules, nil
+}
+
+// ChangeSchedule replaces the definition of the sendpost's schedule and saves it.
+// PlannedAt of the recurring schedule is recalculated from the new cron expression.
+func (ss *ScheduleService) ChangeSchedule(
+	ctx context.Context,
+	sendpostID uint,
+	scheduleID uint,
+	plannedAt *time.Time,
+	cronExpression *string,
+	timezone string,
+) (*entity.SendpostSchedule, error) {
+	schedule, err := ss.GetSchedule(ctx, sendpostID, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+	if err := schedule.Update(plannedAt, cronExpression, timezone); err != nil {
+		return nil, fmt.Errorf("[ScheduleService] error ChangeSchedule: %w", err)
+	}
+	if err := ss.repo.SaveSchedule(ctx, schedule); err != nil {
+		return nil, fmt.Errorf("[ScheduleService] error ChangeSchedule: %s", err)
+	}
+	return schedule, nil
+}
+
+// DeleteSchedule deletes the sendpost's schedule.
+func (ss *ScheduleService) DeleteSchedule(ctx context.Context, sendpostID uint, scheduleID uint) error {
+	if _, err := ss.GetSchedule(ctx, sendpostID, scheduleID); err != nil {
+		return err
+	}
+	if err := ss.repo.DeleteSchedule(ctx, scheduleID); err != nil {
+		return fmt.Errorf("[ScheduleService] error DeleteSchedule: %s", err)
+	}
+	return nil
+}
+
+// GetPendingSchedules retrieves the schedules which should be put to the scheduler on start.
+func (ss *ScheduleService) GetPendingSchedules(ctx context.Context) ([]*entity.SendpostSchedule, error) {
+	schedules, err := ss.repo.GetPendingSchedules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("[ScheduleService] error GetPendingSchedules: %s", err)
+	}
+	return schedules, nil
+}
+
+// SkipSchedule marks the one-time schedule as skipped and saves it.
+func (ss *ScheduleService) SkipSchedule(ctx context.Context, schedule *entity.SendpostSchedule) error {
+	schedule.Skip(time.Now())
+	if err := ss.repo.SaveSchedule(ctx, schedule); err != nil {
+		return fmt.Errorf("[ScheduleService] error SkipSchedule: %s", err)
+	}
+	return nil
+}
+
 // UpdateSchedule updates the given SendpostSchedule in the repository.
 // It takes a context and a pointer to a SendpostSchedule entity as parameters.
 // Returns an error if the update operation fails.
@@ -56,25 +137,28 @@ func (ss *ScheduleService) UpdateSchedule(ctx context.Context, schedule *entity.
 	return nil
 }
 
-// UpdateScheduleStartedAt updates the StartedAt timestamp of a SendpostSchedule
-// entity to the current time and saves the updated schedule to the repository.
-// Returns an error if the save operation fails.
+// ClaimSchedule marks the schedule as started if it's still planned at the same time and wasn't started
+// by another replica, the scheduled run must be started only if the schedule was claimed.
 //
 // Parameters:
-//   - ctx: The context for managing request-scoped values, cancellation signals,
-//     and deadlines.
-//   - schedule: A pointer to the SendpostSchedule entity to be updated.
+//
+//	ctx - The context for managing request-scoped values, cancellation, and deadlines.
+//	schedule - The schedule which fired, StartedAt is set if it was claimed.
 //
 // Returns:
-//   - error: An error if the schedule could not be saved, otherwise nil.
-func (ss *ScheduleService) UpdateScheduleStartedAt(ctx context.Context, schedule *entity.SendpostSchedule) error {
+//
+//	bool - Whether the schedule was claimed.
+//	error - An error if the schedule could not be updated.
+func (ss *ScheduleService) ClaimSchedule(ctx context.Context, schedule *entity.SendpostSchedule) (bool, error) {
 	currentTime := time.Now()
-	schedule.StartedAt = &currentTime
-	err := ss.repo.SaveSchedule(ctx, schedule)
+	claimed, err := ss.repo.ClaimSchedule(ctx, schedule.ID, schedule.PlannedAt, currentTime)
 	if err != nil {
-		return fmt.Errorf("[ScheduleService] error updating schedule StartedAt: %s", err)
+		return false, fmt.Errorf("[ScheduleService] error ClaimSchedule: %s", err)
 	}
-	return nil
+	if claimed {
+		schedule.StartedAt = &currentTime
+	}
+	return claimed, nil
 }
 
 // UpdateScheduleCompletedAt updates the CompletedAt field of a SendpostSchedule
@@ -98,3 +182,14 @@ func (ss *ScheduleService) UpdateScheduleCompletedAt(ctx context.Context, schedu
 	}
 	return nil
 }
+
+// ScheduleNext moves the recurring schedule to its next activation time and saves it.
+func (ss *ScheduleService) ScheduleNext(ctx context.Context, schedule *entity.SendpostSchedule) error {
+	if err := schedule.ScheduleNext(time.Now()); err != nil {
+		return fmt.Errorf("[ScheduleService] error ScheduleNext: %w", err)
+	}
+	if err := ss.repo.SaveSchedule(ctx, schedule); err != nil {
+		return fmt.Errorf("[ScheduleService] error ScheduleNext: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/schema"
+	"crm-uplift-ii24-backend/pkg/template"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidParameters means the parameters don't match the schema of the parameters of the deployment,
+// the error wraps schema.Errors with the mismatch of every field.
+var ErrInvalidParameters = errors.New("parameters don't match the deployment schema")
+
+// SchemaService validates the parameters of the stages against the OpenAPI schema
+// of the parameters of their deployments: the types, the required parameters and the enums.
+// The values with the expressions are rendered within the run, so they aren't checked.
+type SchemaService struct {
+	executor entity.StageExecutor
+}
+
+func NewSchemaService(executor entity.StageExecutor) *SchemaService {
+	return &SchemaService{executor: executor}
+}
+
+// StageErrors checks the parameters of the stage against the schema of its deployment.
+// The required parameters must be set by the defaults of the deployment or by the parameters.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//	stage - The stage whose deployment the parameters are passed to.
+//	params - The parameters of the stage, may be nil.
+//
+// Returns:
+//
+//	schema.Errors - The mismatches of the parameters, nil if the stage isn't executed by a deployment
+//	or the deployment doesn't have the schema.
+//	error - An error if the schema or the defaults of the deployment couldn't be retrieved.
+func (s *SchemaService) StageErrors(ctx context.Context, stage *entity.Stage, params *value.JSONB) (schema.Errors, error) {
+	parameterSchema, err := s.stageSchema(ctx, stage)
+	if err != nil || parameterSchema == nil {
+		return nil, err
+	}
+	defaults, err := s.executor.GetDeploymentParameters(ctx, stage.DeploymnentID)
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]interface{}, len(defaults))
+	for k, v := range defaults {
+		present[k] = v
+	}
+	if params != nil {
+		for k, v := range *params {
+			present[k] = v
+		}
+	}
+	errs := parameterSchema.Missing(present)
+	if params != nil {
+		for _, key := range sortedKeys(*params) {
+			if v := (*params)[key]; !hasExpressions(v) {
+				errs = append(errs, parameterSchema.ValidateField(key, v)...)
+			}
+		}
+	}
+	return errs, nil
+}
+
+// ValueErrors checks the value of the parameter against the schema of the deployment of the stage.
+// The parameter the schema doesn't describe isn't checked.
+func (s *SchemaService) ValueErrors(ctx context.Context, stage *entity.Stage, key string, v interface{}) (schema.Errors, error) {
+	if hasExpressions(v) {
+		return nil, nil
+	}
+	parameterSchema, err := s.stageSchema(ctx, stage)
+	if err != nil || parameterSchema == nil {
+		return nil, err
+	}
+	return parameterSchema.ValidateField(key, v), nil
+}
+
+// stageSchema returns the schema of the parameters of the deployment of the stage,
+// nil if the stage isn't executed by a deployment.
+func (s *SchemaService) stageSchema(ctx context.Context, stage *entity.Stage) (*schema.Schema, error) {
+	if !stage.NeedsDeployment() || stage.DeploymnentID == "" {
+		return nil, nil
+	}
+	return s.executor.GetDeploymentSchema(ctx, stage.DeploymnentID)
+}
+
+// invalidParameters returns ErrInvalidParameters wrapping the mismatches of the fields.
+func invalidParameters(errs schema.Errors) error {
+	return fmt.Errorf("%w: %w", ErrInvalidParameters, errs)
+}
+
+// forStage marks the mismatches found by the schema of the deployment of the stage.
+func forStage(errs schema.Errors, stageID uint) schema.Errors {
+	for i := range errs {
+		errs[i].Message = fmt.Sprintf("%s (stage %d)", errs[i].Message, stageID)
+	}
+	return errs
+}
+
+// hasExpressions reports whether the value is a string with the expressions rendered within the run.
+func hasExpressions(v interface{}) bool {
+	s, ok := v.(string)
+	return ok && template.HasExpressions(s)
+}
@@ -0,0 +1,40 @@
+package services
+
+import "context"
+
+// Semaphore limits the number of the executions at once.
+// The nil semaphore doesn't limit anything.
+type Semaphore struct {
+	slots chan struct{}
+}
+
+// NewSemaphore creates the semaphore with the given number of slots.
+// Returns nil if the limit isn't positive, i.e. the executions aren't limited.
+func NewSemaphore(limit int) *Semaphore {
+	if limit <= 0 {
+		return nil
+	}
+	return &Semaphore{slots: make(chan struct{}, limit)}
+}
+
+// Acquire waits for a free slot until the context is done.
+// Returns the cause of the context cancellation if the slot wasn't acquired.
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// Release frees the slot taken by Acquire.
+func (s *Semaphore) Release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+}
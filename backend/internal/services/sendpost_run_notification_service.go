@@ -5,6 +5,7 @@ import (
 	"crm-uplift-ii24-backend/internal/domain/value"
 	runstatus "crm-uplift-ii24-backend/internal/infrastructure/notifications/runStatus"
 	"crm-uplift-ii24-backend/pkg/logging"
+	"encoding/json"
 	"errors"
 	"time"
 
@@ -37,6 +38,34 @@ func (s *SenpostRunNotificationService) NotifyRunSendpost(sendpostID uint, statu
 	return errors.New("[SenpostRunNotificationService] NotifyRunSendpost: sendpost not found")
 }
 
+// countdown is the notification about the time left until the wait stage finishes waiting
+type countdown struct {
+	Type             string    `json:"type"`
+	StageID          uint      `json:"stage_id"`
+	WakeAt           time.Time `json:"wake_at"`
+	RemainingSeconds int       `json:"remaining_seconds"`
+}
+
+// NotifyCountdown notifies the listeners of the sendpost how much time is left until the wait stage finishes waiting.
+// Unlike the state notifications the message is the JSON object
+// {"type":"countdown","stage_id":1,"wake_at":"2006-01-02T15:04:05Z","remaining_seconds":60}.
+func (s *SenpostRunNotificationService) NotifyCountdown(sendpostID uint, stageID uint, wakeAt time.Time) error {
+	notificator, ok := s.sendopostsToNotify[sendpostID]
+	if !ok {
+		return errors.New("[SenpostRunNotificationService] NotifyCountdown: sendpost not found")
+	}
+	remaining := time.Until(wakeAt).Round(time.Second)
+	if remaining < 0 {
+		remaining = 0
+	}
+	msg, err := json.Marshal(countdown{Type: "countdown", StageID: stageID, WakeAt: wakeAt, RemainingSeconds: int(remaining.Seconds())})
+	if err != nil {
+		return err
+	}
+	notificator.NotifyListeners(string(msg))
+	return nil
+}
+
 func (s *SenpostRunNotificationService) AddListener(sendpostID uint, listener entity.Listener) error {
 	for i := 0; i < 5; i++ {
 		if notificator, ok := s.sendopostsToNotify[sendpostID]; ok {
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ErrorEvalCondition string = "[SendpostRunnerService] error evaluating stage condition"
+	ConditionNotMet    string = "[SendpostRunnerService] Stage condition is false"
+)
+
+// processStageIfConditionMet processes the stage if it has no condition or its condition is true,
+// otherwise the stage is recorded as skipped. The stage whose condition couldn't be evaluated is failed.
+// The stage completed before the run was resumed or recovered isn't checked again.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values, cancelation signals, and deadlines.
+//	run - The sendpost run the stage is processed within.
+//	stage - The stage entity to be processed.
+//	previous - The IDs of the stages it depends on.
+//
+// Returns:
+//
+//	An error if the condition couldn't be evaluated or the stage processing fails, otherwise nil.
+func (srs *SendpostRunnerService) processStageIfConditionMet(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, previous []uint) error {
+	if !stage.HasCondition() || stage.IsBlocked || run.CompletedStageRun(stage.ID) != nil {
+		return srs.processStage(ctx, run, stage)
+	}
+	met, err := srs.evalCondition(ctx, run, stage, previous)
+	if err != nil {
+		err = fmt.Errorf("%s: %s", ErrorEvalCondition, err)
+		if handleErr := srs.stageRunnerService.HandleFailedStage(ctx, run, stage, err); handleErr != nil {
+			logging.Warn(ErrorEvalCondition, zap.Uint("stage_id", stage.ID), zap.Error(handleErr))
+		}
+		return err
+	}
+	if met {
+		return srs.processStage(ctx, run, stage)
+	}
+
+	logging.Info(ConditionNotMet, zap.Uint("stage_id", stage.ID), zap.String("condition", *stage.Condition))
+	if err := srs.stageRunnerService.Skip(ctx, run, stage); err != nil {
+		return logging.WrapError(ProcessError, err)
+	}
+	if err := srs.senpostNotificationService.NotifyRunSendpost(stage.SendpostID, value.Skipped); err != nil {
+		logging.Warn(ErrorNotifyRunSendpost)
+	}
+	return nil
+}
+
+// evalCondition evaluates the condition of the stage with the values:
+//
+//	params.<name> - the global parameters of the sendpost with the overrides of the run
+//	stages["<id>"].state - the states of the stages executed within the run
+//	stages["<id>"].result - the outputs of the flow runs of the stages executed within the run
+//	previous.state - the state of the stages it depends on, see previousStage
+//	weekday - the current day of the week in the configured timezone, e.g. "Monday"
+func (srs *SendpostRunnerService) evalCondition(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, previous []uint) (bool, error) {
+	expr, err := stage.ParseCondition()
+	if err != nil {
+		return false, err
+	}
+
+	params := make(map[string]any)
+	globalParams, err := srs.getGlobalParameters(ctx, run)
+	if err != nil {
+		return false, err
+	}
+	if globalParams != nil {
+		for k, v := range *globalParams {
+			params[k] = v
+		}
+	}
+
+	stages, err := srs.runHistoryService.StageOutputs(ctx, run)
+	if err != nil {
+		return false, err
+	}
+
+	env := map[string]any{
+		"params":   params,
+		"stages":   stages,
+		"previous": previousStage(stages, previous),
+		"weekday":  time.Now().In(srs.location).Weekday().String(),
+	}
+
+	met, err := expr.Eval(env)
+	if err != nil {
+		return false, err
+	}
+	logging.Debug("[SendpostRunnerService] evalCondition", zap.Uint("stage_id", stage.ID), zap.Bool("result", met))
+	return met, nil
+}
+
+// previousStage returns the values of the stages the stage depends on. For the only stage
+// these are its values. For several stages the state is COMPLETED if all of them completed,
+// otherwise SKIPPED. The stage which doesn't depend on other stages has no values.
+func previousStage(stages map[string]any, dependsOn []uint) map[string]any {
+	if len(dependsOn) == 0 {
+		return map[string]any{}
+	}
+	if len(dependsOn) == 1 {
+		if values, ok := stages[strconv.FormatUint(uint64(dependsOn[0]), 10)].(map[string]any); ok {
+			return values
+		}
+		return map[string]any{}
+	}
+	state := value.Completed
+	for _, id := range dependsOn {
+		values, _ := stages[strconv.FormatUint(uint64(id), 10)].(map[string]any)
+		if values["state"] != string(value.Completed) {
+			state = value.Skipped
+		}
+	}
+	return map[string]any{"state": string(state)}
+}
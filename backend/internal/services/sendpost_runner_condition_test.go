@@ -0,0 +1,108 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/mocks"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+func newTestConditionRunner(t *testing.T, location *time.Location) (*SendpostRunnerService, *RunHistoryService, *fakeStageRunRepository) {
+	logging.Logger = zap.NewNop()
+	sendpostRepo := new(mocks.SendpostRepository)
+	sendpostRepo.On("GetSendpostParameters", mock.Anything, uint(1)).Return(&value.JSONB{"segment": "vip"}, nil)
+	stageRepo := new(mocks.StageRepository)
+	stageRepo.On("SaveStage", mock.Anything, mock.Anything).Return(nil)
+	history, _, stageRuns := newFakeRunHistory()
+	stageService := NewStageService(stageRepo, sendpostRepo, new(mocks.StageDependencyRepository), NewSchemaService(nil))
+	sendpostService := NewSendpostService(sendpostRepo, stageService)
+	stageRunnerService, templateService := newTestStageRunnerService(newFakeStageExecutor(), sendpostService, stageService, history)
+	srs := NewSendpostRunService(sendpostService, stageService, stageRunnerService, history, templateService, nil,
+		nil, nil, NewSenpostRunNotificationService(nil), nil, location)
+	return srs, history, stageRuns
+}
+
+func newConditionStage(t *testing.T, id uint, condition string) *entity.Stage {
+	stage := &entity.Stage{Model: gorm.Model{ID: id}, SendpostID: 1, StageParameters: &value.JSONB{}}
+	require.NoError(t, stage.SetCondition(condition))
+	return stage
+}
+
+func TestEvalConditionWeekdayInLocation(t *testing.T) {
+	ctx := context.Background()
+	// Сутки в этих часовых поясах различаются больше чем на день, день недели в них разный
+	east, err := time.LoadLocation("Pacific/Kiritimati")
+	require.NoError(t, err)
+	west, err := time.LoadLocation("Pacific/Pago_Pago")
+	require.NoError(t, err)
+
+	srs, history, _ := newTestConditionRunner(t, east)
+	run, err := history.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+	weekday := time.Now().In(east).Weekday().String()
+	stage := newConditionStage(t, 2, `weekday == "`+weekday+`"`)
+
+	met, err := srs.evalCondition(ctx, run, stage, nil)
+	require.NoError(t, err)
+	assert.True(t, met)
+
+	srs.location = west
+	met, err = srs.evalCondition(ctx, run, stage, nil)
+	require.NoError(t, err)
+	assert.False(t, met)
+}
+
+func TestEvalConditionStages(t *testing.T) {
+	ctx := context.Background()
+	srs, history, stageRuns := newTestConditionRunner(t, time.UTC)
+	run, err := history.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, history.UpdateStageRunState(ctx, run, newConditionStage(t, 1, ""), value.Completed, nil))
+	stageRun, err := stageRuns.GetStageRun(ctx, run.ID, 1)
+	require.NoError(t, err)
+	stageRun.SetResult(map[string]interface{}{"rows": float64(10)})
+	require.NoError(t, stageRuns.SaveStageRun(ctx, stageRun))
+	require.NoError(t, history.UpdateStageRunState(ctx, run, newConditionStage(t, 4, ""), value.Completed, nil))
+	require.NoError(t, history.UpdateStageRunState(ctx, run, newConditionStage(t, 5, ""), value.Skipped, nil))
+
+	cases := []struct {
+		condition string
+		previous  []uint
+		want      bool
+	}{
+		{`previous.state == "COMPLETED" && params.segment == "vip"`, []uint{1}, true},
+		{`previous.state == "SKIPPED"`, []uint{5}, true},
+		// При нескольких зависимостях previous.state равен COMPLETED, только если завершены все
+		{`previous.state == "COMPLETED"`, []uint{1, 4}, true},
+		{`previous.state == "SKIPPED"`, []uint{1, 5}, true},
+		{`previous.state == "SKIPPED"`, []uint{1, 3}, true},
+		{`stages["1"].state == "COMPLETED"`, nil, true},
+		{`stages["3"]?.state == nil`, nil, true},
+		{`stages["1"].result.rows > 5`, nil, true},
+		{`stages["4"].result.rows == nil`, nil, true},
+		// У этапа без зависимостей previous.state равен nil
+		{`previous.state == nil`, nil, true},
+		{`previous.state == "COMPLETED"`, nil, false},
+	}
+	for _, c := range cases {
+		met, err := srs.evalCondition(ctx, run, newConditionStage(t, 2, c.condition), c.previous)
+		require.NoError(t, err, c.condition)
+		assert.Equal(t, c.want, met, c.condition)
+	}
+
+	// Этап, у которого нет записи в запуске, даёт ошибку при обращении к нему без ?.
+	_, err = srs.evalCondition(ctx, run, newConditionStage(t, 2, `stages["3"].state == nil`), nil)
+	assert.Error(t, err)
+}
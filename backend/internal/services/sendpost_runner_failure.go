@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// FailedStageIDParameter and FailedStageErrorParameter are injected into
+	// the failure handling stages which declare them in their parameters
+	FailedStageIDParameter    string = "failed_stage_id"
+	FailedStageErrorParameter string = "failed_stage_error"
+
+	ErrorRunFailureStages string = "[SendpostRunnerService] error running failure handling stages"
+)
+
+// runFailureStages executes the failure handling stages after the stage of the run failed:
+// the on-failure chain of the sendpost first and then the stages of the run flagged as always run
+// which weren't started, in the topological order.
+// The on-failure chain stops at its first failed stage, the always run stages are all executed.
+// The ID of the failed stage and the error are injected into the stages which declare
+// the failed_stage_id and failed_stage_error parameters.
+// The stages are executed after the stage failed or the run timed out. They aren't executed
+// if the run was cancelled by the user, lost its lock or was interrupted by the shutdown:
+// the interrupted run is continued after the restart. The handlers may be cancelled
+// via Cancel the same way as the run.
+//
+// Parameters:
+//
+//	ctx - The context of the run.
+//	run - The failed sendpost run.
+//	graph - The stage graph of the sendpost.
+//	failed - The stage which failed.
+//	failure - The error of the failed stage.
+//	pending - The stages of the graph which weren't started.
+func (srs *SendpostRunnerService) runFailureStages(ctx context.Context, run *entity.SendpostRun, graph *entity.StageGraph, failed *entity.Stage, failure error, pending []*entity.Stage) {
+	// Обработчики выполняются только при падении этапа или по таймауту, отменённый запуск их не выполняет
+	if ctx.Err() != nil && !IsTimeout(context.Cause(ctx)) {
+		return
+	}
+	if ctx.Err() != nil {
+		detached, cancel := srs.runManager.Detach(ctx, run.SendpostID)
+		defer cancel()
+		ctx = detached
+	}
+
+	onFailureStages, err := srs.stageService.GetOnFailureStages(ctx, run.SendpostID)
+	if err != nil {
+		logging.Error(ErrorRunFailureStages, zap.Uint("sendpost_id", run.SendpostID), zap.Error(err))
+		return
+	}
+	var alwaysRunStages []*entity.Stage
+	for _, stage := range pending {
+		if stage.AlwaysRun {
+			alwaysRunStages = append(alwaysRunStages, stage)
+		}
+	}
+	if len(onFailureStages) == 0 && len(alwaysRunStages) == 0 {
+		return
+	}
+
+	logging.Info("[SendpostRunnerService] Run failure handling stages", zap.Uint("sendpost_id", run.SendpostID), zap.Uint("failed_stage_id", failed.ID))
+	// Обработчики выполняются заново, даже если завершились в продолжаемом запуске
+	run.StopResuming()
+	run.Inject(map[string]any{
+		FailedStageIDParameter:    failed.ID,
+		FailedStageErrorParameter: srs.failureMessage(ctx, run, failed, failure),
+	})
+	for _, stage := range onFailureStages {
+		if err := srs.processStage(ctx, run, stage); err != nil {
+			logging.Warn(ErrorRunFailureStages, zap.Uint("stage_id", stage.ID), zap.Error(err))
+			break
+		}
+	}
+	for _, stage := range alwaysRunStages {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := srs.processStageIfConditionMet(ctx, run, stage, graph.DependsOn(stage.ID)); err != nil {
+			logging.Warn(ErrorRunFailureStages, zap.Uint("stage_id", stage.ID), zap.Error(err))
+		}
+	}
+}
+
+// failureMessage returns the error recorded for the failed stage within the run,
+// it is more specific than the error returned by the stage runner.
+func (srs *SendpostRunnerService) failureMessage(ctx context.Context, run *entity.SendpostRun, failed *entity.Stage, failure error) string {
+	stageRun, err := srs.runHistoryService.GetStageRun(ctx, run, failed)
+	if err == nil && stageRun != nil && stageRun.Error != nil {
+		return *stageRun.Error
+	}
+	return failure.Error()
+}
@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/mocks"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// testFailureRun is the sendpost with the graph 1 -> 2 (always run) -> 3
+// and the on-failure chain 10 -> 11
+type testFailureRun struct {
+	srs      *SendpostRunnerService
+	runner   *fakeStageRunner
+	runs     *fakeSendpostRunRepository
+	sendpost *entity.Sendpost
+	stages   map[uint]*entity.Stage
+}
+
+func newTestFailureRun() *testFailureRun {
+	logging.Logger = zap.NewNop()
+	id := func(id uint) *uint { return &id }
+	sendpost := &entity.Sendpost{Model: gorm.Model{ID: 1}, OnFailureStageID: id(10)}
+	stages := map[uint]*entity.Stage{
+		1:  {Model: gorm.Model{ID: 1}, StageParameters: &value.JSONB{}},
+		2:  {Model: gorm.Model{ID: 2}, AlwaysRun: true, StageParameters: &value.JSONB{FailedStageIDParameter: nil}},
+		3:  {Model: gorm.Model{ID: 3}, StageParameters: &value.JSONB{}},
+		10: {Model: gorm.Model{ID: 10}, NextStageID: id(11), StageParameters: &value.JSONB{FailedStageIDParameter: 0, FailedStageErrorParameter: "", "segment": "vip"}},
+		11: {Model: gorm.Model{ID: 11}, StageParameters: &value.JSONB{}},
+	}
+	sendpostRepo := new(mocks.SendpostRepository)
+	sendpostRepo.On("GetSendpostByID", mock.Anything, uint(1)).Return(sendpost, nil)
+	sendpostRepo.On("SaveSendpost", mock.Anything, sendpost).Return(nil)
+	sendpostRepo.On("GetOnFailureStage", mock.Anything, uint(1)).Return(stages[10], nil)
+	sendpostRepo.On("GetSendpostParameters", mock.Anything, uint(1)).Return(&value.JSONB{}, nil)
+	stageRepo := new(mocks.StageRepository)
+	for stageID, stage := range stages {
+		stage.SendpostID = 1
+		stage.DeploymnentID = "d1"
+		stageRepo.On("GetStageByID", mock.Anything, stageID).Return(stage, nil)
+	}
+	stageRepo.On("SaveStage", mock.Anything, mock.Anything).Return(nil)
+	stageRepo.On("GetSendpostStages", mock.Anything, uint(1)).Return([]*entity.Stage{stages[1], stages[2], stages[3], stages[10], stages[11]}, nil)
+	dependencyRepo := new(mocks.StageDependencyRepository)
+	dependencyRepo.On("GetSendpostDependencies", mock.Anything, uint(1)).Return([]*entity.StageDependency{
+		entity.NewStageDependency(2, 1),
+		entity.NewStageDependency(3, 2),
+	}, nil)
+
+	history, runs, _ := newFakeRunHistory()
+	stageService := NewStageService(stageRepo, sendpostRepo, dependencyRepo, NewSchemaService(nil))
+	sendpostService := NewSendpostService(sendpostRepo, stageService)
+	stageRunnerService, templateService := newTestStageRunnerService(newFakeStageExecutor(), sendpostService, stageService, history)
+	runner := &fakeStageRunner{service: stageRunnerService, fail: map[uint]error{}, block: map[uint]bool{}}
+	srs := NewSendpostRunService(sendpostService, stageService, stageRunnerService, history, templateService, nil,
+		newTestRunLockService(newFakeSendpostRunLockRepository()), NewRunManager(context.Background()),
+		NewSenpostRunNotificationService(nil), &fakeStageRunnerFactory{runner: runner}, time.UTC)
+	return &testFailureRun{srs: srs, runner: runner, runs: runs, sendpost: sendpost, stages: stages}
+}
+
+// run runs the sendpost in the background, the returned channel is closed when the run is finished.
+func (r *testFailureRun) run() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.srs.Run(context.Background(), 1, RunOptions{})
+	}()
+	return done
+}
+
+func (r *testFailureRun) lastRun(t *testing.T) *entity.SendpostRun {
+	run, err := r.runs.GetLastSendpostRun(context.Background(), 1)
+	require.NoError(t, err)
+	require.NotNil(t, run)
+	return run
+}
+
+func TestFailureStagesInjectFailedStage(t *testing.T) {
+	r := newTestFailureRun()
+	r.runner.fail[1] = errors.New("segment table is locked")
+
+	require.NoError(t, r.srs.Run(context.Background(), 1, RunOptions{}))
+
+	// После падения выполняется цепочка on_failure, затем этапы always_run, остальные этапы пропускаются
+	assert.Equal(t, []uint{1, 10, 11, 2}, r.runner.startedStages())
+	params := r.runner.startParameters(10)
+	assert.Equal(t, uint(1), params[FailedStageIDParameter])
+	assert.Equal(t, "segment table is locked", params[FailedStageErrorParameter])
+	assert.Equal(t, "vip", params["segment"])
+	assert.Equal(t, uint(1), r.runner.startParameters(2)[FailedStageIDParameter])
+	// Этап, не объявивший параметры, их не получает
+	assert.NotContains(t, r.runner.startParameters(11), FailedStageIDParameter)
+
+	assert.Equal(t, value.Failed, r.lastRun(t).State)
+	assert.Equal(t, value.Failed, r.sendpost.State)
+}
+
+func TestFailureStagesNotRunOnCancel(t *testing.T) {
+	r := newTestFailureRun()
+	r.runner.block[1] = true
+
+	done := r.run()
+	require.Eventually(t, func() bool { return len(r.runner.startedStages()) == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, r.srs.Cancel(context.Background(), 1))
+	<-done
+
+	// Отменённый пользователем запуск не выполняет обработчики
+	assert.Equal(t, []uint{1}, r.runner.startedStages())
+	assert.Equal(t, value.Cancelled, r.lastRun(t).State)
+}
+
+func TestFailureStagesRunOnTimeout(t *testing.T) {
+	r := newTestFailureRun()
+	r.runner.block[1] = true
+	require.NoError(t, r.sendpost.SetMaxDuration(1))
+
+	done := r.run()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("run isn't stopped by max duration")
+	}
+
+	// Обработчики выполняются после таймаута запуска, хотя его контекст уже завершён
+	assert.Equal(t, []uint{1, 10, 11, 2}, r.runner.startedStages())
+	run := r.lastRun(t)
+	assert.Equal(t, value.Failed, run.State)
+	require.NotNil(t, run.Reason)
+	assert.Equal(t, value.ReasonTimedOut, *run.Reason)
+}
+
+func TestFailureStagesCancelledAfterTimeout(t *testing.T) {
+	r := newTestFailureRun()
+	r.runner.block[1] = true
+	r.runner.block[10] = true
+	require.NoError(t, r.sendpost.SetMaxDuration(1))
+
+	done := r.run()
+	require.Eventually(t, func() bool { return len(r.runner.startedStages()) == 2 }, 5*time.Second, time.Millisecond)
+	// Обработчики, выполняемые после таймаута, отменяются так же, как запуск
+	require.NoError(t, r.srs.Cancel(context.Background(), 1))
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("failure handling stages aren't cancelled")
+	}
+
+	assert.Equal(t, []uint{1, 10}, r.runner.startedStages())
+	assert.ErrorIs(t, r.srs.Cancel(context.Background(), 1), ErrSendpostNotRunning)
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// graphResult is the outcome of the execution of the stage graph.
+type graphResult struct {
+	// failed is the first stage which failed, nil if the run was stopped between the stages
+	failed *entity.Stage
+	// err is the error of the failed stage or the cause of the run cancellation
+	err error
+	// pending are the stages which weren't started in the topological order
+	pending []*entity.Stage
+}
+
+type stageResult struct {
+	stage *entity.Stage
+	err   error
+}
+
+// executeGraph processes the stages of the graph in the topological order. A stage is started
+// as soon as all the stages it depends on have been processed successfully, the independent
+// stages are processed concurrently. After the first failure or the cancellation of ctx
+// no more stages are started, the stages in progress are waited for.
+//
+// Parameters:
+//
+//	ctx - The context of the run.
+//	graph - The stage graph of the sendpost.
+//	process - The func processing a stage.
+//
+// Returns:
+//
+//	graphResult - The first failure and the stages which weren't started.
+//	error - entity.ErrDependencyCycle if the graph has a cycle.
+func (srs *SendpostRunnerService) executeGraph(ctx context.Context, graph *entity.StageGraph, process func(ctx context.Context, stage *entity.Stage) error) (graphResult, error) {
+	order, err := graph.TopologicalOrder()
+	if err != nil {
+		return graphResult{}, err
+	}
+
+	remaining := make(map[uint]int, len(order))
+	for _, stage := range order {
+		remaining[stage.ID] = len(graph.DependsOn(stage.ID))
+	}
+	started := make(map[uint]bool, len(order))
+	results := make(chan stageResult)
+	running := 0
+	start := func(stage *entity.Stage) {
+		started[stage.ID] = true
+		running++
+		go func() {
+			results <- stageResult{stage: stage, err: process(ctx, stage)}
+		}()
+	}
+	for _, stage := range graph.Roots() {
+		start(stage)
+	}
+
+	var result graphResult
+	for running > 0 {
+		r := <-results
+		running--
+		if r.err != nil {
+			if result.failed == nil {
+				result.failed, result.err = r.stage, r.err
+			}
+			continue
+		}
+		if result.err != nil {
+			continue
+		}
+		if ctx.Err() != nil {
+			result.err = context.Cause(ctx)
+			continue
+		}
+		for _, dependentID := range graph.Dependents(r.stage.ID) {
+			remaining[dependentID]--
+			if remaining[dependentID] == 0 {
+				start(graph.Stage(dependentID))
+			}
+		}
+	}
+
+	for _, stage := range order {
+		if !started[stage.ID] {
+			result.pending = append(result.pending, stage)
+		}
+	}
+	if result.err != nil {
+		logging.Debug("[SendpostRunnerService] executeGraph stopped", zap.Error(result.err), zap.Int("pending", len(result.pending)))
+	}
+	return result, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// newTestGraph builds 1 → 2, 3 → 4, the roots 1 and 3 are executed concurrently
+func newTestGraph() *entity.StageGraph {
+	var stages []*entity.Stage
+	for id := uint(1); id <= 4; id++ {
+		stages = append(stages, &entity.Stage{Model: gorm.Model{ID: id}})
+	}
+	return entity.NewStageGraph(stages, []*entity.StageDependency{
+		entity.NewStageDependency(2, 1),
+		entity.NewStageDependency(4, 3),
+	})
+}
+
+// processedStages records the stages processed by executeGraph
+type processedStages struct {
+	mu  sync.Mutex
+	ids []uint
+}
+
+func (p *processedStages) add(id uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ids = append(p.ids, id)
+}
+
+func (p *processedStages) get() []uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]uint(nil), p.ids...)
+}
+
+func stageIDs(stages []*entity.Stage) []uint {
+	ids := make([]uint, 0, len(stages))
+	for _, stage := range stages {
+		ids = append(ids, stage.ID)
+	}
+	return ids
+}
+
+func TestExecuteGraphStopsAfterFailure(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	srs := &SendpostRunnerService{}
+	stageErr := errors.New("stage failed")
+
+	var processed processedStages
+	failing := make(chan struct{})
+	result, err := srs.executeGraph(context.Background(), newTestGraph(), func(ctx context.Context, stage *entity.Stage) error {
+		processed.add(stage.ID)
+		switch stage.ID {
+		case 1:
+			close(failing)
+			return stageErr
+		case 3:
+			// Этап в процессе выполнения дожидается завершения после падения соседнего
+			<-failing
+			time.Sleep(50 * time.Millisecond)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []uint{1, 3}, processed.get())
+	require.NotNil(t, result.failed)
+	assert.Equal(t, uint(1), result.failed.ID)
+	assert.ErrorIs(t, result.err, stageErr)
+	assert.Equal(t, []uint{2, 4}, stageIDs(result.pending))
+}
+
+func TestExecuteGraphStopsAfterCancellation(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	srs := &SendpostRunnerService{}
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	var processed processedStages
+	result, err := srs.executeGraph(ctx, newTestGraph(), func(ctx context.Context, stage *entity.Stage) error {
+		processed.add(stage.ID)
+		if stage.ID == 1 {
+			cancel(ErrRunCancelled)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.NotContains(t, processed.get(), uint(2))
+	assert.Nil(t, result.failed)
+	assert.ErrorIs(t, result.err, ErrRunCancelled)
+	assert.Contains(t, stageIDs(result.pending), uint(2))
+}
+
+func TestExecuteGraphRunsDependentsAfterDependencies(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	srs := &SendpostRunnerService{}
+
+	var processed processedStages
+	result, err := srs.executeGraph(context.Background(), newTestGraph(), func(ctx context.Context, stage *entity.Stage) error {
+		processed.add(stage.ID)
+		return nil
+	})
+	require.NoError(t, err)
+
+	ids := processed.get()
+	assert.ElementsMatch(t, []uint{1, 2, 3, 4}, ids)
+	assert.Less(t, indexOf(ids, 1), indexOf(ids, 2))
+	assert.Less(t, indexOf(ids, 3), indexOf(ids, 4))
+	assert.NoError(t, result.err)
+	assert.Empty(t, result.pending)
+}
+
+func indexOf(ids []uint, id uint) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
+	"fmt"
+)
+
+const ErrorPreviewParameters string = "[SendpostRunnerService] error previewing parameters"
+
+// ErrSendpostNotFound means the sendpost doesn't exist
+var ErrSendpostNotFound = errors.New("sendpost not found")
+
+// ParametersPreview is the parameters of the sendpost and of its stages
+// with the expressions rendered as they would be within the run.
+type ParametersPreview struct {
+	GlobalParameters *value.JSONB
+	// GlobalErr is the error of rendering the global parameters, they are left as is then
+	GlobalErr error
+	Stages    []*StageParametersPreview
+}
+
+// StageParametersPreview is the parameters the stage would be executed with and the layer
+// every value was taken from. Err is the error of resolving them, the stage parameters are kept then.
+type StageParametersPreview struct {
+	Stage      *entity.Stage
+	Parameters *value.JSONB
+	Sources    map[string]value.ParameterSource
+	Err        error
+}
+
+// PreviewParameters resolves the parameters of the sendpost and of its stages, including the sub-stages
+// of the parallel stages and the on-failure stages, without running anything. The parameters are resolved
+// for the given run or, if runID is nil, for the run which would be started now: its ID is 0
+// and the outputs of the stages aren't available. The stored parameters aren't changed.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//	sendpostID - The sendpost whose parameters are rendered.
+//	runID - The run of the sendpost the parameters are rendered for, may be nil.
+//
+// Returns:
+//
+//	*ParametersPreview - The resolved parameters, the errors of resolving are reported per stage.
+//	error - ErrSendpostNotFound, ErrRunNotFound or an error if the stages couldn't be retrieved.
+func (srs *SendpostRunnerService) PreviewParameters(ctx context.Context, sendpostID uint, runID *uint) (*ParametersPreview, error) {
+	if _, err := srs.sendpostService.GetSendpost(ctx, sendpostID); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSendpostNotFound, err)
+	}
+	run := entity.NewSendpostRun(sendpostID)
+	if runID != nil {
+		var err error
+		if run, err = srs.runHistoryService.GetSendpostRun(ctx, sendpostID, *runID); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrRunNotFound, err)
+		}
+	}
+
+	stages, err := srs.stageService.GetAllSendpostStages(ctx, sendpostID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorPreviewParameters, err)
+	}
+
+	preview := &ParametersPreview{}
+	preview.GlobalParameters, preview.GlobalErr = srs.getGlobalParameters(ctx, run)
+	if preview.GlobalErr != nil {
+		globalParams, err := srs.sendpostService.GetSendpostParameters(ctx, sendpostID)
+		if err != nil {
+			return nil, logging.WrapError(ErrorPreviewParameters, err)
+		}
+		preview.GlobalParameters = run.GlobalParameters(globalParams)
+	}
+	for _, stage := range stages {
+		stagePreview := &StageParametersPreview{Stage: stage}
+		resolved, err := srs.stageRunnerService.ResolveParameters(ctx, run, stage)
+		if err != nil {
+			stagePreview.Parameters = stage.StageParameters
+			stagePreview.Err = err
+		} else {
+			stagePreview.Parameters = resolved.Parameters
+			stagePreview.Sources = resolved.Sources
+		}
+		preview.Stages = append(preview.Stages, stagePreview)
+	}
+	return preview, nil
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const ErrorRecoverSendpost string = "[SendpostRunnerService] error recovering sendpost"
+
+// Recover finds the sendposts left running after the restart of the backend
+// and recovers their runs in the background. The run whose flow runs are known
+// to the executor is continued: the running flow runs are watched again and
+// the chain goes on from the interrupted stage. Otherwise the run is marked
+// as failed with the INTERRUPTED reason.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//
+// Returns:
+//
+//	error - An error if the sendposts couldn't be retrieved.
+func (srs *SendpostRunnerService) Recover(ctx context.Context) error {
+	sendposts, err := srs.sendpostService.GetSendposts(ctx)
+	if err != nil {
+		return logging.WrapError(ErrorRecoverSendpost, err)
+	}
+	for _, sendpost := range sendposts {
+		if !sendpost.IsRunning() {
+			continue
+		}
+		sendpostID := sendpost.ID
+		logging.Info("[SendpostRunnerService] Recover sendpost", zap.Uint("sendpost_id", sendpostID))
+		if err := srs.runManager.Go(func(ctx context.Context) {
+			srs.recoverRun(ctx, sendpostID)
+		}); err != nil {
+			return logging.WrapError(ErrorRecoverSendpost, err)
+		}
+	}
+	return nil
+}
+
+// recoverRun takes the run lock of the sendpost and continues its interrupted run.
+func (srs *SendpostRunnerService) recoverRun(ctx context.Context, sendpostID uint) {
+	// Аренда упавшего экземпляра истекает сама, ждём её освобождения
+	lockCtx, unlock, err := srs.runLockService.Lock(ctx, sendpostID)
+	if err != nil {
+		logging.Error(ErrorRecoverSendpost, zap.Uint("sendpost_id", sendpostID), zap.Error(err))
+		return
+	}
+	defer unlock()
+	ctx = lockCtx
+
+	// Запуск мог быть уже восстановлен другой репликой, пока ждали блокировку
+	sendpost, err := srs.sendpostService.GetSendpost(ctx, sendpostID)
+	if err != nil {
+		logging.Error(ErrorRecoverSendpost, zap.Uint("sendpost_id", sendpostID), zap.Error(err))
+		return
+	}
+	if !sendpost.IsRunning() {
+		return
+	}
+	run, err := srs.runHistoryService.GetLastSendpostRun(ctx, sendpostID)
+	if err != nil {
+		logging.Error(ErrorRecoverSendpost, zap.Uint("sendpost_id", sendpostID), zap.Error(err))
+		return
+	}
+	if run == nil || run.State.IsFinal() {
+		srs.restoreSendpostState(ctx, sendpostID, run)
+		return
+	}
+	srs.continueRun(ctx, sendpostID, run)
+}
+
+// continueRun reconciles the run interrupted by the restart and processes its remaining stages.
+// The run lock of the sendpost must be held by the caller.
+func (srs *SendpostRunnerService) continueRun(ctx context.Context, sendpostID uint, run *entity.SendpostRun) {
+	runCtx, done, err := srs.runManager.Register(ctx, sendpostID)
+	if err != nil {
+		logging.Warn(ErrorRecoverSendpost, zap.Uint("sendpost_id", sendpostID), zap.Error(err))
+		return
+	}
+	defer done()
+
+	srs.senpostNotificationService.AddRunSendpostToNotify(sendpostID)
+	defer srs.senpostNotificationService.RemoveRunSendpostToNotify(sendpostID)
+
+	runCtx, cancel, err := srs.withMaxDuration(runCtx, run)
+	if err != nil {
+		srs.notifyRunErr(runCtx, sendpostID, run, err)
+		return
+	}
+	defer cancel()
+
+	logging.Info("[SendpostRunnerService] Recover run", zap.Uint("sendpost_id", sendpostID), zap.Uint("run_id", run.ID))
+	if err := srs.reconcileRun(runCtx, run); err != nil {
+		srs.notifyRunErr(runCtx, sendpostID, run, err)
+		return
+	}
+
+	// Состояния этапов изменились при сверке, перечитываем запуск
+	reconciled, err := srs.runHistoryService.GetSendpostRun(runCtx, sendpostID, run.ID)
+	if err != nil {
+		srs.notifyRunErr(runCtx, sendpostID, run, err)
+		return
+	}
+	reconciled.Recover()
+	srs.walkStages(runCtx, reconciled, RunOptions{})
+}
+
+// restoreSendpostState sets the state of the sendpost whose last run had finished,
+// but the sendpost state hadn't been updated before the restart.
+func (srs *SendpostRunnerService) restoreSendpostState(ctx context.Context, sendpostID uint, run *entity.SendpostRun) {
+	state := value.Failed
+	if run != nil {
+		state = run.State
+	}
+	logging.Warn("[SendpostRunnerService] Sendpost has no running run", zap.Uint("sendpost_id", sendpostID), zap.String("state", string(state)))
+	if err := srs.sendpostService.UpdateSendpostState(ctx, sendpostID, state); err != nil {
+		logging.Error(ErrorRecoverSendpost, zap.Uint("sendpost_id", sendpostID), zap.Error(err))
+	}
+}
+
+// reconcileRun queries the executor for the flow runs the run had started before the restart
+// and records their actual states. The flow runs still running are watched until they finish.
+// If the state of any flow run is unknown, the unfinished stages are marked as failed
+// with the INTERRUPTED reason and ErrRunNotRecovered is returned.
+func (srs *SendpostRunnerService) reconcileRun(ctx context.Context, run *entity.SendpostRun) error {
+	type inFlightStage struct {
+		stage    *entity.Stage
+		stageRun *entity.StageRun
+	}
+	var inFlight []inFlightStage
+	for _, stageRun := range run.InFlightStageRuns() {
+		stage, err := srs.stageService.GetStage(ctx, stageRun.StageID)
+		if err != nil {
+			return err
+		}
+		inFlight = append(inFlight, inFlightStage{stage: stage, stageRun: stageRun})
+	}
+
+	var running []*entity.Stage
+	var reconcileErr error
+	completed := make(map[uint]bool)
+	for _, s := range inFlight {
+		// Этапы без flow run (параллельные, наблюдатели) выполняются заново при продолжении цепочки
+		if s.stageRun.FlowRunID == nil {
+			continue
+		}
+		ok, err := srs.stageRunnerService.Reconcile(ctx, run, s.stage, s.stageRun)
+		if ctx.Err() != nil {
+			return context.Cause(ctx)
+		}
+		if err != nil {
+			reconcileErr = fmt.Errorf("%w: %s", ErrRunNotRecovered, err)
+			break
+		}
+		if ok {
+			completed[s.stage.ID] = true
+		} else {
+			running = append(running, s.stage)
+		}
+	}
+	if reconcileErr != nil {
+		for _, s := range inFlight {
+			if completed[s.stage.ID] {
+				continue
+			}
+			if err := srs.stageRunnerService.HandleInterruptedStage(ctx, run, s.stage, reconcileErr); err != nil {
+				logging.Warn(ErrorRecoverSendpost, zap.Uint("stage_id", s.stage.ID), zap.Error(err))
+			}
+		}
+		return reconcileErr
+	}
+
+	var wg sync.WaitGroup
+	errorsChan := make(chan error, len(running))
+	for _, stage := range running {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srs.stageRunnerService.CheckState(ctx, run, stage); err != nil {
+				errorsChan <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errorsChan)
+	if err, ok := <-errorsChan; ok {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/mocks"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// testRecovery is the sendpost with the stage 2 depending on the stage 1 whose run was interrupted
+// by the restart while the flow run of the first stage was running
+type testRecovery struct {
+	srs       *SendpostRunnerService
+	runner    *fakeStageRunner
+	history   *RunHistoryService
+	executor  *fakeStageExecutor
+	stageRuns *fakeStageRunRepository
+	sendpost  *entity.Sendpost
+	run       *entity.SendpostRun
+	flowRunID string
+}
+
+func newTestRecovery(t *testing.T) *testRecovery {
+	logging.Logger = zap.NewNop()
+	ctx := context.Background()
+
+	sendpost := &entity.Sendpost{Model: gorm.Model{ID: 1}, State: value.Running}
+	stages := []*entity.Stage{
+		{Model: gorm.Model{ID: 1}, SendpostID: 1, DeploymnentID: "d1", StageParameters: &value.JSONB{}},
+		{Model: gorm.Model{ID: 2}, SendpostID: 1, DeploymnentID: "d2", StageParameters: &value.JSONB{}},
+	}
+	sendpostRepo := new(mocks.SendpostRepository)
+	sendpostRepo.On("GetSendpostByID", mock.Anything, uint(1)).Return(sendpost, nil)
+	sendpostRepo.On("GetSendposts", mock.Anything).Return([]*entity.Sendpost{sendpost, {Model: gorm.Model{ID: 2}, State: value.Completed}}, nil)
+	sendpostRepo.On("SaveSendpost", mock.Anything, sendpost).Return(nil)
+	sendpostRepo.On("GetSendpostParameters", mock.Anything, uint(1)).Return(&value.JSONB{}, nil)
+	sendpostRepo.On("GetOnFailureStage", mock.Anything, uint(1)).Return(nil, nil)
+	stageRepo := new(mocks.StageRepository)
+	for _, stage := range stages {
+		stageRepo.On("GetStageByID", mock.Anything, stage.ID).Return(stage, nil)
+	}
+	stageRepo.On("SaveStage", mock.Anything, mock.Anything).Return(nil)
+	stageRepo.On("GetSendpostStages", mock.Anything, uint(1)).Return(stages, nil)
+	dependencyRepo := new(mocks.StageDependencyRepository)
+	dependencyRepo.On("GetSendpostDependencies", mock.Anything, uint(1)).Return([]*entity.StageDependency{entity.NewStageDependency(2, 1)}, nil)
+
+	executor := newFakeStageExecutor()
+	history, _, stageRuns := newFakeRunHistory()
+	stageService := NewStageService(stageRepo, sendpostRepo, dependencyRepo, NewSchemaService(nil))
+	sendpostService := NewSendpostService(sendpostRepo, stageService)
+	stageRunnerService, templateService := newTestStageRunnerService(executor, sendpostService, stageService, history)
+	runner := &fakeStageRunner{service: stageRunnerService}
+	srs := NewSendpostRunService(sendpostService, stageService, stageRunnerService, history, templateService, nil,
+		newTestRunLockService(newFakeSendpostRunLockRepository()), NewRunManager(ctx),
+		NewSenpostRunNotificationService(nil), &fakeStageRunnerFactory{runner: runner}, time.UTC)
+
+	// Запуск прерван перезапуском, пока выполнялся flow run первого этапа
+	run, err := history.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+	stageRun, err := history.StartStageRun(ctx, run, stages[0])
+	require.NoError(t, err)
+	flowRunID, _, err := executor.Run(ctx, "d1", nil)
+	require.NoError(t, err)
+	stageRun.FlowRunID = flowRunID
+	stageRun.State = value.Running
+	require.NoError(t, stageRuns.SaveStageRun(ctx, stageRun))
+
+	return &testRecovery{
+		srs:       srs,
+		runner:    runner,
+		history:   history,
+		executor:  executor,
+		stageRuns: stageRuns,
+		sendpost:  sendpost,
+		run:       run,
+		flowRunID: *flowRunID,
+	}
+}
+
+func TestRecoverRunContinuesChain(t *testing.T) {
+	r := newTestRecovery(t)
+	ctx := context.Background()
+	r.executor.setState(r.flowRunID, value.Completed)
+
+	r.srs.recoverRun(ctx, 1)
+
+	// flow run первого этапа не запускается заново, цепочка продолжается со второго этапа
+	assert.Equal(t, []uint{2}, r.runner.startedStages())
+	assert.Equal(t, 2, r.executor.flowRunCount())
+
+	recovered, err := r.history.GetSendpostRun(ctx, 1, r.run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, value.Completed, recovered.State)
+	assert.Equal(t, map[uint]value.StateType{1: value.Completed, 2: value.Completed}, r.stageRuns.states(r.run.ID))
+	assert.Equal(t, value.Completed, r.sendpost.State)
+	assert.Empty(t, r.executor.cancelledFlowRuns())
+}
+
+func TestRecoverRunUnknownFlowRun(t *testing.T) {
+	r := newTestRecovery(t)
+	ctx := context.Background()
+	// Prefect не знает flow run, запуск продолжить нельзя
+	r.executor.forget(r.flowRunID)
+
+	r.srs.recoverRun(ctx, 1)
+
+	assert.Empty(t, r.runner.startedStages())
+	failed, err := r.history.GetSendpostRun(ctx, 1, r.run.ID)
+	require.NoError(t, err)
+	assert.Equal(t, value.Failed, failed.State)
+	require.NotNil(t, failed.Reason)
+	assert.Equal(t, value.ReasonInterrupted, *failed.Reason)
+	require.NotNil(t, failed.Error)
+	assert.Contains(t, *failed.Error, ErrRunNotRecovered.Error())
+	stageRun, err := r.stageRuns.GetStageRun(ctx, r.run.ID, 1)
+	require.NoError(t, err)
+	assert.Equal(t, value.Failed, stageRun.State)
+	require.NotNil(t, stageRun.Reason)
+	assert.Equal(t, value.ReasonInterrupted, *stageRun.Reason)
+	assert.Equal(t, value.Failed, r.sendpost.State)
+}
+
+func TestRecoverOnlyRunningSendposts(t *testing.T) {
+	r := newTestRecovery(t)
+	ctx := context.Background()
+	r.executor.setState(r.flowRunID, value.Completed)
+
+	// Восстанавливается только sendpost в состоянии RUNNING
+	require.NoError(t, r.srs.Recover(ctx))
+	require.Eventually(t, func() bool {
+		recovered, err := r.history.GetSendpostRun(ctx, 1, r.run.ID)
+		return err == nil && recovered.State == value.Completed
+	}, time.Second, time.Millisecond)
+	require.NoError(t, r.srs.runManager.Shutdown(ctx))
+	assert.Equal(t, []uint{2}, r.runner.startedStages())
+	assert.Equal(t, value.Completed, r.sendpost.State)
+}
@@ -5,133 +5,438 @@ import (
 	"crm-uplift-ii24-backend/internal/domain/entity"
 	"crm-uplift-ii24-backend/internal/domain/value"
 	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
+var (
+	ErrSendpostNotRunning = errors.New("sendpost isn't running")
+	ErrRunCancelled       = errors.New("run cancelled")
+	ErrNothingToResume    = errors.New("the last run of the sendpost hasn't failed")
+	ErrInvalidFromStage   = errors.New("stage isn't a top level stage of the sendpost")
+	ErrRunAlreadyQueued   = errors.New("the next run of the sendpost is already queued")
+	// ErrRunNotRecovered means the run interrupted by the backend restart couldn't be continued
+	ErrRunNotRecovered = errors.New("run interrupted by backend restart couldn't be recovered")
+	// ErrRunTimedOut is the cause of the run cancellation when the run exceeded the max duration of the sendpost
+	ErrRunTimedOut = errors.New("sendpost run timed out")
+)
+
 const (
-	RunningStageError                               string = "[SendpostRunnerService] error running sendpost"
-	ProcessError                                    string = "[SendpostRunnerService] error processing stage"
-	ErrorNotifyRunSendpost                          string = "[SendpostRunnerService] error notifying run sendpost"
-	ReplaceStageParametersWithSendpostParametersErr string = "[SendpostRunnerService] error replacing stage parameters with sendpost parameters"
+	RunningStageError      string = "[SendpostRunnerService] error running sendpost"
+	ProcessError           string = "[SendpostRunnerService] error processing stage"
+	ErrorNotifyRunSendpost string = "[SendpostRunnerService] error notifying run sendpost"
 )
 
+// RunOptions defines the stage the sendpost run starts from.
+// By default the run starts from the first stage.
+type RunOptions struct {
+	// FromFailed resumes the last failed run: the stages completed there are not executed again
+	FromFailed bool
+	// FromStageID starts the run from the given top level stage,
+	// the previous stages completed in the last run are taken from it
+	FromStageID *uint
+	// QueueIfRunning makes the run wait for the active run of the sendpost to finish
+	// instead of failing with ErrSendpostAlreadyRunning
+	QueueIfRunning bool
+	// Parameters override the global parameters of the sendpost within the run
+	Parameters *value.JSONB
+	// StageParameters override the parameters of the stages within the run by the stage ID
+	StageParameters map[uint]value.JSONB
+	// ParentRunID is the run whose subsendpost stage starts the run
+	ParentRunID *uint
+
+	// onRunCreated is called with the run as soon as it's created
+	onRunCreated func(run *entity.SendpostRun)
+}
+
+func (o RunOptions) isResume() bool {
+	return o.FromFailed || o.FromStageID != nil
+}
+
 type SendpostRunnerService struct {
 	sendpostService            *SendpostService
 	stageService               *StageService
+	stageRunnerService         *StageRunnerService
+	runHistoryService          *RunHistoryService
+	templateService            *TemplateService
+	parameterService           *ParameterService
+	runLockService             *RunLockService
+	runManager                 *RunManager
 	senpostNotificationService *SenpostRunNotificationService
 	stageRunnerFactory         entity.StageRunnerFactory
+	location                   *time.Location
+	queuedRuns                 map[uint]bool
+	mu                         sync.Mutex
 }
 
-func NewSendpostRunService(sendpostService *SendpostService, stageService *StageService, senpostNotificationService *SenpostRunNotificationService, stageRunnerFactory entity.StageRunnerFactory) *SendpostRunnerService {
+func NewSendpostRunService(sendpostService *SendpostService, stageService *StageService, stageRunnerService *StageRunnerService, runHistoryService *RunHistoryService, templateService *TemplateService, parameterService *ParameterService, runLockService *RunLockService, runManager *RunManager, senpostNotificationService *SenpostRunNotificationService, stageRunnerFactory entity.StageRunnerFactory, location *time.Location) *SendpostRunnerService {
 	return &SendpostRunnerService{
 		stageRunnerFactory:         stageRunnerFactory,
 		stageService:               stageService,
+		stageRunnerService:         stageRunnerService,
+		runHistoryService:          runHistoryService,
+		templateService:            templateService,
+		parameterService:           parameterService,
+		runLockService:             runLockService,
+		runManager:                 runManager,
 		sendpostService:            sendpostService,
 		senpostNotificationService: senpostNotificationService,
+		location:                   location,
+		queuedRuns:                 make(map[uint]bool),
 	}
 }
 
 // Start initiates the sendpost process for a given sendpost ID.
 // It retrieves the sendpost and its associated stages from the repository,
 // then sequentially processes each stage using the appropriate runner.
-// If any error occurs during retrieval or processing, it returns an error.
+// The run is performed in the background within the server-lifetime context of the run manager,
+// only the lock and the options are checked synchronously with ctx.
+// Only one run of the sendpost may be active at a time. If the sendpost is running and
+// opts.QueueIfRunning is set, the run is queued and starts when the active run is finished.
 //
 // Parameters:
 //
 //	ctx - The context for managing request-scoped values and cancellation.
 //	sendpostID - The unique identifier of the sendpost to be processed.
+//	opts - The options defining the stage the run starts from and the overrides of the parameters.
 //
 // Returns:
 //
-//	An error if any step in the process fails, otherwise nil.
-func (srs *SendpostRunnerService) Start(ctx context.Context, sendpostID uint) {
-	go srs.runStages(ctx, sendpostID)
+//	bool - true if the run has been queued.
+//	error - ErrInvalidOverrides, ErrSendpostAlreadyRunning, ErrRunAlreadyQueued, ErrNothingToResume,
+//	ErrInvalidFromStage or ErrServerShuttingDown if the run can't be started, otherwise nil.
+func (srs *SendpostRunnerService) Start(ctx context.Context, sendpostID uint, opts RunOptions) (bool, error) {
+	if err := srs.validateOverrides(ctx, sendpostID, opts); err != nil {
+		return false, err
+	}
+	// Запуск переживает запрос, который его инициировал, при остановке сервера его прерывает менеджер
+	lockCtx, unlock, err := srs.runLockService.TryLock(context.WithoutCancel(ctx), sendpostID)
+	if errors.Is(err, ErrSendpostAlreadyRunning) && opts.QueueIfRunning {
+		return true, srs.queueRun(sendpostID, opts)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	previous, err := srs.getResumedRun(ctx, sendpostID, opts)
+	if err != nil {
+		unlock()
+		return false, err
+	}
+	err = srs.runManager.Go(func(context.Context) {
+		defer unlock()
+		srs.run(lockCtx, sendpostID, opts, previous)
+	})
+	if err != nil {
+		unlock()
+		return false, err
+	}
+	return false, nil
+}
+
+// Run runs the sendpost like Start does but blocks until the run is finished.
+// If opts.QueueIfRunning is set, it waits for the active run of the sendpost to finish.
+// Returns ErrServerShutdown if the run was interrupted by the shutdown.
+func (srs *SendpostRunnerService) Run(ctx context.Context, sendpostID uint, opts RunOptions) error {
+	var lockCtx context.Context
+	var unlock func()
+	var err error
+	if opts.QueueIfRunning {
+		lockCtx, unlock, err = srs.runLockService.Lock(ctx, sendpostID)
+	} else {
+		lockCtx, unlock, err = srs.runLockService.TryLock(ctx, sendpostID)
+	}
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	previous, err := srs.getResumedRun(ctx, sendpostID, opts)
+	if err != nil {
+		return err
+	}
+	_, err = srs.run(lockCtx, sendpostID, opts, previous)
+	return err
+}
+
+// queueRun waits in the background for the active run of the sendpost to finish and starts the run.
+// Only one run of the sendpost may be queued.
+func (srs *SendpostRunnerService) queueRun(sendpostID uint, opts RunOptions) error {
+	srs.mu.Lock()
+	if srs.queuedRuns[sendpostID] {
+		srs.mu.Unlock()
+		return ErrRunAlreadyQueued
+	}
+	srs.queuedRuns[sendpostID] = true
+	srs.mu.Unlock()
+
+	err := srs.runManager.Go(func(ctx context.Context) {
+		lockCtx, unlock, err := srs.runLockService.Lock(ctx, sendpostID)
+
+		srs.mu.Lock()
+		delete(srs.queuedRuns, sendpostID)
+		srs.mu.Unlock()
+
+		if err != nil {
+			logging.Error("[SendpostRunnerService] error locking queued sendpost", zap.Uint("sendpost_id", sendpostID), zap.Error(err))
+			return
+		}
+		defer unlock()
+
+		// Запуск, с которого продолжать, определяется только после завершения активного запуска
+		previous, err := srs.getResumedRun(ctx, sendpostID, opts)
+		if err != nil {
+			logging.Error("[SendpostRunnerService] error running queued sendpost", zap.Uint("sendpost_id", sendpostID), zap.Error(err))
+			return
+		}
+		srs.run(lockCtx, sendpostID, opts, previous)
+	})
+	if err != nil {
+		srs.mu.Lock()
+		delete(srs.queuedRuns, sendpostID)
+		srs.mu.Unlock()
+		return err
+	}
+	logging.Info("[SendpostRunnerService] Run queued", zap.Uint("sendpost_id", sendpostID))
+	return nil
+}
+
+// run registers the run in the run manager and processes the stages.
+// Returns the finished run, nil if it couldn't be created,
+// and ErrServerShutdown if the run was interrupted by the shutdown.
+func (srs *SendpostRunnerService) run(ctx context.Context, sendpostID uint, opts RunOptions, previous *entity.SendpostRun) (*entity.SendpostRun, error) {
+	runCtx, done, err := srs.runManager.Register(ctx, sendpostID)
+	if err != nil {
+		logging.Warn(RunningStageError, zap.Uint("sendpost_id", sendpostID), zap.Error(err))
+		return nil, err
+	}
+	defer done()
+	run := srs.runStages(runCtx, sendpostID, opts, previous)
+	if errors.Is(context.Cause(runCtx), ErrServerShutdown) {
+		return run, ErrServerShutdown
+	}
+	return run, nil
+}
+
+// getResumedRun checks the run options and returns the last run of the sendpost
+// to be resumed. Returns nil if the run starts from the first stage.
+func (srs *SendpostRunnerService) getResumedRun(ctx context.Context, sendpostID uint, opts RunOptions) (*entity.SendpostRun, error) {
+	if !opts.isResume() {
+		return nil, nil
+	}
+	if opts.FromStageID != nil {
+		stage, err := srs.stageService.GetStage(ctx, *opts.FromStageID)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidFromStage, err)
+		}
+		if stage.SendpostID != sendpostID || stage.ParentStageID != nil {
+			return nil, ErrInvalidFromStage
+		}
+	}
+	previous, err := srs.runHistoryService.GetLastSendpostRun(ctx, sendpostID)
+	if err != nil {
+		return nil, err
+	}
+	if opts.FromFailed && (previous == nil || !previous.IsResumable()) {
+		return nil, ErrNothingToResume
+	}
+	return previous, nil
+}
+
+// validateOverrides checks the overrides of the parameters given in the options
+// against the parameters the stages of the sendpost declare.
+func (srs *SendpostRunnerService) validateOverrides(ctx context.Context, sendpostID uint, opts RunOptions) error {
+	if opts.Parameters == nil && len(opts.StageParameters) == 0 {
+		return nil
+	}
+	stages, err := srs.stageService.GetAllSendpostStages(ctx, sendpostID)
+	if err != nil {
+		return err
+	}
+	return srs.parameterService.ValidateOverrides(ctx, sendpostID, stages, opts.Parameters, opts.StageParameters)
+}
+
+// Cancel cancels the active run of the sendpost. The run stops waiting for its stages,
+// asks the executor to cancel the flow runs in flight and marks the sendpost as cancelled.
+// Returns ErrSendpostNotRunning if the sendpost has no active run.
+func (srs *SendpostRunnerService) Cancel(ctx context.Context, sendpostID uint) error {
+	if err := srs.runManager.Cancel(sendpostID, ErrRunCancelled); err != nil {
+		return err
+	}
+	logging.Info("[SendpostRunnerService] Cancel run", zap.Uint("sendpost_id", sendpostID))
+	return nil
 }
 
-func (srs *SendpostRunnerService) runStages(ctx context.Context, sendpostID uint) {
+// runStages creates the run of the sendpost and processes its stages.
+// The run is stopped when it exceeds the max duration of the sendpost.
+// Returns the finished run, nil if it couldn't be created.
+func (srs *SendpostRunnerService) runStages(ctx context.Context, sendpostID uint, opts RunOptions, previous *entity.SendpostRun) *entity.SendpostRun {
 	srs.senpostNotificationService.AddRunSendpostToNotify(sendpostID)
 	defer srs.senpostNotificationService.RemoveRunSendpostToNotify(sendpostID)
 
-	stage, err := srs.sendpostService.GetFirstStage(ctx, sendpostID)
+	run, err := srs.runHistoryService.CreateRun(ctx, sendpostID, previous, opts.ParentRunID, opts.Parameters, opts.StageParameters)
+	if err != nil {
+		srs.notifyRunErr(ctx, sendpostID, nil, err)
+		return nil
+	}
+	if opts.onRunCreated != nil {
+		opts.onRunCreated(run)
+	}
+
+	ctx, cancel, err := srs.withMaxDuration(ctx, run)
+	if err != nil {
+		srs.notifyRunErr(ctx, sendpostID, run, err)
+		return run
+	}
+	defer cancel()
+
+	srs.walkStages(ctx, run, opts)
+	return run
+}
+
+// withMaxDuration limits the run by the max duration of the sendpost counted from the start of the run.
+// When it's exceeded the context is cancelled with ErrRunTimedOut as the cause.
+func (srs *SendpostRunnerService) withMaxDuration(ctx context.Context, run *entity.SendpostRun) (context.Context, context.CancelFunc, error) {
+	sendpost, err := srs.sendpostService.GetSendpost(ctx, run.SendpostID)
+	if err != nil {
+		return ctx, nil, err
+	}
+	maxDuration := sendpost.GetMaxDuration()
+	if maxDuration == 0 {
+		ctx, cancel := context.WithCancel(ctx)
+		return ctx, cancel, nil
+	}
+	cause := fmt.Errorf("%w: max duration %s exceeded", ErrRunTimedOut, maxDuration)
+	ctx, cancel := context.WithDeadlineCause(ctx, run.StartedAt.Add(maxDuration), cause)
+	return ctx, cancel, nil
+}
+
+// walkStages executes the stage graph of the sendpost within the run: every stage is processed
+// as soon as the stages it depends on have completed, the independent stages are processed concurrently.
+// If the run starts from the given stage, only this stage and the stages depending on it are executed.
+// After a stage failed no more stages are started and the failure handling stages are executed.
+func (srs *SendpostRunnerService) walkStages(ctx context.Context, run *entity.SendpostRun, opts RunOptions) {
+	sendpostID := run.SendpostID
+	graph, err := srs.stageService.GetSendpostGraph(ctx, sendpostID)
 	if err != nil {
-		srs.notifyRunErr(ctx, sendpostID, err)
+		srs.notifyRunErr(ctx, sendpostID, run, err)
 		return
 	}
-	if stage == nil {
-		srs.notifyRunErr(ctx, sendpostID, err)
+	if graph.Len() == 0 {
+		srs.notifyRunErr(ctx, sendpostID, run, errors.New("sendpost has no stages"))
 		return
 	}
 
 	if err := srs.sendpostService.UpdateSendpostState(ctx, sendpostID, value.Running); err != nil {
-		srs.notifyRunErr(ctx, sendpostID, err)
+		srs.notifyRunErr(ctx, sendpostID, run, err)
 		return
 	}
 
-	if err := srs.processStage(ctx, stage); err != nil {
-		srs.notifyRunErr(ctx, sendpostID, err)
-		return
+	var rerun map[uint]bool
+	if opts.FromStageID != nil {
+		// Заданный этап и зависящие от него этапы выполняются заново
+		rerun = graph.Descendants(*opts.FromStageID)
+		rerun[*opts.FromStageID] = true
+		run.StopResumingStages(rerun)
 	}
-
-	for stage.NextStageID != nil {
-		nextStage, err := srs.stageService.GetStage(ctx, *stage.NextStageID)
-		if err != nil {
-			srs.notifyRunErr(ctx, sendpostID, err)
-			return
+	result, err := srs.executeGraph(ctx, graph, func(ctx context.Context, stage *entity.Stage) error {
+		if rerun != nil && !rerun[stage.ID] {
+			return srs.passStage(ctx, run, stage)
 		}
-		stage = nextStage
-		if err := srs.processStage(ctx, stage); err != nil {
-			srs.notifyRunErr(ctx, sendpostID, err)
-			return
+		return srs.processStageIfConditionMet(ctx, run, stage, graph.DependsOn(stage.ID))
+	})
+	if err != nil {
+		srs.notifyRunErr(ctx, sendpostID, run, err)
+		return
+	}
+	if result.err != nil {
+		if result.failed != nil {
+			srs.runFailureStages(ctx, run, graph, result.failed, result.err, result.pending)
 		}
+		srs.notifyRunErr(ctx, sendpostID, run, result.err)
+		return
 	}
 	if err := srs.sendpostService.UpdateSendpostState(ctx, sendpostID, value.Completed); err != nil {
-		srs.notifyRunErr(ctx, sendpostID, err)
+		srs.notifyRunErr(ctx, sendpostID, run, err)
 		return
 	}
+	if err := srs.runHistoryService.CompleteRun(ctx, run, value.Completed, nil); err != nil {
+		logging.Warn(RunningStageError, zap.Error(err))
+	}
 	if err := srs.senpostNotificationService.NotifyRunSendpost(sendpostID, value.Completed); err != nil {
 		logging.Warn(ErrorNotifyRunSendpost)
 	}
 }
 
-// processStage processes a given stage by replacing its parameters, creating a runner,
+// processStage processes a given stage by resolving its parameters, creating a runner,
 // starting the runner, and notifying the sendpost service of updates. It handles errors
 // by wrapping them with a process error and logs warnings if notification fails.
+// The blocked stage isn't executed and is recorded as skipped.
+// The stage completed in the resumed run isn't executed and its result is reused.
+// The execution of the stage is limited by its timeout.
+// The parameters of the stage are resolved for the run without changing the stored ones,
+// the stage whose parameters couldn't be resolved is failed.
 //
 // Parameters:
 //
 //	ctx - The context for managing request-scoped values, cancelation signals, and deadlines.
+//	run - The sendpost run the stage is processed within.
 //	stage - The stage entity to be processed.
 //
 // Returns:
 //
 //	An error if any step in the process fails, otherwise nil.
-func (srs *SendpostRunnerService) processStage(ctx context.Context, stage *entity.Stage) error {
+func (srs *SendpostRunnerService) processStage(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
 	logging.Debug("[SendpostRunnerService] processStage", zap.Any("stage", stage))
-	if stage.Type == value.ParallelStage {
-		stages, err := srs.stageService.GetSubStages(ctx, stage.ID)
-		if err != nil {
+	if stage.IsBlocked {
+		if err := srs.stageRunnerService.Skip(ctx, run, stage); err != nil {
 			return logging.WrapError(ProcessError, err)
 		}
-		for _, subStage := range stages {
-			if err := srs.ReplaceStageParametersWithSendpostParameters(ctx, subStage); err != nil {
-				return logging.WrapError(ProcessError, err)
-			}
+		if err := srs.senpostNotificationService.NotifyRunSendpost(stage.SendpostID, value.Skipped); err != nil {
+			logging.Warn(ErrorNotifyRunSendpost)
 		}
-	} else {
-		if err := srs.ReplaceStageParametersWithSendpostParameters(ctx, stage); err != nil {
+		return nil
+	}
+	reused, err := srs.stageRunnerService.Reuse(ctx, run, stage)
+	if err != nil {
+		return logging.WrapError(ProcessError, err)
+	}
+	if reused {
+		if err := srs.senpostNotificationService.NotifyRunSendpost(stage.SendpostID, value.Updated); err != nil {
+			logging.Warn(ErrorNotifyRunSendpost)
+		}
+		return nil
+	}
+	// Параметры подэтапов параллельного этапа разрешаются при их запуске
+	if !stage.IsParallel() {
+		if _, err := srs.stageRunnerService.ResolveParameters(ctx, run, stage); err != nil {
+			return srs.stageRunnerService.HandleFailedStage(ctx, run, stage, err)
+		}
+	}
+	ctx, cancel := srs.stageRunnerService.WithTimeout(ctx, stage)
+	defer cancel()
+	if stage.IsSubsendpost() {
+		if err := srs.runSubsendpost(ctx, run, stage); err != nil {
 			return logging.WrapError(ProcessError, err)
 		}
+		if err := srs.senpostNotificationService.NotifyRunSendpost(stage.SendpostID, value.Updated); err != nil {
+			logging.Warn(ErrorNotifyRunSendpost)
+		}
+		return nil
 	}
 	runner := srs.stageRunnerFactory.CreateRunner(stage.Type)
-	if err := runner.Start(ctx, stage); err != nil {
+	if err := runner.Start(ctx, run, stage); err != nil {
 		return logging.WrapError(ProcessError, err)
 	}
 	if err := srs.senpostNotificationService.NotifyRunSendpost(stage.SendpostID, value.Updated); err != nil {
 		logging.Warn(ErrorNotifyRunSendpost)
 	}
 
-	if err := runner.CheckState(ctx, stage); err != nil {
+	if err := runner.CheckState(ctx, run, stage); err != nil {
 		return logging.WrapError(ProcessError, err)
 	}
 	if err := srs.senpostNotificationService.NotifyRunSendpost(stage.SendpostID, value.Updated); err != nil {
@@ -141,48 +446,163 @@ func (srs *SendpostRunnerService) processStage(ctx context.Context, stage *entit
 	return nil
 }
 
+// passStage handles the stage preceding the stage the run starts from.
+// The stage isn't executed: its result is reused if it completed in the last run,
+// otherwise it's recorded as skipped.
+func (srs *SendpostRunnerService) passStage(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	reused, err := srs.stageRunnerService.Reuse(ctx, run, stage)
+	if err != nil {
+		return logging.WrapError(ProcessError, err)
+	}
+	if !reused {
+		if err := srs.stageRunnerService.Skip(ctx, run, stage); err != nil {
+			return logging.WrapError(ProcessError, err)
+		}
+	}
+	if err := srs.senpostNotificationService.NotifyRunSendpost(stage.SendpostID, value.Updated); err != nil {
+		logging.Warn(ErrorNotifyRunSendpost)
+	}
+	return nil
+}
+
 // notifyRunErr handles errors during the execution of a sendpost operation.
-// It updates the sendpost state to 'Failed' and sends a notification about the failure.
+// It updates the sendpost state to 'Failed', records the error in the run
+// and sends a notification about the failure.
+// The cancelled, the timed out, the not recovered, the shut down runs and the runs which lost the lock are handled separately.
 // Additionally, it logs the error using the organization's logging package.
 //
 // Parameters:
 //
 //	ctx - The context for managing request-scoped values.
 //	sendpostID - The unique identifier of the sendpost operation.
+//	run - The failed sendpost run, nil if the run hasn't been created.
 //	err - The error encountered during the sendpost execution.
-func (srs *SendpostRunnerService) notifyRunErr(ctx context.Context, sendpostID uint, err error) {
+func (srs *SendpostRunnerService) notifyRunErr(ctx context.Context, sendpostID uint, run *entity.SendpostRun, err error) {
+	if ctx.Err() != nil {
+		err = context.Cause(ctx)
+		ctx = context.WithoutCancel(ctx)
+		if errors.Is(err, ErrServerShutdown) {
+			srs.notifyRunShutdown(sendpostID, run)
+			return
+		}
+		if errors.Is(err, ErrRunLockLost) {
+			srs.notifyRunLockLost(ctx, sendpostID, run, err)
+			return
+		}
+		if !IsTimeout(err) {
+			srs.notifyRunCancelled(ctx, sendpostID, run, err)
+			return
+		}
+	}
+	if IsTimeout(err) {
+		srs.notifyRunFailedWithReason(ctx, sendpostID, run, value.ReasonTimedOut, err)
+		return
+	}
+	if errors.Is(err, ErrRunNotRecovered) {
+		srs.notifyRunFailedWithReason(ctx, sendpostID, run, value.ReasonInterrupted, err)
+		return
+	}
 	srs.sendpostService.UpdateSendpostState(ctx, sendpostID, value.Failed)
+	if run != nil {
+		if err := srs.runHistoryService.CompleteRun(ctx, run, value.Failed, err); err != nil {
+			logging.Warn(RunningStageError, zap.Error(err))
+		}
+	}
 	srs.senpostNotificationService.NotifyRunSendpost(sendpostID, value.Failed)
 	logging.Error(RunningStageError, zap.Error(err))
 }
 
-// replaceStageParametersWithSendpostParameters updates the stage parameters with
-// the corresponding sendpost parameters. It retrieves global parameters using the
-// sendpost ID and replaces matching keys in the stage parameters. If successful,
-// the updated stage is saved. Returns an error if any operation fails.
+// notifyRunCancelled marks the sendpost and its run as cancelled
+// and sends a notification about the cancellation.
 //
 // Parameters:
 //
-//	ctx - The context for managing request-scoped values and cancellation.
-//	stage - The stage entity whose parameters are to be updated.
+//	ctx - The context for managing request-scoped values, mustn't be done.
+//	sendpostID - The unique identifier of the sendpost operation.
+//	run - The cancelled sendpost run, nil if the run hasn't been created.
+//	cause - The cause of the cancellation.
+func (srs *SendpostRunnerService) notifyRunCancelled(ctx context.Context, sendpostID uint, run *entity.SendpostRun, cause error) {
+	if err := srs.sendpostService.UpdateSendpostState(ctx, sendpostID, value.Cancelled); err != nil {
+		logging.Warn(RunningStageError, zap.Error(err))
+	}
+	if run != nil {
+		if err := srs.runHistoryService.CompleteRun(ctx, run, value.Cancelled, cause); err != nil {
+			logging.Warn(RunningStageError, zap.Error(err))
+		}
+	}
+	if err := srs.senpostNotificationService.NotifyRunSendpost(sendpostID, value.Cancelled); err != nil {
+		logging.Warn(ErrorNotifyRunSendpost)
+	}
+	logging.Warn("[SendpostRunnerService] Sendpost run cancelled", zap.Uint("sendpost_id", sendpostID), zap.Error(cause))
+}
+
+// notifyRunShutdown handles the run interrupted by the shutdown.
+// The sendpost and the run stay running and the stage runs keep their flow runs,
+// so the run is recovered after the restart.
+func (srs *SendpostRunnerService) notifyRunShutdown(sendpostID uint, run *entity.SendpostRun) {
+	fields := []zap.Field{zap.Uint("sendpost_id", sendpostID)}
+	if run != nil {
+		fields = append(fields, zap.Uint("run_id", run.ID))
+	}
+	logging.Warn("[SendpostRunnerService] Sendpost run interrupted by shutdown", fields...)
+}
+
+// notifyRunFailedWithReason marks the sendpost and its run as failed with the reason
+// and sends a notification about the failure. The timeout is notified as TIMED_OUT.
 //
-// Returns:
+// Parameters:
 //
-//	An error if retrieving sendpost parameters or saving the stage fails.
-func (src *SendpostRunnerService) ReplaceStageParametersWithSendpostParameters(ctx context.Context, stage *entity.Stage) error {
-	globalParams, err := src.sendpostService.GetSendpostParameters(ctx, stage.SendpostID)
-	if err != nil {
-		return logging.WrapError(ReplaceStageParametersWithSendpostParametersErr, err)
+//	ctx - The context for managing request-scoped values, mustn't be done.
+//	sendpostID - The unique identifier of the sendpost operation.
+//	run - The failed sendpost run, nil if the run hasn't been created.
+//	reason - The reason of the failure.
+//	cause - The error of the run or of its stage.
+func (srs *SendpostRunnerService) notifyRunFailedWithReason(ctx context.Context, sendpostID uint, run *entity.SendpostRun, reason value.FailureReason, cause error) {
+	if err := srs.sendpostService.UpdateSendpostState(ctx, sendpostID, value.Failed); err != nil {
+		logging.Warn(RunningStageError, zap.Error(err))
 	}
-	stageParams := *stage.StageParameters
-	for k, v := range *globalParams {
-		if _, ok := (*stage.StageParameters)[k]; ok {
-			stageParams[k] = v
+	if run != nil {
+		if err := srs.runHistoryService.FailRun(ctx, run, reason, cause); err != nil {
+			logging.Warn(RunningStageError, zap.Error(err))
 		}
 	}
-	stage.StageParameters = &stageParams
-	if err := src.stageService.saveStage(ctx, stage); err != nil {
-		return logging.WrapError(ReplaceStageParametersWithSendpostParametersErr, err)
+	state := value.Failed
+	if reason == value.ReasonTimedOut {
+		state = value.TimedOut
 	}
-	return nil
+	if err := srs.senpostNotificationService.NotifyRunSendpost(sendpostID, state); err != nil {
+		logging.Warn(ErrorNotifyRunSendpost)
+	}
+	logging.Error(RunningStageError, zap.Uint("sendpost_id", sendpostID), zap.String("reason", string(reason)), zap.Error(cause))
+}
+
+// notifyRunLockLost marks the run whose lease was lost as failed with the LOCK_LOST reason.
+// The state of the sendpost isn't changed, as the sendpost may be already run by another replica.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values, mustn't be done.
+//	sendpostID - The unique identifier of the sendpost operation.
+//	run - The stopped sendpost run, nil if the run hasn't been created.
+//	cause - The cause of the cancellation.
+func (srs *SendpostRunnerService) notifyRunLockLost(ctx context.Context, sendpostID uint, run *entity.SendpostRun, cause error) {
+	if run != nil {
+		if err := srs.runHistoryService.FailRun(ctx, run, value.ReasonLockLost, cause); err != nil {
+			logging.Warn(RunningStageError, zap.Error(err))
+		}
+	}
+	if err := srs.senpostNotificationService.NotifyRunSendpost(sendpostID, value.Updated); err != nil {
+		logging.Warn(ErrorNotifyRunSendpost)
+	}
+	logging.Error(RunningStageError, zap.Uint("sendpost_id", sendpostID), zap.Error(cause))
+}
+
+// getGlobalParameters returns the global parameters of the sendpost of the run
+// with the overrides of the run applied and the expressions rendered.
+func (srs *SendpostRunnerService) getGlobalParameters(ctx context.Context, run *entity.SendpostRun) (*value.JSONB, error) {
+	globalParams, err := srs.sendpostService.GetSendpostParameters(ctx, run.SendpostID)
+	if err != nil {
+		return nil, err
+	}
+	return srs.templateService.Render(ctx, run, run.GlobalParameters(globalParams))
 }
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/mocks"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// fakeStageRunnerFactory runs every stage with the given runner
+type fakeStageRunnerFactory struct {
+	runner entity.StageRunner
+}
+
+func (f *fakeStageRunnerFactory) CreateRunner(stageType value.StageType) entity.StageRunner {
+	return f.runner
+}
+
+// testSendpostRun is the sendpost with a single stage run over the in-memory repositories,
+// the flow run of the stage runs until the run is stopped
+type testSendpostRun struct {
+	srs       *SendpostRunnerService
+	manager   *RunManager
+	executor  *fakeStageExecutor
+	locks     *fakeSendpostRunLockRepository
+	runs      *fakeSendpostRunRepository
+	stageRuns *fakeStageRunRepository
+	sendpost  *entity.Sendpost
+	stage     *entity.Stage
+}
+
+func newTestSendpostRun() *testSendpostRun {
+	logging.Logger = zap.NewNop()
+	params := value.JSONB{}
+	sendpost := &entity.Sendpost{Model: gorm.Model{ID: 1}}
+	stage := &entity.Stage{Model: gorm.Model{ID: 1}, SendpostID: 1, DeploymnentID: "d1", StageParameters: &params}
+	sendpostRepo := new(mocks.SendpostRepository)
+	sendpostRepo.On("GetSendpostByID", mock.Anything, uint(1)).Return(sendpost, nil)
+	sendpostRepo.On("SaveSendpost", mock.Anything, sendpost).Return(nil)
+	sendpostRepo.On("GetSendpostParameters", mock.Anything, uint(1)).Return(&value.JSONB{}, nil)
+	sendpostRepo.On("GetOnFailureStage", mock.Anything, uint(1)).Return(nil, nil)
+	stageRepo := new(mocks.StageRepository)
+	stageRepo.On("SaveStage", mock.Anything, mock.Anything).Return(nil)
+	stageRepo.On("GetSendpostStages", mock.Anything, uint(1)).Return([]*entity.Stage{stage}, nil)
+	dependencyRepo := new(mocks.StageDependencyRepository)
+	dependencyRepo.On("GetSendpostDependencies", mock.Anything, uint(1)).Return([]*entity.StageDependency{}, nil)
+
+	executor := newFakeStageExecutor()
+	locks := newFakeSendpostRunLockRepository()
+	runHistoryService, runs, stageRuns := newFakeRunHistory()
+	stageService := NewStageService(stageRepo, sendpostRepo, dependencyRepo, NewSchemaService(nil))
+	sendpostService := NewSendpostService(sendpostRepo, stageService)
+	stageRunnerService, templateService := newTestStageRunnerService(executor, sendpostService, stageService, runHistoryService)
+	manager := NewRunManager(context.Background())
+	srs := NewSendpostRunService(sendpostService, stageService, stageRunnerService, runHistoryService, templateService, nil,
+		newTestRunLockService(locks), manager, NewSenpostRunNotificationService(nil), &fakeStageRunnerFactory{runner: stageRunnerService}, time.UTC)
+	return &testSendpostRun{
+		srs:       srs,
+		manager:   manager,
+		executor:  executor,
+		locks:     locks,
+		runs:      runs,
+		stageRuns: stageRuns,
+		sendpost:  sendpost,
+		stage:     stage,
+	}
+}
+
+// start runs the sendpost in the background and waits until the flow run of the stage is created.
+// The returned channel receives the result of the run when it is finished.
+func (r *testSendpostRun) start(t *testing.T) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- r.srs.Run(context.Background(), 1, RunOptions{})
+	}()
+	require.Eventually(t, func() bool { return r.executor.flowRunCount() == 1 }, time.Second, time.Millisecond)
+	return done
+}
+
+// lastRun returns the only run of the sendpost.
+func (r *testSendpostRun) lastRun(t *testing.T) *entity.SendpostRun {
+	history, err := r.runs.GetSendpostRuns(context.Background(), 1)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	return history[0]
+}
+
+func waitRunStopped(t *testing.T, done <-chan error, timeout time.Duration) error {
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		t.Fatal("run isn't stopped")
+		return nil
+	}
+}
+
+func TestCancelRun(t *testing.T) {
+	r := newTestSendpostRun()
+	ctx := context.Background()
+
+	assert.ErrorIs(t, r.srs.Cancel(ctx, 1), ErrSendpostNotRunning)
+
+	// Этап ждёт завершения flow run, пока запуск не отменён
+	done := r.start(t)
+	require.NoError(t, r.srs.Cancel(ctx, 1))
+	assert.NoError(t, waitRunStopped(t, done, time.Second))
+
+	assert.Len(t, r.executor.cancelledFlowRuns(), 1)
+	assert.Equal(t, value.Cancelled, r.sendpost.State)
+	assert.Equal(t, value.Cancelled, r.stage.State)
+	run := r.lastRun(t)
+	assert.Equal(t, value.Cancelled, run.State)
+	require.NotNil(t, run.Error)
+	assert.Equal(t, ErrRunCancelled.Error(), *run.Error)
+	assert.Equal(t, map[uint]value.StateType{1: value.Cancelled}, r.stageRuns.states(run.ID))
+
+	// Завершённый запуск уже не отменяется
+	assert.ErrorIs(t, r.srs.Cancel(ctx, 1), ErrSendpostNotRunning)
+}
+
+func TestRunLockLostFailsRun(t *testing.T) {
+	r := newTestSendpostRun()
+
+	done := r.start(t)
+	r.locks.failRenewals(errors.New("connection refused"))
+	assert.NoError(t, waitRunStopped(t, done, time.Second))
+
+	// flow run останавливается, состояние sendpost не меняется: его может выполнять другая реплика
+	assert.Len(t, r.executor.cancelledFlowRuns(), 1)
+	assert.Equal(t, value.Running, r.sendpost.State)
+	run := r.lastRun(t)
+	assert.Equal(t, value.Failed, run.State)
+	require.NotNil(t, run.Error)
+	assert.Contains(t, *run.Error, ErrRunLockLost.Error())
+}
+
+func TestRunMaxDuration(t *testing.T) {
+	r := newTestSendpostRun()
+	require.NoError(t, r.sendpost.SetMaxDuration(1))
+
+	// Запуск, превысивший max_duration, падает с причиной TIMED_OUT вместе с выполняемым этапом
+	done := r.start(t)
+	assert.NoError(t, waitRunStopped(t, done, 5*time.Second))
+
+	assert.Len(t, r.executor.cancelledFlowRuns(), 1)
+	assert.Equal(t, value.Failed, r.sendpost.State)
+	assert.Equal(t, value.Failed, r.stage.State)
+	run := r.lastRun(t)
+	assert.Equal(t, value.Failed, run.State)
+	require.NotNil(t, run.Reason)
+	assert.Equal(t, value.ReasonTimedOut, *run.Reason)
+	require.NotNil(t, run.Error)
+	assert.Contains(t, *run.Error, ErrRunTimedOut.Error())
+	stageRuns, err := r.stageRuns.GetStageRuns(context.Background(), run.ID)
+	require.NoError(t, err)
+	require.Len(t, stageRuns, 1)
+	require.NotNil(t, stageRuns[0].Reason)
+	assert.Equal(t, value.ReasonTimedOut, *stageRuns[0].Reason)
+}
+
+func TestShutdownInterruptsRun(t *testing.T) {
+	r := newTestSendpostRun()
+	ctx := context.Background()
+
+	done := r.start(t)
+	require.NoError(t, r.manager.Shutdown(ctx))
+	assert.ErrorIs(t, waitRunStopped(t, done, time.Second), ErrServerShutdown)
+
+	// Прерванный запуск сохраняет состояние, flow run в Prefect продолжает выполняться
+	assert.Empty(t, r.executor.cancelledFlowRuns())
+	assert.Equal(t, value.Running, r.sendpost.State)
+	assert.Equal(t, value.Running, r.lastRun(t).State)
+
+	// Новые запуски не принимаются до перезапуска
+	_, err := r.srs.Start(ctx, 1, RunOptions{})
+	assert.ErrorIs(t, err, ErrServerShuttingDown)
+	assert.Equal(t, 1, r.executor.flowRunCount())
+}
+
+func TestWithMaxDurationFromRunStart(t *testing.T) {
+	r := newTestSendpostRun()
+	ctx := context.Background()
+	startedAt := time.Now().Add(-time.Minute)
+	run := &entity.SendpostRun{SendpostID: 1, StartedAt: startedAt}
+
+	runCtx, cancel, err := r.srs.withMaxDuration(ctx, run)
+	require.NoError(t, err)
+	_, limited := runCtx.Deadline()
+	assert.False(t, limited)
+	cancel()
+
+	// Восстановленный запуск ограничивается временем от его начала, а не от перезапуска
+	require.NoError(t, r.sendpost.SetMaxDuration(30))
+	runCtx, cancel, err = r.srs.withMaxDuration(ctx, run)
+	require.NoError(t, err)
+	defer cancel()
+	deadline, limited := runCtx.Deadline()
+	require.True(t, limited)
+	assert.Equal(t, startedAt.Add(30*time.Second), deadline)
+	<-runCtx.Done()
+	assert.ErrorIs(t, context.Cause(runCtx), ErrRunTimedOut)
+}
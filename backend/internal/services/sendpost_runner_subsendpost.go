@@ -0,0 +1,111 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ErrorRunSubsendpost string = "[SendpostRunnerService] error running subsendpost"
+	SubsendpostResumed  string = "[SendpostRunnerService] Subsendpost run resumed after restart"
+)
+
+// ErrSubsendpostFailed means the run of the sendpost started by the subsendpost stage hasn't completed
+var ErrSubsendpostFailed = errors.New("subsendpost run hasn't completed")
+
+// runSubsendpost runs the sendpost of the subsendpost stage and waits for the run to finish.
+// The stage parameters override the global parameters of the sendpost within its run.
+// If the sendpost is already running, its active run is waited for first.
+// The nested run is cancelled with the stage, the stage fails if the nested run hasn't completed.
+// The nested run interrupted by the restart is continued if it hasn't been recovered yet,
+// the failed one is resumed instead of starting the sendpost again.
+func (srs *SendpostRunnerService) runSubsendpost(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	interrupted, err := srs.runHistoryService.GetStageRun(ctx, run, stage)
+	if err != nil {
+		return logging.WrapError(ErrorRunSubsendpost, err)
+	}
+	if err := srs.stageRunnerService.StartWithoutExecutor(ctx, run, stage); err != nil {
+		return err
+	}
+
+	sendpostID := *stage.SubsendpostID
+	lockCtx, unlock, err := srs.runLockService.Lock(ctx, sendpostID)
+	if err != nil {
+		return srs.handleSubsendpostErr(ctx, run, stage, err)
+	}
+	defer unlock()
+
+	var previous *entity.SendpostRun
+	if interrupted != nil && interrupted.SubsendpostRunID != nil {
+		// Вложенный запуск, прерванный рестартом, продолжается после его восстановления
+		nested, err := srs.runHistoryService.GetSendpostRun(ctx, sendpostID, *interrupted.SubsendpostRunID)
+		if err != nil {
+			return srs.handleSubsendpostErr(ctx, run, stage, err)
+		}
+		logging.Info(SubsendpostResumed, zap.Uint("stage_id", stage.ID), zap.Uint("run_id", nested.ID), zap.String("state", string(nested.State)))
+		if !nested.State.IsFinal() {
+			// Вложенный запуск ещё не восстановлен, а блокировка у нас: продолжаем его сами
+			srs.continueRun(lockCtx, sendpostID, nested)
+			if nested, err = srs.runHistoryService.GetSendpostRun(ctx, sendpostID, nested.ID); err != nil {
+				return srs.handleSubsendpostErr(ctx, run, stage, err)
+			}
+			return srs.finishSubsendpost(ctx, run, stage, nested)
+		}
+		if nested.State == value.Completed {
+			return srs.completeSubsendpost(ctx, run, stage, nested)
+		}
+		if nested.IsResumable() {
+			previous = nested
+		}
+	}
+
+	opts := RunOptions{
+		Parameters:  stage.RunParameters(),
+		ParentRunID: &run.ID,
+		onRunCreated: func(nested *entity.SendpostRun) {
+			if err := srs.runHistoryService.LinkSubsendpostRun(ctx, run, stage, nested); err != nil {
+				logging.Warn(ErrorRunSubsendpost, zap.Uint("stage_id", stage.ID), zap.Error(err))
+			}
+		},
+	}
+	nested, err := srs.run(lockCtx, sendpostID, opts, previous)
+	if err != nil {
+		return srs.handleSubsendpostErr(ctx, run, stage, err)
+	}
+	if nested == nil {
+		return srs.handleSubsendpostErr(ctx, run, stage, fmt.Errorf("%w: run of sendpost %d wasn't created", ErrSubsendpostFailed, sendpostID))
+	}
+	return srs.finishSubsendpost(ctx, run, stage, nested)
+}
+
+// finishSubsendpost completes the subsendpost stage if the nested run has completed, fails it otherwise.
+func (srs *SendpostRunnerService) finishSubsendpost(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, nested *entity.SendpostRun) error {
+	if nested.State != value.Completed {
+		err := fmt.Errorf("%w: run %d of sendpost %d finished with %s state", ErrSubsendpostFailed, nested.ID, nested.SendpostID, nested.State)
+		if nested.Error != nil {
+			err = fmt.Errorf("%w: %s", err, *nested.Error)
+		}
+		return srs.handleSubsendpostErr(ctx, run, stage, err)
+	}
+	return srs.completeSubsendpost(ctx, run, stage, nested)
+}
+
+func (srs *SendpostRunnerService) completeSubsendpost(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, nested *entity.SendpostRun) error {
+	logging.Info(StageCompleted, zap.Uint("stage_id", stage.ID), zap.Uint("subsendpost_run_id", nested.ID))
+	return srs.stageRunnerService.UpdateState(ctx, run, stage, value.Completed)
+}
+
+// handleSubsendpostErr marks the subsendpost stage as cancelled if the run was cancelled
+// or the stage timed out, as failed otherwise.
+func (srs *SendpostRunnerService) handleSubsendpostErr(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, err error) error {
+	if ctx.Err() != nil {
+		return srs.stageRunnerService.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
+	}
+	return srs.stageRunnerService.HandleFailedStage(ctx, run, stage, err)
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/mocks"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+// testSubsendpost is the sendpost 1 whose subsendpost stage 1 runs the sendpost 2
+// with the stage 3 depending on the stage 2. The run of the sendpost 1 was interrupted
+// by the restart while the nested run had completed the stage 2 only.
+type testSubsendpost struct {
+	srs       *SendpostRunnerService
+	runner    *fakeStageRunner
+	history   *RunHistoryService
+	runs      *fakeSendpostRunRepository
+	stageRuns *fakeStageRunRepository
+	sendposts map[uint]*entity.Sendpost
+	stages    map[uint]*entity.Stage
+	run       *entity.SendpostRun
+	nested    *entity.SendpostRun
+}
+
+func newTestSubsendpost(t *testing.T) *testSubsendpost {
+	logging.Logger = zap.NewNop()
+	ctx := context.Background()
+
+	nestedID := uint(2)
+	sendposts := map[uint]*entity.Sendpost{
+		1: {Model: gorm.Model{ID: 1}, State: value.Running},
+		2: {Model: gorm.Model{ID: 2}, State: value.Running},
+	}
+	stages := map[uint]*entity.Stage{
+		1: {Model: gorm.Model{ID: 1}, SendpostID: 1, Type: value.SubsendpostStage, SubsendpostID: &nestedID, StageParameters: &value.JSONB{}},
+		2: {Model: gorm.Model{ID: 2}, SendpostID: 2, DeploymnentID: "d2", StageParameters: &value.JSONB{}},
+		3: {Model: gorm.Model{ID: 3}, SendpostID: 2, DeploymnentID: "d3", StageParameters: &value.JSONB{}},
+	}
+	sendpostRepo := new(mocks.SendpostRepository)
+	stageRepo := new(mocks.StageRepository)
+	dependencyRepo := new(mocks.StageDependencyRepository)
+	for id, sendpost := range sendposts {
+		sendpostRepo.On("GetSendpostByID", mock.Anything, id).Return(sendpost, nil)
+		sendpostRepo.On("SaveSendpost", mock.Anything, sendpost).Return(nil)
+		sendpostRepo.On("GetSendpostParameters", mock.Anything, id).Return(&value.JSONB{}, nil)
+		sendpostRepo.On("GetOnFailureStage", mock.Anything, id).Return(nil, nil)
+	}
+	for id, stage := range stages {
+		stageRepo.On("GetStageByID", mock.Anything, id).Return(stage, nil)
+	}
+	stageRepo.On("SaveStage", mock.Anything, mock.Anything).Return(nil)
+	stageRepo.On("GetSendpostStages", mock.Anything, uint(1)).Return([]*entity.Stage{stages[1]}, nil)
+	stageRepo.On("GetSendpostStages", mock.Anything, uint(2)).Return([]*entity.Stage{stages[2], stages[3]}, nil)
+	dependencyRepo.On("GetSendpostDependencies", mock.Anything, uint(1)).Return([]*entity.StageDependency{}, nil)
+	dependencyRepo.On("GetSendpostDependencies", mock.Anything, uint(2)).Return([]*entity.StageDependency{entity.NewStageDependency(3, 2)}, nil)
+
+	history, runs, stageRuns := newFakeRunHistory()
+	stageService := NewStageService(stageRepo, sendpostRepo, dependencyRepo, NewSchemaService(nil))
+	sendpostService := NewSendpostService(sendpostRepo, stageService)
+	stageRunnerService, templateService := newTestStageRunnerService(newFakeStageExecutor(), sendpostService, stageService, history)
+	runner := &fakeStageRunner{service: stageRunnerService}
+	srs := NewSendpostRunService(sendpostService, stageService, stageRunnerService, history, templateService, nil,
+		newTestRunLockService(newFakeSendpostRunLockRepository()), NewRunManager(ctx),
+		NewSenpostRunNotificationService(nil), &fakeStageRunnerFactory{runner: runner}, time.UTC)
+
+	// Рестарт прервал запуск, пока вложенный запуск выполнял этап 3
+	run, err := history.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, stageRunnerService.StartWithoutExecutor(ctx, run, stages[1]))
+	nested, err := history.CreateRun(ctx, 2, nil, &run.ID, stages[1].StageParameters, nil)
+	require.NoError(t, err)
+	require.NoError(t, history.LinkSubsendpostRun(ctx, run, stages[1], nested))
+	require.NoError(t, history.UpdateStageRunState(ctx, nested, stages[2], value.Completed, nil))
+
+	return &testSubsendpost{
+		srs:       srs,
+		runner:    runner,
+		history:   history,
+		runs:      runs,
+		stageRuns: stageRuns,
+		sendposts: sendposts,
+		stages:    stages,
+		run:       run,
+		nested:    nested,
+	}
+}
+
+// nestedRuns returns the runs of the sendpost 2.
+func (s *testSubsendpost) nestedRuns(t *testing.T) []*entity.SendpostRun {
+	runs, err := s.runs.GetSendpostRuns(context.Background(), 2)
+	require.NoError(t, err)
+	return runs
+}
+
+func TestRecoverRunContinuesNestedRun(t *testing.T) {
+	s := newTestSubsendpost(t)
+	ctx := context.Background()
+
+	// Вложенный запуск ещё не восстановлен, его продолжает восстановление родительского
+	s.srs.recoverRun(ctx, 1)
+
+	assert.Equal(t, []uint{3}, s.runner.startedStages())
+	assert.Len(t, s.nestedRuns(t), 1)
+	assert.Equal(t, map[uint]value.StateType{2: value.Completed, 3: value.Completed}, s.stageRuns.states(s.nested.ID))
+	assert.Equal(t, map[uint]value.StateType{1: value.Completed}, s.stageRuns.states(s.run.ID))
+	assert.Equal(t, value.Completed, s.sendposts[1].State)
+	assert.Equal(t, value.Completed, s.sendposts[2].State)
+}
+
+func TestRecoverRunReusesRecoveredNestedRun(t *testing.T) {
+	s := newTestSubsendpost(t)
+	ctx := context.Background()
+
+	// Вложенный запуск восстановлен раньше родительского и завершился
+	s.srs.recoverRun(ctx, 2)
+	require.Equal(t, []uint{3}, s.runner.startedStages())
+	s.srs.recoverRun(ctx, 1)
+
+	assert.Equal(t, []uint{3}, s.runner.startedStages())
+	assert.Len(t, s.nestedRuns(t), 1)
+	assert.Equal(t, map[uint]value.StateType{1: value.Completed}, s.stageRuns.states(s.run.ID))
+	assert.Equal(t, value.Completed, s.sendposts[1].State)
+}
+
+func TestRecoverRunResumesFailedNestedRun(t *testing.T) {
+	s := newTestSubsendpost(t)
+	ctx := context.Background()
+	require.NoError(t, s.history.CompleteRun(ctx, s.nested, value.Failed, errors.New("stage 3 failed")))
+	s.sendposts[2].State = value.Failed
+
+	s.srs.recoverRun(ctx, 1)
+
+	// Упавший вложенный запуск продолжается новым запуском, завершённый этап 2 не выполняется заново
+	assert.Equal(t, []uint{3}, s.runner.startedStages())
+	nestedRuns := s.nestedRuns(t)
+	require.Len(t, nestedRuns, 2)
+	require.NotNil(t, nestedRuns[0].ResumedFromRunID)
+	assert.Equal(t, s.nested.ID, *nestedRuns[0].ResumedFromRunID)
+	require.NotNil(t, nestedRuns[0].ParentRunID)
+	assert.Equal(t, s.run.ID, *nestedRuns[0].ParentRunID)
+	assert.Equal(t, value.Completed, nestedRuns[0].State)
+	assert.Equal(t, map[uint]value.StateType{1: value.Completed}, s.stageRuns.states(s.run.ID))
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"crm-uplift-ii24-backend/pkg/schema"
+	"fmt"
+)
+
+const ErrorValidateSendpost string = "[SendpostRunnerService] error validating sendpost"
+
+// Validate checks the parameters every stage of the sendpost would be executed with against the schema
+// of the parameters of its deployment, including the sub-stages of the parallel stages and the on-failure stages.
+// The parameters are resolved as for the run which would be started now, the values with the expressions aren't checked.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//	sendpostID - The sendpost to validate.
+//
+// Returns:
+//
+//	schema.Errors - The mismatches of the parameters, the fields are prefixed with stages.<stage_id>.
+//	error - ErrSendpostNotFound or an error if the stages couldn't be retrieved.
+func (srs *SendpostRunnerService) Validate(ctx context.Context, sendpostID uint) (schema.Errors, error) {
+	if _, err := srs.sendpostService.GetSendpost(ctx, sendpostID); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrSendpostNotFound, err)
+	}
+	stages, err := srs.stageService.GetAllSendpostStages(ctx, sendpostID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorValidateSendpost, err)
+	}
+
+	run := entity.NewSendpostRun(sendpostID)
+	errs := schema.Errors{}
+	for _, stage := range stages {
+		prefix := fmt.Sprintf("stages.%d", stage.ID)
+		stageErrs, err := srs.parameterService.Validate(ctx, run, stage)
+		if err != nil {
+			// Недоступный деплоймент тоже не даст запустить этап
+			errs = append(errs, schema.FieldError{Field: prefix, Message: err.Error()})
+			continue
+		}
+		errs = append(errs, stageErrs.Prefix(prefix)...)
+	}
+	return errs, nil
+}
@@ -3,63 +3,249 @@ package services
 import (
 	"context"
 	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
 	"crm-uplift-ii24-backend/pkg/logging"
+	"errors"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
 
 type SendpostSchedulerService struct {
 	scheduler             entity.SendpostScheduler
-	ScheduleService       ScheduleService
-	SendpostRunnerService SendpostRunnerService
+	ScheduleService       *ScheduleService
+	SendpostRunnerService *SendpostRunnerService
 	workerCount           int
+	misfirePolicy         value.MisfirePolicy
+	misfireGracePeriod    time.Duration
 	wg                    sync.WaitGroup
+	// ctx lives as long as the workers, the schedules are waiting within it
+	ctx context.Context
 }
 
-func NewSendpostSchedulerService(scheduler entity.SendpostScheduler, ScheduleService ScheduleService, SendpostRunnerService SendpostRunnerService, workerCount int) *SendpostSchedulerService {
+func NewSendpostSchedulerService(
+	scheduler entity.SendpostScheduler,
+	ScheduleService *ScheduleService,
+	SendpostRunnerService *SendpostRunnerService,
+	workerCount int,
+	misfirePolicy value.MisfirePolicy,
+	misfireGracePeriod time.Duration,
+) *SendpostSchedulerService {
+	if !misfirePolicy.IsValid() {
+		logging.Warn("[SchedulerService] Unknown misfire policy, schedules will be run immediately", zap.String("misfire_policy", string(misfirePolicy)))
+		misfirePolicy = value.MisfireRunImmediately
+	}
 	return &SendpostSchedulerService{
 		scheduler:             scheduler,
 		ScheduleService:       ScheduleService,
 		SendpostRunnerService: SendpostRunnerService,
 		workerCount:           workerCount,
+		misfirePolicy:         misfirePolicy,
+		misfireGracePeriod:    misfireGracePeriod,
+		ctx:                   context.Background(),
 	}
 }
 
+// Start launches the workers which run the sendposts of the due schedules
+// and restores the pending schedules saved before the restart.
+// The workers stop when ctx is done.
 func (s *SendpostSchedulerService) Start(ctx context.Context) {
+	s.ctx = ctx
 	for i := 0; i < s.workerCount; i++ {
 		s.wg.Add(1)
 		go s.worker(ctx)
 	}
+	if err := s.restoreSchedules(ctx); err != nil {
+		logging.Error("[SchedulerService] Error restoring schedules", zap.Error(err))
+	}
+}
+
+// restoreSchedules puts the pending schedules from the repository to the scheduler.
+// The schedules whose planned time passed while the service was down
+// are handled according to the misfire policy.
+func (s *SendpostSchedulerService) restoreSchedules(ctx context.Context) error {
+	schedules, err := s.ScheduleService.GetPendingSchedules(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, schedule := range schedules {
+		// Рекуррентное расписание было прервано во время запуска
+		if schedule.IsRecurring() && schedule.StartedAt != nil {
+			logging.Warn("[SchedulerService] Recurring schedule was interrupted", zap.Uint("schedule_id", schedule.ID))
+			s.scheduleNext(ctx, schedule)
+			continue
+		}
+		if schedule.IsMisfired(now) && !s.runMisfired(schedule, now) {
+			s.skipMisfired(ctx, schedule)
+			continue
+		}
+		logging.Info("[SchedulerService] Schedule restored", zap.Uint("schedule_id", schedule.ID), zap.Time("planned_at", schedule.PlannedAt))
+		s.scheduler.AddSchedule(ctx, *schedule)
+	}
+	return nil
+}
+
+// runMisfired reports whether the misfired schedule should be run according to the misfire policy.
+func (s *SendpostSchedulerService) runMisfired(schedule *entity.SendpostSchedule, now time.Time) bool {
+	switch s.misfirePolicy {
+	case value.MisfireSkip:
+		return false
+	case value.MisfireGrace:
+		return now.Sub(schedule.PlannedAt) <= s.misfireGracePeriod
+	default:
+		return true
+	}
+}
+
+// skipMisfired skips the misfired schedule. The recurring schedule is moved
+// to its next activation time, the one-time schedule is marked as skipped.
+func (s *SendpostSchedulerService) skipMisfired(ctx context.Context, schedule *entity.SendpostSchedule) {
+	logging.Warn("[SchedulerService] Skip misfired schedule", zap.Uint("schedule_id", schedule.ID), zap.Time("planned_at", schedule.PlannedAt))
+	if schedule.IsRecurring() {
+		s.scheduleNext(ctx, schedule)
+		return
+	}
+	if err := s.ScheduleService.SkipSchedule(ctx, schedule); err != nil {
+		logging.Error("[SchedulerService] Error skipping schedule", zap.Uint("schedule_id", schedule.ID), zap.Error(err))
+	}
+}
+
+// CreateSchedule saves the new schedule of the sendpost and puts it to the scheduler.
+func (s *SendpostSchedulerService) CreateSchedule(
+	ctx context.Context,
+	sendpostID uint,
+	plannedAt *time.Time,
+	cronExpression *string,
+	timezone string,
+) (*entity.SendpostSchedule, error) {
+	schedule, err := s.ScheduleService.CreateSchedule(ctx, sendpostID, plannedAt, cronExpression, timezone)
+	if err != nil {
+		return nil, err
+	}
+	s.scheduler.AddSchedule(s.ctx, *schedule)
+	return schedule, nil
+}
+
+// ChangeSchedule saves the new definition of the schedule and replaces it in the scheduler.
+func (s *SendpostSchedulerService) ChangeSchedule(
+	ctx context.Context,
+	sendpostID uint,
+	scheduleID uint,
+	plannedAt *time.Time,
+	cronExpression *string,
+	timezone string,
+) (*entity.SendpostSchedule, error) {
+	schedule, err := s.ScheduleService.ChangeSchedule(ctx, sendpostID, scheduleID, plannedAt, cronExpression, timezone)
+	if err != nil {
+		return nil, err
+	}
+	s.scheduler.AddSchedule(s.ctx, *schedule)
+	return schedule, nil
+}
+
+// DeleteSchedule removes the schedule from the scheduler and deletes it.
+func (s *SendpostSchedulerService) DeleteSchedule(ctx context.Context, sendpostID uint, scheduleID uint) error {
+	if err := s.ScheduleService.DeleteSchedule(ctx, sendpostID, scheduleID); err != nil {
+		return err
+	}
+	s.scheduler.RemoveSchedule(scheduleID)
+	return nil
 }
 
 func (s *SendpostSchedulerService) worker(ctx context.Context) {
 	defer s.wg.Done()
 	for {
 		select {
-		case schedule := <-s.scheduler.GetQueue():
-			logging.Info("[SchedulerService] Start Sendpost ID: %d", zap.Uint("sendpost_id", schedule.SendpostID))
+		case queued := <-s.scheduler.GetQueue():
+			// Расписание могло быть удалено или изменено, пока стояло в очереди
+			schedule, err := s.ScheduleService.GetSchedule(ctx, queued.SendpostID, queued.ID)
+			if err != nil {
+				logging.Warn("[SchedulerService] Skip removed schedule", zap.Uint("schedule_id", queued.ID), zap.Error(err))
+				continue
+			}
+			if !schedule.PlannedAt.Equal(queued.PlannedAt) {
+				logging.Info("[SchedulerService] Skip changed schedule", zap.Uint("schedule_id", queued.ID))
+				s.keepSchedule(schedule)
+				continue
+			}
 
-			// Обновляем, что выполнение началось
-			if err := s.ScheduleService.UpdateScheduleStartedAt(ctx, &schedule); err != nil {
+			logging.Info("[SchedulerService] Start Sendpost", zap.Uint("sendpost_id", schedule.SendpostID), zap.Uint("schedule_id", schedule.ID))
+
+			// Захватываем расписание: на других репликах оно сработало в то же время
+			claimed, err := s.ScheduleService.ClaimSchedule(ctx, schedule)
+			if err != nil {
 				logging.Error("[SchedulerService] Error updating start schedule", zap.Error(err))
 				continue
 			}
+			if !claimed {
+				logging.Info("[SchedulerService] Skip schedule claimed by another replica", zap.Uint("schedule_id", schedule.ID))
+				// Пропускается только это срабатывание, расписание остаётся в планировщике
+				if stored, err := s.ScheduleService.GetSchedule(ctx, schedule.SendpostID, schedule.ID); err == nil {
+					s.keepSchedule(stored)
+				}
+				continue
+			}
 
-			// Запускаем выполнение рассылки
-			s.SendpostRunnerService.Start(ctx, schedule.SendpostID)
+			// Запускаем выполнение рассылки и ждём его завершения, активный запуск не ставит плановый в очередь
+			err = s.SendpostRunnerService.Run(ctx, schedule.SendpostID, RunOptions{})
+			if errors.Is(err, ErrServerShutdown) || errors.Is(err, ErrServerShuttingDown) || ctx.Err() != nil {
+				// Выполнение не отмечается завершённым: прерванный запуск продолжается после перезапуска
+				logging.Warn("[SchedulerService] Sendpost run interrupted by shutdown", zap.Uint("schedule_id", schedule.ID))
+				return
+			}
+			if errors.Is(err, ErrSendpostAlreadyRunning) {
+				logging.Warn("[SchedulerService] Skip schedule of running sendpost", zap.Uint("sendpost_id", schedule.SendpostID), zap.Uint("schedule_id", schedule.ID))
+			} else if err != nil {
+				logging.Error("[SchedulerService] Error running sendpost", zap.Uint("sendpost_id", schedule.SendpostID), zap.Error(err))
+			}
 
 			// Обновляем, что выполнение завершилось
-			if err := s.ScheduleService.UpdateScheduleCompletedAt(ctx, &schedule); err != nil {
+			if err := s.ScheduleService.UpdateScheduleCompletedAt(ctx, schedule); err != nil {
 				logging.Error("[SchedulerService] Error updating completed stage", zap.Error(err))
 			}
 
+			if schedule.IsRecurring() {
+				s.scheduleNext(ctx, schedule)
+			}
+
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
+// scheduleNext moves the recurring schedule to its next activation time
+// and puts it back to the scheduler.
+func (s *SendpostSchedulerService) scheduleNext(ctx context.Context, schedule *entity.SendpostSchedule) {
+	if err := s.ScheduleService.ScheduleNext(ctx, schedule); err != nil {
+		logging.Error("[SchedulerService] Error scheduling next run", zap.Uint("schedule_id", schedule.ID), zap.Error(err))
+		return
+	}
+	logging.Info("[SchedulerService] Next run scheduled", zap.Uint("schedule_id", schedule.ID), zap.Time("planned_at", schedule.PlannedAt))
+	s.scheduler.AddSchedule(s.ctx, *schedule)
+}
+
+// keepSchedule keeps the schedule which fired but isn't run by this replica in the scheduler.
+// The changed schedule waits for its new planned time. The recurring schedule being run
+// by another replica waits for its next activation, it's saved by that replica.
+func (s *SendpostSchedulerService) keepSchedule(schedule *entity.SendpostSchedule) {
+	if schedule.StartedAt == nil && schedule.SkippedAt == nil {
+		s.scheduler.AddSchedule(s.ctx, *schedule)
+		return
+	}
+	if !schedule.IsRecurring() {
+		return
+	}
+	next := *schedule
+	if err := next.ScheduleNext(time.Now()); err != nil {
+		logging.Error("[SchedulerService] Error scheduling next run", zap.Uint("schedule_id", schedule.ID), zap.Error(err))
+		return
+	}
+	s.scheduler.AddSchedule(s.ctx, next)
+}
+
 func (s *SendpostSchedulerService) Wait() {
 	s.wg.Wait()
 }
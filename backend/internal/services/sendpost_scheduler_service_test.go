@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+func TestRestoreSchedulesMisfirePolicy(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	hourly := "0 * * * *"
+	now := time.Now()
+	startedAt := now.Add(-2 * time.Hour)
+
+	type expected struct {
+		scheduled bool
+		skipped   bool
+		moved     bool
+	}
+	for _, tc := range []struct {
+		name     string
+		policy   value.MisfirePolicy
+		schedule entity.SendpostSchedule
+		expected expected
+	}{
+		{
+			name:     "future schedule is restored",
+			policy:   value.MisfireSkip,
+			schedule: entity.SendpostSchedule{PlannedAt: now.Add(time.Hour)},
+			expected: expected{scheduled: true},
+		},
+		{
+			name:     "run_immediately runs misfired schedule",
+			policy:   value.MisfireRunImmediately,
+			schedule: entity.SendpostSchedule{PlannedAt: now.Add(-3 * time.Hour)},
+			expected: expected{scheduled: true},
+		},
+		{
+			name:     "skip skips misfired schedule",
+			policy:   value.MisfireSkip,
+			schedule: entity.SendpostSchedule{PlannedAt: now.Add(-time.Minute)},
+			expected: expected{skipped: true},
+		},
+		{
+			name:     "skip moves misfired recurring schedule",
+			policy:   value.MisfireSkip,
+			schedule: entity.SendpostSchedule{PlannedAt: now.Add(-time.Minute), CronExpression: &hourly},
+			expected: expected{scheduled: true, moved: true},
+		},
+		{
+			name:     "grace runs schedule misfired within grace period",
+			policy:   value.MisfireGrace,
+			schedule: entity.SendpostSchedule{PlannedAt: now.Add(-5 * time.Minute)},
+			expected: expected{scheduled: true},
+		},
+		{
+			name:     "grace skips schedule misfired beyond grace period",
+			policy:   value.MisfireGrace,
+			schedule: entity.SendpostSchedule{PlannedAt: now.Add(-time.Hour)},
+			expected: expected{skipped: true},
+		},
+		{
+			name:     "interrupted recurring schedule is moved",
+			policy:   value.MisfireRunImmediately,
+			schedule: entity.SendpostSchedule{PlannedAt: startedAt, StartedAt: &startedAt, CronExpression: &hourly},
+			expected: expected{scheduled: true, moved: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newFakeSendpostScheduleRepository()
+			scheduler := newFakeSendpostScheduler()
+			svc := NewSendpostSchedulerService(scheduler, NewScheduleService(repo), nil, 1, tc.policy, 10*time.Minute)
+
+			schedule := tc.schedule
+			schedule.SendpostID = 1
+			schedule.Timezone = entity.DefaultScheduleTimezone
+			require.NoError(t, repo.SaveSchedule(context.Background(), &schedule))
+
+			require.NoError(t, svc.restoreSchedules(context.Background()))
+
+			saved, err := repo.GetScheduleByID(context.Background(), schedule.ID)
+			require.NoError(t, err)
+			if tc.expected.scheduled {
+				require.Len(t, scheduler.added(), 1)
+				assert.True(t, scheduler.added()[0].PlannedAt.Equal(saved.PlannedAt))
+			} else {
+				assert.Empty(t, scheduler.added())
+			}
+			assert.Equal(t, tc.expected.skipped, saved.SkippedAt != nil)
+			if tc.expected.moved {
+				assert.True(t, saved.PlannedAt.After(now))
+				assert.Nil(t, saved.StartedAt)
+			} else {
+				assert.True(t, saved.PlannedAt.Equal(schedule.PlannedAt))
+			}
+		})
+	}
+}
+
+func TestClaimSchedule(t *testing.T) {
+	repo := newFakeSendpostScheduleRepository()
+	svc := NewScheduleService(repo)
+	schedule := &entity.SendpostSchedule{SendpostID: 1, PlannedAt: time.Now()}
+	require.NoError(t, repo.SaveSchedule(context.Background(), schedule))
+
+	// Расписание, сработавшее на двух репликах, запускает только одна
+	first, second := *schedule, *schedule
+	claimed, err := svc.ClaimSchedule(context.Background(), &first)
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	assert.NotNil(t, first.StartedAt)
+
+	claimed, err = svc.ClaimSchedule(context.Background(), &second)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+	assert.Nil(t, second.StartedAt)
+
+	// Изменённое расписание не запускается по старому времени
+	changed := &entity.SendpostSchedule{SendpostID: 1, PlannedAt: time.Now()}
+	require.NoError(t, repo.SaveSchedule(context.Background(), changed))
+	stale := *changed
+	stale.PlannedAt = changed.PlannedAt.Add(-time.Hour)
+	claimed, err = svc.ClaimSchedule(context.Background(), &stale)
+	require.NoError(t, err)
+	assert.False(t, claimed)
+}
+
+func TestWorkerKeepsScheduleNotRunHere(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	hourly := "0 * * * *"
+	now := time.Now()
+	startedAt := now.Add(-time.Second)
+
+	for _, tc := range []struct {
+		name string
+		// stored is the schedule saved by another replica after the schedule fired
+		stored   entity.SendpostSchedule
+		expected func(t *testing.T, added []entity.SendpostSchedule)
+	}{
+		{
+			name:   "recurring schedule claimed by another replica waits for next activation",
+			stored: entity.SendpostSchedule{PlannedAt: now, StartedAt: &startedAt, CronExpression: &hourly},
+			expected: func(t *testing.T, added []entity.SendpostSchedule) {
+				require.Len(t, added, 1)
+				assert.True(t, added[0].PlannedAt.After(now))
+				assert.Nil(t, added[0].StartedAt)
+			},
+		},
+		{
+			name:   "one-time schedule claimed by another replica is dropped",
+			stored: entity.SendpostSchedule{PlannedAt: now, StartedAt: &startedAt},
+			expected: func(t *testing.T, added []entity.SendpostSchedule) {
+				assert.Empty(t, added)
+			},
+		},
+		{
+			name:   "changed schedule waits for new planned time",
+			stored: entity.SendpostSchedule{PlannedAt: now.Add(time.Hour)},
+			expected: func(t *testing.T, added []entity.SendpostSchedule) {
+				require.Len(t, added, 1)
+				assert.True(t, added[0].PlannedAt.Equal(now.Add(time.Hour)))
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			repo := newFakeSendpostScheduleRepository()
+			scheduler := newFakeSendpostScheduler()
+			svc := NewSendpostSchedulerService(scheduler, NewScheduleService(repo), nil, 1, value.MisfireRunImmediately, 0)
+
+			stored := tc.stored
+			stored.SendpostID = 1
+			stored.Timezone = entity.DefaultScheduleTimezone
+			require.NoError(t, repo.SaveSchedule(context.Background(), &stored))
+			fired := stored
+			fired.PlannedAt = now
+			fired.StartedAt = nil
+
+			ctx, cancel := context.WithCancel(context.Background())
+			svc.wg.Add(1)
+			go svc.worker(ctx)
+			scheduler.queue <- fired
+			cancel()
+			svc.Wait()
+
+			tc.expected(t, scheduler.added())
+			saved, err := repo.GetScheduleByID(context.Background(), stored.ID)
+			require.NoError(t, err)
+			assert.True(t, saved.PlannedAt.Equal(stored.PlannedAt))
+		})
+	}
+}
@@ -37,22 +37,29 @@ Parameters:
   - sendpostName: The name of the sendpost to be created.
   - sendpostDate: The date associated with the sendpost.
   - firstStageID: An optional pointer to the ID of the first stage.
+  - maxDuration: An optional max duration of the run in seconds.
 
 Returns:
   - A pointer to the created Sendpost entity.
-  - An error if the sendpost creation or saving fails.
+  - An error if the sendpost creation or saving fails, entity.ErrInvalidMaxDuration if the max duration is invalid.
 */
 func (ss *SendpostService) CreateSendpost(
 	ctx context.Context,
 	sendpostName string,
 	description *string,
 	parameters *value.JSONB,
+	maxDuration *int,
 ) (*entity.Sendpost, error) {
 
 	logging.Debug("[SendpostService] CreateSendpost")
 
 	sendpost := entity.Sendpost{}
 	sendpost.Update(sendpostName, description, parameters)
+	if maxDuration != nil {
+		if err := sendpost.SetMaxDuration(*maxDuration); err != nil {
+			return nil, logging.WrapError("[SendpostService] error CreateSendpost", err)
+		}
+	}
 	if err := ss.sendpostRepo.SaveSendpost(ctx, &sendpost); err != nil {
 		return nil, fmt.Errorf("[SendpostService] error CreateSendpost: %s", err)
 	}
@@ -151,27 +158,6 @@ func (srs *SendpostService) UpdateSendpostState(ctx context.Context, id uint, st
 	return nil
 }
 
-// GetFirstStage retrieves the first stage of a sendpost by its ID.
-// It logs the operation and returns the stage entity or an error if the retrieval fails.
-//
-// Parameters:
-//
-//	ctx - The context for controlling cancellation and deadlines.
-//	sendpostID - The unique identifier of the sendpost.
-//
-// Returns:
-//
-//	*entity.Stage - The first stage entity of the sendpost.
-//	error - An error if the operation fails, otherwise nil.
-func (src *SendpostService) GetFirstStage(ctx context.Context, sendpostID uint) (*entity.Stage, error) {
-	logging.Debug("[SendpostService] GetFirstStage")
-	stage, err := src.sendpostRepo.GetFirstStage(ctx, sendpostID)
-	if err != nil {
-		return nil, fmt.Errorf("[SendpostService] error GetFirstStage: %s", err)
-	}
-	return stage, nil
-}
-
 /*
 CopySendpost duplicates an existing sendpost identified by sendpostID, assigning it a new name and optional description.
 It retrieves the original sendpost, creates a copy with the new attributes, and saves the new sendpost to the repository.
@@ -182,18 +168,24 @@ Parameters:
   - sendpostID: The unique identifier of the sendpost to be copied.
   - NewName: The new name for the copied sendpost.
   - NewDescription: An optional new description for the copied sendpost.
+  - NewMaxDuration: An optional new max duration of the run, the original one is kept if nil.
 
 Returns:
   - A pointer to the newly created sendpost entity.
   - An error if the operation fails at any step.
 */
-func (src *SendpostService) CopySendpost(ctx context.Context, sendpostID uint, NewName string, NewDescription *string, NewParams *value.JSONB) (*entity.Sendpost, error) {
+func (src *SendpostService) CopySendpost(ctx context.Context, sendpostID uint, NewName string, NewDescription *string, NewParams *value.JSONB, NewMaxDuration *int) (*entity.Sendpost, error) {
 	logging.Debug("[SendpostService] CopySendpost")
 	sendpost, err := src.sendpostRepo.GetSendpostByID(ctx, sendpostID)
 	if err != nil {
 		return nil, logging.WrapError(ErrorCopySendpost, err)
 	}
 	newSendpost := sendpost.Copy(NewName, NewDescription)
+	if NewMaxDuration != nil {
+		if err := newSendpost.SetMaxDuration(*NewMaxDuration); err != nil {
+			return nil, logging.WrapError(ErrorCopySendpost, err)
+		}
+	}
 	if err := src.sendpostRepo.SaveSendpost(ctx, newSendpost); err != nil {
 		return nil, logging.WrapError(ErrorCopySendpost, err)
 	}
@@ -243,6 +235,13 @@ func (src *SendpostService) AddUpdateSendpostParameter(ctx context.Context, send
 	return nil
 }
 
+// ValidateSendpostParameters validates the global parameters before they are added or updated
+// against the schemas of the deployments of the stages of the sendpost.
+// Returns ErrInvalidParameters with the mismatch of every field.
+func (src *SendpostService) ValidateSendpostParameters(ctx context.Context, sendpostID uint, parameters value.JSONB) error {
+	return src.stageService.ValidateGlobalParameters(ctx, sendpostID, parameters)
+}
+
 // DeleteSendpostParameter removes a specific parameter from a sendpost's global parameters.
 // It retrieves the sendpost by its ID, deletes the specified key from its parameters,
 // and saves the updated sendpost back to the repository. If any error occurs during
@@ -20,15 +20,17 @@ import (
 
 type SendpostServiceTestSuite struct {
 	suite.Suite
-	svc          *SendpostService
-	sendpostRepo *mocks.SendpostRepository
-	stageRepo    *mocks.StageRepository
+	svc            *SendpostService
+	sendpostRepo   *mocks.SendpostRepository
+	stageRepo      *mocks.StageRepository
+	dependencyRepo *mocks.StageDependencyRepository
 }
 
 func (s *SendpostServiceTestSuite) SetupTest() {
 	s.sendpostRepo = new(mocks.SendpostRepository)
 	s.stageRepo = new(mocks.StageRepository)
-	stageService := NewStageService(s.stageRepo, s.sendpostRepo)
+	s.dependencyRepo = new(mocks.StageDependencyRepository)
+	stageService := NewStageService(s.stageRepo, s.sendpostRepo, s.dependencyRepo, NewSchemaService(nil))
 	s.svc = NewSendpostService(s.sendpostRepo, stageService)
 	logging.Logger = zap.NewNop()
 
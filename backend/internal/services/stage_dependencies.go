@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/pkg/logging"
+	"fmt"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ErrorGetSendpostGraph   string = "[StageService] error GetSendpostGraph"
+	ErrorAddDependency      string = "[StageService] error AddDependency"
+	ErrorRemoveDependency   string = "[StageService] error RemoveDependency"
+	ErrorAddStageWithDeps   string = "[StageService] error AddStageWithDependencies"
+	ErrorUpdateDependencies string = "[StageService] error updating stage dependencies"
+)
+
+// GetSendpostGraph retrieves the graph of the top level stages of the sendpost
+// except the on-failure chain with the dependencies between them.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//	sendpostID - The unique identifier of the sendpost.
+//
+// Returns:
+//
+//	*entity.StageGraph - The stage graph of the sendpost.
+//	error - An error if the stages or the dependencies couldn't be retrieved.
+func (s *StageService) GetSendpostGraph(ctx context.Context, sendpostID uint) (*entity.StageGraph, error) {
+	stages, err := s.stageRepo.GetSendpostStages(ctx, sendpostID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorGetSendpostGraph, err)
+	}
+	onFailureStages, err := s.GetOnFailureStages(ctx, sendpostID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorGetSendpostGraph, err)
+	}
+	stages = slices.DeleteFunc(stages, func(stage *entity.Stage) bool {
+		return slices.ContainsFunc(onFailureStages, func(onFailure *entity.Stage) bool {
+			return onFailure.ID == stage.ID
+		})
+	})
+	dependencies, err := s.dependencyRepo.GetSendpostDependencies(ctx, sendpostID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorGetSendpostGraph, err)
+	}
+	return entity.NewStageGraph(stages, dependencies), nil
+}
+
+// AddStageWithDependencies adds a new stage to the stage graph of the sendpost
+// which depends on the given stages. The stage without dependencies is run first
+// along with the other such stages.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values.
+//	stage - The stage to be added.
+//	dependsOn - The IDs of the top level stages of the sendpost the stage depends on.
+//
+// Returns:
+//
+//	error - entity.ErrInvalidDependency if any of the stages isn't a top level stage
+//	of the sendpost, or an error if the stage could not be added.
+func (s *StageService) AddStageWithDependencies(ctx context.Context, stage *entity.Stage, dependsOn []uint) error {
+	logging.Debug("[StageService] AddStageWithDependencies", zap.Any("stage", stage), zap.Uints("depends_on", dependsOn))
+
+	graph, err := s.GetSendpostGraph(ctx, stage.SendpostID)
+	if err != nil {
+		return logging.WrapError(ErrorAddStageWithDeps, err)
+	}
+	for i, stageID := range dependsOn {
+		if graph.Stage(stageID) == nil {
+			return fmt.Errorf("%w: stage %d isn't a top level stage of the sendpost", entity.ErrInvalidDependency, stageID)
+		}
+		if slices.Contains(dependsOn[:i], stageID) {
+			return fmt.Errorf("%w: stage %d is listed twice", entity.ErrInvalidDependency, stageID)
+		}
+	}
+	if err := s.checkSubsendpost(ctx, stage); err != nil {
+		return logging.WrapError(ErrorAddStageWithDeps, err)
+	}
+	if err := s.checkParameters(ctx, stage, stage.StageParameters); err != nil {
+		return logging.WrapError(ErrorAddStageWithDeps, err)
+	}
+
+	if err := s.saveStage(ctx, stage); err != nil {
+		return logging.WrapError(ErrorAddStageWithDeps, err)
+	}
+	for _, stageID := range dependsOn {
+		if err := s.dependencyRepo.SaveDependency(ctx, entity.NewStageDependency(stage.ID, stageID)); err != nil {
+			return logging.WrapError(ErrorAddStageWithDeps, err)
+		}
+	}
+	return nil
+}
+
+// AddDependency makes the stage of the sendpost depend on the other stage.
+// Returns entity.ErrInvalidDependency if any of the stages isn't a top level stage
+// of the sendpost or the dependency exists, entity.ErrDependencyCycle if it would form a cycle.
+func (s *StageService) AddDependency(ctx context.Context, sendpostID uint, stageID uint, dependsOnStageID uint) error {
+	graph, err := s.GetSendpostGraph(ctx, sendpostID)
+	if err != nil {
+		return logging.WrapError(ErrorAddDependency, err)
+	}
+	if err := graph.AddDependency(stageID, dependsOnStageID); err != nil {
+		return err
+	}
+	if err := s.dependencyRepo.SaveDependency(ctx, entity.NewStageDependency(stageID, dependsOnStageID)); err != nil {
+		return logging.WrapError(ErrorAddDependency, err)
+	}
+	return nil
+}
+
+// RemoveDependency removes the dependency of the stage of the sendpost on the other stage.
+// Returns entity.ErrInvalidDependency if the stage doesn't depend on the other stage.
+func (s *StageService) RemoveDependency(ctx context.Context, sendpostID uint, stageID uint, dependsOnStageID uint) error {
+	graph, err := s.GetSendpostGraph(ctx, sendpostID)
+	if err != nil {
+		return logging.WrapError(ErrorRemoveDependency, err)
+	}
+	if !slices.Contains(graph.DependsOn(stageID), dependsOnStageID) {
+		return fmt.Errorf("%w: stage %d doesn't depend on stage %d", entity.ErrInvalidDependency, stageID, dependsOnStageID)
+	}
+	if err := s.dependencyRepo.DeleteDependency(ctx, stageID, dependsOnStageID); err != nil {
+		return logging.WrapError(ErrorRemoveDependency, err)
+	}
+	return nil
+}
+
+// insertAfter makes the stage depend on the previous stage
+// and the stages which depended on the previous stage depend on the stage.
+func (s *StageService) insertAfter(ctx context.Context, graph *entity.StageGraph, stage *entity.Stage, previousStageID uint) error {
+	for _, dependentID := range graph.Dependents(previousStageID) {
+		if err := s.dependencyRepo.DeleteDependency(ctx, dependentID, previousStageID); err != nil {
+			return logging.WrapError(ErrorUpdateDependencies, err)
+		}
+		if err := s.dependencyRepo.SaveDependency(ctx, entity.NewStageDependency(dependentID, stage.ID)); err != nil {
+			return logging.WrapError(ErrorUpdateDependencies, err)
+		}
+	}
+	if err := s.dependencyRepo.SaveDependency(ctx, entity.NewStageDependency(stage.ID, previousStageID)); err != nil {
+		return logging.WrapError(ErrorUpdateDependencies, err)
+	}
+	return nil
+}
+
+// insertFirst makes the stages without dependencies depend on the stage.
+func (s *StageService) insertFirst(ctx context.Context, graph *entity.StageGraph, stage *entity.Stage) error {
+	for _, root := range graph.Roots() {
+		if err := s.dependencyRepo.SaveDependency(ctx, entity.NewStageDependency(root.ID, stage.ID)); err != nil {
+			return logging.WrapError(ErrorUpdateDependencies, err)
+		}
+	}
+	return nil
+}
+
+// detachFromGraph removes the dependencies of the stage being deleted.
+// The stages which depended on it depend on its dependencies instead, so the order is kept.
+func (s *StageService) detachFromGraph(ctx context.Context, stage *entity.Stage) error {
+	graph, err := s.GetSendpostGraph(ctx, stage.SendpostID)
+	if err != nil {
+		return err
+	}
+	if graph.Stage(stage.ID) == nil {
+		return nil
+	}
+	for _, dependentID := range graph.Dependents(stage.ID) {
+		existing := graph.DependsOn(dependentID)
+		for _, dependsOn := range graph.DependsOn(stage.ID) {
+			if slices.Contains(existing, dependsOn) {
+				continue
+			}
+			if err := s.dependencyRepo.SaveDependency(ctx, entity.NewStageDependency(dependentID, dependsOn)); err != nil {
+				return logging.WrapError(ErrorUpdateDependencies, err)
+			}
+		}
+	}
+	if err := s.dependencyRepo.DeleteStageDependencies(ctx, stage.ID); err != nil {
+		return logging.WrapError(ErrorUpdateDependencies, err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+const (
+	ErrorSaveResult string = "[StageRunnerService] error saving flow run result"
+)
+
+// saveResult records the output of the completed flow run of the stage in its stage run.
+// The stage without the output or whose output couldn't be retrieved completes anyway,
+// the next stages referencing the output fail on rendering their parameters.
+func (bsr *StageRunnerService) saveResult(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) {
+	stageRun, err := bsr.runHistoryService.GetStageRun(ctx, run, stage)
+	if err != nil || stageRun == nil || stageRun.FlowRunID == nil {
+		logging.Warn(ErrorSaveResult, zap.Uint("stage_id", stage.ID), zap.Error(err))
+		return
+	}
+	result, err := bsr.executor.Result(ctx, *stageRun.FlowRunID)
+	if err != nil {
+		logging.Warn(ErrorSaveResult, zap.Uint("stage_id", stage.ID), zap.String("flow_run_id", *stageRun.FlowRunID), zap.Error(err))
+		return
+	}
+	stageRun.SetResult(result)
+	if err := bsr.runHistoryService.SaveStageRun(ctx, stageRun); err != nil {
+		logging.Warn(ErrorSaveResult, zap.Uint("stage_id", stage.ID), zap.Error(err))
+	}
+}
@@ -13,63 +13,237 @@ import (
 )
 
 const (
-	StageCompleted string = "[StageRunnerService] Stage completed"
-	StageFailed    string = "[StageRunnerService] Stage failed"
+	StageCompleted   string = "[StageRunnerService] Stage completed"
+	StageFailed      string = "[StageRunnerService] Stage failed"
+	StageSkipped     string = "[StageRunnerService] Stage skipped"
+	StageCancelled   string = "[StageRunnerService] Stage cancelled"
+	StageReused      string = "[StageRunnerService] Stage completed in the resumed run"
+	StageRetried     string = "[StageRunnerService] Stage retried"
+	StageTimedOut    string = "[StageRunnerService] Stage timed out"
+	StageInterrupted string = "[StageRunnerService] Stage interrupted by shutdown"
+	StageReconciled  string = "[StageRunnerService] Stage reconciled after restart"
+	StageWaiting     string = "[StageRunnerService] Stage waiting"
 )
 
+// ErrStageTimedOut is the cause of the stage cancellation when the stage exceeded its timeout
+var ErrStageTimedOut = errors.New("stage timed out")
+
 type StageRunnerService struct {
 	stageService              *StageService
+	runHistoryService         *RunHistoryService
+	parameterService          *ParameterService
 	executor                  entity.StageExecutor
 	stageExecutorQueryTimeout int
 }
 
-func NewStageRunnerService(executor entity.StageExecutor, stageService *StageService, stageExecutorQueryTimeout int) *StageRunnerService {
-	return &StageRunnerService{executor: executor, stageService: stageService, stageExecutorQueryTimeout: stageExecutorQueryTimeout}
+func NewStageRunnerService(executor entity.StageExecutor, stageService *StageService, runHistoryService *RunHistoryService, parameterService *ParameterService, stageExecutorQueryTimeout int) *StageRunnerService {
+	return &StageRunnerService{executor: executor, stageService: stageService, runHistoryService: runHistoryService, parameterService: parameterService, stageExecutorQueryTimeout: stageExecutorQueryTimeout}
+}
+
+// ResolveParameters resolves the parameters the stage is executed with within the run
+// and sets them as the run parameters of the stage, the stored stage parameters are kept.
+// Returns the parameters with the layer of every value.
+func (bsr *StageRunnerService) ResolveParameters(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) (*entity.ResolvedParameters, error) {
+	stage.SetRunParameters(nil)
+	resolved, err := bsr.parameterService.Resolve(ctx, run, stage)
+	if err != nil {
+		return nil, err
+	}
+	stage.SetRunParameters(resolved.Parameters)
+	logging.Debug("[StageRunnerService] ResolveParameters", zap.Uint("stage_id", stage.ID), zap.Any("parameters", resolved.Parameters), zap.Any("sources", resolved.Sources))
+	return resolved, nil
 }
 
 // Start initiates the execution of a stage by running it through the executor.
-// It updates the stage's FlowRunID and state upon successful execution.
+// It records the stage run with the parameters sent to the executor and
+// updates the stage's FlowRunID and state upon successful execution.
 // If any error occurs during execution or state update, it returns the error.
 //
 // Parameters:
 //
 //	ctx - The context for managing request-scoped values, cancellation, and timeouts.
+//	run - The sendpost run the stage is executed within.
 //	stage - A pointer to the Stage entity containing deployment ID and parameters.
 //
 // Returns:
 //
 //	An error if the execution or state update fails, otherwise nil.
-func (bsr *StageRunnerService) Start(ctx context.Context, stage *entity.Stage) error {
-	flowRunID, state, err := bsr.executor.Run(ctx, stage.DeploymnentID, (*map[string]interface{})(stage.StageParameters))
+func (bsr *StageRunnerService) Start(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	stageRun, err := bsr.runHistoryService.StartStageRun(ctx, run, stage)
 	if err != nil {
-		bsr.HandleFailedStage(ctx, stage, err)
+		return fmt.Errorf("[StageRunnerService] error starting stage: %s", err)
+	}
+	return bsr.startFlowRun(ctx, run, stage, stageRun)
+}
+
+// startFlowRun creates the flow run of the stage attempt and saves its ID in the stage and the stage run.
+func (bsr *StageRunnerService) startFlowRun(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, stageRun *entity.StageRun) error {
+	flowRunID, state, err := bsr.executor.Run(ctx, stage.DeploymnentID, (*map[string]interface{})(stage.RunParameters()))
+	if err != nil {
+		if ctx.Err() != nil {
+			return bsr.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
+		}
+		bsr.HandleFailedStage(ctx, run, stage, err)
 		return fmt.Errorf("[StageRunnerService] error starting stage: %s", err)
 	}
 
 	stage.FlowRunID = flowRunID
-	stage.State = *state
-	if err := bsr.stageService.UpdateStageState(ctx, stage, *state); err != nil {
-		bsr.HandleFailedStage(ctx, stage, err)
+	stageRun.FlowRunID = flowRunID
+	if err := bsr.runHistoryService.SaveStageRun(ctx, stageRun); err != nil {
+		logging.Warn("[StageRunnerService] error saving stage run", zap.Uint("stage_id", stage.ID), zap.Error(err))
+	}
+	if err := bsr.UpdateState(ctx, run, stage, *state); err != nil {
+		bsr.HandleFailedStage(ctx, run, stage, err)
 		return fmt.Errorf("[StageRunnerService] error starting stage: %s", err)
 	}
 
 	return nil
 }
 
+// StartWithoutExecutor records the start of a stage which isn't executed
+// by the executor itself (parallel, observer) and marks it as running.
+func (bsr *StageRunnerService) StartWithoutExecutor(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	if _, err := bsr.runHistoryService.StartStageRun(ctx, run, stage); err != nil {
+		return fmt.Errorf("[StageRunnerService] error starting stage: %s", err)
+	}
+	return bsr.UpdateState(ctx, run, stage, value.Running)
+}
+
+// StartWait records the start of the wait stage with the time it finishes waiting and marks it as running.
+// The wait stage interrupted by the restart keeps its record and its wake-up time.
+// Returns the time the stage finishes waiting.
+func (bsr *StageRunnerService) StartWait(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) (time.Time, error) {
+	stageRun, err := bsr.runHistoryService.GetStageRun(ctx, run, stage)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("[StageRunnerService] error starting stage: %s", err)
+	}
+	// Ожидание, прерванное перезапуском, продолжается до сохранённого времени
+	if stageRun == nil || stageRun.WakeAt == nil || stageRun.State.IsFinal() {
+		stageRun, err = bsr.runHistoryService.StartStageRun(ctx, run, stage)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("[StageRunnerService] error starting stage: %s", err)
+		}
+		wakeAt, err := stage.WakeAt(stageRun.StartedAt)
+		if err != nil {
+			return time.Time{}, bsr.HandleFailedStage(ctx, run, stage, err)
+		}
+		stageRun.WakeAt = &wakeAt
+		if err := bsr.runHistoryService.SaveStageRun(ctx, stageRun); err != nil {
+			return time.Time{}, bsr.HandleFailedStage(ctx, run, stage, err)
+		}
+	}
+	logging.Info(StageWaiting, zap.Uint("stage_id", stage.ID), zap.Time("wake_at", *stageRun.WakeAt))
+	return *stageRun.WakeAt, bsr.UpdateState(ctx, run, stage, value.Running)
+}
+
+// Queue records the stage waiting for a free slot to be started as pending.
+func (bsr *StageRunnerService) Queue(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	if err := bsr.runHistoryService.QueueStageRun(ctx, run, stage); err != nil {
+		return fmt.Errorf("[StageRunnerService] error queueing stage: %s", err)
+	}
+	return bsr.stageService.UpdateStageState(ctx, stage, value.Pending)
+}
+
+// Skip records the blocked stage or the stage whose condition is false as skipped without executing it.
+func (bsr *StageRunnerService) Skip(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
+	logging.Info(StageSkipped, zap.Uint("stage_id", stage.ID))
+	if _, err := bsr.runHistoryService.StartStageRun(ctx, run, stage); err != nil {
+		return fmt.Errorf("[StageRunnerService] error skipping stage: %s", err)
+	}
+	return bsr.UpdateState(ctx, run, stage, value.Skipped)
+}
+
+// Reuse takes the result of the stage completed in the run being resumed
+// instead of executing the stage again. It reports whether the stage was reused.
+// The stage completed by the recovered run itself isn't recorded again.
+func (bsr *StageRunnerService) Reuse(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) (bool, error) {
+	completed := run.CompletedStageRun(stage.ID)
+	if completed == nil {
+		return false, nil
+	}
+	logging.Info(StageReused, zap.Uint("stage_id", stage.ID), zap.Uint("stage_run_id", completed.ID))
+	if completed.SendpostRunID != run.ID {
+		if err := bsr.runHistoryService.ReuseStageRun(ctx, run, completed); err != nil {
+			return false, fmt.Errorf("[StageRunnerService] error reusing stage: %s", err)
+		}
+	}
+	if err := bsr.stageService.UpdateStageState(ctx, stage, value.Completed); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Reconcile queries the executor for the actual state of the flow run the stage
+// had started before the backend restart and records it in the stage and the stage run.
+// It reports whether the stage completed, otherwise its flow run should be watched with CheckState.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values, cancellation, and timeouts.
+//	run - The interrupted sendpost run.
+//	stage - The stage whose flow run is reconciled.
+//	stageRun - The latest record of the stage within the run, it must have the flow run ID.
+//
+// Returns:
+//
+//	bool - true if the flow run completed.
+//	error - An error if the state of the flow run couldn't be queried.
+func (bsr *StageRunnerService) Reconcile(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, stageRun *entity.StageRun) (bool, error) {
+	state, err := bsr.executor.Status(ctx, *stageRun.FlowRunID)
+	if err != nil {
+		return false, fmt.Errorf("[StageRunnerService] error reconciling stage: %s", err)
+	}
+	logging.Info(StageReconciled, zap.Uint("stage_id", stage.ID), zap.String("flow_run_id", *stageRun.FlowRunID), zap.String("state", string(*state)))
+
+	stage.FlowRunID = stageRun.FlowRunID
+	if bsr.IsStageFailed(state) {
+		// Неуспешное состояние обрабатывается в CheckState с учётом политики повторов
+		return false, nil
+	}
+	if *state == value.Completed {
+		bsr.saveResult(ctx, run, stage)
+	}
+	if err := bsr.UpdateState(ctx, run, stage, *state); err != nil {
+		return false, err
+	}
+	return *state == value.Completed, nil
+}
+
+// WithTimeout limits the execution of the stage by its timeout. When the timeout
+// is exceeded the context is cancelled with ErrStageTimedOut as the cause.
+// The stage without the timeout is limited only by the parent context.
+func (bsr *StageRunnerService) WithTimeout(ctx context.Context, stage *entity.Stage) (context.Context, context.CancelFunc) {
+	if stage.Timeout == 0 {
+		return context.WithCancel(ctx)
+	}
+	cause := fmt.Errorf("%w: stage %d exceeded %s", ErrStageTimedOut, stage.ID, stage.GetTimeout())
+	return context.WithTimeoutCause(ctx, stage.GetTimeout(), cause)
+}
+
+// IsTimeout reports whether the execution was stopped because the stage
+// exceeded its timeout or the run exceeded the max duration of the sendpost.
+func IsTimeout(err error) bool {
+	return errors.Is(err, ErrStageTimedOut) || errors.Is(err, ErrRunTimedOut)
+}
+
 // CheckState monitors the state of a given stage until it completes, fails, or the context is done.
 // It periodically checks the status of the stage using a ticker and handles different states accordingly.
+// If the flow run fails and the retry policy of the stage allows it, the flow run is created again.
 // If the stage fails, it invokes HandleFailedStage. If the stage completes, it updates the stage state.
+// If the context is done, the stage is cancelled with HandleCancelledStage,
+// the stage stopped by the timeout is marked as failed there.
 // Logs errors and completion status using the internal logging package.
 //
 // Parameters:
 //
 //	ctx - The context to control cancellation and timeout.
+//	run - The sendpost run the stage is executed within.
 //	stage - The stage entity to monitor.
 //
 // Returns:
 //
 //	An error if the context is done or if there is an issue checking the stage status.
-func (bsr *StageRunnerService) CheckState(ctx context.Context, stage *entity.Stage) error {
+func (bsr *StageRunnerService) CheckState(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) error {
 
 	ticker := time.NewTicker(time.Duration(bsr.stageExecutorQueryTimeout) * time.Minute)
 	defer ticker.Stop()
@@ -77,28 +251,74 @@ func (bsr *StageRunnerService) CheckState(ctx context.Context, stage *entity.Sta
 	for {
 		select {
 		case <-ctx.Done():
-			logging.Error("[StageRunnerService] Timeout exceeded while waiting for stage completion", zap.Uint("stage_id", stage.ID))
-			bsr.HandleFailedStage(ctx, stage, errors.New("timeout exceeded while waiting for stage completion"))
-			return ctx.Err()
+			return bsr.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
 		case <-ticker.C:
 			state, err := bsr.executor.Status(ctx, *stage.FlowRunID)
 			if err != nil {
-				bsr.HandleFailedStage(ctx, stage, err)
+				bsr.HandleFailedStage(ctx, run, stage, err)
 				return fmt.Errorf("[StageRunnerService] error geting stage status: %s", err)
 			}
 
 			if bsr.IsStageFailed(state) {
-				return bsr.HandleFailedStage(ctx, stage, errors.New("stage completed with failed state"))
+				stageErr := fmt.Errorf("stage completed with %s state", *state)
+				retried, err := bsr.retry(ctx, run, stage, *state, stageErr)
+				if err != nil {
+					return err
+				}
+				if retried {
+					continue
+				}
+				return bsr.HandleFailedStage(ctx, run, stage, stageErr)
 			}
 
 			if *state == value.Completed {
 				logging.Info(StageCompleted, zap.Uint("stage_id", stage.ID))
-				return bsr.stageService.UpdateStageState(ctx, stage, *state)
+				bsr.saveResult(ctx, run, stage)
+				return bsr.UpdateState(ctx, run, stage, *state)
 			}
 		}
 	}
 }
 
+// retry creates the flow run of the stage again if its retry policy allows it.
+// The failed attempt is recorded in the run history, the next attempt
+// is started after the retry delay. It reports whether the stage was retried.
+func (bsr *StageRunnerService) retry(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, state value.StateType, stageErr error) (bool, error) {
+	stageRun, err := bsr.runHistoryService.GetStageRun(ctx, run, stage)
+	if err != nil || stageRun == nil {
+		logging.Warn("[StageRunnerService] error getting stage run", zap.Uint("stage_id", stage.ID), zap.Error(err))
+		return false, nil
+	}
+	if !stage.ShouldRetry(state, stageRun.Attempt) {
+		return false, nil
+	}
+
+	delay := stage.RetryDelayAfter(stageRun.Attempt)
+	logging.Warn(StageRetried, zap.Uint("stage_id", stage.ID), zap.Int("attempt", stageRun.Attempt), zap.Duration("delay", delay), zap.Error(stageErr))
+
+	stageRun.UpdateState(state, stageErr)
+	if err := bsr.runHistoryService.SaveStageRun(ctx, stageRun); err != nil {
+		logging.Warn("[StageRunnerService] error saving stage run", zap.Uint("stage_id", stage.ID), zap.Error(err))
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false, bsr.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
+	case <-timer.C:
+	}
+
+	nextStageRun, err := bsr.runHistoryService.StartStageRunAttempt(ctx, stageRun, stage)
+	if err != nil {
+		return false, bsr.HandleFailedStage(ctx, run, stage, err)
+	}
+	if err := bsr.startFlowRun(ctx, run, stage, nextStageRun); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // CheckStageCompledSuccesfullyInPeriod verifies if a stage has completed successfully
 // within a specified time period. It checks the flow run completion using the stage's
 // DeploymentID and updates the stage state accordingly. If the check fails, it handles
@@ -107,6 +327,7 @@ func (bsr *StageRunnerService) CheckState(ctx context.Context, stage *entity.Sta
 // Parameters:
 //
 //	ctx - The context for managing request-scoped values, cancelation, and deadlines.
+//	run - The sendpost run the stage is executed within.
 //	stage - The stage entity to be checked.
 //	start - The start time of the period to check.
 //	end - The end time of the period to check.
@@ -115,28 +336,115 @@ func (bsr *StageRunnerService) CheckState(ctx context.Context, stage *entity.Sta
 //
 //	An error if the stage did not complete successfully or if there was an issue
 //	updating the stage state.
-func (s *StageRunnerService) CheckStageCompledSuccesfullyInPeriod(ctx context.Context, stage *entity.Stage, start time.Time, end time.Time) error {
+func (s *StageRunnerService) CheckStageCompledSuccesfullyInPeriod(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, start time.Time, end time.Time) error {
 	if err := s.executor.CheckFlowRunCompletionByDeploymentID(ctx, start, end, stage.DeploymnentID); err != nil {
-		return s.HandleFailedStage(ctx, stage, err)
+		if ctx.Err() != nil {
+			return s.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
+		}
+		return s.HandleFailedStage(ctx, run, stage, err)
 	}
 	logging.Info(StageCompleted, zap.Uint("stage_id", stage.ID))
-	return s.stageService.UpdateStageState(ctx, stage, value.Completed)
+	return s.UpdateState(ctx, run, stage, value.Completed)
 }
 
 // IsStageFailed checks if the given stage state indicates a failure.
 // It returns true if the state is Cancelled, Cancelling, Failed, or Crashed.
 func (s *StageRunnerService) IsStageFailed(state *value.StateType) bool {
-	return *state == value.Cancelled || *state == value.Cancelling || *state == value.Failed || *state == value.Crashed
+	return state.IsFailure()
+}
+
+// UpdateState updates the state of the stage and of its record in the sendpost run.
+// A failure to update the run history is logged and doesn't stop the execution.
+func (s *StageRunnerService) UpdateState(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, state value.StateType) error {
+	if err := s.stageService.UpdateStageState(ctx, stage, state); err != nil {
+		return err
+	}
+	if err := s.runHistoryService.UpdateStageRunState(ctx, run, stage, state, nil); err != nil {
+		logging.Warn("[StageRunnerService] error updating stage run", zap.Uint("stage_id", stage.ID), zap.Error(err))
+	}
+	return nil
 }
 
 // HandleFailedStage logs a warning for a failed stage and updates its state.
-// It takes a context, a pointer to a Stage entity, and a StateType value.
+// The error is recorded in the stage run.
 // If updating the stage state fails, it returns the error.
 // Otherwise, it returns a generic error indicating stage execution failure.
-func (s *StageRunnerService) HandleFailedStage(ctx context.Context, stage *entity.Stage, err error) error {
+func (s *StageRunnerService) HandleFailedStage(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, err error) error {
 	logging.Warn(StageFailed, zap.Uint("stage_id", stage.ID), zap.Error(err))
+	if err := s.runHistoryService.UpdateStageRunState(ctx, run, stage, value.Failed, err); err != nil {
+		logging.Warn("[StageRunnerService] error updating stage run", zap.Uint("stage_id", stage.ID), zap.Error(err))
+	}
 	if err := s.stageService.UpdateStageState(ctx, stage, value.Failed); err != nil {
 		return err
 	}
 	return errors.New(StageFailed)
 }
+
+// HandleFailedStageWithReason marks the stage as failed for the reason the state doesn't tell,
+// e.g. the approval stage was rejected. Returns the error of the stage.
+func (s *StageRunnerService) HandleFailedStageWithReason(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, reason value.FailureReason, err error) error {
+	logging.Warn(StageFailed, zap.Uint("stage_id", stage.ID), zap.String("reason", string(reason)), zap.Error(err))
+	if err := s.runHistoryService.FailStageRun(ctx, run, stage, reason, err); err != nil {
+		logging.Warn("[StageRunnerService] error updating stage run", zap.Uint("stage_id", stage.ID), zap.Error(err))
+	}
+	if err := s.stageService.UpdateStageState(ctx, stage, value.Failed); err != nil {
+		return err
+	}
+	return err
+}
+
+// HandleInterruptedStage marks the stage interrupted by the backend restart
+// as failed with the INTERRUPTED reason.
+func (s *StageRunnerService) HandleInterruptedStage(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, err error) error {
+	logging.Warn(StageFailed, zap.Uint("stage_id", stage.ID), zap.String("reason", string(value.ReasonInterrupted)), zap.Error(err))
+	if err := s.runHistoryService.FailStageRun(ctx, run, stage, value.ReasonInterrupted, err); err != nil {
+		logging.Warn("[StageRunnerService] error updating stage run", zap.Uint("stage_id", stage.ID), zap.Error(err))
+	}
+	return s.stageService.UpdateStageState(ctx, stage, value.Failed)
+}
+
+// HandleCancelledStage cancels the flow run of the stage started within the run
+// and marks the stage as cancelled. If the cause is the timeout, the stage is marked
+// as failed with the TIMED_OUT reason instead. The stage interrupted by the shutdown
+// keeps its state and its flow run to be continued after the restart. The context of the stage may be already done,
+// so the cancellation is performed without it. Returns the cause of the cancellation.
+func (s *StageRunnerService) HandleCancelledStage(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage, cause error) error {
+	ctx = context.WithoutCancel(ctx)
+
+	// При остановке сервера flow run продолжает выполняться в Prefect, состояние этапа сохраняется
+	if errors.Is(cause, ErrServerShutdown) {
+		logging.Warn(StageInterrupted, zap.Uint("stage_id", stage.ID))
+		return cause
+	}
+
+	stageRun, err := s.runHistoryService.GetStageRun(ctx, run, stage)
+	if err != nil {
+		logging.Warn("[StageRunnerService] error getting stage run", zap.Uint("stage_id", stage.ID), zap.Error(err))
+	}
+	// Отменяем flow run, запущенный в рамках текущего запуска
+	if stageRun != nil && stageRun.FlowRunID != nil && !stageRun.State.IsFinal() {
+		if err := s.executor.Cancel(ctx, *stageRun.FlowRunID); err != nil {
+			logging.Warn("[StageRunnerService] error cancelling flow run", zap.Uint("stage_id", stage.ID), zap.String("flow_run_id", *stageRun.FlowRunID), zap.Error(err))
+		}
+	}
+
+	if IsTimeout(cause) {
+		logging.Warn(StageTimedOut, zap.Uint("stage_id", stage.ID), zap.Error(cause))
+		if err := s.runHistoryService.FailStageRun(ctx, run, stage, value.ReasonTimedOut, cause); err != nil {
+			logging.Warn("[StageRunnerService] error updating stage run", zap.Uint("stage_id", stage.ID), zap.Error(err))
+		}
+		if err := s.stageService.UpdateStageState(ctx, stage, value.Failed); err != nil {
+			return err
+		}
+		return cause
+	}
+
+	logging.Warn(StageCancelled, zap.Uint("stage_id", stage.ID), zap.Error(cause))
+	if err := s.runHistoryService.UpdateStageRunState(ctx, run, stage, value.Cancelled, cause); err != nil {
+		logging.Warn("[StageRunnerService] error updating stage run", zap.Uint("stage_id", stage.ID), zap.Error(err))
+	}
+	if err := s.stageService.UpdateStageState(ctx, stage, value.Cancelled); err != nil {
+		return err
+	}
+	return cause
+}
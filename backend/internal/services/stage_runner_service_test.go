@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/mocks"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+func TestHandleCancelledStage(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	stageRepo := new(mocks.StageRepository)
+	stageRepo.On("SaveStage", mock.Anything, mock.Anything).Return(nil)
+	executor := newFakeStageExecutor()
+	runHistoryService, _, stageRuns := newFakeRunHistory()
+	stageRunnerService := NewStageRunnerService(executor, NewStageService(stageRepo, new(mocks.SendpostRepository), new(mocks.StageDependencyRepository), NewSchemaService(nil)), runHistoryService, nil, 1)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	run, err := runHistoryService.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+	params := value.JSONB{}
+	stage := &entity.Stage{Model: gorm.Model{ID: 1}, SendpostID: 1, DeploymnentID: "d1", StageParameters: &params}
+	require.NoError(t, stageRunnerService.Start(ctx, run, stage))
+	require.NotNil(t, stage.FlowRunID)
+
+	// Контекст этапа уже отменён, отмена flow run выполняется без него
+	cancel(ErrRunCancelled)
+	err = stageRunnerService.HandleCancelledStage(ctx, run, stage, context.Cause(ctx))
+	assert.ErrorIs(t, err, ErrRunCancelled)
+
+	assert.Equal(t, []string{*stage.FlowRunID}, executor.cancelledFlowRuns())
+	assert.Equal(t, value.Cancelled, stage.State)
+	stageRun, err := runHistoryService.GetStageRun(context.Background(), run, stage)
+	require.NoError(t, err)
+	assert.Equal(t, value.Cancelled, stageRun.State)
+	require.NotNil(t, stageRun.Error)
+	assert.Equal(t, ErrRunCancelled.Error(), *stageRun.Error)
+	assert.Equal(t, map[uint]value.StateType{1: value.Cancelled}, stageRuns.states(run.ID))
+
+	// Завершённый flow run повторно не отменяется
+	err = stageRunnerService.HandleCancelledStage(context.Background(), run, stage, ErrRunCancelled)
+	assert.ErrorIs(t, err, ErrRunCancelled)
+	assert.Len(t, executor.cancelledFlowRuns(), 1)
+}
+
+func TestRetryStage(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	ctx := context.Background()
+	stageRepo := new(mocks.StageRepository)
+	stageRepo.On("SaveStage", mock.Anything, mock.Anything).Return(nil)
+	executor := newFakeStageExecutor()
+	runHistoryService, _, stageRuns := newFakeRunHistory()
+	stageRunnerService := NewStageRunnerService(executor, NewStageService(stageRepo, new(mocks.SendpostRepository), new(mocks.StageDependencyRepository), NewSchemaService(nil)), runHistoryService, nil, 1)
+
+	run, err := runHistoryService.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+	params := value.JSONB{}
+	stage := &entity.Stage{Model: gorm.Model{ID: 1}, SendpostID: 1, DeploymnentID: "d1", StageParameters: &params}
+	require.NoError(t, stage.SetRetryPolicy(1, 0, value.StateTypes{value.Crashed}))
+	require.NoError(t, stageRunnerService.Start(ctx, run, stage))
+	stageErr := errors.New("stage completed with failed state")
+
+	// Состояние, не входящее в retry_on, не повторяется
+	retried, err := stageRunnerService.retry(ctx, run, stage, value.Failed, stageErr)
+	require.NoError(t, err)
+	assert.False(t, retried)
+	assert.Equal(t, 1, executor.flowRunCount())
+
+	retried, err = stageRunnerService.retry(ctx, run, stage, value.Crashed, stageErr)
+	require.NoError(t, err)
+	assert.True(t, retried)
+	assert.Equal(t, 2, executor.flowRunCount())
+	stageRun, err := runHistoryService.GetStageRun(ctx, run, stage)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stageRun.Attempt)
+	assert.Equal(t, *stage.FlowRunID, *stageRun.FlowRunID)
+
+	// Попытка сверх max_retries не выполняется
+	retried, err = stageRunnerService.retry(ctx, run, stage, value.Crashed, stageErr)
+	require.NoError(t, err)
+	assert.False(t, retried)
+	assert.Equal(t, 2, executor.flowRunCount())
+
+	attempts, err := stageRuns.GetStageRuns(ctx, run.ID)
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	assert.Equal(t, value.Crashed, attempts[0].State)
+	assert.Equal(t, value.Running, attempts[1].State)
+}
+
+func TestStageTimeout(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	stageRepo := new(mocks.StageRepository)
+	stageRepo.On("SaveStage", mock.Anything, mock.Anything).Return(nil)
+	executor := newFakeStageExecutor()
+	runHistoryService, _, _ := newFakeRunHistory()
+	stageRunnerService := NewStageRunnerService(executor, NewStageService(stageRepo, new(mocks.SendpostRepository), new(mocks.StageDependencyRepository), NewSchemaService(nil)), runHistoryService, nil, 1)
+
+	params := value.JSONB{}
+	stage := &entity.Stage{Model: gorm.Model{ID: 1}, SendpostID: 1, DeploymnentID: "d1", StageParameters: &params}
+	ctx, cancel := stageRunnerService.WithTimeout(context.Background(), stage)
+	_, limited := ctx.Deadline()
+	assert.False(t, limited)
+	cancel()
+
+	require.NoError(t, stage.SetTimeout(60))
+	ctx, cancel = stageRunnerService.WithTimeout(context.Background(), stage)
+	defer cancel()
+	deadline, limited := ctx.Deadline()
+	require.True(t, limited)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+
+	run, err := runHistoryService.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, stageRunnerService.Start(ctx, run, stage))
+
+	// Этап, превысивший таймаут, падает с причиной TIMED_OUT, его flow run отменяется
+	timeoutErr := fmt.Errorf("%w: stage 1 exceeded 1m0s", ErrStageTimedOut)
+	err = stageRunnerService.HandleCancelledStage(ctx, run, stage, timeoutErr)
+	assert.True(t, IsTimeout(err))
+	assert.Equal(t, []string{*stage.FlowRunID}, executor.cancelledFlowRuns())
+	assert.Equal(t, value.Failed, stage.State)
+	stageRun, err := runHistoryService.GetStageRun(ctx, run, stage)
+	require.NoError(t, err)
+	assert.Equal(t, value.Failed, stageRun.State)
+	require.NotNil(t, stageRun.Reason)
+	assert.Equal(t, value.ReasonTimedOut, *stageRun.Reason)
+}
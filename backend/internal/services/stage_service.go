@@ -6,28 +6,35 @@ import (
 	"crm-uplift-ii24-backend/internal/domain/repository"
 	"crm-uplift-ii24-backend/internal/domain/value"
 	"crm-uplift-ii24-backend/pkg/logging"
-	"errors"
+	"crm-uplift-ii24-backend/pkg/schema"
 	"fmt"
+	"reflect"
 
 	"go.uber.org/zap"
 )
 
 const (
-	ErrorDeleteStage      string = "[StageService] error DeleteStage"
-	ErrorBlockUnblock     string = "[StageService] error BlockUnblockStage"
-	ErrorGetSubStages     string = "[StageService] error GetSubStages"
-	ErrorCopyStages       string = "[StageService] error copyStages"
-	ErrorCopySubStages    string = "[StageService] error copySubStages"
-	ErrorUpdateParameters string = "[StageService] error UpdateParameters"
+	ErrorDeleteStage        string = "[StageService] error DeleteStage"
+	ErrorBlockUnblock       string = "[StageService] error BlockUnblockStage"
+	ErrorGetSubStages       string = "[StageService] error GetSubStages"
+	ErrorCopyStages         string = "[StageService] error copyStages"
+	ErrorCopySubStages      string = "[StageService] error copySubStages"
+	ErrorUpdateParameters   string = "[StageService] error UpdateParameters"
+	ErrorAddOnFailure       string = "[StageService] error AddOnFailureStage"
+	ErrorGetOnFailure       string = "[StageService] error GetOnFailureStages"
+	ErrorExpandMapStage     string = "[StageService] error ExpandMapStage"
+	ErrorValidateParameters string = "[StageService] error validating parameters"
 )
 
 type StageService struct {
-	stageRepo    repository.StageRepository
-	sendpostRepo repository.SendpostRepository
+	stageRepo      repository.StageRepository
+	sendpostRepo   repository.SendpostRepository
+	dependencyRepo repository.StageDependencyRepository
+	schemaService  *SchemaService
 }
 
-func NewStageService(stageRepo repository.StageRepository, sendpostRepo repository.SendpostRepository) *StageService {
-	return &StageService{stageRepo: stageRepo, sendpostRepo: sendpostRepo}
+func NewStageService(stageRepo repository.StageRepository, sendpostRepo repository.SendpostRepository, dependencyRepo repository.StageDependencyRepository, schemaService *SchemaService) *StageService {
+	return &StageService{stageRepo: stageRepo, sendpostRepo: sendpostRepo, dependencyRepo: dependencyRepo, schemaService: schemaService}
 }
 
 // SaveStage updates the given stage or creates new in the stageRepository.
@@ -76,79 +83,115 @@ func (s *StageService) handlePreviousStage(ctx context.Context, stage *entity.St
 	return s.updateNextStageID(ctx, previousStage, &stage.ID)
 }
 
-// Handles inserting a stage as the first stage in the sendpost sequence
-func (s *StageService) handleFirstStage(ctx context.Context, sendpostID uint, stage *entity.Stage) error {
+// AddStage adds a new stage to the stage graph of the sendpost.
+// If a previous stage is provided, the new stage depends on it and the stages
+// which depended on the previous stage depend on the new one instead a.k.a the stage
+// is inserted after the previous one. Otherwise the stage is inserted before the stages
+// which don't depend on other stages, i.e. it becomes the first one.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values.
+//	stage - The stage to be added.
+//	previousStageID - The ID of the previous stage, if applicable.
+//
+// Returns:
+//
+//	error - entity.ErrInvalidDependency if the previous stage isn't a top level stage
+//	of the sendpost, or an error if the stage could not be added.
+func (s *StageService) AddStage(
+	ctx context.Context,
+	stage *entity.Stage,
+	previousStageID *uint,
+) error {
 
-	logging.Debug("[Stage Service] handleFirstStage")
+	logging.Debug("[StageService] AddStage", zap.Any("stage", stage), zap.Any("previousStageID", previousStageID))
 
-	firstStage, err := s.sendpostRepo.GetFirstStage(ctx, sendpostID)
+	graph, err := s.GetSendpostGraph(ctx, stage.SendpostID)
 	if err != nil {
 		return err
 	}
+	if previousStageID != nil && graph.Stage(*previousStageID) == nil {
+		return fmt.Errorf("%w: previous stage %d isn't a top level stage of the sendpost", entity.ErrInvalidDependency, *previousStageID)
+	}
+	if err := s.checkSubsendpost(ctx, stage); err != nil {
+		return err
+	}
+	if err := s.checkParameters(ctx, stage, stage.StageParameters); err != nil {
+		return err
+	}
+
+	if err := s.saveStage(ctx, stage); err != nil {
+		return err
+	}
+
+	if previousStageID != nil {
+		return s.insertAfter(ctx, graph, stage, *previousStageID)
+	}
+	return s.insertFirst(ctx, graph, stage)
+}
+
+// Handles inserting a stage as the first stage of the sendpost on-failure chain
+func (s *StageService) handleFirstOnFailureStage(ctx context.Context, sendpostID uint, stage *entity.Stage) error {
+	logging.Debug("[Stage Service] handleFirstOnFailureStage")
 
-	// update sendpost's first stage
 	sendpost, err := s.sendpostRepo.GetSendpostByID(ctx, sendpostID)
 	if err != nil {
 		return err
 	}
-	sendpost.FirstStageID = &stage.ID
+	firstStageID := sendpost.OnFailureStageID
+	sendpost.OnFailureStageID = &stage.ID
 	if err := s.sendpostRepo.SaveSendpost(ctx, sendpost); err != nil {
 		return err
 	}
 
-	if firstStage != nil {
-		return s.updateNextStageID(ctx, stage, &firstStage.ID)
+	if firstStageID != nil {
+		return s.updateNextStageID(ctx, stage, firstStageID)
 	}
 	return nil
 }
 
-// AddStage adds a new stage to the system with the specified parameters.
-// It saves the stage to the stageRepository and updates the next stage ID if
-// a previous stage is provided. Returns the created stage or an error.
+// AddOnFailureStage adds a new stage to the on-failure chain of the sendpost.
+// The chain is executed after a stage of the run failed. The stage is inserted
+// after the previous stage of the chain if it is provided, otherwise as the first one.
 //
 // Parameters:
 //
 //	ctx - The context for managing request-scoped values.
-//	sendpostID - The ID associated with the sendpost.
-//	stageType - The type of the stage being added.
-//	parentStageID - The ID of the parent stage, if applicable.
-//	deploymentID - The ID of the deployment, if applicable.
-//	stageParameters - Additional parameters for the stage.
-//	previousStageID - The ID of the previous stage, if applicable.
+//	stage - The stage to be added.
+//	previousStageID - The ID of the previous stage of the on-failure chain, if applicable.
 //
 // Returns:
 //
-//	*entity.Stage - The newly created stage entity.
 //	error - An error if the stage could not be added.
-func (s *StageService) AddStage(
-	ctx context.Context,
-	stage *entity.Stage,
-	previousStageID *uint,
-) error {
-
-	logging.Debug("[StageService] AddStage", zap.Any("stage", stage), zap.Any("previousStageID", previousStageID))
+func (s *StageService) AddOnFailureStage(ctx context.Context, stage *entity.Stage, previousStageID *uint) error {
+	logging.Debug("[StageService] AddOnFailureStage", zap.Any("stage", stage), zap.Any("previousStageID", previousStageID))
 
+	if err := s.checkSubsendpost(ctx, stage); err != nil {
+		return logging.WrapError(ErrorAddOnFailure, err)
+	}
+	if err := s.checkParameters(ctx, stage, stage.StageParameters); err != nil {
+		return logging.WrapError(ErrorAddOnFailure, err)
+	}
 	if err := s.saveStage(ctx, stage); err != nil {
-		return err
+		return logging.WrapError(ErrorAddOnFailure, err)
 	}
-
 	if previousStageID != nil {
 		if err := s.handlePreviousStage(ctx, stage, *previousStageID); err != nil {
-			return err
+			return logging.WrapError(ErrorAddOnFailure, err)
 		}
 		return nil
 	}
-
-	if err := s.handleFirstStage(ctx, stage.SendpostID, stage); err != nil {
-		return err
+	if err := s.handleFirstOnFailureStage(ctx, stage.SendpostID, stage); err != nil {
+		return logging.WrapError(ErrorAddOnFailure, err)
 	}
-
 	return nil
 }
 
 // AddSubStage adds a sub-stage to a parent stage if the parent stage is of type ParallelStage.
 // It retrieves the parent stage using the provided parentStageID and checks its type.
-// If the parent stage is not of type ParallelStage, an error is returned.
+// If the parent stage is not of type ParallelStage or the stage couldn't be its sub-stage
+// (see entity.Stage.ValidateSubStage), an error wrapping the entity validation error is returned.
 // Otherwise, it creates a new sub-stage with the specified parameters and saves it.
 // Returns the newly created sub-stage or an error if the operation fails.
 func (s *StageService) AddSubStage(
@@ -162,10 +205,16 @@ func (s *StageService) AddSubStage(
 		return fmt.Errorf("[StageService] error AddSubStage: %s", err)
 	}
 	if parentStage.Type != value.ParallelStage {
-		return errors.New("[StageService] error AddSubStage: try to add sub-stage to a non parallel stage")
+		return fmt.Errorf("[StageService] error AddSubStage: %w: try to add sub-stage to a non parallel stage", entity.ErrInvalidSubStage)
+	}
+	if err := stage.ValidateSubStage(); err != nil {
+		return fmt.Errorf("[StageService] error AddSubStage: %w", err)
 	}
 
 	stage.ParentStageID = &parentStageID
+	if err := s.checkParameters(ctx, stage, stage.StageParameters); err != nil {
+		return fmt.Errorf("[StageService] error AddSubStage: %w", err)
+	}
 	if err := s.saveStage(ctx, stage); err != nil {
 		return err
 	}
@@ -214,7 +263,25 @@ func (s *StageService) DeleteStage(ctx context.Context, stageID uint) error {
 			return logging.WrapError(ErrorDeleteStage, err)
 		}
 	}
-	if stage.Type == value.ParallelStage { //cascade delete for parallel stages
+	if stage.ParentStageID == nil {
+		if err := s.detachFromGraph(ctx, stage); err != nil {
+			return logging.WrapError(ErrorDeleteStage, err)
+		}
+	}
+	if previousStage == nil && stage.ParentStageID == nil {
+		// the first stage of the on-failure chain is replaced with the next one
+		sendpost, err := s.sendpostRepo.GetSendpostByID(ctx, stage.SendpostID)
+		if err != nil {
+			return logging.WrapError(ErrorDeleteStage, err)
+		}
+		if sendpost.OnFailureStageID != nil && *sendpost.OnFailureStageID == stage.ID {
+			sendpost.OnFailureStageID = stage.NextStageID
+			if err := s.sendpostRepo.SaveSendpost(ctx, sendpost); err != nil {
+				return logging.WrapError(ErrorDeleteStage, err)
+			}
+		}
+	}
+	if stage.HasSubStages() { //cascade delete for parallel and map stages
 		if err := s.cascadeDeleteSubStages(ctx, stage.ID); err != nil {
 			return logging.WrapError(ErrorDeleteStage, err)
 		}
@@ -257,7 +324,7 @@ func (s *StageService) UpdateStageState(ctx context.Context, stage *entity.Stage
 }
 
 // GetSubStages retrieves the sub-stages of a given stage by its ID.
-// It first checks if the stage is of type ParallelStage, returning an error if not.
+// It first checks if the stage is of type ParallelStage or MapStage, returning an error if not.
 // If the stage is valid, it fetches the sub-stages from the repository.
 // Returns a slice of Stage entities or an error if the operation fails.
 func (s *StageService) GetSubStages(ctx context.Context, stageID uint) ([]*entity.Stage, error) {
@@ -265,8 +332,8 @@ func (s *StageService) GetSubStages(ctx context.Context, stageID uint) ([]*entit
 	if err != nil {
 		return nil, logging.WrapError(ErrorGetSubStages, err)
 	}
-	if stage.Type != value.ParallelStage {
-		return nil, fmt.Errorf("%s: %s", ErrorGetSubStages, "stage is not a parallel stage")
+	if !stage.HasSubStages() {
+		return nil, fmt.Errorf("%s: %s", ErrorGetSubStages, "stage is not a parallel or map stage")
 	}
 	stages, err := s.stageRepo.GetSubStages(ctx, stage.ID)
 	if err != nil {
@@ -275,8 +342,9 @@ func (s *StageService) GetSubStages(ctx context.Context, stageID uint) ([]*entit
 	return stages, nil
 }
 
-// GetSendpostStages retrieves the stages associated with a given sendpost ID.
-// It logs the operation and returns a slice of Stage entities or an error if the retrieval fails.
+// GetSendpostStages retrieves the top level stages of the sendpost except the on-failure ones
+// in the order of execution: every stage follows the stages it depends on.
+// It returns a slice of Stage entities or an error if the retrieval fails.
 //
 // Parameters:
 //
@@ -287,20 +355,42 @@ func (s *StageService) GetSubStages(ctx context.Context, stageID uint) ([]*entit
 //
 //	A slice of pointers to Stage entities if successful, or an error if the operation fails.
 func (s *StageService) GetSendpostStages(ctx context.Context, sendpostID uint) ([]*entity.Stage, error) {
-	var stages []*entity.Stage
-	firstStage, err := s.sendpostRepo.GetFirstStage(ctx, sendpostID)
+	graph, err := s.GetSendpostGraph(ctx, sendpostID)
+	if err != nil {
+		return nil, fmt.Errorf("[StageService] error GetSendpostStages: %s", err)
+	}
+	stages, err := graph.TopologicalOrder()
 	if err != nil {
 		return nil, fmt.Errorf("[StageService] error GetSendpostStages: %s", err)
 	}
+	return stages, nil
+}
+
+// GetOnFailureStages retrieves the on-failure chain of the sendpost in the order of execution.
+// It returns nil if the sendpost has no on-failure stages.
+func (s *StageService) GetOnFailureStages(ctx context.Context, sendpostID uint) ([]*entity.Stage, error) {
+	firstStage, err := s.sendpostRepo.GetOnFailureStage(ctx, sendpostID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorGetOnFailure, err)
+	}
+	stages, err := s.getStageChain(ctx, firstStage)
+	if err != nil {
+		return nil, logging.WrapError(ErrorGetOnFailure, err)
+	}
+	return stages, nil
+}
+
+// getStageChain retrieves the stages linked by the next stage ID starting from the given one.
+func (s *StageService) getStageChain(ctx context.Context, firstStage *entity.Stage) ([]*entity.Stage, error) {
 	if firstStage == nil {
 		return nil, nil
 	}
-	stages = append(stages, firstStage)
+	stages := []*entity.Stage{firstStage}
 	nextStageID := firstStage.NextStageID
 	for nextStageID != nil {
 		stage, err := s.GetStage(ctx, *nextStageID)
 		if err != nil {
-			return nil, fmt.Errorf("[StageService] error GetSendpostStages: %s", err)
+			return nil, err
 		}
 		stages = append(stages, stage)
 		nextStageID = stage.NextStageID
@@ -324,19 +414,46 @@ func (s *StageService) BlockUnblockStage(ctx context.Context, stageID uint) erro
 }
 
 // CopyStages duplicates the stages associated with a given sendpost ID to a new sendpost ID.
-// It retrieves the stages of the original sendpost, copies each stage to the new sendpost,
-// and maintains the order of stages by linking them appropriately.
+// It retrieves the stage graph of the original sendpost, copies each stage to the new sendpost
+// and the dependencies between them. The on-failure chain of the sendpost is copied keeping its order.
 // If any error occurs during the process, it wraps and returns the error.
 func (src *StageService) CopyStages(ctx context.Context, sendpostID uint, newSendpostId uint) error {
-	stages, err := src.GetSendpostStages(ctx, sendpostID)
+	graph, err := src.GetSendpostGraph(ctx, sendpostID)
 	if err != nil {
 		return logging.WrapError(ErrorCopyStages, err)
 	}
-	var previousStageId *uint
-	previousStageId = nil
+	stages, err := graph.TopologicalOrder()
+	if err != nil {
+		return logging.WrapError(ErrorCopyStages, err)
+	}
+	newStageIDs := make(map[uint]uint, len(stages))
 	for _, stage := range stages {
 		newStage := stage.Copy(newSendpostId)
-		if err := src.AddStage(ctx, newStage, previousStageId); err != nil {
+		if err := src.saveStage(ctx, newStage); err != nil {
+			return logging.WrapError(ErrorCopyStages, err)
+		}
+		if err := src.copySubStages(ctx, stage.ID, newStage); err != nil {
+			return logging.WrapError(ErrorCopyStages, err)
+		}
+		newStageIDs[stage.ID] = newStage.ID
+	}
+	for _, stage := range stages {
+		for _, dependsOn := range graph.DependsOn(stage.ID) {
+			dependency := entity.NewStageDependency(newStageIDs[stage.ID], newStageIDs[dependsOn])
+			if err := src.dependencyRepo.SaveDependency(ctx, dependency); err != nil {
+				return logging.WrapError(ErrorCopyStages, err)
+			}
+		}
+	}
+
+	onFailureStages, err := src.GetOnFailureStages(ctx, sendpostID)
+	if err != nil {
+		return logging.WrapError(ErrorCopyStages, err)
+	}
+	var previousStageId *uint
+	for _, stage := range onFailureStages {
+		newStage := stage.Copy(newSendpostId)
+		if err := src.AddOnFailureStage(ctx, newStage, previousStageId); err != nil {
 			return logging.WrapError(ErrorCopyStages, err)
 		}
 		if err := src.copySubStages(ctx, stage.ID, newStage); err != nil {
@@ -379,15 +496,158 @@ func (s *StageService) copySubStages(ctx context.Context, parentStageID uint, ne
 
 // UpdateParameters updates the parameters of a stage identified by stageID.
 // It retrieves the stage, updates its parameters, and saves the changes.
-// Returns an error if the stage cannot be retrieved or saved.
+// Returns ErrInvalidParameters if the parameters don't match the schema of the deployment
+// or an error if the stage cannot be retrieved or saved.
 func (s *StageService) UpdateParameters(ctx context.Context, stageID uint, parameters value.JSONB) error {
 	stage, err := s.GetStage(ctx, stageID)
 	if err != nil {
 		return logging.WrapError(ErrorUpdateParameters, err)
 	}
+	if err := s.checkParameters(ctx, stage, &parameters); err != nil {
+		return logging.WrapError(ErrorUpdateParameters, err)
+	}
 	stage.StageParameters = &parameters
 	if err := s.stageRepo.SaveStage(ctx, stage); err != nil {
 		return logging.WrapError(ErrorUpdateParameters, err)
 	}
 	return nil
 }
+
+// ExpandMapStage creates the sub-stages of the map stage for the elements of its list
+// taking the overrides of the global parameters within the run into account.
+// The sub-stages created for the same elements in the previous runs are kept and updated,
+// so the completed ones could be reused when the run is resumed. The sub-stages of the elements
+// which aren't in the list anymore are deleted. Returns the sub-stages in the order of the elements.
+func (s *StageService) ExpandMapStage(ctx context.Context, run *entity.SendpostRun, stage *entity.Stage) ([]*entity.Stage, error) {
+	sendpost, err := s.sendpostRepo.GetSendpostByID(ctx, stage.SendpostID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorExpandMapStage, err)
+	}
+	items, err := stage.MapItems(run.GlobalParameters(sendpost.GlobalParameters))
+	if err != nil {
+		return nil, logging.WrapError(ErrorExpandMapStage, err)
+	}
+	existing, err := s.stageRepo.GetSubStages(ctx, stage.ID)
+	if err != nil {
+		return nil, logging.WrapError(ErrorExpandMapStage, err)
+	}
+
+	subStages := make([]*entity.Stage, 0, len(items))
+	kept := make(map[uint]bool, len(existing))
+	for _, item := range items {
+		var subStage *entity.Stage
+		for _, candidate := range existing {
+			if kept[candidate.ID] {
+				continue
+			}
+			if candidateItem, ok := candidate.MapItem(stage.MapKey); ok && reflect.DeepEqual(candidateItem, item) {
+				subStage = candidate
+				break
+			}
+		}
+		if subStage == nil {
+			subStage = stage.NewMapSubStage(item)
+		} else {
+			stage.UpdateMapSubStage(subStage, item)
+		}
+		if err := s.saveStage(ctx, subStage); err != nil {
+			return nil, logging.WrapError(ErrorExpandMapStage, err)
+		}
+		kept[subStage.ID] = true
+		subStages = append(subStages, subStage)
+	}
+	for _, subStage := range existing {
+		if kept[subStage.ID] {
+			continue
+		}
+		if err := s.stageRepo.DeleteStage(ctx, subStage.ID); err != nil {
+			return nil, logging.WrapError(ErrorExpandMapStage, err)
+		}
+	}
+	return subStages, nil
+}
+
+// GetAllSendpostStages returns the stages of the sendpost in the order of execution followed by the on-failure stages,
+// the sub-stages of the parallel stage follow it. The sub-stages of the map stages are created within the run.
+func (s *StageService) GetAllSendpostStages(ctx context.Context, sendpostID uint) ([]*entity.Stage, error) {
+	stages, err := s.GetSendpostStages(ctx, sendpostID)
+	if err != nil {
+		return nil, err
+	}
+	onFailure, err := s.GetOnFailureStages(ctx, sendpostID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*entity.Stage
+	var add func(stages []*entity.Stage) error
+	add = func(stages []*entity.Stage) error {
+		for _, stage := range stages {
+			result = append(result, stage)
+			if !stage.IsParallel() {
+				continue
+			}
+			subStages, err := s.GetSubStages(ctx, stage.ID)
+			if err != nil {
+				return err
+			}
+			if err := add(subStages); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := add(append(stages, onFailure...)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkParameters validates the parameters of the stage against the schema of its deployment.
+// The parameters aren't validated if the schema couldn't be retrieved, e.g. Prefect is unavailable,
+// so the stages could be edited anyway.
+func (s *StageService) checkParameters(ctx context.Context, stage *entity.Stage, parameters *value.JSONB) error {
+	errs, err := s.schemaService.StageErrors(ctx, stage, parameters)
+	if err != nil {
+		logging.Warn(ErrorValidateParameters, zap.String("deployment_id", stage.DeploymnentID), zap.Error(err))
+		return nil
+	}
+	if len(errs) > 0 {
+		return invalidParameters(errs.Prefix("stage_parameters"))
+	}
+	return nil
+}
+
+// ValidateGlobalParameters validates the global parameters of the sendpost against the schemas
+// of the deployments of the stages declaring them, the global parameters override their values within the run.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//	sendpostID - The sendpost whose global parameters are updated.
+//	parameters - The updated global parameters.
+//
+// Returns:
+//
+//	error - ErrInvalidParameters with the mismatch of every field or an error if the stages couldn't be retrieved.
+func (s *StageService) ValidateGlobalParameters(ctx context.Context, sendpostID uint, parameters value.JSONB) error {
+	stages, err := s.GetAllSendpostStages(ctx, sendpostID)
+	if err != nil {
+		return logging.WrapError(ErrorValidateParameters, err)
+	}
+	var errs schema.Errors
+	for _, key := range sortedKeys(parameters) {
+		for _, stage := range stages {
+			fieldErrs, err := s.schemaService.ValueErrors(ctx, stage, key, parameters[key])
+			if err != nil {
+				logging.Warn(ErrorValidateParameters, zap.String("deployment_id", stage.DeploymnentID), zap.Error(err))
+				continue
+			}
+			errs = append(errs, forStage(fieldErrs.Prefix("global_parameters"), stage.ID)...)
+		}
+	}
+	if len(errs) > 0 {
+		return invalidParameters(errs)
+	}
+	return nil
+}
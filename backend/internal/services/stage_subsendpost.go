@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"fmt"
+)
+
+// checkSubsendpost checks that the sendpost run by the subsendpost stage exists
+// and doesn't run the sendpost of the stage itself, directly or via its own subsendpost stages.
+// Returns ErrInvalidSubsendpost or ErrSubsendpostCycle if the stage couldn't be added.
+func (s *StageService) checkSubsendpost(ctx context.Context, stage *entity.Stage) error {
+	if !stage.IsSubsendpost() {
+		return nil
+	}
+	if _, err := s.sendpostRepo.GetSendpostByID(ctx, *stage.SubsendpostID); err != nil {
+		return fmt.Errorf("%w: %s", entity.ErrInvalidSubsendpost, err)
+	}
+
+	visited := map[uint]bool{}
+	queue := []uint{*stage.SubsendpostID}
+	for len(queue) > 0 {
+		sendpostID := queue[0]
+		queue = queue[1:]
+		if sendpostID == stage.SendpostID {
+			return fmt.Errorf("%w: sendpost %d runs sendpost %d", entity.ErrSubsendpostCycle, *stage.SubsendpostID, stage.SendpostID)
+		}
+		if visited[sendpostID] {
+			continue
+		}
+		visited[sendpostID] = true
+
+		stages, err := s.stageRepo.GetSendpostStages(ctx, sendpostID)
+		if err != nil {
+			return err
+		}
+		for _, nested := range stages {
+			if nested.IsSubsendpost() && nested.SubsendpostID != nil {
+				queue = append(queue, *nested.SubsendpostID)
+			}
+		}
+	}
+	return nil
+}
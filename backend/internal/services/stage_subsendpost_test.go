@@ -0,0 +1,46 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/mocks"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+func newSubsendpostStage(sendpostID uint, subsendpostID uint) *entity.Stage {
+	return &entity.Stage{SendpostID: sendpostID, Type: value.SubsendpostStage, SubsendpostID: &subsendpostID}
+}
+
+func TestCheckSubsendpostCycles(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	ctx := context.Background()
+	sendpostRepo := new(mocks.SendpostRepository)
+	stageRepo := new(mocks.StageRepository)
+	for id := uint(1); id <= 3; id++ {
+		sendpostRepo.On("GetSendpostByID", mock.Anything, id).Return(&entity.Sendpost{Model: gorm.Model{ID: id}}, nil)
+	}
+	// Sendpost 2 запускает sendpost 3, sendpost 3 ничего не запускает
+	stageRepo.On("GetSendpostStages", mock.Anything, uint(2)).Return([]*entity.Stage{newSubsendpostStage(2, 3)}, nil)
+	stageRepo.On("GetSendpostStages", mock.Anything, uint(3)).Return([]*entity.Stage{{Model: gorm.Model{ID: 30}, SendpostID: 3}}, nil)
+	stageService := NewStageService(stageRepo, sendpostRepo, new(mocks.StageDependencyRepository), NewSchemaService(nil))
+
+	// A → A
+	assert.ErrorIs(t, stageService.checkSubsendpost(ctx, newSubsendpostStage(1, 1)), entity.ErrSubsendpostCycle)
+	// A → B → A
+	assert.ErrorIs(t, stageService.checkSubsendpost(ctx, newSubsendpostStage(3, 2)), entity.ErrSubsendpostCycle)
+	// A → B → C без цикла
+	require.NoError(t, stageService.checkSubsendpost(ctx, newSubsendpostStage(1, 2)))
+
+	sendpostRepo.On("GetSendpostByID", mock.Anything, uint(4)).Return(nil, gorm.ErrRecordNotFound)
+	assert.ErrorIs(t, stageService.checkSubsendpost(ctx, newSubsendpostStage(1, 4)), entity.ErrInvalidSubsendpost)
+}
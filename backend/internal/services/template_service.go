@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/pkg/template"
+	"encoding/json"
+	"time"
+)
+
+// TemplateService renders the expressions within the parameters, e.g.
+// {{ today | add_days -1 | date "2006-01-02" }}, with the variables of the run.
+type TemplateService struct {
+	sendpostService   *SendpostService
+	runHistoryService *RunHistoryService
+	environment       string
+	location          *time.Location
+}
+
+func NewTemplateService(sendpostService *SendpostService, runHistoryService *RunHistoryService, environment string, location *time.Location) *TemplateService {
+	return &TemplateService{
+		sendpostService:   sendpostService,
+		runHistoryService: runHistoryService,
+		environment:       environment,
+		location:          location,
+	}
+}
+
+// Variables returns the values the expressions are rendered with within the run:
+//
+//	run.id, run.started_at - the run, the ID is 0 if the run hasn't been created
+//	sendpost.id, sendpost.name - the sendpost of the run
+//	env - the environment the backend is deployed to, e.g. "prod"
+//	today - the midnight of the current day in the configured timezone
+//	now - the current time in the configured timezone
+//	stages.<id>.state, stages.<id>.result - the outputs of the stages executed within the run
+func (s *TemplateService) Variables(ctx context.Context, run *entity.SendpostRun) (map[string]any, error) {
+	sendpost, err := s.sendpostService.GetSendpost(ctx, run.SendpostID)
+	if err != nil {
+		return nil, err
+	}
+	stages, err := s.runHistoryService.StageOutputs(ctx, run)
+	if err != nil {
+		return nil, err
+	}
+	// День определяется в часовом поясе сервиса, а не UTC: ночной запуск по Москве видит уже новую дату
+	now := time.Now().In(s.location)
+	return map[string]any{
+		"run": map[string]any{
+			"id":         run.ID,
+			"started_at": run.StartedAt.UTC(),
+		},
+		"sendpost": map[string]any{
+			"id":   sendpost.ID,
+			"name": sendpost.SendpostName,
+		},
+		"env":    s.environment,
+		"today":  time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, s.location),
+		"now":    now,
+		"stages": stages,
+	}, nil
+}
+
+// Render renders the expressions within the parameters into the new parameters.
+// The parameters without the expressions are returned as is.
+//
+// Parameters:
+//
+//	ctx - The context for managing request-scoped values and cancellation.
+//	run - The sendpost run the parameters are rendered for.
+//	params - The parameters, may be nil.
+//
+// Returns:
+//
+//	*value.JSONB - The rendered parameters.
+//	error - An error if an expression is invalid or references a missing value.
+func (s *TemplateService) Render(ctx context.Context, run *entity.SendpostRun, params *value.JSONB) (*value.JSONB, error) {
+	if !HasExpressions(params) {
+		return params, nil
+	}
+	vars, err := s.Variables(ctx, run)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := template.RenderMap(*params, vars)
+	if err != nil {
+		return nil, err
+	}
+	result := value.JSONB(rendered)
+	return &result, nil
+}
+
+// HasExpressions reports whether any value of the parameters contains an expression.
+func HasExpressions(params *value.JSONB) bool {
+	if params == nil {
+		return false
+	}
+	b, err := json.Marshal(params)
+	return err == nil && template.HasExpressions(string(b))
+}
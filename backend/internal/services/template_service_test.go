@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+
+	"crm-uplift-ii24-backend/internal/domain/entity"
+	"crm-uplift-ii24-backend/internal/domain/value"
+	"crm-uplift-ii24-backend/internal/mocks"
+	"crm-uplift-ii24-backend/pkg/logging"
+
+	"go.uber.org/zap"
+)
+
+func TestTemplateServiceTodayInLocation(t *testing.T) {
+	logging.Logger = zap.NewNop()
+	ctx := context.Background()
+	sendpostRepo := new(mocks.SendpostRepository)
+	sendpostRepo.On("GetSendpostByID", mock.Anything, uint(1)).Return(&entity.Sendpost{Model: gorm.Model{ID: 1}, SendpostName: "report"}, nil)
+	history, _, _ := newFakeRunHistory()
+	run, err := history.CreateRun(ctx, 1, nil, nil, nil, nil)
+	require.NoError(t, err)
+	sendpostService := NewSendpostService(sendpostRepo, NewStageService(new(mocks.StageRepository), sendpostRepo, new(mocks.StageDependencyRepository), NewSchemaService(nil)))
+
+	// Сутки в этих часовых поясах различаются больше чем на день, дата в них разная
+	for _, name := range []string{"Pacific/Kiritimati", "Pacific/Pago_Pago"} {
+		loc, err := time.LoadLocation(name)
+		require.NoError(t, err)
+		templateService := NewTemplateService(sendpostService, history, "prod", loc)
+
+		rendered, err := templateService.Render(ctx, run, &value.JSONB{"date": `{{ today | date "2006-01-02 15:04" }}`})
+		require.NoError(t, err, name)
+		assert.Equal(t, time.Now().In(loc).Format("2006-01-02")+" 00:00", (*rendered)["date"], name)
+	}
+}
@@ -1,17 +1,26 @@
 package main
 
 import (
+	"context"
 	"crm-uplift-ii24-backend/config"
 	_ "crm-uplift-ii24-backend/docs"
 	"crm-uplift-ii24-backend/internal/application"
+	"crm-uplift-ii24-backend/internal/domain/value"
 	runstatus "crm-uplift-ii24-backend/internal/infrastructure/notifications/runStatus"
 	"crm-uplift-ii24-backend/internal/infrastructure/persistence"
 	"crm-uplift-ii24-backend/internal/infrastructure/persistence/repository"
+	"crm-uplift-ii24-backend/internal/infrastructure/scheduler"
 	"crm-uplift-ii24-backend/internal/infrastructure/workflow/prefectV2"
 	"crm-uplift-ii24-backend/internal/services"
 	"crm-uplift-ii24-backend/internal/services/runners"
 	log "crm-uplift-ii24-backend/pkg/logging"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	_ "time/tzdata"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -39,6 +48,13 @@ func main() {
 	defer log.Sync()
 
 	cfg := config.LoadConfig()
+	location, err := time.LoadLocation(cfg.App.Timezone)
+	if err != nil {
+		log.Fatal("Invalid timezone", zap.String("timezone", cfg.App.Timezone), zap.Error(err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
 	// Infrustructure
 	db, err := persistence.ConnectDB(cfg)
@@ -50,24 +66,53 @@ func main() {
 	}
 	stageExecutor := prefectV2.NewPrefectClientV2(cfg.App.PrefectApiUrl, cfg.App.InsecureSkipVerify)
 	sendpostRunNotificator := runstatus.NewNotificatorWS()
+	sendpostScheduler := scheduler.NewSendpostScheduler()
 
 	// Repository
 	sendpostRepo := repository.NewGormSendpostRepository(db)
 	stageRepo := repository.NewGormSendpostStageRepository(db)
+	sendpostRunRepo := repository.NewGormSendpostRunRepository(db)
+	stageRunRepo := repository.NewGormStageRunRepository(db)
+	runLockRepo := repository.NewGormSendpostRunLockRepository(db)
+	scheduleRepo := repository.NewGormSendpostScheduleRepository(db)
+	stageDependencyRepo := repository.NewGormStageDependencyRepository(db)
 
 	// Services
-	stageService := services.NewStageService(stageRepo, sendpostRepo)
+	schemaService := services.NewSchemaService(stageExecutor)
+	stageService := services.NewStageService(stageRepo, sendpostRepo, stageDependencyRepo, schemaService)
 	sendpostService := services.NewSendpostService(sendpostRepo, stageService)
-	stageRunnerService := services.NewStageRunnerService(stageExecutor, stageService, cfg.App.StageStatusQueryTimeout)
-	stageRunnerFactory := runners.NewStageRunnerFactory(stageRunnerService, stageService)
+	runHistoryService := services.NewRunHistoryService(sendpostRunRepo, stageRunRepo)
+	runLockService := services.NewRunLockService(runLockRepo)
+	runManager := services.NewRunManager(ctx)
+	templateService := services.NewTemplateService(sendpostService, runHistoryService, cfg.App.Environment, location)
+	parameterService := services.NewParameterService(stageExecutor, sendpostService, stageService, templateService, schemaService)
+	stageRunnerService := services.NewStageRunnerService(stageExecutor, stageService, runHistoryService, parameterService, cfg.App.StageStatusQueryTimeout)
 	sendpostRunNotificationService := services.NewSenpostRunNotificationService(sendpostRunNotificator)
-	sendpostRunnerService := services.NewSendpostRunService(sendpostService, stageService, sendpostRunNotificationService, stageRunnerFactory)
+	approvalService := services.NewApprovalService(sendpostService, stageService, stageRunnerService, runHistoryService, sendpostRunNotificationService)
+	stageRunnerFactory := runners.NewStageRunnerFactory(stageRunnerService, stageService, sendpostRunNotificationService, approvalService, cfg.App.MaxParallelFlowRuns)
+	sendpostRunnerService := services.NewSendpostRunService(sendpostService, stageService, stageRunnerService, runHistoryService, templateService, parameterService, runLockService, runManager, sendpostRunNotificationService, stageRunnerFactory, location)
+	scheduleService := services.NewScheduleService(scheduleRepo)
+	sendpostSchedulerService := services.NewSendpostSchedulerService(
+		sendpostScheduler,
+		scheduleService,
+		sendpostRunnerService,
+		cfg.App.NumWorkers,
+		value.MisfirePolicy(cfg.App.MisfirePolicy),
+		time.Duration(cfg.App.MisfireGracePeriod)*time.Minute,
+	)
+	// Восстанавливаем запуски, прерванные остановкой или падением сервиса
+	if err := sendpostRunnerService.Recover(ctx); err != nil {
+		log.Error("Failed to recover sendpost runs", zap.Error(err))
+	}
+	sendpostSchedulerService.Start(ctx)
 
 	// Controllers
 	sendpostController := application.NewSendpostController(sendpostService)
 	stageController := application.NewStageController(stageService, stageExecutor)
 	sendpostRunnerController := application.NewSendpostRunnerController(sendpostRunnerService)
+	sendpostRunController := application.NewSendpostRunController(runHistoryService, approvalService)
 	notificationController := application.NewNotificationController(cfg.CORS.AllowOrigins, sendpostRunNotificationService)
+	scheduleController := application.NewScheduleController(scheduleService, sendpostSchedulerService)
 
 	// Router
 	r := gin.Default()
@@ -96,6 +141,22 @@ func main() {
 
 	// sendpost run
 	apiV1.POST("/sendposts/:sendpost_id/run", sendpostRunnerController.Start)
+	apiV1.POST("/sendposts/:sendpost_id/cancel", sendpostRunnerController.Cancel)
+	apiV1.POST("/sendposts/:sendpost_id/render-parameters", sendpostRunnerController.RenderParameters)
+	apiV1.POST("/sendposts/:sendpost_id/validate", sendpostRunnerController.Validate)
+
+	// sendpost runs history
+	apiV1.GET("/sendposts/:sendpost_id/runs", sendpostRunController.GetSendpostRuns)
+	apiV1.GET("/sendposts/:sendpost_id/runs/:run_id", sendpostRunController.GetSendpostRun)
+	apiV1.POST("/sendposts/:sendpost_id/runs/:run_id/approve", sendpostRunController.Approve)
+	apiV1.POST("/sendposts/:sendpost_id/runs/:run_id/reject", sendpostRunController.Reject)
+
+	// sendpost schedules
+	apiV1.POST("/sendposts/:sendpost_id/schedules", scheduleController.CreateSchedule)
+	apiV1.GET("/sendposts/:sendpost_id/schedules", scheduleController.GetSchedules)
+	apiV1.GET("/sendposts/:sendpost_id/schedules/:schedule_id", scheduleController.GetSchedule)
+	apiV1.PUT("/sendposts/:sendpost_id/schedules/:schedule_id", scheduleController.UpdateSchedule)
+	apiV1.DELETE("/sendposts/:sendpost_id/schedules/:schedule_id", scheduleController.DeleteSchedule)
 
 	// notifications
 	apiV1.GET("/sendposts/:sendpost_id/run/ws", notificationController.SendopostRunNotificatorAddListener)
@@ -107,6 +168,11 @@ func main() {
 	apiV1.DELETE("/sendposts/:sendpost_id/stages/:stage_id", stageController.DeleteStage)
 	apiV1.PATCH("/sendposts/:sendpost_id/stages/:stage_id", stageController.BlockUnblockStage)
 	apiV1.PUT("/sendposts/:sendpost_id/stages/:stage_id", stageController.UpdateParameters)
+	apiV1.POST("/sendposts/:sendpost_id/on-failure-stages", stageController.AddOnFailureStage)
+	apiV1.GET("/sendposts/:sendpost_id/on-failure-stages", stageController.GetOnFailureStages)
+	apiV1.GET("/sendposts/:sendpost_id/graph", stageController.GetSendpostGraph)
+	apiV1.POST("/sendposts/:sendpost_id/stages/:stage_id/dependencies", stageController.AddStageDependency)
+	apiV1.DELETE("/sendposts/:sendpost_id/stages/:stage_id/dependencies/:depends_on_stage_id", stageController.DeleteStageDependency)
 
 	// stage info
 	apiV1.GET("/prefectV2/:deployment_id/parameters", stageController.GetStageParameters)
@@ -116,6 +182,29 @@ func main() {
 	apiV1.GET("/sendposts/:sendpost_id/stages/:stage_id/sub-stages", stageController.GetSubStages)
 
 	// Start Server
-	log.Info("Server is running on port: 8081")
-	r.Run("0.0.0.0" + ":" + cfg.App.Port)
+	srv := &http.Server{Addr: "0.0.0.0" + ":" + cfg.App.Port, Handler: r}
+	go func() {
+		log.Info("Server is running on port: " + cfg.App.Port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Server error", zap.Error(err))
+		}
+	}()
+
+	// Graceful shutdown: активные запуски сохраняют состояние до истечения таймаута
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Info("Shutting down server...")
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Duration(cfg.App.ShutdownTimeout)*time.Second)
+	defer shutdownCancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Error("Server shutdown error", zap.Error(err))
+	}
+	if err := runManager.Shutdown(shutdownCtx); err != nil {
+		log.Error("Runs shutdown error", zap.Error(err))
+	}
+	cancel()
+	sendpostSchedulerService.Wait()
+	log.Info("Server stopped")
 }
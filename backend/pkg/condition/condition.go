@@ -0,0 +1,52 @@
+// Package condition compiles and evaluates boolean conditions with expr
+// (https://expr-lang.org), e.g.
+//
+//	weekday == "Saturday" && params.segment in ["vip", "new"]
+//
+// The condition is compiled against the sample of the values it may refer to,
+// so the unknown names and the type errors are reported when it's parsed.
+// A missing key of a map value is nil, the nested values of a possibly missing
+// key are accessed with ?., e.g. stages["12"]?.state.
+package condition
+
+import (
+	"fmt"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// Expression is a compiled condition.
+type Expression struct {
+	source  string
+	program *vm.Program
+}
+
+// Parse compiles the condition. The env is the sample of the values
+// the condition may refer to, only its keys and the types of its values are used.
+func Parse(source string, env map[string]any) (*Expression, error) {
+	program, err := expr.Compile(source, expr.Env(env), expr.AsBool())
+	if err != nil {
+		return nil, err
+	}
+	return &Expression{source: source, program: program}, nil
+}
+
+// String returns the source of the condition.
+func (e *Expression) String() string {
+	return e.source
+}
+
+// Eval evaluates the condition with the given values.
+// It returns an error if the condition doesn't evaluate to a boolean.
+func (e *Expression) Eval(env map[string]any) (bool, error) {
+	result, err := expr.Run(e.program, env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition evaluates to %v, not to a boolean", result)
+	}
+	return b, nil
+}
@@ -0,0 +1,79 @@
+package condition
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testEnv = map[string]any{
+	"weekday": "",
+	"params":  map[string]any{},
+	"stages":  map[string]any{},
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"weekday ==",
+		"(true",
+		"params.",
+		"'unterminated",
+		"a == b c",
+		"unknown == 1",
+		"weekday > 1",
+		"weekday",
+	} {
+		_, err := Parse(expr, testEnv)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestEval(t *testing.T) {
+	env := map[string]any{
+		"weekday": "Saturday",
+		"params":  map[string]any{"segment": "vip", "limit": 100, "dry_run": false},
+		"stages":  map[string]any{"12": map[string]any{"state": "COMPLETED"}},
+	}
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{"true", true},
+		{"weekday == 'Saturday'", true},
+		{`weekday in ["Saturday", "Sunday"]`, true},
+		{"!(weekday == 'Saturday')", false},
+		{"params.limit >= 100 && params.limit < 1000.5", true},
+		{"params.segment != 'vip' || params.dry_run", false},
+		{"!params.dry_run", true},
+		{`stages["12"].state == 'COMPLETED'`, true},
+		{`stages["13"]?.state == nil`, true},
+		{"params.missing == nil && params.limit > -1", true},
+		{"false && params.missing > 1", false},
+	}
+	for _, c := range cases {
+		expr, err := Parse(c.expr, testEnv)
+		require.NoError(t, err, c.expr)
+		got, err := expr.Eval(env)
+		require.NoError(t, err, c.expr)
+		assert.Equal(t, c.want, got, c.expr)
+	}
+}
+
+func TestEvalInvalid(t *testing.T) {
+	env := map[string]any{"weekday": "Monday", "params": map[string]any{"segment": "vip"}, "stages": map[string]any{}}
+	for _, expr := range []string{
+		"params.segment",
+		"params.segment > 1",
+		"params.segment in 'vip'",
+		"!params.segment",
+		`stages["13"].state == nil`,
+	} {
+		parsed, err := Parse(expr, testEnv)
+		require.NoError(t, err, expr)
+		_, err = parsed.Eval(env)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,213 @@
+// Package cron parses standard 5-field cron expressions
+// (minute hour day-of-month month day-of-week) and calculates
+// the next activation time of the schedule.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// day of month and day of week are matched with OR
+	// if both of them are restricted (as in Vixie cron)
+	domStar bool
+	dowStar bool
+}
+
+type bounds struct {
+	min, max uint
+	names    map[string]uint
+}
+
+var (
+	minuteBounds = bounds{0, 59, nil}
+	hourBounds   = bounds{0, 23, nil}
+	domBounds    = bounds{1, 31, nil}
+	monthBounds  = bounds{1, 12, map[string]uint{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	dowBounds = bounds{0, 7, map[string]uint{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// searchLimitYears limits the search of the next activation time
+// for the expressions which never match (e.g. "0 0 30 2 *").
+const searchLimitYears = 5
+
+// Parse parses the cron expression.
+// Besides 5 fields the descriptors @yearly, @monthly, @weekly, @daily and @hourly are supported.
+func Parse(expr string) (*Schedule, error) {
+	expr = strings.TrimSpace(expr)
+	if descriptor, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must contain 5 fields, got %d", expr, len(fields))
+	}
+
+	var (
+		s   Schedule
+		err error
+	)
+	if s.minute, err = parseField(fields[0], minuteBounds); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if s.hour, err = parseField(fields[1], hourBounds); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if s.dom, err = parseField(fields[2], domBounds); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if s.month, err = parseField(fields[3], monthBounds); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if s.dow, err = parseField(fields[4], dowBounds); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	// 7 is an alias of Sunday
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domStar = strings.HasPrefix(fields[2], "*")
+	s.dowStar = strings.HasPrefix(fields[4], "*")
+
+	return &s, nil
+}
+
+// Next returns the first activation time strictly after t in the location of t.
+// The zero time is returned if the schedule never matches.
+func (s *Schedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc).Add(time.Minute)
+	yearLimit := t.Year() + searchLimitYears
+
+	for t.Year() <= yearLimit {
+		if !has(s.month, uint(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !has(s.hour, uint(t.Hour())) {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			if !next.After(t) { // DST transition
+				next = t.Truncate(time.Hour).Add(time.Hour)
+			}
+			t = next
+			continue
+		}
+		if !has(s.minute, uint(t.Minute())) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	domMatch := has(s.dom, uint(t.Day()))
+	dowMatch := has(s.dow, uint(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+func has(set uint64, v uint) bool {
+	return set&(1<<v) != 0
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		rangeSet, err := parseRange(part, b)
+		if err != nil {
+			return 0, err
+		}
+		set |= rangeSet
+	}
+	return set, nil
+}
+
+func parseRange(expr string, b bounds) (uint64, error) {
+	rangeExpr, stepExpr, hasStep := strings.Cut(expr, "/")
+
+	var start, end uint
+	switch {
+	case rangeExpr == "*":
+		start, end = b.min, b.max
+	default:
+		lowExpr, highExpr, isRange := strings.Cut(rangeExpr, "-")
+		low, err := parseValue(lowExpr, b)
+		if err != nil {
+			return 0, err
+		}
+		start, end = low, low
+		if isRange {
+			if end, err = parseValue(highExpr, b); err != nil {
+				return 0, err
+			}
+		} else if hasStep {
+			end = b.max
+		}
+	}
+	if start > end {
+		return 0, fmt.Errorf("invalid range %q", expr)
+	}
+
+	step := uint(1)
+	if hasStep {
+		n, err := strconv.ParseUint(stepExpr, 10, 8)
+		if err != nil || n == 0 {
+			return 0, fmt.Errorf("invalid step %q", expr)
+		}
+		step = uint(n)
+	}
+
+	var set uint64
+	for v := start; v <= end; v += step {
+		set |= 1 << v
+	}
+	return set, nil
+}
+
+func parseValue(expr string, b bounds) (uint, error) {
+	if v, ok := b.names[strings.ToLower(expr)]; ok {
+		return v, nil
+	}
+	n, err := strconv.ParseUint(expr, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", expr)
+	}
+	if uint(n) < b.min || uint(n) > b.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", n, b.min, b.max)
+	}
+	return uint(n), nil
+}
@@ -0,0 +1,65 @@
+package cron
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"foo * * * *",
+	} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestNext(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	from := time.Date(2025, time.May, 16, 10, 30, 15, 0, time.UTC) // Friday
+
+	cases := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, time.Date(2025, time.May, 16, 10, 31, 0, 0, time.UTC)},
+		{"0 2 * * *", from, time.Date(2025, time.May, 17, 2, 0, 0, 0, time.UTC)},
+		{"@daily", from, time.Date(2025, time.May, 17, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", from, time.Date(2025, time.May, 16, 11, 0, 0, 0, time.UTC)},
+		{"*/15 * * * *", from, time.Date(2025, time.May, 16, 10, 45, 0, 0, time.UTC)},
+		{"0 9 * * sat", from, time.Date(2025, time.May, 17, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", from, time.Date(2025, time.May, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 1-5", from, time.Date(2025, time.May, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", from, time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", from, time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// day of month OR day of week when both are restricted
+		{"0 0 1 * mon", from, time.Date(2025, time.May, 19, 0, 0, 0, 0, time.UTC)},
+		{"0 3 * * *", from.In(moscow), time.Date(2025, time.May, 17, 3, 0, 0, 0, moscow)},
+	}
+	for _, c := range cases {
+		s, err := Parse(c.expr)
+		require.NoError(t, err, c.expr)
+		assert.True(t, c.want.Equal(s.Next(c.from)), "%s: want %s, got %s", c.expr, c.want, s.Next(c.from))
+	}
+}
+
+func TestNextNeverMatches(t *testing.T) {
+	s, err := Parse("0 0 30 2 *")
+	require.NoError(t, err)
+	assert.True(t, s.Next(time.Now()).IsZero())
+}
@@ -0,0 +1,274 @@
+// Package schema validates the parameters against the OpenAPI schema of the
+// parameters of the Prefect deployment (parameter_openapi_schema):
+//
+//	{"type": "object",
+//	 "properties": {"date": {"type": "string"}, "segment": {"$ref": "#/definitions/Segment"}},
+//	 "required": ["date"],
+//	 "definitions": {"Segment": {"enum": ["vip", "new"], "type": "string"}}}
+//
+// Only the types, the required properties, the enums, the items of the arrays
+// and the references combined with allOf and anyOf are checked, the other
+// keywords (formats, bounds, patterns) are left to Prefect.
+package schema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Schema is the part of the JSON schema the parameters are validated against.
+type Schema struct {
+	// Type is the name of the type or the list of the names
+	Type        interface{}        `json:"type,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	Required    []string           `json:"required,omitempty"`
+	Enum        []interface{}      `json:"enum,omitempty"`
+	Items       *Schema            `json:"items,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	AllOf       []*Schema          `json:"allOf,omitempty"`
+	AnyOf       []*Schema          `json:"anyOf,omitempty"`
+	Definitions map[string]*Schema `json:"definitions,omitempty"`
+	// Defs are the definitions of the schemas generated by pydantic v2
+	Defs map[string]*Schema `json:"$defs,omitempty"`
+}
+
+// FieldError is the mismatch of the field with the schema.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors are the mismatches of the fields, the error of the validation.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		messages = append(messages, fieldErr.Field+": "+fieldErr.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Prefix returns the errors with the fields prefixed by the path, e.g. stage_parameters.
+func (e Errors) Prefix(prefix string) Errors {
+	result := make(Errors, 0, len(e))
+	for _, fieldErr := range e {
+		result = append(result, FieldError{Field: prefix + "." + fieldErr.Field, Message: fieldErr.Message})
+	}
+	return result
+}
+
+// HasProperty reports whether the parameter is described by the schema.
+func (s *Schema) HasProperty(name string) bool {
+	_, ok := s.Properties[name]
+	return ok
+}
+
+// Validate checks the parameters: the required ones must be present and
+// the values must match their properties. The parameters the schema doesn't describe are ignored.
+func (s *Schema) Validate(params map[string]interface{}) Errors {
+	errs := s.Missing(params)
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		errs = append(errs, s.ValidateField(key, params[key])...)
+	}
+	return errs
+}
+
+// Missing returns the errors of the required parameters which aren't present.
+func (s *Schema) Missing(params map[string]interface{}) Errors {
+	var errs Errors
+	for _, name := range s.Required {
+		if _, ok := params[name]; !ok {
+			errs = append(errs, FieldError{Field: name, Message: "is required"})
+		}
+	}
+	return errs
+}
+
+// ValidateField checks the value of the parameter against its property,
+// the parameter the schema doesn't describe isn't checked.
+func (s *Schema) ValidateField(name string, v interface{}) Errors {
+	property, ok := s.Properties[name]
+	if !ok {
+		return nil
+	}
+	return s.validate(property, name, v)
+}
+
+// validate checks the value against the schema, the references are resolved within the root schema s.
+func (s *Schema) validate(schema *Schema, field string, v interface{}) Errors {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != "" {
+		ref, ok := s.resolve(schema.Ref)
+		if !ok {
+			return nil
+		}
+		return s.validate(ref, field, v)
+	}
+
+	var errs Errors
+	for _, sub := range schema.AllOf {
+		errs = append(errs, s.validate(sub, field, v)...)
+	}
+	if len(schema.AnyOf) > 0 {
+		matched := false
+		for _, sub := range schema.AnyOf {
+			if len(s.validate(sub, field, v)) == 0 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			errs = append(errs, FieldError{Field: field, Message: "doesn't match any of the allowed schemas"})
+		}
+	}
+	if types := schema.types(); len(types) > 0 && !matchesType(types, v) {
+		return append(errs, FieldError{Field: field, Message: fmt.Sprintf("expected %s, got %s", strings.Join(types, " or "), typeOf(v))})
+	}
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, v) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("must be one of %s", enumString(schema.Enum))})
+	}
+
+	switch v := v.(type) {
+	case []interface{}:
+		for i, item := range v {
+			errs = append(errs, s.validate(schema.Items, fmt.Sprintf("%s[%d]", field, i), item)...)
+		}
+	case map[string]interface{}:
+		if len(schema.Properties) == 0 {
+			break
+		}
+		nested := &Schema{Properties: schema.Properties, Required: schema.Required}
+		for _, fieldErr := range nested.Missing(v) {
+			errs = append(errs, FieldError{Field: field + "." + fieldErr.Field, Message: fieldErr.Message})
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, ok := schema.Properties[key]; ok {
+				errs = append(errs, s.validate(property, field+"."+key, v[key])...)
+			}
+		}
+	}
+	return errs
+}
+
+// resolve returns the definition referenced as #/definitions/<name> or #/$defs/<name>.
+func (s *Schema) resolve(ref string) (*Schema, bool) {
+	if name, ok := strings.CutPrefix(ref, "#/definitions/"); ok {
+		schema, ok := s.Definitions[name]
+		return schema, ok
+	}
+	if name, ok := strings.CutPrefix(ref, "#/$defs/"); ok {
+		schema, ok := s.Defs[name]
+		return schema, ok
+	}
+	return nil, false
+}
+
+// types returns the names of the types allowed by the schema.
+func (s *Schema) types() []string {
+	switch t := s.Type.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, name := range t {
+			if name, ok := name.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	case []string:
+		return t
+	default:
+		return nil
+	}
+}
+
+func matchesType(types []string, v interface{}) bool {
+	actual := typeOf(v)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeOf returns the JSON schema type of the decoded JSON value,
+// the number without the fractional part is an integer.
+func typeOf(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case float32:
+		return typeOf(float64(v))
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "integer"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, allowed := range enum {
+		if reflect.DeepEqual(normalize(allowed), normalize(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize makes the numbers of any type comparable.
+func normalize(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32:
+		return rv.Float()
+	default:
+		return v
+	}
+}
+
+func enumString(enum []interface{}) string {
+	values := make([]string, 0, len(enum))
+	for _, v := range enum {
+		if s, ok := v.(string); ok {
+			values = append(values, fmt.Sprintf("%q", s))
+		} else {
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+	return "[" + strings.Join(values, ", ") + "]"
+}
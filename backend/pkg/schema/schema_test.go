@@ -0,0 +1,60 @@
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const prefectSchema = `{
+	"title": "Parameters",
+	"type": "object",
+	"properties": {
+		"date": {"title": "date", "position": 0, "type": "string", "format": "date"},
+		"segment": {"allOf": [{"$ref": "#/definitions/Segment"}], "position": 1},
+		"limit": {"title": "limit", "default": 100, "type": "integer"},
+		"ratio": {"anyOf": [{"type": "number"}, {"type": "null"}], "default": null},
+		"tables": {"type": "array", "items": {"type": "string"}},
+		"options": {"type": "object", "properties": {"dry_run": {"type": "boolean"}}, "required": ["dry_run"]}
+	},
+	"required": ["date", "segment"],
+	"definitions": {"Segment": {"title": "Segment", "enum": ["vip", "new"], "type": "string"}}
+}`
+
+func parse(t *testing.T) *Schema {
+	var schema Schema
+	require.NoError(t, json.Unmarshal([]byte(prefectSchema), &schema))
+	return &schema
+}
+
+func TestValidate(t *testing.T) {
+	schema := parse(t)
+
+	var params map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"date": "2024-05-01", "segment": "vip", "limit": 10, "ratio": null,
+		"tables": ["a", "b"], "options": {"dry_run": true}, "unknown": 1
+	}`), &params))
+	assert.Empty(t, schema.Validate(params))
+
+	params = map[string]interface{}{"segment": "old", "limit": 1.5, "ratio": "high", "tables": []interface{}{"a", 2.0}, "options": map[string]interface{}{}}
+	assert.Equal(t, Errors{
+		{Field: "date", Message: "is required"},
+		{Field: "limit", Message: "expected integer, got number"},
+		{Field: "options.dry_run", Message: "is required"},
+		{Field: "ratio", Message: "doesn't match any of the allowed schemas"},
+		{Field: "segment", Message: `must be one of ["vip", "new"]`},
+		{Field: "tables[1]", Message: "expected string, got integer"},
+	}, schema.Validate(params))
+}
+
+func TestValidateField(t *testing.T) {
+	schema := parse(t)
+
+	assert.Empty(t, schema.ValidateField("limit", 5))
+	assert.Empty(t, schema.ValidateField("unknown", "anything"))
+	assert.Equal(t, Errors{{Field: "limit", Message: "expected integer, got string"}}, schema.ValidateField("limit", "5"))
+	assert.Equal(t, "stage_parameters.limit: expected integer, got string", schema.ValidateField("limit", "5").Prefix("stage_parameters").Error())
+}
@@ -0,0 +1,319 @@
+// Package template renders the expressions in double braces within the
+// parameters of the stages over a set of named values, e.g.
+//
+//	{{ stages.12.result.table_name }}
+//	{{ today | add_days -1 | date "2006-01-02" }}
+//
+// The expression is the dotted path to the value, the elements of the lists
+// are taken by their indexes. The value may be passed through the filters
+// separated by |, the arguments of the filters are the strings in single or
+// double quotes and the numbers:
+//
+//	date "layout" - formats the time with the Go layout
+//	add_days n - adds n days to the time, n may be negative
+//	tz "name" - converts the time to the IANA time zone
+//
+// The string consisting of a single expression is replaced by the value itself
+// keeping its type, otherwise the values are written into the string.
+// The times are written in RFC 3339. A missing value is an error.
+package template
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	expressionRe = regexp.MustCompile(`\{\{(.*?)\}\}`)
+	pathRe       = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+)
+
+// HasExpressions reports whether the string contains any expression.
+func HasExpressions(s string) bool {
+	return expressionRe.MatchString(s)
+}
+
+// Render renders the expressions of the string with the given values.
+// The string without the expressions is returned as is.
+func Render(s string, env map[string]any) (any, error) {
+	matches := expressionRe.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return s, nil
+	}
+	// Строка из одного выражения заменяется значением без приведения к строке
+	if len(matches) == 1 && matches[0][0] == 0 && matches[0][1] == len(s) {
+		v, err := eval(s[matches[0][2]:matches[0][3]], env)
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := v.(time.Time); ok {
+			return t.Format(time.RFC3339), nil
+		}
+		return v, nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m[0]])
+		v, err := eval(s[m[2]:m[3]], env)
+		if err != nil {
+			return nil, err
+		}
+		str, err := toString(v)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(str)
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String(), nil
+}
+
+// RenderValue renders the expressions of the strings within the value,
+// the maps and the lists are rendered recursively into the new ones.
+func RenderValue(v any, env map[string]any) (any, error) {
+	switch t := v.(type) {
+	case string:
+		return Render(t, env)
+	case map[string]any:
+		return RenderMap(t, env)
+	case []any:
+		list := make([]any, 0, len(t))
+		for _, item := range t {
+			rendered, err := RenderValue(item, env)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, rendered)
+		}
+		return list, nil
+	}
+	return v, nil
+}
+
+// RenderMap renders the expressions of the values of the map into the new map.
+// The error tells the key of the value which couldn't be rendered.
+func RenderMap(m map[string]any, env map[string]any) (map[string]any, error) {
+	result := make(map[string]any, len(m))
+	for k, v := range m {
+		rendered, err := RenderValue(v, env)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		result[k] = rendered
+	}
+	return result, nil
+}
+
+func eval(expr string, env map[string]any) (any, error) {
+	parts, err := splitPipes(expr)
+	if err != nil {
+		return nil, err
+	}
+	v, err := lookup(strings.TrimSpace(parts[0]), env)
+	if err != nil {
+		return nil, err
+	}
+	for _, part := range parts[1:] {
+		name, args, err := parseFilter(part)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := filters[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown filter %q", name)
+		}
+		if v, err = f(v, args); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return v, nil
+}
+
+// lookup takes the value by the dotted path.
+func lookup(path string, env map[string]any) (any, error) {
+	if !pathRe.MatchString(path) {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+	var current any = env
+	for _, key := range strings.Split(path, ".") {
+		switch t := current.(type) {
+		case map[string]any:
+			v, ok := t[key]
+			if !ok {
+				return nil, fmt.Errorf("%s is undefined", path)
+			}
+			current = v
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(t) {
+				return nil, fmt.Errorf("%s is undefined", path)
+			}
+			current = t[i]
+		default:
+			return nil, fmt.Errorf("%s is undefined", path)
+		}
+	}
+	return current, nil
+}
+
+// splitPipes splits the expression by the | outside of the quotes.
+func splitPipes(expr string) ([]string, error) {
+	var parts []string
+	var quote rune
+	start := 0
+	for i, r := range expr {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '|':
+			parts = append(parts, expr[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string in {{%s}}", expr)
+	}
+	return append(parts, expr[start:]), nil
+}
+
+// parseFilter parses the name and the arguments of the filter.
+func parseFilter(source string) (string, []any, error) {
+	source = strings.TrimSpace(source)
+	end := strings.IndexFunc(source, unicode.IsSpace)
+	if end < 0 {
+		end = len(source)
+	}
+	name := source[:end]
+	if name == "" {
+		return "", nil, errors.New("empty filter")
+	}
+
+	var args []any
+	rest := strings.TrimSpace(source[end:])
+	for rest != "" {
+		var arg any
+		if rest[0] == '"' || rest[0] == '\'' {
+			closing := strings.IndexByte(rest[1:], rest[0])
+			if closing < 0 {
+				return "", nil, fmt.Errorf("unterminated string in filter %s", name)
+			}
+			arg = rest[1 : closing+1]
+			rest = rest[closing+2:]
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			n, err := strconv.ParseFloat(rest[:end], 64)
+			if err != nil {
+				return "", nil, fmt.Errorf("invalid argument %q of filter %s", rest[:end], name)
+			}
+			arg = n
+			rest = rest[end:]
+		}
+		args = append(args, arg)
+		rest = strings.TrimSpace(rest)
+	}
+	return name, args, nil
+}
+
+type filter func(v any, args []any) (any, error)
+
+var filters = map[string]filter{
+	"date": func(v any, args []any) (any, error) {
+		t, err := asTime(v)
+		if err != nil {
+			return nil, err
+		}
+		layout, err := stringArg(args)
+		if err != nil {
+			return nil, err
+		}
+		return t.Format(layout), nil
+	},
+	"add_days": func(v any, args []any) (any, error) {
+		t, err := asTime(v)
+		if err != nil {
+			return nil, err
+		}
+		if len(args) != 1 {
+			return nil, errors.New("expects one argument")
+		}
+		days, ok := args[0].(float64)
+		if !ok || days != float64(int(days)) {
+			return nil, errors.New("expects the whole number of days")
+		}
+		return t.AddDate(0, 0, int(days)), nil
+	},
+	"tz": func(v any, args []any) (any, error) {
+		t, err := asTime(v)
+		if err != nil {
+			return nil, err
+		}
+		name, err := stringArg(args)
+		if err != nil {
+			return nil, err
+		}
+		loc, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, err
+		}
+		return t.In(loc), nil
+	},
+}
+
+// asTime takes the time or parses it from the string in RFC 3339.
+func asTime(v any) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case string:
+		if parsed, err := time.Parse(time.RFC3339, t); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%v is not a time", v)
+}
+
+func stringArg(args []any) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("expects one argument")
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return "", errors.New("expects a string argument")
+	}
+	return s, nil
+}
+
+// toString writes the value into the string, the maps and the lists are written as JSON.
+func toString(v any) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case nil:
+		return "", nil
+	case time.Time:
+		return t.Format(time.RFC3339), nil
+	case map[string]any, []any:
+		b, err := json.Marshal(t)
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	return fmt.Sprint(v), nil
+}
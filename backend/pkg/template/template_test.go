@@ -0,0 +1,106 @@
+package template
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	env := map[string]any{
+		"stages": map[string]any{
+			"12": map[string]any{
+				"state":  "COMPLETED",
+				"result": map[string]any{"table_name": "tmp_vip", "rows": float64(42), "segments": []any{"vip", "new"}},
+			},
+		},
+	}
+
+	cases := []struct {
+		source string
+		want   any
+	}{
+		{"no expressions", "no expressions"},
+		{"{{ stages.12.result.table_name }}", "tmp_vip"},
+		{"{{stages.12.result.rows}}", float64(42)},
+		{"{{ stages.12.result.segments }}", []any{"vip", "new"}},
+		{"{{ stages.12.result.segments.1 }}", "new"},
+		{"select * from {{ stages.12.result.table_name }} limit {{ stages.12.result.rows }}", "select * from tmp_vip limit 42"},
+		{"segments: {{ stages.12.result.segments }}", `segments: ["vip","new"]`},
+	}
+	for _, c := range cases {
+		got, err := Render(c.source, env)
+		require.NoError(t, err, c.source)
+		assert.Equal(t, c.want, got, c.source)
+	}
+}
+
+func TestRenderInvalid(t *testing.T) {
+	env := map[string]any{"stages": map[string]any{"12": map[string]any{"state": "COMPLETED"}}}
+	for _, source := range []string{
+		"{{ stages.12.result.table_name }}",
+		"{{ stages.13.state }}",
+		"{{ stages.12.state.value }}",
+		"{{ stages..state }}",
+		"{{ }}",
+	} {
+		_, err := Render(source, env)
+		assert.Error(t, err, source)
+	}
+}
+
+func TestRenderMap(t *testing.T) {
+	env := map[string]any{"stages": map[string]any{"12": map[string]any{"result": map[string]any{"table_name": "tmp_vip"}}}}
+	params := map[string]any{
+		"table":  "{{ stages.12.result.table_name }}",
+		"tables": []any{"{{ stages.12.result.table_name }}", "static"},
+		"limit":  float64(100),
+	}
+
+	got, err := RenderMap(params, env)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"table": "tmp_vip", "tables": []any{"tmp_vip", "static"}, "limit": float64(100)}, got)
+	assert.Equal(t, "{{ stages.12.result.table_name }}", params["table"])
+
+	_, err = RenderMap(map[string]any{"table": "{{ stages.13.result.table_name }}"}, env)
+	assert.ErrorContains(t, err, "table: stages.13.result.table_name is undefined")
+}
+
+func TestRenderFilters(t *testing.T) {
+	env := map[string]any{
+		"run":   map[string]any{"id": uint(7), "started_at": time.Date(2024, 3, 1, 22, 30, 0, 0, time.UTC)},
+		"today": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+
+	cases := []struct {
+		source string
+		want   any
+	}{
+		{"{{ run.id }}", uint(7)},
+		{"run_{{ run.id }}", "run_7"},
+		{`{{ run.started_at | date "2006-01-02" }}`, "2024-03-01"},
+		{"{{ today | add_days -1 | date '2006-01-02' }}", "2024-02-29"},
+		{`{{ run.started_at | tz "Europe/Moscow" | date "2006-01-02 15:04" }}`, "2024-03-02 01:30"},
+		{"{{ today }}", "2024-03-01T00:00:00Z"},
+		{`from {{ today | add_days -7 | date "20060102" }} to {{ today | date "20060102" }}`, "from 20240223 to 20240301"},
+	}
+	for _, c := range cases {
+		got, err := Render(c.source, env)
+		require.NoError(t, err, c.source)
+		assert.Equal(t, c.want, got, c.source)
+	}
+
+	for _, source := range []string{
+		"{{ today | add_days }}",
+		"{{ today | add_days 1.5 }}",
+		"{{ today | date 1 }}",
+		"{{ today | unknown }}",
+		`{{ run.id | date "2006" }}`,
+		`{{ today | date "2006 }}`,
+	} {
+		_, err := Render(source, env)
+		assert.Error(t, err, source)
+	}
+}
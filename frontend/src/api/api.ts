@@ -241,7 +241,9 @@ export const ValueStateType = {
     Paused: 'PAUSED',
     Cancelling: 'CANCELLING',
     NeverRunning: 'NEVERRUNNING',
-    Updated: 'UPDATED'
+    Updated: 'UPDATED',
+    Skipped: 'SKIPPED',
+    TimedOut: 'TIMED_OUT'
 } as const;
 
 export type ValueStateType = typeof ValueStateType[keyof typeof ValueStateType];
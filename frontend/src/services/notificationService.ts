@@ -2,12 +2,20 @@ import { WsConnector } from "@/ws";
 import { ValueStateType } from "@/api";
 import { BASE_PATH } from "./base";
 
+export type WaitCountdown = {
+  type: "countdown";
+  stage_id: number;
+  wake_at: string;
+  remaining_seconds: number;
+};
+
 type Handlers = {
   onRun?: () => void;
   onFailed?: () => void;
   onCompleted?: () => void;
   onError?: () => void;
   onUpdated?: () => void;
+  onCountdown?: (countdown: WaitCountdown) => void;
 };
 
 export class WsService {
@@ -64,11 +72,19 @@ export class WsService {
       event.data
     );
 
+    const countdown = this.parseCountdown(event.data);
+    if (countdown) {
+      handlers.onCountdown?.(countdown);
+      return;
+    }
+
     switch (event.data) {
       case ValueStateType.Running:
         handlers.onRun?.();
         break;
       case ValueStateType.Failed:
+      case ValueStateType.Cancelled:
+      case ValueStateType.TimedOut:
         handlers.onFailed?.();
         this.close(sendpostId);
         break;
@@ -77,6 +93,8 @@ export class WsService {
         this.close(sendpostId);
         break;
       case ValueStateType.Updated:
+      case ValueStateType.Skipped:
+      case ValueStateType.Paused:
         handlers.onUpdated?.();
         break;
       default:
@@ -85,6 +103,16 @@ export class WsService {
     }
   }
 
+  private parseCountdown(data: string): WaitCountdown | null {
+    if (!data.startsWith("{")) return null;
+    try {
+      const message = JSON.parse(data);
+      return message.type === "countdown" ? (message as WaitCountdown) : null;
+    } catch {
+      return null;
+    }
+  }
+
   private handleError(sendpostId: number, event: Event | CloseEvent) {
     console.warn(
       `[WsService] WebSocket error for sendpost ${sendpostId}`,